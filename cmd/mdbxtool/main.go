@@ -0,0 +1,597 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// mdbxtool - inspect and administer databases created by this module.
+//
+//	mdbxtool <command> [flags] <datadir> [args]
+//
+// Databases are opened in Readonly mode (or in Accede mode by -accede flag and by commands which write) - it's safe to
+// run the tool against db which is used by live process.
+//
+// Custom comparators of app (kv.TableCfgItem.KeyCmp/DupCmp) are not stored in db: tables are opened with order of their
+// flags, and get, scan and prefix refuse tables whose entries are not in that order.
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/c2h5oh/datasize"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/common"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/integrity"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+type command struct {
+	name, args, help string
+	run              func(ctx context.Context, fs *flag.FlagSet, o *options) error
+}
+
+var commands = []command{
+	{"tables", "<datadir>", "list tables with flags, amount of entries and size", cmdTables},
+	{"get", "<datadir> <table> <key>", "print value of key", cmdGet},
+	{"scan", "<datadir> <table> [from] [to]", "print entries with keys in [from, to)", cmdScan},
+	{"prefix", "<datadir> <table> <prefix>", "print entries with keys starting with prefix", cmdPrefix},
+	{"count", "<datadir> <table>", "print amount of entries in table", cmdCount},
+	{"readers", "<datadir>", "print active readers of all processes, most lagging first", cmdReaders},
+	{"stat", "<datadir>", "print db geometry and environment info", cmdStat},
+	{"drop-deprecated", "<datadir> <table>...", "drop given tables - they must not be used by app anymore", cmdDropDeprecated},
+	{"copy", "<datadir> <dstdir>", "write consistent copy of db to dstdir", cmdCopy},
+	{"check", "<datadir> [table]...", "verify order of entries, flags of tables (with -cfg) and Sequence table, print json report", cmdCheck},
+}
+
+// options - flags shared by all commands
+type options struct {
+	accede bool
+	keyFmt string
+	outFmt string
+	limit  int
+
+	keepSize bool
+	verify   bool
+	check    bool
+	cfgPath  string
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := run(ctx, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		usage(os.Stderr)
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		o := &options{}
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "usage: mdbxtool %s [flags] %s\n%s\n", cmd.name, cmd.args, cmd.help)
+			fs.PrintDefaults()
+		}
+		fs.BoolVar(&o.accede, "accede", false, "open db in Accede mode instead of Readonly")
+		fs.StringVar(&o.keyFmt, "key", "utf8", "format of keys in arguments: hex or utf8")
+		fs.StringVar(&o.outFmt, "out", "hex", "format of printed keys and values: hex or utf8 (non-utf8 values are printed as hex)")
+		fs.IntVar(&o.limit, "limit", 100, "max amount of printed entries (check: violations per table), -1 means unlimited")
+		fs.BoolVar(&o.keepSize, "keep-size", false, "copy: preserve file size of source db, copy is compact anyway")
+		fs.BoolVar(&o.verify, "verify", true, "copy: verify amount of entries in copy")
+		fs.BoolVar(&o.check, "check", false, "readers: clear slots of dead processes before listing")
+		fs.StringVar(&o.cfgPath, "cfg", "", `check: json file with expected kv.TableCfg, e.g. {"T":{"Flags":4}}. Flags of tables are checked only with it`)
+		if err := fs.Parse(args[1:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return fmt.Errorf("datadir is required")
+		}
+		return cmd.run(ctx, fs, o)
+	}
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command: %s", args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: mdbxtool <command> [flags] <datadir> [args]")
+	fmt.Fprintln(w, "commands:")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.help)
+	}
+	tw.Flush()
+}
+
+// openDB - opens db and all tables which exist in it. Tables from tblCfg are opened with given config, other tables -
+// with flags stored in db: they are read by first open, then db is re-opened with config of all tables. Custom
+// comparators of app are unknown to the tool, see checkOrder.
+func openDB(ctx context.Context, path string, accede bool, tblCfg kv.TableCfg) (*mdbx.MdbxKV, error) {
+	open := func(tblCfg kv.TableCfg) (kv.RwDB, error) {
+		if accede {
+			return mdbx.Open(ctx, path, log.NewNoop(), true, tblCfg)
+		}
+		return mdbx.NewMDBX(log.NewNoop()).Path(path).Readonly().WithTableCfg(tblCfg).Open(ctx)
+	}
+	db, err := open(tblCfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg := kv.TableCfg{}
+	for name, item := range tblCfg {
+		cfg[name] = item
+	}
+	err = db.View(ctx, func(tx kv.Tx) error {
+		tables, err := tx.ListBuckets()
+		if err != nil {
+			return err
+		}
+		for _, name := range tables {
+			if _, ok := tblCfg[name]; ok {
+				continue
+			}
+			// table is opened only till end of tx: rollback reverts config of db
+			if err := tx.(kv.BucketMigrator).CreateBucket(name); err != nil {
+				return err
+			}
+			flags, err := tx.(*mdbx.MdbxTx).TableFlags(name)
+			if err != nil {
+				return err
+			}
+			cfg[name] = kv.TableCfgItem{Flags: flags}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		return nil, err
+	}
+	if db, err = open(cfg); err != nil {
+		return nil, err
+	}
+	return db.(*mdbx.MdbxKV), nil
+}
+
+func withDB(ctx context.Context, fs *flag.FlagSet, o *options, minArgs int, f func(db *mdbx.MdbxKV, args []string) error) error {
+	if fs.NArg() < minArgs {
+		fs.Usage()
+		return fmt.Errorf("expected at least %d arguments", minArgs)
+	}
+	db, err := openDB(ctx, fs.Arg(0), o.accede, kv.TableCfg{})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return f(db, fs.Args()[1:])
+}
+
+func checkTable(db *mdbx.MdbxKV, table string) error {
+	if _, ok := db.AllTables()[table]; !ok {
+		return fmt.Errorf("table not found: %s", table)
+	}
+	return nil
+}
+
+// orderSample - amount of first and last entries of table verified by checkOrder
+const orderSample = 16
+
+// errCustomOrder - entries of table are not in order of its flags: table has custom comparator (KeyCmp/DupCmp) of app.
+// Tool opens it with default order - lookups and ranges can miss entries, so such tables are refused.
+var errCustomOrder = errors.New("entries are not in order of table flags, table probably has custom comparator - not supported by the tool")
+
+// checkOrder - refuses table with custom order, which is detected by first and last orderSample entries
+func checkOrder(tx kv.Tx, table string, cfg kv.TableCfgItem) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	oc := orderChecker{cfg: cfg}
+	for k, v, err := c.First(); k != nil || err != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !oc.next(k, v) {
+			return fmt.Errorf("table: %s, %w", table, errCustomOrder)
+		}
+		if oc.n == orderSample {
+			break
+		}
+	}
+	oc = orderChecker{cfg: cfg, desc: true}
+	for k, v, err := c.Last(); k != nil || err != nil; k, v, err = c.Prev() {
+		if err != nil {
+			return err
+		}
+		if !oc.next(k, v) {
+			return fmt.Errorf("table: %s, %w", table, errCustomOrder)
+		}
+		if oc.n == orderSample {
+			break
+		}
+	}
+	return nil
+}
+
+// orderChecker - verifies that entries follow each other in order of table flags (or in reverse order if desc)
+type orderChecker struct {
+	cfg          kv.TableCfgItem
+	desc         bool
+	n            int
+	prevK, prevV []byte
+}
+
+func (oc *orderChecker) next(k, v []byte) bool {
+	oc.n++
+	if oc.n == 1 {
+		oc.prevK, oc.prevV = common.Copy(k), common.Copy(v)
+		return true
+	}
+	a, b, aV, bV := oc.prevK, k, oc.prevV, v
+	if oc.desc {
+		a, b, aV, bV = b, a, bV, aV
+	}
+	oc.prevK, oc.prevV = common.Copy(k), common.Copy(v)
+	cmp := oc.cfg.CompareKeys(a, b)
+	if cmp == 0 && oc.cfg.Flags&kv.DupSort != 0 {
+		cmp = oc.cfg.CompareDups(aV, bV)
+	}
+	return cmp < 0
+}
+
+func (o *options) parseKey(s string) ([]byte, error) {
+	switch o.keyFmt {
+	case "hex":
+		return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	case "utf8":
+		return []byte(s), nil
+	default:
+		return nil, fmt.Errorf("unknown key format: %s", o.keyFmt)
+	}
+}
+
+func (o *options) format(b []byte) string {
+	if o.outFmt == "utf8" && utf8.Valid(b) {
+		return string(b)
+	}
+	return hex.EncodeToString(b)
+}
+
+func formatFlags(flags kv.TableFlags) string {
+	if flags == kv.Default {
+		return "-"
+	}
+	var res []string
+	for _, f := range []struct {
+		flag kv.TableFlags
+		name string
+	}{{kv.DupSort, "DupSort"}, {kv.ReverseKey, "ReverseKey"}, {kv.IntegerKey, "IntegerKey"}, {kv.IntegerDup, "IntegerDup"}, {kv.ReverseDup, "ReverseDup"}} {
+		if flags&f.flag != 0 {
+			res = append(res, f.name)
+		}
+	}
+	return strings.Join(res, "|")
+}
+
+func cmdTables(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 1, func(db *mdbx.MdbxKV, _ []string) error {
+		tables := db.AllTables()
+		names := make([]string, 0, len(tables))
+		for name := range tables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return db.View(ctx, func(tx kv.Tx) error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "table\tflags\tentries\tdepth\tsize")
+			for _, name := range names {
+				st, err := tx.(*mdbx.MdbxTx).BucketStat(name)
+				if err != nil {
+					return err
+				}
+				size := (st.LeafPages + st.BranchPages + st.OverflowPages) * uint64(st.PSize)
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", name, formatFlags(tables[name].Flags), st.Entries, st.Depth, datasize.ByteSize(size).HR())
+			}
+			return w.Flush()
+		})
+	})
+}
+
+func cmdGet(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 3, func(db *mdbx.MdbxKV, args []string) error {
+		if err := checkTable(db, args[0]); err != nil {
+			return err
+		}
+		key, err := o.parseKey(args[1])
+		if err != nil {
+			return err
+		}
+		return db.View(ctx, func(tx kv.Tx) error {
+			if err := checkOrder(tx, args[0], db.AllTables()[args[0]]); err != nil {
+				return err
+			}
+			v, err := tx.GetOne(args[0], key)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				return fmt.Errorf("key not found: %s", args[1])
+			}
+			fmt.Println(o.format(v))
+			return nil
+		})
+	})
+}
+
+func cmdScan(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 2, func(db *mdbx.MdbxKV, args []string) error {
+		if err := checkTable(db, args[0]); err != nil {
+			return err
+		}
+		var from, to []byte
+		var err error
+		if len(args) > 1 {
+			if from, err = o.parseKey(args[1]); err != nil {
+				return err
+			}
+		}
+		if len(args) > 2 {
+			if to, err = o.parseKey(args[2]); err != nil {
+				return err
+			}
+		}
+		return db.View(ctx, func(tx kv.Tx) error {
+			cfg := db.AllTables()[args[0]]
+			if err := checkOrder(tx, args[0], cfg); err != nil {
+				return err
+			}
+			it, err := tx.RangeAscend(args[0], from, to, o.limit)
+			if err != nil {
+				return err
+			}
+			return o.print(ctx, args[0], cfg, it)
+		})
+	})
+}
+
+func cmdPrefix(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 3, func(db *mdbx.MdbxKV, args []string) error {
+		if err := checkTable(db, args[0]); err != nil {
+			return err
+		}
+		prefix, err := o.parseKey(args[1])
+		if err != nil {
+			return err
+		}
+		to, _ := kv.NextSubtree(prefix) // nil if prefix is 0xff...ff - means till end of table
+		return db.View(ctx, func(tx kv.Tx) error {
+			cfg := db.AllTables()[args[0]]
+			if err := checkOrder(tx, args[0], cfg); err != nil {
+				return err
+			}
+			it, err := tx.RangeAscend(args[0], prefix, to, o.limit)
+			if err != nil {
+				return err
+			}
+			return o.print(ctx, args[0], cfg, it)
+		})
+	})
+}
+
+// print - prints entries of range, stops at first entry out of order of table: see checkOrder
+func (o *options) print(ctx context.Context, table string, cfg kv.TableCfgItem, it iter.KV) error {
+	oc := orderChecker{cfg: cfg}
+	for it.HasNext() {
+		k, v, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !oc.next(k, v) {
+			return fmt.Errorf("table: %s, %w", table, errCustomOrder)
+		}
+		fmt.Printf("%s\t%s\n", o.format(k), o.format(v))
+	}
+	return nil
+}
+
+func cmdCount(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 2, func(db *mdbx.MdbxKV, args []string) error {
+		if err := checkTable(db, args[0]); err != nil {
+			return err
+		}
+		return db.View(ctx, func(tx kv.Tx) error {
+			st, err := tx.(*mdbx.MdbxTx).BucketStat(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(st.Entries)
+			return nil
+		})
+	})
+}
+
+func cmdReaders(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 1, func(db *mdbx.MdbxKV, _ []string) error {
+		if o.check {
+			dead, err := db.ReaderCheck()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("cleared slots of dead processes: %d\n", dead)
+		}
+		info, err := db.Env().Info(nil)
+		if err != nil {
+			return err
+		}
+		readers, err := db.Readers()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reader slots used: %d of %d, last txn id: %d\n", info.NumReaders, info.MaxReaders, info.LastTxnID)
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "slot\tpid\tthread\ttxn id\tlag\tused\tretained")
+		for _, r := range readers {
+			fmt.Fprintf(w, "%d\t%d\t%#x\t%d\t%d\t%s\t%s\n", r.Slot, r.PID, r.Thread, r.TxnID, r.Lag,
+				datasize.ByteSize(r.BytesUsed).HR(), datasize.ByteSize(r.BytesRetained).HR())
+		}
+		return w.Flush()
+	})
+}
+
+func cmdStat(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 1, func(db *mdbx.MdbxKV, _ []string) error {
+		info, err := db.Env().Info(nil)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintf(w, "page size\t%d\n", info.PageSize)
+		fmt.Fprintf(w, "size\t%s\n", datasize.ByteSize(info.Geo.Current).HR())
+		fmt.Fprintf(w, "size lower\t%s\n", datasize.ByteSize(info.Geo.Lower).HR())
+		fmt.Fprintf(w, "size upper\t%s\n", datasize.ByteSize(info.Geo.Upper).HR())
+		fmt.Fprintf(w, "growth step\t%s\n", datasize.ByteSize(info.Geo.Grow).HR())
+		fmt.Fprintf(w, "shrink threshold\t%s\n", datasize.ByteSize(info.Geo.Shrink).HR())
+		fmt.Fprintf(w, "used\t%s\n", datasize.ByteSize(uint64(info.LastPNO+1)*uint64(info.PageSize)).HR())
+		fmt.Fprintf(w, "last txn id\t%d\n", info.LastTxnID)
+		fmt.Fprintf(w, "readers\t%d of %d\n", info.NumReaders, info.MaxReaders)
+		fmt.Fprintf(w, "since sync\t%s\n", info.SinceSync)
+		fmt.Fprintf(w, "since reader check\t%s\n", info.SinceReaderCheck)
+		fmt.Fprintf(w, "tables\t%d\n", len(db.AllTables()))
+		return w.Flush()
+	})
+}
+
+func cmdDropDeprecated(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return fmt.Errorf("expected at least 2 arguments")
+	}
+	cfg := kv.TableCfg{}
+	for _, name := range fs.Args()[1:] {
+		cfg[name] = kv.TableCfgItem{IsDeprecated: true}
+	}
+	db, err := openDB(ctx, fs.Arg(0), true, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(ctx, func(tx kv.RwTx) error {
+		for _, name := range fs.Args()[1:] {
+			exists, err := tx.ExistsBucket(name)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				fmt.Printf("%s: not found\n", name)
+				continue
+			}
+			if err := tx.DropBucket(name); err != nil {
+				return err
+			}
+			fmt.Printf("%s: dropped\n", name)
+		}
+		return nil
+	})
+}
+
+func cmdCopy(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 2, func(db *mdbx.MdbxKV, args []string) error {
+		info, err := db.Backup(ctx, args[0], mdbx.BackupOpts{
+			KeepSize: o.keepSize,
+			Progress: func(p mdbx.BackupProgress) {
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s: %d/%d\n", p.TablesDone, p.TablesTotal, p.Table, p.Entries, p.Total)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("copied snapshot %d to %s\n", info.ViewID, args[0])
+		if !o.verify {
+			return nil
+		}
+		if err := mdbx.VerifyBackup(ctx, args[0], info, log.NewNoop()); err != nil {
+			return err
+		}
+		fmt.Println("verified")
+		return nil
+	})
+}
+
+// cmdCheck - tables are checked against flags stored in db: tool doesn't know config and custom comparators of app
+func cmdCheck(ctx context.Context, fs *flag.FlagSet, o *options) error {
+	return withDB(ctx, fs, o, 1, func(db *mdbx.MdbxKV, args []string) error {
+		var expected kv.TableCfg // nil - config of db, which is read from db
+		if o.cfgPath != "" {
+			b, err := os.ReadFile(o.cfgPath)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(b, &expected); err != nil {
+				return fmt.Errorf("cfg: %w", err)
+			}
+		}
+		var names []string
+		for _, name := range args {
+			if err := checkTable(db, name); err != nil {
+				return err
+			}
+			if _, ok := expected[name]; expected != nil && !ok {
+				return fmt.Errorf("table not in cfg: %s", name)
+			}
+			names = append(names, name)
+		}
+		report, err := integrity.Check(ctx, db, integrity.Opts{Tables: expected, Names: names, MaxViolations: o.limit})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+		if !report.OK() {
+			return fmt.Errorf("integrity check failed: %d violations", report.ViolationsCount)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,217 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/integrity"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+// TestMain - test binary runs main() instead of tests if env var is set: tool is tested with real output and exit status
+func TestMain(m *testing.M) {
+	if os.Getenv("MDBXTOOL_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// mdbxtool - runs tool in subprocess, returns stdout, stderr and exit status
+func mdbxtool(t *testing.T, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "MDBXTOOL_TEST_MAIN=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.String(), stderr.String(), exitErr.ExitCode()
+	}
+	require.NoError(t, err)
+	return stdout.String(), stderr.String(), 0
+}
+
+func testDB(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	db := mdbx.NewMDBX(log.NewNoop()).Path(dir).WithTableCfg(kv.TableCfg{"T": {}, "D": {Flags: kv.DupSort}}).MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, e := range [][3]string{{"T", "a", "1"}, {"T", "b", "2"}, {"T", "c", "3"}, {"D", "k", "x"}, {"D", "k", "y"}} {
+			if err := tx.Put(e[0], []byte(e[1]), []byte(e[2])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return dir
+}
+
+func TestCommands(t *testing.T) {
+	dir := testDB(t)
+
+	stdout, _, code := mdbxtool(t, "tables", dir)
+	require.Equal(t, 0, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Regexp(t, `^table\s+flags\s+entries`, lines[0])
+	require.Regexp(t, `^D\s+DupSort\s+2\s`, lines[1])
+	require.Regexp(t, `^T\s+-\s+3\s`, lines[2])
+
+	stdout, _, code = mdbxtool(t, "get", "-out", "utf8", dir, "T", "b")
+	require.Equal(t, 0, code)
+	require.Equal(t, "2\n", stdout)
+	stdout, _, code = mdbxtool(t, "get", "-key", "hex", dir, "T", "0x63")
+	require.Equal(t, 0, code)
+	require.Equal(t, "33\n", stdout)
+
+	stdout, _, code = mdbxtool(t, "scan", "-out", "utf8", dir, "T", "b")
+	require.Equal(t, 0, code)
+	require.Equal(t, "b\t2\nc\t3\n", stdout)
+	stdout, _, code = mdbxtool(t, "scan", "-out", "utf8", "-limit", "1", dir, "D")
+	require.Equal(t, 0, code)
+	require.Equal(t, "k\tx\n", stdout)
+
+	stdout, _, code = mdbxtool(t, "prefix", "-out", "utf8", dir, "T", "b")
+	require.Equal(t, 0, code)
+	require.Equal(t, "b\t2\n", stdout)
+	stdout, _, code = mdbxtool(t, "prefix", "-out", "utf8", dir, "D", "k")
+	require.Equal(t, 0, code)
+	require.Equal(t, "k\tx\nk\ty\n", stdout)
+
+	stdout, _, code = mdbxtool(t, "count", dir, "D")
+	require.Equal(t, 0, code)
+	require.Equal(t, "2\n", stdout)
+
+	stdout, _, code = mdbxtool(t, "stat", dir)
+	require.Equal(t, 0, code)
+	require.Regexp(t, `(?m)^page size\s+\d+$`, stdout)
+	require.Regexp(t, `(?m)^readers\s+\d+ of \d+$`, stdout)
+	require.Regexp(t, `(?m)^tables\s+2$`, stdout)
+
+	stdout, _, code = mdbxtool(t, "check", dir)
+	require.Equal(t, 0, code)
+	var report integrity.Report
+	require.NoError(t, json.Unmarshal([]byte(stdout), &report))
+	require.True(t, report.OK())
+	require.Len(t, report.Tables, 2)
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	stdout, stderr, code := mdbxtool(t, "copy", dir, dst)
+	require.Equal(t, 0, code, stderr)
+	require.Regexp(t, `^copied snapshot \d+ to `+dst+"\nverified\n$", stdout)
+	stdout, _, code = mdbxtool(t, "count", dst, "T")
+	require.Equal(t, 0, code)
+	require.Equal(t, "3\n", stdout)
+}
+
+func TestReaders(t *testing.T) {
+	dir := testDB(t)
+	db := mdbx.NewMDBX(log.NewNoop()).Path(dir).Readonly().WithTableCfg(kv.TableCfg{"T": {}, "D": {Flags: kv.DupSort}}).MustOpen()
+	defer db.Close()
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	// reader of this process is listed by tool from other process
+	stdout, _, code := mdbxtool(t, "readers", dir)
+	require.Equal(t, 0, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Regexp(t, `^reader slots used: [1-9]\d* of \d+, last txn id: \d+$`, lines[0])
+	require.Regexp(t, `^slot\s+pid\s+thread\s+txn id\s+lag\s+used\s+retained$`, lines[1])
+	require.Regexp(t, fmt.Sprintf(`(?m)^\d+\s+%d\s+0x[0-9a-f]+\s+%d\s+0\s`, os.Getpid(), tx.ViewID()), stdout)
+}
+
+func TestDropDeprecated(t *testing.T) {
+	dir := testDB(t)
+
+	stdout, stderr, code := mdbxtool(t, "drop-deprecated", dir, "D", "Missing")
+	require.Equal(t, 0, code, stderr)
+	require.Equal(t, "D: dropped\nMissing: not found\n", stdout)
+
+	stdout, _, code = mdbxtool(t, "tables", dir)
+	require.Equal(t, 0, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Len(t, lines, 2)
+	require.Regexp(t, `^T\s+-\s+3\s`, lines[1])
+}
+
+func TestCustomComparator(t *testing.T) {
+	dir := t.TempDir()
+	reverse := func(k1, k2, _, _ []byte) int { return bytes.Compare(k2, k1) }
+	db := mdbx.NewMDBX(log.NewNoop()).Path(dir).WithTableCfg(kv.TableCfg{"R": {KeyCmp: reverse}}).MustOpen()
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, k := range []string{"a", "b", "c"} {
+			if err := tx.Put("R", []byte(k), []byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	db.Close()
+
+	// tool doesn't know comparator of app: lookups in table would be wrong
+	for _, args := range [][]string{{"get", dir, "R", "b"}, {"scan", dir, "R"}, {"prefix", dir, "R", "a"}} {
+		_, stderr, code := mdbxtool(t, args...)
+		require.Equal(t, 1, code, args)
+		require.Contains(t, stderr, "error: table: R, entries are not in order of table flags", args)
+	}
+	stdout, _, code := mdbxtool(t, "count", dir, "R")
+	require.Equal(t, 0, code)
+	require.Equal(t, "3\n", stdout)
+}
+
+func TestErrors(t *testing.T) {
+	dir := testDB(t)
+	cfg := filepath.Join(t.TempDir(), "cfg.json")
+	require.NoError(t, os.WriteFile(cfg, []byte(`{"T":{"Flags":4}}`), 0o600)) // DupSort, but T is not DupSort in db
+
+	for _, tc := range []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"unknown", dir}, "error: unknown command: unknown"},
+		{[]string{"get"}, "error: datadir is required"},
+		{[]string{"get", dir, "T"}, "error: expected at least 3 arguments"},
+		{[]string{"get", dir, "T", "z"}, "error: key not found: z"},
+		{[]string{"get", dir, "Missing", "a"}, "error: table not found: Missing"},
+		{[]string{"count", dir, "Missing"}, "error: table not found: Missing"},
+		{[]string{"scan", "-key", "hex", dir, "T", "zz"}, "error: encoding/hex"},
+		{[]string{"check", "-cfg", cfg, dir, "D"}, "error: table not in cfg: D"},
+		{[]string{"check", "-cfg", cfg, dir}, "error: integrity check failed: 1 violations"},
+		{[]string{"copy", dir, dir}, "error: backup: db already exists"},
+	} {
+		_, stderr, code := mdbxtool(t, tc.args...)
+		require.Equal(t, 1, code, tc.args)
+		require.Contains(t, stderr, tc.stderr, tc.args)
+	}
+}
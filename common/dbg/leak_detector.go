@@ -21,6 +21,9 @@ type LeakDetector struct {
 
 	list     map[uint64]LeakDetectorItem
 	listLock sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 type LeakDetectorItem struct {
@@ -35,7 +38,7 @@ func NewLeakDetector(ctx context.Context, name string, slowThreshold time.Durati
 	if !enabled {
 		return nil
 	}
-	d := &LeakDetector{list: map[uint64]LeakDetectorItem{}}
+	d := &LeakDetector{list: map[uint64]LeakDetectorItem{}, stop: make(chan struct{})}
 	d.SetSlowThreshold(slowThreshold)
 
 	if enabled {
@@ -45,6 +48,8 @@ func NewLeakDetector(ctx context.Context, name string, slowThreshold time.Durati
 
 			for {
 				select {
+				case <-d.stop:
+					return
 				case <-logEvery.C:
 					if list := d.slowList(); len(list) > 0 {
 						logger.Info(fmt.Sprintf("[dbg.%s] long living resources", name), "list", strings.Join(d.slowList(), ", "))
@@ -56,6 +61,14 @@ func NewLeakDetector(ctx context.Context, name string, slowThreshold time.Durati
 	return d
 }
 
+// Close - stops periodic logging
+func (d *LeakDetector) Close() {
+	if d == nil {
+		return
+	}
+	d.stopOnce.Do(func() { close(d.stop) })
+}
+
 func (d *LeakDetector) slowList() (res []string) {
 	if d == nil || !d.Enabled() {
 		return res
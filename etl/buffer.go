@@ -0,0 +1,164 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// entryOverhead - memory used by buffer for every entry besides key and value
+const entryOverhead = 3 * 8
+
+type bufferEntry struct {
+	offset     int // offset of key in sortableBuffer.data, value follows the key
+	kLen, vLen int
+}
+
+// sortableBuffer - collected entries in order of collection, sortBy key keeps this order for entries with equal keys
+type sortableBuffer struct {
+	data    []byte
+	entries []bufferEntry
+	cmp     func(a, b []byte) int // keys order of table
+}
+
+func (b *sortableBuffer) put(k, v []byte) {
+	b.entries = append(b.entries, bufferEntry{offset: len(b.data), kLen: len(k), vLen: len(v)})
+	b.data = append(b.data, k...)
+	b.data = append(b.data, v...)
+}
+
+func (b *sortableBuffer) key(i int) []byte {
+	e := b.entries[i]
+	return b.data[e.offset : e.offset+e.kLen : e.offset+e.kLen]
+}
+
+func (b *sortableBuffer) value(i int) []byte {
+	e := b.entries[i]
+	return b.data[e.offset+e.kLen : e.offset+e.kLen+e.vLen : e.offset+e.kLen+e.vLen]
+}
+
+func (b *sortableBuffer) len() int   { return len(b.entries) }
+func (b *sortableBuffer) size() int  { return len(b.data) + len(b.entries)*entryOverhead }
+func (b *sortableBuffer) reset()     { b.data, b.entries = b.data[:0], b.entries[:0] }
+func (b *sortableBuffer) sortByKey() { sort.Stable(byKey{b}) }
+
+type byKey struct{ b *sortableBuffer }
+
+func (s byKey) Len() int           { return s.b.len() }
+func (s byKey) Less(i, j int) bool { return s.b.cmp(s.b.key(i), s.b.key(j)) < 0 }
+func (s byKey) Swap(i, j int)      { s.b.entries[i], s.b.entries[j] = s.b.entries[j], s.b.entries[i] }
+
+// run - sorted sequence of entries, returns io.EOF after last entry
+type run interface {
+	next() (k, v []byte, err error)
+}
+
+// memoryRun - sorted buffer which was not flushed to disk
+type memoryRun struct {
+	b *sortableBuffer
+	i int
+}
+
+func (r *memoryRun) next() ([]byte, []byte, error) {
+	if r.i >= r.b.len() {
+		return nil, nil, io.EOF
+	}
+	r.i++
+	return r.b.key(r.i - 1), r.b.value(r.i - 1), nil
+}
+
+// writeRun - writes sorted buffer to temporary file in dir: sequence of uvarint(len(k)), k, uvarint(len(v)), v
+func writeRun(dir string, b *sortableBuffer) (name string, err error) {
+	f, err := os.CreateTemp(dir, "etl-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	w := bufio.NewWriterSize(f, 1<<20)
+	var lenBuf [binary.MaxVarintLen64]byte
+	for i := 0; i < b.len(); i++ {
+		for _, part := range [2][]byte{b.key(i), b.value(i)} {
+			n := binary.PutUvarint(lenBuf[:], uint64(len(part)))
+			if _, err = w.Write(lenBuf[:n]); err != nil {
+				return "", err
+			}
+			if _, err = w.Write(part); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// fileRun - reader of file written by writeRun
+type fileRun struct {
+	f *os.File
+	r *bufio.Reader
+}
+
+func openRun(name string) (*fileRun, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileRun{f: f, r: bufio.NewReaderSize(f, 256*1024)}, nil
+}
+
+func (r *fileRun) next() (k, v []byte, err error) {
+	if k, err = r.readPart(); err != nil {
+		return nil, nil, err
+	}
+	if v, err = r.readPart(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, fmt.Errorf("%s: %w", r.f.Name(), err)
+	}
+	return k, v, nil
+}
+
+func (r *fileRun) readPart() ([]byte, error) {
+	l, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	part := make([]byte, l)
+	if _, err := io.ReadFull(r.r, part); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("%s: %w", r.f.Name(), err)
+	}
+	return part, nil
+}
+
+func (r *fileRun) close() error { return r.f.Close() }
@@ -0,0 +1,342 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package etl - external sort for bulk loading of unsorted data into db. Collector accumulates entries in memory,
+// flushes sorted runs to temporary files when buffer is full, and Load merges runs and writes them in order of keys
+// by RwCursor.Append - it avoids page splits and spills of dirty pages caused by random Put.
+package etl
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/c2h5oh/datasize"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+	"github.com/uncommoncorrelation/go-mdbx-db/mmap"
+)
+
+const logInterval = 30 * time.Second
+
+// DefaultBufferSize - 1/16 of available memory, but not less than 16Mb and not more than 512Mb
+func DefaultBufferSize() datasize.ByteSize {
+	size := datasize.ByteSize(mmap.TotalMemory() / 16)
+	if size < 16*datasize.MB {
+		return 16 * datasize.MB
+	}
+	if size > 512*datasize.MB {
+		return 512 * datasize.MB
+	}
+	return size
+}
+
+// TransformFunc - applied to every collected entry before it's buffered. Entries are sorted by keys returned by
+// TransformFunc. Return nil key to skip entry.
+type TransformFunc func(k, v []byte) (newK, newV []byte, err error)
+
+// DedupFunc - merges values collected for the same key: called with accumulated value and next collected value, in
+// order of collection. Result of last call is written to table.
+type DedupFunc func(k, acc, v []byte) ([]byte, error)
+
+// Collector - not thread-safe. Must be closed to remove temporary files, it can't be used after Load.
+//
+// Without DedupFunc, value collected last is written for key of not-DupSort table, and all distinct values are
+// written for key of DupSort table.
+type Collector struct {
+	logPrefix  string
+	tmpdir     string
+	cfg        kv.TableCfgItem
+	bufferSize datasize.ByteSize
+	transform  TransformFunc
+	dedup      DedupFunc
+	logger     log.Logger
+
+	buf      sortableBuffer
+	files    []string
+	loaded   bool
+	closed   bool
+	entries  uint64
+	flushing time.Duration
+}
+
+// NewCollector - cfg is config of table which entries are loaded into (see kv.RoDB.AllTables): entries are sorted by its
+// CompareKeys and CompareDups, it tells if table is DupSort.
+func NewCollector(logPrefix, tmpdir string, cfg kv.TableCfgItem, logger log.Logger) *Collector {
+	c := &Collector{logPrefix: logPrefix, tmpdir: tmpdir, cfg: cfg, bufferSize: DefaultBufferSize(), logger: logger}
+	c.buf.cmp = cfg.CompareKeys
+	return c
+}
+
+// BufferSize - size of memory buffer, sorted run is flushed to file when buffer is full
+func (c *Collector) BufferSize(size datasize.ByteSize) *Collector {
+	c.bufferSize = size
+	return c
+}
+
+func (c *Collector) Transform(f TransformFunc) *Collector {
+	c.transform = f
+	return c
+}
+
+func (c *Collector) Dedup(f DedupFunc) *Collector {
+	c.dedup = f
+	return c
+}
+
+// Collect - k and v are copied, caller can reuse them
+func (c *Collector) Collect(k, v []byte) error {
+	if c.loaded || c.closed {
+		return fmt.Errorf("[%s] etl: collect after load or close", c.logPrefix)
+	}
+	if c.transform != nil {
+		var err error
+		if k, v, err = c.transform(k, v); err != nil {
+			return fmt.Errorf("[%s] etl: transform: %w", c.logPrefix, err)
+		}
+		if k == nil {
+			return nil
+		}
+	}
+	c.buf.put(k, v)
+	c.entries++
+	if c.buf.size() >= int(c.bufferSize) {
+		return c.flush()
+	}
+	return nil
+}
+
+func (c *Collector) flush() error {
+	if c.buf.len() == 0 {
+		return nil
+	}
+	start := time.Now()
+	c.buf.sortByKey()
+	name, err := writeRun(c.tmpdir, &c.buf)
+	if err != nil {
+		return fmt.Errorf("[%s] etl: flush buffer: %w", c.logPrefix, err)
+	}
+	c.files = append(c.files, name)
+	c.flushing += time.Since(start)
+	c.logger.Debug(fmt.Sprintf("[%s] ETL [1/2] Flushed buffer", c.logPrefix), "file", name, "entries", c.buf.len(), "size", datasize.ByteSize(c.buf.size()).HR(), "took", time.Since(start))
+	c.buf.reset()
+	return nil
+}
+
+// Load - merges collected entries and writes them to table in order of keys. It uses RwCursor.Append if all keys are
+// greater than last key of table, and RwCursor.Put otherwise. If tx implements kv.RawTx, flags of table are checked
+// against config of Collector.
+func (c *Collector) Load(tx kv.RwTx, table string) error {
+	if c.loaded || c.closed {
+		return fmt.Errorf("[%s] etl: load after load or close", c.logPrefix)
+	}
+	c.loaded = true
+	start := time.Now()
+
+	if rawTx, ok := tx.(kv.RawTx); ok {
+		flags, err := rawTx.TableFlags(table)
+		if err != nil {
+			return fmt.Errorf("[%s] etl: %w", c.logPrefix, err)
+		}
+		if flags != c.cfg.Flags {
+			return fmt.Errorf("[%s] etl: table: %s, flags of collector %#x, in db %#x", c.logPrefix, table, uint(c.cfg.Flags), uint(flags))
+		}
+	}
+	// entries of AutoDupSortKeysConversion table are converted by cursor, its keys are unique for collector
+	dupSort := c.cfg.Flags&kv.DupSort != 0 && !c.cfg.AutoDupSortKeysConversion
+	cursor, err := tx.RwCursor(table)
+	if err != nil {
+		return fmt.Errorf("[%s] etl: %w", c.logPrefix, err)
+	}
+	defer cursor.Close()
+	lastK, _, err := cursor.Last()
+	if err != nil {
+		return fmt.Errorf("[%s] etl: %w", c.logPrefix, err)
+	}
+	l := &loader{c: c, cursor: cursor, table: table, dupSort: dupSort, lastK: lastK, append: lastK == nil, logEvery: time.NewTicker(logInterval)}
+	defer l.logEvery.Stop()
+
+	c.buf.sortByKey()
+	runs := make([]run, 0, len(c.files)+1)
+	for _, name := range c.files {
+		r, err := openRun(name)
+		if err != nil {
+			return fmt.Errorf("[%s] etl: %w", c.logPrefix, err)
+		}
+		defer r.close()
+		runs = append(runs, r)
+	}
+	runs = append(runs, &memoryRun{b: &c.buf}) // collected last: its entries go after entries of files with equal keys
+	if err := l.load(runs); err != nil {
+		return fmt.Errorf("[%s] etl: load into %s: %w", c.logPrefix, table, err)
+	}
+	c.logger.Debug(fmt.Sprintf("[%s] ETL [2/2] Loaded", c.logPrefix), "into", table, "entries", c.entries, "files", len(c.files), "flushing", c.flushing, "took", time.Since(start))
+	return nil
+}
+
+// Close - removes temporary files
+func (c *Collector) Close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for _, name := range c.files {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.logger.Warn(fmt.Sprintf("[%s] etl: remove temporary file", c.logPrefix), "file", name, "err", err)
+		}
+	}
+	c.files = nil
+	c.buf = sortableBuffer{cmp: c.buf.cmp}
+}
+
+type loader struct {
+	c        *Collector
+	cursor   kv.RwCursor
+	table    string
+	dupSort  bool
+	lastK    []byte // last key of table before Load, nil if table was empty
+	append   bool   // all keys left to load are greater than lastK
+	logEvery *time.Ticker
+
+	k    []byte
+	vals [][]byte // values of k in order of collection
+}
+
+// load - k-way merge of runs. Entries with equal keys are ordered by index of run, then by order in run - it's order
+// of collection.
+func (l *loader) load(runs []run) error {
+	h := mergeHeap{cmp: l.c.cfg.CompareKeys, items: make([]mergeItem, 0, len(runs))}
+	for i, r := range runs {
+		k, v, err := r.next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		h.items = append(h.items, mergeItem{k: k, v: v, run: i})
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		item := &h.items[0]
+		if len(l.vals) > 0 && h.cmp(l.k, item.k) != 0 {
+			if err := l.write(); err != nil {
+				return err
+			}
+		}
+		if len(l.vals) == 0 {
+			l.k = item.k
+		}
+		l.vals = append(l.vals, item.v)
+
+		k, v, err := runs[item.run].next()
+		switch {
+		case err == io.EOF:
+			heap.Pop(&h)
+		case err != nil:
+			return err
+		default:
+			item.k, item.v = k, v
+			heap.Fix(&h, 0)
+		}
+	}
+	if len(l.vals) == 0 {
+		return nil
+	}
+	return l.write()
+}
+
+// write - writes collected values of l.k
+func (l *loader) write() error {
+	select {
+	case <-l.logEvery.C:
+		l.c.logger.Info(fmt.Sprintf("[%s] ETL [2/2] Loading", l.c.logPrefix), "into", l.table, "current_prefix", fmt.Sprintf("%x", l.k[:min(len(l.k), 4)]))
+	default:
+	}
+
+	if !l.append {
+		l.append = l.c.cfg.CompareKeys(l.k, l.lastK) > 0
+	}
+
+	vals := l.vals
+	switch {
+	case l.c.dedup != nil:
+		acc := vals[0]
+		for _, v := range vals[1:] {
+			var err error
+			if acc, err = l.c.dedup(l.k, acc, v); err != nil {
+				return fmt.Errorf("dedup: %w", err)
+			}
+		}
+		vals = [][]byte{acc}
+	case l.dupSort:
+		cmp := l.c.cfg.CompareDups
+		sort.SliceStable(vals, func(i, j int) bool { return cmp(vals[i], vals[j]) < 0 })
+		uniq := vals[:1]
+		for _, v := range vals[1:] {
+			if cmp(v, uniq[len(uniq)-1]) != 0 {
+				uniq = append(uniq, v)
+			}
+		}
+		vals = uniq
+	default:
+		vals = vals[len(vals)-1:]
+	}
+
+	for _, v := range vals {
+		var err error
+		if l.append {
+			err = l.cursor.Append(l.k, v)
+		} else {
+			err = l.cursor.Put(l.k, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	l.k, l.vals = nil, l.vals[:0]
+	return nil
+}
+
+type mergeItem struct {
+	k, v []byte
+	run  int
+}
+
+type mergeHeap struct {
+	items []mergeItem
+	cmp   func(a, b []byte) int // keys order of table
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := h.cmp(h.items[i].k, h.items[j].k); c != 0 {
+		return c < 0
+	}
+	return h.items[i].run < h.items[j].run
+}
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x any)    { h.items = append(h.items, x.(mergeItem)) }
+func (h *mergeHeap) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
@@ -0,0 +1,189 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package etl
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+var testCfg = kv.TableCfg{
+	"T":   {},
+	"D":   {Flags: kv.DupSort},
+	"I":   {Flags: kv.IntegerKey},
+	"R":   {Flags: kv.ReverseKey},
+	"IDI": {Flags: kv.DupSort | kv.IntegerKey | kv.IntegerDup},
+}
+
+func testDB(t *testing.T) kv.RwDB {
+	t.Helper()
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(testCfg).MustOpen()
+	t.Cleanup(db.Close)
+	return db
+}
+
+func load(t *testing.T, db kv.RwDB, c *Collector, table string) {
+	t.Helper()
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error { return c.Load(tx, table) }))
+}
+
+func entries(t *testing.T, db kv.RoDB, table string) (res []string) {
+	t.Helper()
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		return tx.ForEach(table, nil, func(k, v []byte) error {
+			res = append(res, fmt.Sprintf("%s=%s", k, v))
+			return nil
+		})
+	}))
+	return res
+}
+
+func TestLoad(t *testing.T) {
+	db, tmpdir := testDB(t), t.TempDir()
+	c := NewCollector("test", tmpdir, testCfg["T"], log.NewNoop()).BufferSize(1024)
+	defer c.Close()
+
+	const n = 1000
+	expect := make([]string, 0, n)
+	for _, i := range rand.Perm(n) {
+		k := make([]byte, 4)
+		binary.BigEndian.PutUint32(k, uint32(i))
+		require.NoError(t, c.Collect(k, []byte("old")))
+		require.NoError(t, c.Collect(k, []byte(fmt.Sprintf("%d", i)))) // last collected value wins
+	}
+	for i := 0; i < n; i++ {
+		k := make([]byte, 4)
+		binary.BigEndian.PutUint32(k, uint32(i))
+		expect = append(expect, fmt.Sprintf("%s=%d", k, i))
+	}
+	files, err := os.ReadDir(tmpdir)
+	require.NoError(t, err)
+	require.Greater(t, len(files), 1)
+
+	load(t, db, c, "T")
+	require.Equal(t, expect, entries(t, db, "T"))
+	require.Error(t, c.Collect([]byte("k"), nil))
+
+	c.Close()
+	files, err = os.ReadDir(tmpdir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestLoadIntoNotEmptyTable(t *testing.T) {
+	db := testDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		if err := tx.Put("T", []byte("b"), []byte("old")); err != nil {
+			return err
+		}
+		return tx.Put("T", []byte("d"), []byte("old"))
+	}))
+
+	c := NewCollector("test", t.TempDir(), testCfg["T"], log.NewNoop()).BufferSize(32)
+	defer c.Close()
+	for _, k := range []string{"e", "d", "c", "a"} {
+		require.NoError(t, c.Collect([]byte(k), []byte("new")))
+	}
+	load(t, db, c, "T")
+	require.Equal(t, []string{"a=new", "b=old", "c=new", "d=new", "e=new"}, entries(t, db, "T"))
+}
+
+func TestLoadDupSort(t *testing.T) {
+	db := testDB(t)
+	c := NewCollector("test", t.TempDir(), testCfg["D"], log.NewNoop()).BufferSize(64)
+	defer c.Close()
+	for _, e := range [][2]string{{"b", "2"}, {"a", "3"}, {"b", "1"}, {"a", "1"}, {"b", "2"}, {"a", "2"}} {
+		require.NoError(t, c.Collect([]byte(e[0]), []byte(e[1])))
+	}
+	load(t, db, c, "D")
+	require.Equal(t, []string{"a=1", "a=2", "a=3", "b=1", "b=2"}, entries(t, db, "D"))
+}
+
+func TestLoadInOrderOfTable(t *testing.T) {
+	db := testDB(t)
+	u32 := func(i int) []byte { return binary.NativeEndian.AppendUint32(nil, uint32(i)) }
+	for _, table := range []string{"I", "R", "IDI"} {
+		c := NewCollector("test", t.TempDir(), testCfg[table], log.NewNoop()).BufferSize(128)
+		for _, i := range rand.Perm(300) { // many runs, keys order differs from bytes order
+			if table == "IDI" {
+				require.NoError(t, c.Collect(u32(i%10), u32(i)), table)
+				require.NoError(t, c.Collect(u32(i%10), u32(i)), table) // duplicates are written once
+			} else {
+				require.NoError(t, c.Collect(u32(i), u32(i)), table)
+			}
+		}
+		load(t, db, c, table)
+		c.Close()
+
+		var prevK, prevV []byte
+		n := 0
+		require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+			return tx.ForEach(table, nil, func(k, v []byte) error {
+				if prevK != nil {
+					if c := testCfg[table].CompareKeys(prevK, k); c == 0 {
+						require.Negative(t, testCfg[table].CompareDups(prevV, v), table)
+					} else {
+						require.Negative(t, c, table)
+					}
+				}
+				prevK, prevV = k, v
+				n++
+				return nil
+			})
+		}))
+		require.Equal(t, 300, n, table)
+	}
+}
+
+func TestLoadCfgMismatch(t *testing.T) {
+	db := testDB(t)
+	c := NewCollector("test", t.TempDir(), testCfg["T"], log.NewNoop())
+	defer c.Close()
+	require.NoError(t, c.Collect([]byte("a"), []byte("1")))
+	require.ErrorContains(t, db.Update(context.Background(), func(tx kv.RwTx) error { return c.Load(tx, "D") }), "flags")
+	require.Empty(t, entries(t, db, "D"))
+}
+
+func TestTransformAndDedup(t *testing.T) {
+	db := testDB(t)
+	c := NewCollector("test", t.TempDir(), testCfg["T"], log.NewNoop()).BufferSize(64).
+		Transform(func(k, v []byte) ([]byte, []byte, error) {
+			if string(k) == "skip" {
+				return nil, nil, nil
+			}
+			return k[:1], v, nil
+		}).
+		Dedup(func(k, acc, v []byte) ([]byte, error) {
+			return append(append(append([]byte{}, acc...), ','), v...), nil
+		})
+	defer c.Close()
+	for _, e := range [][2]string{{"b1", "1"}, {"skip", "1"}, {"a1", "1"}, {"b2", "2"}, {"a2", "2"}, {"b3", "3"}} {
+		require.NoError(t, c.Collect([]byte(e[0]), []byte(e[1])))
+	}
+	load(t, db, c, "T")
+	require.Equal(t, []string{"a=1,2", "b=1,2,3"}, entries(t, db, "T"))
+}
@@ -24,66 +24,45 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/erigontech/mdbx-go/mdbx"
 	"github.com/uncommoncorrelation/go-mdbx-db/common"
 )
 
+// maxPageSize - MDBX_MAX_PAGESIZE, kept here to not depend on cgo in backends which don't use mdbx
+const maxPageSize = 64 * 1024
+
 func DefaultPageSize() uint64 {
 	osPageSize := os.Getpagesize()
 	if osPageSize < 4096 { // reduce further may lead to errors (because some data is just big)
 		osPageSize = 4096
-	} else if osPageSize > mdbx.MaxPageSize {
-		osPageSize = mdbx.MaxPageSize
+	} else if osPageSize > maxPageSize {
+		osPageSize = maxPageSize
 	}
 	osPageSize = osPageSize / 4096 * 4096 // ensure it's rounded
 	return uint64(osPageSize)
 }
 
-// BigChunks - read `table` by big chunks - restart read transaction after each 1 minutes
+// BigChunks - read `table` by big chunks - move read transaction to the latest snapshot after each 1 minutes (see
+// RenewableTx, transactions which don't support it are restarted)
 func BigChunks(db RoDB, table string, from []byte, walker func(tx Tx, k, v []byte) (bool, error)) error {
-	rollbackEvery := time.NewTicker(1 * time.Minute)
+	renewEvery := time.NewTicker(1 * time.Minute)
+	defer renewEvery.Stop()
 
 	var stop bool
 	for !stop {
 		if err := db.View(context.Background(), func(tx Tx) error {
-			c, err := tx.Cursor(table)
-			if err != nil {
-				return err
-			}
-			defer c.Close()
-
-			k, v, err := c.Seek(from)
-		Loop:
-			for ; k != nil; k, v, err = c.Next() {
-				if err != nil {
+			for {
+				var err error
+				if from, stop, err = bigChunk(tx, table, from, renewEvery.C, walker); err != nil || stop {
 					return err
 				}
-
-				// break loop before walker() call, to make sure all keys are received by walker() exactly once
-				select {
-				case <-rollbackEvery.C:
-
-					break Loop
-				default:
+				rtx, ok := tx.(RenewableTx)
+				if !ok {
+					return nil // next chunk in new transaction
 				}
-
-				ok, err := walker(tx, k, v)
-				if err != nil {
+				if err := rtx.Renew(); err != nil {
 					return err
 				}
-				if !ok {
-					stop = true
-					break
-				}
-			}
-
-			if k == nil {
-				stop = true
 			}
-
-			from = common.Copy(k) // next transaction will start from this key
-
-			return nil
 		}); err != nil {
 			return err
 		}
@@ -91,6 +70,42 @@ func BigChunks(db RoDB, table string, from []byte, walker func(tx Tx, k, v []byt
 	return nil
 }
 
+// bigChunk - walks table from `from` until `done` fires, returns key from which next chunk must start
+func bigChunk(tx Tx, table string, from []byte, done <-chan time.Time, walker func(tx Tx, k, v []byte) (bool, error)) (next []byte, stop bool, err error) {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return nil, false, err
+	}
+	defer c.Close()
+
+	k, v, err := c.Seek(from)
+Loop:
+	for ; k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return nil, false, err
+		}
+
+		// break loop before walker() call, to make sure all keys are received by walker() exactly once
+		select {
+		case <-done:
+			break Loop
+		default:
+		}
+
+		ok, err := walker(tx, k, v)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			return nil, true, nil
+		}
+	}
+	if k == nil {
+		return nil, true, nil
+	}
+	return common.Copy(k), false, nil // next chunk will start from this key
+}
+
 var (
 	bytesTrue  = []byte{1}
 	bytesFalse = []byte{0}
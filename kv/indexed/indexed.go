@@ -0,0 +1,290 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package indexed - primary table with secondary indexes which are updated together with it. Index is DupSort table:
+// index_key -> primary_key.
+package indexed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/etl"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+// ErrInconsistent - index doesn't match primary table, see Table.Check and Table.Rebuild
+var ErrInconsistent = errors.New("index is inconsistent with table")
+
+// IndexFunc - keys of index for entry of primary table. Must be deterministic: same keys for same k, v.
+type IndexFunc func(k, v []byte) ([][]byte, error)
+
+type index struct {
+	table string
+	f     IndexFunc
+}
+
+// Table - writes to primary table through Table update its indexes in the same tx. Writes to primary table which
+// bypass Table make indexes inconsistent.
+type Table struct {
+	Name    string
+	indexes []index
+	logger  log.Logger
+}
+
+func New(name string, logger log.Logger) *Table {
+	return &Table{Name: name, logger: logger}
+}
+
+// AddIndex - index table must be DupSort, see TableCfg
+func (t *Table) AddIndex(table string, f IndexFunc) *Table {
+	t.indexes = append(t.indexes, index{table: table, f: f})
+	return t
+}
+
+// TableCfg - config of primary table and its indexes, must be merged into TableCfg of db
+func (t *Table) TableCfg() kv.TableCfg {
+	cfg := kv.TableCfg{t.Name: {}}
+	for _, idx := range t.indexes {
+		cfg[idx.table] = kv.TableCfgItem{Flags: kv.DupSort}
+	}
+	return cfg
+}
+
+func (t *Table) index(table string) (index, error) {
+	for _, idx := range t.indexes {
+		if idx.table == table {
+			return idx, nil
+		}
+	}
+	return index{}, fmt.Errorf("table: %s, index %s not found", t.Name, table)
+}
+
+func (t *Table) Put(tx kv.RwTx, k, v []byte) error {
+	old, err := tx.GetOne(t.Name, k)
+	if err != nil {
+		return err
+	}
+	for _, idx := range t.indexes {
+		newKeys, err := idx.f(k, v)
+		if err != nil {
+			return fmt.Errorf("table: %s, index: %s, %w", t.Name, idx.table, err)
+		}
+		var oldKeys [][]byte
+		if old != nil {
+			if oldKeys, err = idx.f(k, old); err != nil {
+				return fmt.Errorf("table: %s, index: %s, %w", t.Name, idx.table, err)
+			}
+		}
+		if err := t.updateIndex(tx, idx.table, k, oldKeys, newKeys); err != nil {
+			return err
+		}
+	}
+	return tx.Put(t.Name, k, v)
+}
+
+func (t *Table) Delete(tx kv.RwTx, k []byte) error {
+	old, err := tx.GetOne(t.Name, k)
+	if err != nil || old == nil {
+		return err
+	}
+	for _, idx := range t.indexes {
+		oldKeys, err := idx.f(k, old)
+		if err != nil {
+			return fmt.Errorf("table: %s, index: %s, %w", t.Name, idx.table, err)
+		}
+		if err := t.updateIndex(tx, idx.table, k, oldKeys, nil); err != nil {
+			return err
+		}
+	}
+	return tx.Delete(t.Name, k)
+}
+
+// updateIndex - deletes oldKeys which are not in newKeys and puts newKeys which are not in oldKeys
+func (t *Table) updateIndex(tx kv.RwTx, table string, k []byte, oldKeys, newKeys [][]byte) error {
+	c, err := tx.RwCursorDupSort(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, ik := range oldKeys {
+		if contains(newKeys, ik) {
+			continue
+		}
+		if err := c.DeleteExact(ik, k); err != nil {
+			return fmt.Errorf("table: %s, index: %s, %w", t.Name, table, err)
+		}
+	}
+	for _, ik := range newKeys {
+		if contains(oldKeys, ik) {
+			continue
+		}
+		if err := c.Put(ik, k); err != nil {
+			return fmt.Errorf("table: %s, index: %s, %w", t.Name, table, err)
+		}
+	}
+	return nil
+}
+
+func contains(keys [][]byte, k []byte) bool {
+	for _, key := range keys {
+		if bytes.Equal(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupKeys - keys of primary table which have index key ik, in ascending order
+func (t *Table) LookupKeys(tx kv.Tx, table string, ik []byte) (iter.KV, error) {
+	if _, err := t.index(table); err != nil {
+		return nil, err
+	}
+	return tx.RangeDupSort(table, ik, nil, nil, order.Asc, -1)
+}
+
+// Lookup - entries of primary table which have index key ik, in ascending order of keys
+func (t *Table) Lookup(tx kv.Tx, table string, ik []byte) (iter.KV, error) {
+	it, err := t.LookupKeys(tx, table, ik)
+	if err != nil {
+		return nil, err
+	}
+	return &lookupIter{tx: tx, t: t, table: table, it: it}, nil
+}
+
+type lookupIter struct {
+	tx    kv.Tx
+	t     *Table
+	table string
+	it    iter.KV
+}
+
+func (it *lookupIter) HasNext() bool { return it.it.HasNext() }
+func (it *lookupIter) Next() ([]byte, []byte, error) {
+	ik, k, err := it.it.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := it.tx.GetOne(it.t.Name, k)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v == nil {
+		return nil, nil, fmt.Errorf("%w: table: %s, index: %s, key %x of index key %x not found", ErrInconsistent, it.t.Name, it.table, k, ik)
+	}
+	return k, v, nil
+}
+func (it *lookupIter) Close() {
+	if c, ok := it.it.(kv.Closer); ok {
+		c.Close()
+	}
+}
+
+// Rebuild - clears index and fills it from primary table. Index entries are sorted in tmpdir by etl.Collector.
+func (t *Table) Rebuild(tx kv.RwTx, table, tmpdir string) error {
+	idx, err := t.index(table)
+	if err != nil {
+		return err
+	}
+	collector := etl.NewCollector("rebuild "+table, tmpdir, t.TableCfg()[table], t.logger)
+	defer collector.Close()
+	if err := tx.ForEach(t.Name, nil, func(k, v []byte) error {
+		keys, err := idx.f(k, v)
+		if err != nil {
+			return err
+		}
+		for _, ik := range keys {
+			if err := collector.Collect(ik, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("table: %s, index: %s, %w", t.Name, table, err)
+	}
+	if err := tx.ClearBucket(table); err != nil {
+		return err
+	}
+	return collector.Load(tx, table)
+}
+
+// Check - returns ErrInconsistent if index has no entry for some entry of primary table (missing), or has entry which
+// doesn't match any entry of primary table (dangling)
+func (t *Table) Check(tx kv.Tx, table string) error {
+	idx, err := t.index(table)
+	if err != nil {
+		return err
+	}
+	c, err := tx.CursorDupSort(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var missing, dangling uint64
+	var first string
+	if err := tx.ForEach(t.Name, nil, func(k, v []byte) error {
+		keys, err := idx.f(k, v)
+		if err != nil {
+			return err
+		}
+		for _, ik := range keys {
+			found, _, err := c.SeekBothExact(ik, k)
+			if err != nil {
+				return err
+			}
+			if found == nil {
+				if missing+dangling == 0 {
+					first = fmt.Sprintf("missing %x -> %x", ik, k)
+				}
+				missing++
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("table: %s, index: %s, %w", t.Name, table, err)
+	}
+
+	for ik, k, err := c.First(); ik != nil || err != nil; ik, k, err = c.Next() {
+		if err != nil {
+			return fmt.Errorf("table: %s, index: %s, %w", t.Name, table, err)
+		}
+		v, err := tx.GetOne(t.Name, k)
+		if err != nil {
+			return err
+		}
+		var keys [][]byte
+		if v != nil {
+			if keys, err = idx.f(k, v); err != nil {
+				return fmt.Errorf("table: %s, index: %s, %w", t.Name, table, err)
+			}
+		}
+		if !contains(keys, ik) {
+			if missing+dangling == 0 {
+				first = fmt.Sprintf("dangling %x -> %x", ik, k)
+			}
+			dangling++
+		}
+	}
+	if missing+dangling > 0 {
+		return fmt.Errorf("%w: table: %s, index: %s, missing: %d, dangling: %d, first: %s", ErrInconsistent, t.Name, table, missing, dangling, first)
+	}
+	return nil
+}
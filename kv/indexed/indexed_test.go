@@ -0,0 +1,139 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package indexed_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/indexed"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+// users: name -> "city,tag1,tag2"
+func testTable(t *testing.T) (kv.RwDB, *indexed.Table) {
+	t.Helper()
+	users := indexed.New("User", log.NewNoop()).
+		AddIndex("UserByCity", func(k, v []byte) ([][]byte, error) {
+			return bytes.Split(v, []byte(","))[:1], nil
+		}).
+		AddIndex("UserByTag", func(k, v []byte) ([][]byte, error) {
+			return bytes.Split(v, []byte(","))[1:], nil
+		})
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(users.TableCfg()).MustOpen()
+	t.Cleanup(db.Close)
+	return db, users
+}
+
+func lookup(t *testing.T, tx kv.Tx, users *indexed.Table, index, ik string) []string {
+	t.Helper()
+	it, err := users.Lookup(tx, index, []byte(ik))
+	require.NoError(t, err)
+	keys, _, err := iter.ToKVArray(it)
+	require.NoError(t, err)
+	res := []string{}
+	for _, k := range keys {
+		res = append(res, string(k))
+	}
+	return res
+}
+
+func TestIndexedTable(t *testing.T) {
+	ctx := context.Background()
+	db, users := testTable(t)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, users.Put(tx, []byte("alice"), []byte("paris,a,b")))
+		require.NoError(t, users.Put(tx, []byte("bob"), []byte("paris,b")))
+		require.NoError(t, users.Put(tx, []byte("carol"), []byte("rome,a")))
+		require.NoError(t, users.Put(tx, []byte("bob"), []byte("rome,b,c")))
+		require.NoError(t, users.Delete(tx, []byte("carol")))
+		require.NoError(t, users.Delete(tx, []byte("dave")))
+		return nil
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Equal(t, []string{"alice"}, lookup(t, tx, users, "UserByCity", "paris"))
+		require.Equal(t, []string{"bob"}, lookup(t, tx, users, "UserByCity", "rome"))
+		require.Equal(t, []string{"alice"}, lookup(t, tx, users, "UserByTag", "a"))
+		require.Equal(t, []string{"alice", "bob"}, lookup(t, tx, users, "UserByTag", "b"))
+		require.Equal(t, []string{}, lookup(t, tx, users, "UserByTag", "d"))
+
+		it, err := users.Lookup(tx, "UserByTag", []byte("c"))
+		require.NoError(t, err)
+		k, v, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, "bob", string(k))
+		require.Equal(t, "rome,b,c", string(v))
+
+		_, err = users.Lookup(tx, "User", []byte("c"))
+		require.Error(t, err)
+
+		require.NoError(t, users.Check(tx, "UserByCity"))
+		require.NoError(t, users.Check(tx, "UserByTag"))
+		return nil
+	}))
+}
+
+func TestCheckAndRebuild(t *testing.T) {
+	ctx := context.Background()
+	db, users := testTable(t)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, users.Put(tx, []byte("alice"), []byte("paris,a")))
+		require.NoError(t, users.Put(tx, []byte("bob"), []byte("paris,b")))
+		// writes which bypass indexed.Table
+		require.NoError(t, tx.Put(users.Name, []byte("carol"), []byte("rome,a")))
+		require.NoError(t, tx.Delete(users.Name, []byte("bob")))
+		return nil
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		err := users.Check(tx, "UserByCity")
+		require.ErrorIs(t, err, indexed.ErrInconsistent)
+		require.ErrorContains(t, err, "missing: 1, dangling: 1")
+		_, _, err = iter.ToKVArray(must(users.Lookup(tx, "UserByCity", []byte("paris"))))
+		require.ErrorIs(t, err, indexed.ErrInconsistent)
+		return nil
+	}))
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, users.Rebuild(tx, "UserByCity", t.TempDir()))
+		require.NoError(t, users.Rebuild(tx, "UserByTag", t.TempDir()))
+		return nil
+	}))
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.NoError(t, users.Check(tx, "UserByCity"))
+		require.NoError(t, users.Check(tx, "UserByTag"))
+		require.Equal(t, []string{"alice"}, lookup(t, tx, users, "UserByCity", "paris"))
+		require.Equal(t, []string{"alice", "carol"}, lookup(t, tx, users, "UserByTag", "a"))
+		return nil
+	}))
+}
+
+func must(it iter.KV, err error) iter.KV {
+	if err != nil {
+		panic(err)
+	}
+	return it
+}
@@ -0,0 +1,244 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package integrity - verifies structure of tables of kv.RoDB without C tooling: order of keys and values, flags of
+// tables, encoding of AutoDupSortKeysConversion tables and format of Sequence table.
+package integrity
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+// DefaultMaxViolations - how many violations of each table are stored in report by default
+const DefaultMaxViolations = 10
+
+const checkCtxEvery = 64 * 1024 // how often (in entries) ctx is checked
+
+// CheckName - name of verified property, used in Violation and TableReport.Skipped
+type CheckName string
+
+const (
+	KeyOrder    CheckName = "key-order"    // keys are sorted by KeyCmp/IntegerKey/ReverseKey, no duplicated keys in not DupSort table
+	DupOrder    CheckName = "dup-order"    // values of key in DupSort table are sorted by DupCmp/IntegerDup/ReverseDup and unique
+	AutoDupSort CheckName = "auto-dupsort" // entries of AutoDupSortKeysConversion table can be decoded by DupFromLen/DupToLen
+	Sequence    CheckName = "sequence"     // values of Sequence table are 8-byte numbers
+	Flags       CheckName = "flags"        // flags of table in db are same as in Opts.Tables
+)
+
+type Opts struct {
+	Tables        kv.TableCfg // expected config of tables, nil - db.AllTables(): then flags of tables are not checked
+	Names         []string    // tables to check, nil - all tables of Tables
+	MaxViolations int         // violations of table stored in report, all violations are counted. 0 - DefaultMaxViolations, -1 - unlimited
+}
+
+type Violation struct {
+	Check CheckName `json:"check"`
+	Key   string    `json:"key,omitempty"`   // hex
+	Value string    `json:"value,omitempty"` // hex
+	Msg   string    `json:"msg"`
+}
+
+type TableReport struct {
+	Name            string      `json:"name"`
+	Missing         bool        `json:"missing,omitempty"` // table is configured, but doesn't exist in db
+	Keys            uint64      `json:"keys"`
+	Entries         uint64      `json:"entries"` // for DupSort table: all values of all keys
+	ViolationsCount uint64      `json:"violationsCount"`
+	Violations      []Violation `json:"violations,omitempty"` // first Opts.MaxViolations violations
+	Skipped         []CheckName `json:"skipped,omitempty"`    // checks which tx of db doesn't support, see kv.RawTx
+}
+
+// Report - result of Check, designed to be marshaled to json
+type Report struct {
+	ViewID          uint64        `json:"viewId"` // snapshot of db which was checked
+	ViolationsCount uint64        `json:"violationsCount"`
+	Tables          []TableReport `json:"tables"`
+}
+
+func (r *Report) OK() bool { return r.ViolationsCount == 0 }
+
+// Check - walks all entries of tables from opts.Tables in 1 read transaction. Found violations are returned in report,
+// error means that check couldn't be done. Some checks require tx of db to implement kv.RawTx - otherwise they are
+// listed in TableReport.Skipped.
+func Check(ctx context.Context, db kv.RoDB, opts Opts) (*Report, error) {
+	tables, checkFlags := opts.Tables, opts.Tables != nil // config of db is read from db - its flags are always same
+	if tables == nil {
+		tables = db.AllTables()
+	}
+	if opts.MaxViolations == 0 {
+		opts.MaxViolations = DefaultMaxViolations
+	}
+	names := opts.Names
+	if names == nil {
+		names = make([]string, 0, len(tables))
+		for name := range tables {
+			names = append(names, name)
+		}
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+
+	report := &Report{Tables: make([]TableReport, 0, len(names))}
+	if err := db.View(ctx, func(tx kv.Tx) error {
+		report.ViewID = tx.ViewID()
+		existing, err := tx.ListBuckets()
+		if err != nil {
+			return err
+		}
+		inDB := make(map[string]struct{}, len(existing))
+		for _, name := range existing {
+			inDB[name] = struct{}{}
+		}
+		opened := db.AllTables()
+		for _, name := range names {
+			t := TableReport{Name: name}
+			if _, ok := inDB[name]; !ok {
+				t.Missing = true
+				report.Tables = append(report.Tables, t)
+				continue
+			}
+			if _, ok := opened[name]; !ok {
+				return fmt.Errorf("table: %s, exists in db but not opened by it", name)
+			}
+			c := &tableChecker{name: name, cfg: tables[name], report: &t, maxViolations: opts.MaxViolations, checkFlags: checkFlags}
+			if err := c.check(ctx, tx); err != nil {
+				return fmt.Errorf("table: %s, %w", name, err)
+			}
+			report.ViolationsCount += t.ViolationsCount
+			report.Tables = append(report.Tables, t)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("integrity: %w", err)
+	}
+	return report, nil
+}
+
+type tableChecker struct {
+	name          string
+	cfg           kv.TableCfgItem
+	report        *TableReport
+	maxViolations int
+	checkFlags    bool
+}
+
+func (c *tableChecker) violation(check CheckName, k, v []byte, format string, args ...any) {
+	c.report.ViolationsCount++
+	if c.maxViolations >= 0 && len(c.report.Violations) >= c.maxViolations {
+		return
+	}
+	c.report.Violations = append(c.report.Violations, Violation{
+		Check: check,
+		Key:   hex.EncodeToString(k),
+		Value: hex.EncodeToString(v),
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *tableChecker) check(ctx context.Context, tx kv.Tx) error {
+	rawTx, ok := tx.(kv.RawTx)
+	if !c.checkFlags || !ok {
+		c.report.Skipped = append(c.report.Skipped, Flags)
+	}
+	if !ok {
+		if c.cfg.AutoDupSortKeysConversion {
+			// cursor returns decoded entries - their order can't be checked by table comparators
+			c.report.Skipped = append(c.report.Skipped, KeyOrder, DupOrder, AutoDupSort)
+			return nil
+		}
+		cur, err := tx.Cursor(c.name)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		return c.walk(ctx, cur)
+	}
+
+	if c.checkFlags {
+		flags, err := rawTx.TableFlags(c.name)
+		if err != nil {
+			return err
+		}
+		if flags != c.cfg.Flags {
+			c.violation(Flags, nil, nil, "configured flags %#x, in db %#x", uint(c.cfg.Flags), uint(flags))
+		}
+	}
+	cur, err := rawTx.RawCursor(c.name)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	return c.walk(ctx, cur)
+}
+
+// walk - checks all entries of table as they are stored in db
+func (c *tableChecker) walk(ctx context.Context, cur kv.Cursor) error {
+	var prevK, prevV []byte
+	first := true
+	for k, v, err := cur.First(); k != nil; k, v, err = cur.Next() {
+		if err != nil {
+			return err
+		}
+		c.report.Entries++
+		if c.report.Entries%checkCtxEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		cmp := -1
+		if !first {
+			cmp = c.cfg.CompareKeys(prevK, k)
+		}
+		switch {
+		case cmp < 0:
+			c.report.Keys++
+		case cmp > 0:
+			c.report.Keys++
+			c.violation(KeyOrder, k, v, "key is less than previous key %x", prevK)
+		case c.cfg.Flags&kv.DupSort == 0:
+			c.violation(KeyOrder, k, v, "duplicated key in not DupSort table")
+		case c.cfg.CompareDups(prevV, v) >= 0:
+			c.violation(DupOrder, k, v, "value is not greater than previous value %x", prevV)
+		}
+		if c.cfg.AutoDupSortKeysConversion {
+			c.checkAutoDupSort(k, v)
+		}
+		if c.name == kv.Sequence && len(v) != 8 {
+			c.violation(Sequence, k, v, "value must be 8 bytes, got %d", len(v))
+		}
+		prevK, prevV = append(prevK[:0], k...), append(prevV[:0], v...)
+		first = false
+	}
+	return nil
+}
+
+// checkAutoDupSort - stored entry must be decodable: key of DupFromLen bytes is stored as key of DupToLen bytes and value,
+// which starts with the rest of key. Only lengths can be checked - any bytes are valid key.
+func (c *tableChecker) checkAutoDupSort(k, v []byte) {
+	from, to := c.cfg.DupFromLen, c.cfg.DupToLen
+	switch {
+	case len(k) == to && len(v) < from-to:
+		c.violation(AutoDupSort, k, v, "value of %d bytes key must start with %d bytes of key, got %d bytes", to, from-to, len(v))
+	case len(k) == from && from != to:
+		c.violation(AutoDupSort, k, v, "key of %d bytes must be stored as %d bytes key", from, to)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func reverseCmp(k1, k2, v1, v2 []byte) int {
+	if k1 == nil {
+		return -bytes.Compare(v1, v2)
+	}
+	return -bytes.Compare(k1, k2)
+}
+
+func tableReport(t *testing.T, r *Report, name string) TableReport {
+	t.Helper()
+	for _, tr := range r.Tables {
+		if tr.Name == name {
+			return tr
+		}
+	}
+	t.Fatalf("table %s not in report", name)
+	return TableReport{}
+}
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	cfg := kv.TableCfg{
+		kv.Sequence: {},
+		"Plain":     {},
+		"DupSort":   {Flags: kv.DupSort},
+		"Auto":      {Flags: kv.DupSort, AutoDupSortKeysConversion: true, DupFromLen: 4, DupToLen: 2},
+		"Rev":       {KeyCmp: reverseCmp},
+	}
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(cfg).MustOpen()
+	defer db.Close()
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := uint32(0); i < 100; i++ {
+			k := binary.BigEndian.AppendUint32(nil, i)
+			for _, table := range []string{"Plain", "DupSort", "Auto", "Rev"} {
+				require.NoError(t, tx.Put(table, k, []byte{1}))
+			}
+			require.NoError(t, tx.Put("DupSort", k, []byte{2}))
+		}
+		_, err := tx.IncrementSequence("Plain", 100)
+		return err
+	}))
+
+	report, err := Check(ctx, db, Opts{Tables: cfg})
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%+v", report)
+	require.Len(t, report.Tables, 5)
+	require.Equal(t, TableReport{Name: "DupSort", Keys: 100, Entries: 200}, tableReport(t, report, "DupSort"))
+	require.Equal(t, TableReport{Name: "Auto", Keys: 1, Entries: 100}, tableReport(t, report, "Auto")) // all keys have same 2 bytes prefix
+	require.Equal(t, uint64(1), tableReport(t, report, kv.Sequence).Entries)
+
+	// without expected config flags are not checked: config of db is read from db
+	report, err = Check(ctx, db, Opts{Names: []string{"DupSort", "Plain"}})
+	require.NoError(t, err)
+	require.True(t, report.OK(), "%+v", report)
+	require.Len(t, report.Tables, 2)
+	require.Equal(t, TableReport{Name: "DupSort", Keys: 100, Entries: 200, Skipped: []CheckName{Flags}}, tableReport(t, report, "DupSort"))
+
+	// table which is not in db
+	report, err = Check(ctx, db, Opts{Tables: kv.TableCfg{"Plain": {}, "NoSuchTable": {}}})
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.True(t, tableReport(t, report, "NoSuchTable").Missing)
+}
+
+func TestCheckViolations(t *testing.T) {
+	ctx := context.Background()
+	// db is written with config, which differs from expected config passed to Check
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{
+		kv.Sequence: {},
+		"Rev":       {KeyCmp: reverseCmp},
+		"DupRev":    {Flags: kv.DupSort, DupCmp: reverseCmp},
+		"Auto":      {Flags: kv.DupSort},
+		"Flags":     {},
+	}).MustOpen()
+	defer db.Close()
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := byte(0); i < 5; i++ {
+			require.NoError(t, tx.Put("Rev", []byte{i}, []byte{i}))
+			require.NoError(t, tx.Put("DupRev", []byte{0}, []byte{i}))
+		}
+		require.NoError(t, tx.Put("Auto", []byte{1, 2}, []byte{3, 4, 5})) // ok
+		require.NoError(t, tx.Put("Auto", []byte{1, 3}, []byte{3}))       // value is shorter than key part
+		require.NoError(t, tx.Put("Auto", []byte{1, 4, 5, 6}, []byte{7})) // key isn't converted
+		require.NoError(t, tx.Put(kv.Sequence, []byte("Rev"), []byte{1, 2, 3, 4}))
+		return nil
+	}))
+
+	report, err := Check(ctx, db, Opts{MaxViolations: 2, Tables: kv.TableCfg{
+		kv.Sequence: {},
+		"Rev":       {},
+		"DupRev":    {Flags: kv.DupSort},
+		"Auto":      {Flags: kv.DupSort, AutoDupSortKeysConversion: true, DupFromLen: 4, DupToLen: 2},
+		"Flags":     {Flags: kv.DupSort},
+	}})
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.Equal(t, uint64(4+4+2+1+1), report.ViolationsCount)
+
+	rev := tableReport(t, report, "Rev")
+	require.Equal(t, uint64(4), rev.ViolationsCount)
+	require.Len(t, rev.Violations, 2)
+	require.Equal(t, Violation{Check: KeyOrder, Key: "03", Value: "03", Msg: "key is less than previous key 04"}, rev.Violations[0])
+
+	dupRev := tableReport(t, report, "DupRev")
+	require.Equal(t, uint64(4), dupRev.ViolationsCount)
+	require.Equal(t, DupOrder, dupRev.Violations[0].Check)
+	require.Equal(t, uint64(1), dupRev.Keys)
+
+	auto := tableReport(t, report, "Auto")
+	require.Equal(t, uint64(2), auto.ViolationsCount)
+	require.Equal(t, AutoDupSort, auto.Violations[0].Check)
+	require.Equal(t, "0103", auto.Violations[0].Key)
+	require.Equal(t, "01040506", auto.Violations[1].Key)
+
+	require.Equal(t, Sequence, tableReport(t, report, kv.Sequence).Violations[0].Check)
+	require.Equal(t, Flags, tableReport(t, report, "Flags").Violations[0].Check)
+
+	b, err := json.Marshal(report)
+	require.NoError(t, err)
+	var decoded Report
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, *report, decoded)
+}
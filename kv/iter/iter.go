@@ -97,9 +97,15 @@ type UnionKVIter struct {
 	yNextK, yNextV     []byte
 	limit              int
 	err                error
+	cmp                func(a, b []byte) int
 }
 
 func UnionKV(x, y KV, limit int) KV {
+	return UnionKVFunc(x, y, limit, bytes.Compare)
+}
+
+// UnionKVFunc - same as UnionKV, but keys order is defined by cmp - for tables with custom keys order
+func UnionKVFunc(x, y KV, limit int, cmp func(a, b []byte) int) KV {
 	if x == nil && y == nil {
 		return EmptyKV
 	}
@@ -109,7 +115,7 @@ func UnionKV(x, y KV, limit int) KV {
 	if y == nil {
 		return x
 	}
-	m := &UnionKVIter{x: x, y: y, limit: limit}
+	m := &UnionKVIter{x: x, y: y, limit: limit, cmp: cmp}
 	m.advanceX()
 	m.advanceY()
 	return m
@@ -141,7 +147,7 @@ func (m *UnionKVIter) Next() ([]byte, []byte, error) {
 	}
 	m.limit--
 	if m.xHasNext && m.yHasNext {
-		cmp := bytes.Compare(m.xNextK, m.yNextK)
+		cmp := m.cmp(m.xNextK, m.yNextK)
 		if cmp < 0 {
 			k, v, err := m.xNextK, m.xNextV, m.err
 			m.advanceX()
@@ -177,16 +183,22 @@ func (m *UnionKVIter) Close() {
 }
 
 // UnionUnary
-type UnionUnary[T constraints.Ordered] struct {
+type UnionUnary[T any] struct {
 	x, y           Unary[T]
 	asc            bool
 	xHas, yHas     bool
 	xNextK, yNextK T
 	err            error
 	limit          int
+	cmp            func(a, b T) int
 }
 
 func Union[T constraints.Ordered](x, y Unary[T], asc order.By, limit int) Unary[T] {
+	return UnionFunc(x, y, asc, limit, compareOrdered[T])
+}
+
+// UnionFunc - same as Union, but order is defined by cmp
+func UnionFunc[T any](x, y Unary[T], asc order.By, limit int, cmp func(a, b T) int) Unary[T] {
 	if x == nil && y == nil {
 		return &EmptyUnary[T]{}
 	}
@@ -202,7 +214,7 @@ func Union[T constraints.Ordered](x, y Unary[T], asc order.By, limit int) Unary[
 	if !y.HasNext() {
 		return x
 	}
-	m := &UnionUnary[T]{x: x, y: y, asc: bool(asc), limit: limit}
+	m := &UnionUnary[T]{x: x, y: y, asc: bool(asc), limit: limit, cmp: cmp}
 	m.advanceX()
 	m.advanceY()
 	return m
@@ -230,8 +242,14 @@ func (m *UnionUnary[T]) advanceY() {
 	}
 }
 
-func (m *UnionUnary[T]) less() bool {
-	return (m.asc && m.xNextK < m.yNextK) || (!m.asc && m.xNextK > m.yNextK)
+func compareOrdered[T constraints.Ordered](a, b T) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
 }
 
 func (m *UnionUnary[T]) Next() (res T, err error) {
@@ -240,11 +258,12 @@ func (m *UnionUnary[T]) Next() (res T, err error) {
 	}
 	m.limit--
 	if m.xHas && m.yHas {
-		if m.less() {
+		cmp := m.cmp(m.xNextK, m.yNextK)
+		if (m.asc && cmp < 0) || (!m.asc && cmp > 0) {
 			k, err := m.xNextK, m.err
 			m.advanceX()
 			return k, err
-		} else if m.xNextK == m.yNextK {
+		} else if cmp == 0 {
 			k, err := m.xNextK, m.err
 			m.advanceX()
 			m.advanceY()
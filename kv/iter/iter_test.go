@@ -51,6 +51,15 @@ func TestUnion(t *testing.T) {
 		require.Equal(t, []uint64{8, 7}, res)
 
 	})
+	t.Run("custom order", func(t *testing.T) {
+		byLen := func(a, b string) int { return len(a) - len(b) }
+		s1 := iter.Array[string]([]string{"a", "ccc", "dddd"})
+		s2 := iter.Array[string]([]string{"bb", "eee"})
+		s3 := iter.UnionFunc[string](s1, s2, order.Asc, -1, byLen)
+		res, err := iter.ToArr[string](s3)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "bb", "ccc", "dddd"}, res) // "eee" has same order as "ccc" - 1-st stream wins
+	})
 	t.Run("empty left", func(t *testing.T) {
 		s1 := iter.EmptyU64
 		s2 := iter.Array[uint64]([]uint64{2, 3, 7, 8})
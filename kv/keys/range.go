@@ -0,0 +1,50 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package keys
+
+// PrefixRange - [from, to) for tx.Range: all tuples which start with elements of prefix and have more elements.
+// Tuple equal to prefix is not in range.
+func PrefixRange(prefix Tuple) (from, to []byte) {
+	p := prefix.Pack()
+	return append(p[:len(p):len(p)], 0x00), append(p[:len(p):len(p)], 0xFF)
+}
+
+// PrefixRangeDescend - from, to for tx.RangeDescend: same tuples as PrefixRange, in descending order
+func PrefixRangeDescend(prefix Tuple) (from, to []byte) {
+	p := prefix.Pack()
+	return append(p[:len(p):len(p)], 0xFF), append([]byte{}, p...)
+}
+
+// Range - [from, to) for tx.Range: tuples which are >= from and < to. If inclusive, tuples which start with elements
+// of `to` are in range too. Empty from/to means StartOfTable/EndOfTable.
+func Range(from, to Tuple, inclusive bool) (fromKey, toKey []byte) {
+	toKey = to.Pack()
+	if inclusive {
+		toKey = append(toKey, 0xFF)
+	}
+	return from.Pack(), toKey
+}
+
+// RangeDescend - from, to for tx.RangeDescend: tuples which are <= from and > to, in descending order. If inclusive,
+// tuples which start with elements of `from` are in range too. Empty from/to means EndOfTable/StartOfTable.
+func RangeDescend(from, to Tuple, inclusive bool) (fromKey, toKey []byte) {
+	fromKey = from.Pack()
+	if inclusive {
+		fromKey = append(fromKey, 0xFF)
+	}
+	return fromKey, to.Pack()
+}
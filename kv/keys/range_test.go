@@ -0,0 +1,87 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package keys_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/keys"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func TestRanges(t *testing.T) {
+	ctx := context.Background()
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"T": {}}).MustOpen()
+	defer db.Close()
+
+	all := []keys.Tuple{
+		{int64(1)},
+		{int64(1), "a"},
+		{int64(1), "a", int64(-5)},
+		{int64(1), "b"},
+		{int64(2)},
+		{int64(2), "a"},
+		{int64(3), "a"},
+	}
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for _, k := range all {
+			if err := tx.Put("T", k.Pack(), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	collect := func(it iter.KV, err error) (res []keys.Tuple) {
+		require.NoError(t, err)
+		for it.HasNext() {
+			k, _, err := it.Next()
+			require.NoError(t, err)
+			tuple, err := keys.Unpack(k)
+			require.NoError(t, err)
+			res = append(res, tuple)
+		}
+		return res
+	}
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		from, to := keys.PrefixRange(keys.Tuple{int64(1)})
+		require.Equal(t, all[1:4], collect(tx.Range("T", from, to)))
+		from, to = keys.PrefixRangeDescend(keys.Tuple{int64(1)})
+		require.Equal(t, []keys.Tuple{all[3], all[2], all[1]}, collect(tx.RangeDescend("T", from, to, -1)))
+		from, to = keys.PrefixRange(keys.Tuple{int64(1), "a"})
+		require.Equal(t, all[2:3], collect(tx.Range("T", from, to)))
+
+		from, to = keys.Range(keys.Tuple{int64(1), "a"}, keys.Tuple{int64(2)}, false)
+		require.Equal(t, all[1:4], collect(tx.Range("T", from, to)))
+		from, to = keys.Range(keys.Tuple{int64(1), "a"}, keys.Tuple{int64(2)}, true)
+		require.Equal(t, all[1:6], collect(tx.Range("T", from, to)))
+		from, to = keys.Range(keys.Tuple{int64(2)}, keys.Tuple{}, false)
+		require.Equal(t, all[4:], collect(tx.Range("T", from, to)))
+
+		from, to = keys.RangeDescend(keys.Tuple{int64(2)}, keys.Tuple{int64(1), "a"}, false)
+		require.Equal(t, []keys.Tuple{all[4], all[3], all[2]}, collect(tx.RangeDescend("T", from, to, -1)))
+		from, to = keys.RangeDescend(keys.Tuple{int64(2)}, keys.Tuple{int64(1), "a"}, true)
+		require.Equal(t, []keys.Tuple{all[5], all[4], all[3], all[2]}, collect(tx.RangeDescend("T", from, to, -1)))
+		return nil
+	}))
+}
@@ -0,0 +1,246 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package keys - order-preserving encoding of tuples into keys of tables, in spirit of FoundationDB tuple layer:
+// bytes.Compare of packed tuples gives same order as element-wise comparison of tuples. Elements of different types
+// are ordered by type: nil < []byte < string < nested Tuple < integers < false < true.
+package keys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Tuple - elements can be: nil, []byte, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32,
+// uint64, Tuple. Unpack returns integers as int64, or as uint64 if value doesn't fit int64.
+type Tuple []any
+
+var ErrMalformed = errors.New("keys: malformed tuple")
+
+const (
+	nilCode    = 0x00
+	bytesCode  = 0x01
+	stringCode = 0x02
+	nestedCode = 0x05
+	intZero    = 0x14 // code of 0, code of positive integer is intZero+len(bytes), of negative is intZero-len(bytes)
+	falseCode  = 0x26
+	trueCode   = 0x27
+
+	escape = 0xFF // 0x00 inside of []byte, string and nested Tuple is followed by escape
+)
+
+// Pack - encodes t, panics on element of unsupported type
+func (t Tuple) Pack() []byte {
+	b, err := t.AppendPacked(nil)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// AppendPacked - appends encoded t to buf
+func (t Tuple) AppendPacked(buf []byte) ([]byte, error) {
+	for i, e := range t {
+		var err error
+		if buf, err = appendElement(buf, e, false); err != nil {
+			return nil, fmt.Errorf("keys: element %d: %w", i, err)
+		}
+	}
+	return buf, nil
+}
+
+func appendElement(buf []byte, e any, nested bool) ([]byte, error) {
+	switch e := e.(type) {
+	case nil:
+		if nested {
+			return append(buf, nilCode, escape), nil
+		}
+		return append(buf, nilCode), nil
+	case []byte:
+		return AppendEscaped(append(buf, bytesCode), e), nil
+	case string:
+		return AppendEscaped(append(buf, stringCode), []byte(e)), nil
+	case Tuple:
+		buf = append(buf, nestedCode)
+		for i, ne := range e {
+			var err error
+			if buf, err = appendElement(buf, ne, true); err != nil {
+				return nil, fmt.Errorf("nested element %d: %w", i, err)
+			}
+		}
+		return append(buf, nilCode), nil
+	case bool:
+		if e {
+			return append(buf, trueCode), nil
+		}
+		return append(buf, falseCode), nil
+	case int:
+		return appendInt(buf, int64(e)), nil
+	case int8:
+		return appendInt(buf, int64(e)), nil
+	case int16:
+		return appendInt(buf, int64(e)), nil
+	case int32:
+		return appendInt(buf, int64(e)), nil
+	case int64:
+		return appendInt(buf, e), nil
+	case uint:
+		return appendUint(buf, uint64(e)), nil
+	case uint8:
+		return appendUint(buf, uint64(e)), nil
+	case uint16:
+		return appendUint(buf, uint64(e)), nil
+	case uint32:
+		return appendUint(buf, uint64(e)), nil
+	case uint64:
+		return appendUint(buf, e), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", e)
+	}
+}
+
+// AppendEscaped - appends b with 0x00 escaped as 0x00 0xFF, and terminator 0x00: bytes.Compare of escaped values gives
+// same order as of values, and escaped value can be followed by other encoded values. Used by typed.String.
+func AppendEscaped(buf, b []byte) []byte {
+	for _, c := range b {
+		buf = append(buf, c)
+		if c == 0x00 {
+			buf = append(buf, escape)
+		}
+	}
+	return append(buf, 0x00)
+}
+
+// appendUint - big-endian bytes of v without leading zeros
+func appendUint(buf []byte, v uint64) []byte {
+	n := (bits.Len64(v) + 7) / 8
+	buf = append(buf, byte(intZero+n))
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[8-n:]...)
+}
+
+// appendInt - negative v is encoded as one's complement of |v|: more bytes and smaller complement for smaller v
+func appendInt(buf []byte, v int64) []byte {
+	if v >= 0 {
+		return appendUint(buf, uint64(v))
+	}
+	abs := uint64(-(v + 1)) + 1 // no overflow for MinInt64
+	n := (bits.Len64(abs) + 7) / 8
+	buf = append(buf, byte(intZero-n))
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], ^abs)
+	return append(buf, b[8-n:]...)
+}
+
+// Unpack - decodes tuple packed by Tuple.Pack
+func Unpack(b []byte) (Tuple, error) {
+	t, _, err := unpack(b, false)
+	return t, err
+}
+
+// unpack - decodes elements until end of b, or until terminator of nested tuple
+func unpack(b []byte, nested bool) (t Tuple, n int, err error) {
+	t = Tuple{}
+	for n < len(b) {
+		code := b[n]
+		n++
+		switch {
+		case code == nilCode:
+			if !nested {
+				t = append(t, nil)
+				continue
+			}
+			if n < len(b) && b[n] == escape {
+				t = append(t, nil)
+				n++
+				continue
+			}
+			return t, n, nil // end of nested tuple
+		case code == bytesCode || code == stringCode:
+			s, read, err := Unescape(b[n:])
+			if err != nil {
+				return nil, 0, err
+			}
+			n += read
+			if code == stringCode {
+				t = append(t, string(s))
+			} else {
+				t = append(t, s)
+			}
+		case code == nestedCode:
+			nt, read, err := unpack(b[n:], true)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += read
+			t = append(t, nt)
+		case code >= intZero-8 && code <= intZero+8:
+			size := int(code) - intZero
+			if size < 0 {
+				size = -size
+			}
+			if n+size > len(b) {
+				return nil, 0, fmt.Errorf("%w: integer of %d bytes at %d", ErrMalformed, size, n)
+			}
+			var buf [8]byte
+			copy(buf[8-size:], b[n:n+size])
+			v := binary.BigEndian.Uint64(buf[:])
+			n += size
+			switch {
+			case code < intZero:
+				abs := ^v & (math.MaxUint64 >> (64 - 8*size)) // size is > 0 for negative integers
+				t = append(t, -int64(abs-1)-1)
+			case v > math.MaxInt64:
+				t = append(t, v)
+			default:
+				t = append(t, int64(v))
+			}
+		case code == falseCode:
+			t = append(t, false)
+		case code == trueCode:
+			t = append(t, true)
+		default:
+			return nil, 0, fmt.Errorf("%w: unknown type code %#x at %d", ErrMalformed, code, n-1)
+		}
+	}
+	if nested {
+		return nil, 0, fmt.Errorf("%w: no terminator of nested tuple", ErrMalformed)
+	}
+	return t, n, nil
+}
+
+// Unescape - decodes value appended by AppendEscaped: returns bytes until terminator and number of read bytes, including
+// terminator
+func Unescape(b []byte) ([]byte, int, error) {
+	res := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0x00 {
+			res = append(res, b[i])
+			continue
+		}
+		if i+1 < len(b) && b[i+1] == escape {
+			res = append(res, 0x00)
+			i++
+			continue
+		}
+		return res, i + 1, nil
+	}
+	return nil, 0, fmt.Errorf("%w: no terminator of []byte or string", ErrMalformed)
+}
@@ -0,0 +1,94 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package keys
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackOrder(t *testing.T) {
+	sorted := []Tuple{
+		{},
+		{nil},
+		{nil, int64(1)},
+		{[]byte{}},
+		{[]byte{0x00}},
+		{[]byte{0x00, 0x00}},
+		{[]byte{0x00, 0xFF}},
+		{[]byte("a")},
+		{""},
+		{"a"},
+		{"a", nil},
+		{"a", int64(-1)},
+		{"a", int64(0)},
+		{"a\x00"},
+		{"ab"},
+		{Tuple{}},
+		{Tuple{nil}},
+		{Tuple{nil, "a"}},
+		{Tuple{"a"}},
+		{Tuple{"a", Tuple{int64(1)}}},
+		{Tuple{"a", int64(1)}},
+		{int64(math.MinInt64)},
+		{int64(-1 << 32)},
+		{int64(-65536)},
+		{int64(-256)},
+		{int64(-255)},
+		{int64(-1)},
+		{int64(0)},
+		{int64(1)},
+		{int64(255)},
+		{int64(256)},
+		{int64(math.MaxInt64)},
+		{uint64(math.MaxInt64 + 1)},
+		{uint64(math.MaxUint64)},
+		{false},
+		{true},
+		{true, false},
+	}
+	for i, tuple := range sorted {
+		packed := tuple.Pack()
+		unpacked, err := Unpack(packed)
+		require.NoError(t, err)
+		require.Equal(t, tuple, unpacked, "%d", i)
+		if i > 0 {
+			require.Equal(t, -1, bytes.Compare(sorted[i-1].Pack(), packed), "%v < %v", sorted[i-1], tuple)
+		}
+	}
+}
+
+func TestPackIntegerTypes(t *testing.T) {
+	packed := Tuple{int8(-3), int16(-3), int32(-3), -3, uint8(3), uint16(3), uint32(3), uint(3)}.Pack()
+	unpacked, err := Unpack(packed)
+	require.NoError(t, err)
+	require.Equal(t, Tuple{int64(-3), int64(-3), int64(-3), int64(-3), int64(3), int64(3), int64(3), int64(3)}, unpacked)
+}
+
+func TestPackErrors(t *testing.T) {
+	_, err := Tuple{1.5}.AppendPacked(nil)
+	require.ErrorContains(t, err, "unsupported type float64")
+	require.Panics(t, func() { Tuple{Tuple{struct{}{}}}.Pack() })
+
+	for _, b := range [][]byte{{0x02, 'a'}, {0x05, 0x15, 0x01}, {0x16, 0x01}, {0x30}} {
+		_, err = Unpack(b)
+		require.ErrorIs(t, err, ErrMalformed, "%x", b)
+	}
+}
@@ -19,11 +19,12 @@ package kv
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 	"unsafe"
 
 	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
 	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
-	"github.com/uncommoncorrelation/go-mdbx-db/metrics"
 )
 
 //Variables Naming:
@@ -82,54 +83,45 @@ const Unlim int = -1
 var (
 	// TODO(AD): Remove chaindata specific
 	ErrAttemptToDeleteNonDeprecatedBucket = errors.New("only buckets from dbutils.ChaindataDeprecatedTables can be deleted")
-
-	DbSize    = metrics.GetOrCreateGauge(`db_size`)    //nolint
-	TxLimit   = metrics.GetOrCreateGauge(`tx_limit`)   //nolint
-	TxSpill   = metrics.GetOrCreateGauge(`tx_spill`)   //nolint
-	TxUnspill = metrics.GetOrCreateGauge(`tx_unspill`) //nolint
-	TxDirty   = metrics.GetOrCreateGauge(`tx_dirty`)   //nolint
-
-	DbCommitPreparation = metrics.GetOrCreateSummary(`db_commit_seconds{phase="preparation"}`) //nolint
-	//DbGCWallClock       = metrics.GetOrCreateSummary(`db_commit_seconds{phase="gc_wall_clock"}`) //nolint
-	//DbGCCpuTime         = metrics.GetOrCreateSummary(`db_commit_seconds{phase="gc_cpu_time"}`)   //nolint
-	//DbCommitAudit       = metrics.GetOrCreateSummary(`db_commit_seconds{phase="audit"}`)         //nolint
-	DbCommitWrite  = metrics.GetOrCreateSummary(`db_commit_seconds{phase="write"}`)  //nolint
-	DbCommitSync   = metrics.GetOrCreateSummary(`db_commit_seconds{phase="sync"}`)   //nolint
-	DbCommitEnding = metrics.GetOrCreateSummary(`db_commit_seconds{phase="ending"}`) //nolint
-	DbCommitTotal  = metrics.GetOrCreateSummary(`db_commit_seconds{phase="total"}`)  //nolint
-
-	DbPgopsNewly   = metrics.GetOrCreateGauge(`db_pgops{phase="newly"}`)   //nolint
-	DbPgopsCow     = metrics.GetOrCreateGauge(`db_pgops{phase="cow"}`)     //nolint
-	DbPgopsClone   = metrics.GetOrCreateGauge(`db_pgops{phase="clone"}`)   //nolint
-	DbPgopsSplit   = metrics.GetOrCreateGauge(`db_pgops{phase="split"}`)   //nolint
-	DbPgopsMerge   = metrics.GetOrCreateGauge(`db_pgops{phase="merge"}`)   //nolint
-	DbPgopsSpill   = metrics.GetOrCreateGauge(`db_pgops{phase="spill"}`)   //nolint
-	DbPgopsUnspill = metrics.GetOrCreateGauge(`db_pgops{phase="unspill"}`) //nolint
-	DbPgopsWops    = metrics.GetOrCreateGauge(`db_pgops{phase="wops"}`)    //nolint
+	// ErrNestedTxUnsupported - returned by NestedRwTx.BeginNested when db can't start nested transaction, and by
+	// BucketMigrator methods which create or drop tables in nested transaction
+	ErrNestedTxUnsupported = errors.New("nested transactions are not supported")
+	// ErrTxExpired - matches any TxExpiredError
+	ErrTxExpired = errors.New("read transaction expired")
+	// ErrLabelInUse - db is opened with label of other open db, see AcquireDBMetrics
+	ErrLabelInUse = errors.New("db label already in use")
+	// ErrCursorClosed - cursor or stream is used after its Close, or after end of its tx
+	ErrCursorClosed = errors.New("cursor closed")
+
+	// Deprecated: metrics are scoped by db label, see DBMetrics. These are metrics of label InMem.
+	DbSize    = defaultDBMetrics.DbSize    //nolint
+	TxLimit   = defaultDBMetrics.TxLimit   //nolint
+	TxSpill   = defaultDBMetrics.TxSpill   //nolint
+	TxUnspill = defaultDBMetrics.TxUnspill //nolint
+	TxDirty   = defaultDBMetrics.TxDirty   //nolint
+
+	// Deprecated: commit metrics are labelled by db, see DBCommitMetrics. These are commit metrics of label InMem.
+	DbCommitPreparation = defaultDBCommitMetrics.Preparation //nolint
+	DbCommitWrite       = defaultDBCommitMetrics.Write       //nolint
+	DbCommitSync        = defaultDBCommitMetrics.Sync        //nolint
+	DbCommitEnding      = defaultDBCommitMetrics.Ending      //nolint
+	DbCommitTotal       = defaultDBCommitMetrics.Total       //nolint
+
+	// Deprecated: see DbSize
+	DbPgopsNewly   = defaultDBMetrics.DbPgopsNewly   //nolint
+	DbPgopsCow     = defaultDBMetrics.DbPgopsCow     //nolint
+	DbPgopsClone   = defaultDBMetrics.DbPgopsClone   //nolint
+	DbPgopsSplit   = defaultDBMetrics.DbPgopsSplit   //nolint
+	DbPgopsMerge   = defaultDBMetrics.DbPgopsMerge   //nolint
+	DbPgopsSpill   = defaultDBMetrics.DbPgopsSpill   //nolint
+	DbPgopsUnspill = defaultDBMetrics.DbPgopsUnspill //nolint
+	DbPgopsWops    = defaultDBMetrics.DbPgopsWops    //nolint
 	/*
 		DbPgopsPrefault = metrics.NewCounter(`db_pgops{phase="prefault"}`) //nolint
 		DbPgopsMinicore = metrics.NewCounter(`db_pgops{phase="minicore"}`) //nolint
 		DbPgopsMsync    = metrics.NewCounter(`db_pgops{phase="msync"}`)    //nolint
 		DbPgopsFsync    = metrics.NewCounter(`db_pgops{phase="fsync"}`)    //nolint
 		DbMiLastPgNo    = metrics.NewCounter(`db_mi_last_pgno`)            //nolint
-
-		DbGcWorkRtime    = metrics.GetOrCreateSummary(`db_gc_seconds{phase="work_rtime"}`) //nolint
-		DbGcWorkRsteps   = metrics.NewCounter(`db_gc{phase="work_rsteps"}`)                //nolint
-		DbGcWorkRxpages  = metrics.NewCounter(`db_gc{phase="work_rxpages"}`)               //nolint
-		DbGcSelfRtime    = metrics.GetOrCreateSummary(`db_gc_seconds{phase="self_rtime"}`) //nolint
-		DbGcSelfXtime    = metrics.GetOrCreateSummary(`db_gc_seconds{phase="self_xtime"}`) //nolint
-		DbGcWorkXtime    = metrics.GetOrCreateSummary(`db_gc_seconds{phase="work_xtime"}`) //nolint
-		DbGcSelfRsteps   = metrics.NewCounter(`db_gc{phase="self_rsteps"}`)                //nolint
-		DbGcWloops       = metrics.NewCounter(`db_gc{phase="wloop"}`)                      //nolint
-		DbGcCoalescences = metrics.NewCounter(`db_gc{phase="coalescences"}`)               //nolint
-		DbGcWipes        = metrics.NewCounter(`db_gc{phase="wipes"}`)                      //nolint
-		DbGcFlushes      = metrics.NewCounter(`db_gc{phase="flushes"}`)                    //nolint
-		DbGcKicks        = metrics.NewCounter(`db_gc{phase="kicks"}`)                      //nolint
-		DbGcWorkMajflt   = metrics.NewCounter(`db_gc{phase="work_majflt"}`)                //nolint
-		DbGcSelfMajflt   = metrics.NewCounter(`db_gc{phase="self_majflt"}`)                //nolint
-		DbGcWorkCounter  = metrics.NewCounter(`db_gc{phase="work_counter"}`)               //nolint
-		DbGcSelfCounter  = metrics.NewCounter(`db_gc{phase="self_counter"}`)               //nolint
-		DbGcSelfXpages   = metrics.NewCounter(`db_gc{phase="self_xpages"}`)                //nolint
 	*/
 
 	//DbGcWorkPnlMergeTime   = metrics.GetOrCreateSummary(`db_gc_pnl_seconds{phase="work_merge_time"}`) //nolint
@@ -139,12 +131,25 @@ var (
 	//DbGcSelfPnlMergeVolume = metrics.NewCounter(`db_gc_pnl{phase="self_merge_volume"}`)               //nolint
 	//DbGcSelfPnlMergeCalls  = metrics.NewCounter(`db_gc_pnl{phase="slef_merge_calls"}`)                //nolint
 
-	GcLeafMetric     = metrics.GetOrCreateGauge(`db_gc_leaf`)     //nolint
-	GcOverflowMetric = metrics.GetOrCreateGauge(`db_gc_overflow`) //nolint
-	GcPagesMetric    = metrics.GetOrCreateGauge(`db_gc_pages`)    //nolint
+	// Deprecated: see DbSize
+	GcLeafMetric     = defaultDBMetrics.GcLeaf     //nolint
+	GcOverflowMetric = defaultDBMetrics.GcOverflow //nolint
+	GcPagesMetric    = defaultDBMetrics.GcPages    //nolint
 
 )
 
+// TxExpiredError - read transaction lived longer than allowed by db and was reset. Transaction can only be rolled back.
+type TxExpiredError struct {
+	Label Label
+	Lived time.Duration
+	Limit time.Duration
+}
+
+func (e *TxExpiredError) Error() string {
+	return fmt.Sprintf("%s: label: %s, lived %s, limit %s", ErrTxExpired, e.Label, e.Lived, e.Limit)
+}
+func (e *TxExpiredError) Is(err error) bool { return err == ErrTxExpired }
+
 type DBVerbosityLvl int8
 
 type Label string
@@ -389,6 +394,46 @@ type RwTx interface {
 	CollectMetrics()
 }
 
+// RenewableTx - read-only Tx which can move to the latest snapshot of db without being closed: cheaper than
+// Rollback and BeginRo. Cursors and streams of tx are closed by Renew.
+type RenewableTx interface {
+	Tx
+	Renew() error
+}
+
+// NestedRwTx - RwTx which supports nested (child) transactions: savepoints, which can be rolled back without rolling
+// back parent. Parent must not be used until nested tx is committed or rolled back.
+type NestedRwTx interface {
+	RwTx
+	BeginNested() (RwTx, error)
+}
+
+// Savepoint - runs f in nested transaction of tx: changes of f are applied to tx only if f returns nil.
+// Returns ErrNestedTxUnsupported if tx doesn't implement NestedRwTx.
+func Savepoint(tx RwTx, f func(tx RwTx) error) error {
+	ntx, ok := tx.(NestedRwTx)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNestedTxUnsupported, tx)
+	}
+	nested, err := ntx.BeginNested()
+	if err != nil {
+		return err
+	}
+	defer nested.Rollback()
+	if err := f(nested); err != nil {
+		return err
+	}
+	return nested.Commit()
+}
+
+// RawTx - Tx which gives access to tables as they are stored in db: to flags of table and to entries without
+// AutoDupSortKeysConversion. Used by tools which verify db.
+type RawTx interface {
+	Tx
+	TableFlags(table string) (TableFlags, error)
+	RawCursor(table string) (Cursor, error)
+}
+
 type BucketMigratorRO interface {
 	ListBuckets() ([]string, error)
 }
@@ -400,6 +445,10 @@ type BucketMigrator interface {
 	CreateBucket(string) error
 	ExistsBucket(string) (bool, error)
 	ClearBucket(string) error
+	// RenameBucket - moves all entries and config of table `from` to table `to`, `from` is dropped
+	RenameBucket(from, to string) error
+	// CopyBucket - copies all entries of table src to empty table dst, preserving DupSort values
+	CopyBucket(src, dst string) error
 }
 
 // Cursor - class for navigating through a database
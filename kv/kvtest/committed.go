@@ -0,0 +1,355 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+// Tests of this file change data committed by previous tx: db which keeps changes of tx over committed data (like
+// MemoryMutation does) must merge both.
+
+// committedCase - rw tx over 4 committed entries of plainTable
+func committedCase(t *testing.T, newDB Factory) (kv.RwDB, kv.RwTx) {
+	t.Helper()
+	db := newDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, e := range [][2]string{{"AAAA", "value"}, {"CAAA", "value1"}, {"CBAA", "value2"}, {"CCAA", "value3"}} {
+			if err := tx.Put(plainTable, []byte(e[0]), []byte(e[1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return db, beginRw(t, db)
+}
+
+// committedDupCase - rw tx over 2 committed keys with 2 values each in dupTable
+func committedDupCase(t *testing.T, newDB Factory) (kv.RwDB, kv.RwTx) {
+	t.Helper()
+	db := newDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, e := range [][2]string{{"key1", "value1.1"}, {"key3", "value3.1"}, {"key1", "value1.3"}, {"key3", "value3.3"}} {
+			if err := tx.Put(dupTable, []byte(e[0]), []byte(e[1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return db, beginRw(t, db)
+}
+
+// committedEntries - entries of table seen by new tx, after commit of tx
+func committedEntries(t *testing.T, db kv.RwDB, tx kv.RwTx, table string) (res []string) {
+	t.Helper()
+	require.NoError(t, tx.Commit())
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		res = entries(t, tx, table)
+		return nil
+	}))
+	return res
+}
+
+func testCommittedLast(t *testing.T, newDB Factory) {
+	_, tx := committedCase(t, newDB)
+	c, err := tx.Cursor(plainTable)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// last entry is committed one
+	require.NoError(t, tx.Put(plainTable, []byte("BAAA"), []byte("value4")))
+	require.NoError(t, tx.Put(plainTable, []byte("BCAA"), []byte("value5")))
+	k, v, err := c.Last()
+	require.NoError(t, err)
+	require.Equal(t, "CCAA=value3", string(k)+"="+string(v))
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	require.Nil(t, k)
+	require.Nil(t, v)
+
+	// last entry is written by tx
+	require.NoError(t, tx.Put(plainTable, []byte("DCAA"), []byte("value6")))
+	k, v, err = c.Last()
+	require.NoError(t, err)
+	require.Equal(t, "DCAA=value6", string(k)+"="+string(v))
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	require.Nil(t, k)
+}
+
+func testCommittedDelete(t *testing.T, newDB Factory) {
+	db, tx := committedCase(t, newDB)
+	require.NoError(t, tx.Put(plainTable, []byte("BAAA"), []byte("value4")))
+	require.NoError(t, tx.Put(plainTable, []byte("DCAA"), []byte("value5")))
+	require.NoError(t, tx.Put(plainTable, []byte("AAAA"), []byte("value6")))
+	require.NoError(t, tx.Delete(plainTable, []byte("BAAA")))
+	require.NoError(t, tx.Delete(plainTable, []byte("CBAA")))
+
+	c, err := tx.Cursor(plainTable)
+	require.NoError(t, err)
+	defer c.Close()
+	for _, key := range []string{"BAAA", "CBAA"} {
+		k, v, err := c.SeekExact([]byte(key))
+		require.NoError(t, err)
+		require.Nil(t, k)
+		require.Nil(t, v)
+	}
+	has, err := tx.Has(plainTable, []byte("CBAA"))
+	require.NoError(t, err)
+	require.False(t, has)
+
+	expected := []string{"AAAA=value6", "CAAA=value1", "CCAA=value3", "DCAA=value5"}
+	require.Equal(t, expected, entries(t, tx, plainTable))
+	require.Equal(t, expected, committedEntries(t, db, tx, plainTable))
+}
+
+func testCommittedWalk(t *testing.T, newDB Factory) {
+	_, tx := committedCase(t, newDB)
+	require.NoError(t, tx.Put(plainTable, []byte("FCAA"), []byte("value5")))
+
+	var res []string
+	walker := func(k, v []byte) error {
+		res = append(res, string(k)+"="+string(v))
+		return nil
+	}
+	walk := func(f func() error) []string {
+		t.Helper()
+		res = nil
+		require.NoError(t, f())
+		return res
+	}
+
+	require.Nil(t, walk(func() error { return tx.ForEach(plainTable, []byte("XYAZ"), walker) }))
+	require.Equal(t, []string{"CCAA=value3", "FCAA=value5"},
+		walk(func() error { return tx.ForEach(plainTable, []byte("CC"), walker) }))
+	require.Equal(t, []string{"AAAA=value", "CAAA=value1", "CBAA=value2", "CCAA=value3", "FCAA=value5"},
+		walk(func() error { return tx.ForEach(plainTable, []byte("A"), walker) }))
+
+	require.Nil(t, walk(func() error { return tx.ForPrefix(plainTable, []byte("AB"), walker) }))
+	require.Equal(t, []string{"AAAA=value"},
+		walk(func() error { return tx.ForPrefix(plainTable, []byte("AAAA"), walker) }))
+	require.Equal(t, []string{"CAAA=value1", "CBAA=value2", "CCAA=value3"},
+		walk(func() error { return tx.ForPrefix(plainTable, []byte("C"), walker) }))
+
+	require.Equal(t, []string{"CAAA=value1", "CBAA=value2", "CCAA=value3"},
+		walk(func() error { return tx.ForAmount(plainTable, []byte("C"), 3, walker) }))
+	require.Equal(t, []string{"CAAA=value1", "CBAA=value2", "CCAA=value3", "FCAA=value5"},
+		walk(func() error { return tx.ForAmount(plainTable, []byte("C"), 10, walker) }))
+}
+
+func testCommittedClear(t *testing.T, newDB Factory) {
+	db, tx := committedCase(t, newDB)
+	require.NoError(t, tx.ClearBucket(plainTable))
+
+	for _, key := range []string{"A", "AAAA"} {
+		v, err := tx.GetOne(plainTable, []byte(key))
+		require.NoError(t, err)
+		require.Nil(t, v)
+	}
+
+	c, err := tx.RwCursor(plainTable)
+	require.NoError(t, err)
+	defer c.Close()
+	k, v, err := c.SeekExact([]byte("AAAA"))
+	require.NoError(t, err)
+	require.Nil(t, k)
+	require.Nil(t, v)
+
+	require.NoError(t, c.Put([]byte("AAAA"), []byte("valueX")))
+	k, v, err = c.SeekExact([]byte("AAAA"))
+	require.NoError(t, err)
+	require.Equal(t, "AAAA=valueX", string(k)+"="+string(v))
+	k, v, err = c.SeekExact([]byte("CAAA"))
+	require.NoError(t, err)
+	require.Nil(t, k)
+	require.Nil(t, v)
+
+	require.NoError(t, tx.Put(plainTable, []byte("BBBB"), []byte("value5")))
+	k, v, err = c.First()
+	require.NoError(t, err)
+	require.Equal(t, "AAAA=valueX", string(k)+"="+string(v))
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	require.Equal(t, "BBBB=value5", string(k)+"="+string(v))
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	require.Nil(t, k)
+
+	require.Equal(t, []string{"AAAA=valueX", "BBBB=value5"}, committedEntries(t, db, tx, plainTable))
+}
+
+func testCommittedSequence(t *testing.T, newDB Factory) {
+	db := newDB(t)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		_, err := tx.IncrementSequence(plainTable, 5)
+		return err
+	}))
+	tx := beginRw(t, db)
+	i, err := tx.IncrementSequence(plainTable, 12)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), i)
+	i, err = tx.ReadSequence(plainTable)
+	require.NoError(t, err)
+	require.Equal(t, uint64(17), i)
+	require.NoError(t, tx.Commit())
+
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		i, err := tx.ReadSequence(plainTable)
+		require.NoError(t, err)
+		require.Equal(t, uint64(17), i)
+		return nil
+	}))
+}
+
+func testCommittedDupSort(t *testing.T, newDB Factory) {
+	db, tx := committedDupCase(t, newDB)
+	c, err := tx.RwCursorDupSort(dupTable)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, tx.Put(dupTable, []byte("key1"), []byte("value1.2")))
+	require.NoError(t, tx.Put(dupTable, []byte("key2"), []byte("value2.1")))
+	require.NoError(t, tx.Put(dupTable, []byte("key2"), []byte("value2.2")))
+
+	k, v, err := c.First()
+	require.NoError(t, err)
+	keys, values := iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key1", "key1", "key2", "key2", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.2", "value1.3", "value2.1", "value2.2", "value3.1", "value3.3"}, values)
+
+	k, _, err = c.NextNoDup()
+	require.NoError(t, err)
+	require.Equal(t, []byte("key2"), k)
+	k, _, err = c.NextNoDup()
+	require.NoError(t, err)
+	require.Equal(t, []byte("key3"), k)
+	count, err := c.CountDuplicates()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), count)
+
+	require.NoError(t, c.Put([]byte("key3"), []byte("value3.2")))
+	v, err = c.SeekBothRange([]byte("key4"), []byte("value1.2"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = c.SeekBothRange([]byte("key3"), []byte("value3.15"))
+	require.NoError(t, err)
+	require.Equal(t, "value3.2", string(v))
+
+	k, _, err = c.SeekExact([]byte("key3"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key3"), k)
+	require.NoError(t, c.DeleteCurrentDuplicates())
+	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.1")))
+
+	expected := []string{"key1=value1.2", "key1=value1.3", "key2=value2.1", "key2=value2.2"}
+	require.Equal(t, expected, entries(t, tx, dupTable))
+	require.Equal(t, expected, committedEntries(t, db, tx, dupTable))
+}
+
+// testMultipleBuckets - deletes of one table don't affect another one, deleted key is skipped by Seek
+func testMultipleBuckets(t *testing.T, newDB Factory) {
+	db, ctx := newDB(t), context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		c, err := tx.RwCursor(plainTable)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		for i := uint8(0); i < 10; i++ {
+			if err := c.Put([]byte{i}, []byte{i}); err != nil {
+				return err
+			}
+		}
+		c2, err := tx.RwCursor(dupTable)
+		if err != nil {
+			return err
+		}
+		defer c2.Close()
+		for i := uint8(0); i < 12; i++ {
+			if err := c2.Put([]byte{i}, []byte{i}); err != nil {
+				return err
+			}
+		}
+		// delete from first table key 5, then Seek of it must return key 6
+		if err := c.Delete([]byte{5}); err != nil {
+			return err
+		}
+		return c.Delete([]byte{6, 1}) // delete of not existing key
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Len(t, entries(t, tx, plainTable), 9)
+		require.Len(t, entries(t, tx, dupTable), 12)
+		c, err := tx.Cursor(plainTable)
+		require.NoError(t, err)
+		defer c.Close()
+		k, v, err := c.Seek([]byte{5})
+		require.NoError(t, err)
+		require.Equal(t, []byte{6}, k)
+		require.Equal(t, []byte{6}, v)
+		return nil
+	}))
+}
+
+// testReadAfterPut - entries put and deleted by cursor are visible to cursor and tx, in this and in next tx
+func testReadAfterPut(t *testing.T, newDB Factory) {
+	db, ctx := newDB(t), context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		c, err := tx.RwCursor(plainTable)
+		require.NoError(t, err)
+		defer c.Close()
+		for i := uint8(0); i < 10; i++ { // don't read in same loop to check that writes don't affect each other
+			require.NoError(t, c.Put([]byte{i}, []byte{i}))
+		}
+		for i := uint8(0); i < 10; i++ {
+			_, v, err := c.SeekExact([]byte{i})
+			require.NoError(t, err)
+			require.Equal(t, []byte{i}, v)
+			v, err = tx.GetOne(plainTable, []byte{i})
+			require.NoError(t, err)
+			require.Equal(t, []byte{i}, v)
+		}
+
+		require.NoError(t, c.Delete([]byte{5}))
+		_, v, err := c.SeekExact([]byte{5})
+		require.NoError(t, err)
+		require.Nil(t, v)
+		require.NoError(t, c.Delete([]byte{255})) // delete of not existing key
+		return nil
+	}))
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		c, err := tx.RwCursor(plainTable)
+		require.NoError(t, err)
+		defer c.Close()
+		require.NoError(t, c.Delete([]byte{6}))
+		for _, i := range []byte{5, 6} {
+			v, err := tx.GetOne(plainTable, []byte{i})
+			require.NoError(t, err)
+			require.Nil(t, v)
+		}
+		v, err := tx.GetOne(plainTable, []byte{7})
+		require.NoError(t, err)
+		require.Equal(t, []byte{7}, v)
+		return nil
+	}))
+}
@@ -0,0 +1,479 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+func testAppendFirstLast(t *testing.T, newDB Factory) {
+	_, tx, c := baseCase(t, newDB)
+
+	table := dupTable
+
+	require.Error(t, tx.Append(table, []byte("key2"), []byte("value2.1")))
+	require.NoError(t, tx.Append(table, []byte("key6"), []byte("value6.1")))
+	require.Error(t, tx.Append(table, []byte("key4"), []byte("value4.1")))
+	require.NoError(t, tx.AppendDup(table, []byte("key2"), []byte("value1.11")))
+
+	k, v, err := c.First()
+	require.Nil(t, err)
+	require.Equal(t, k, []byte("key1"))
+	require.Equal(t, v, []byte("value1.1"))
+
+	keys, values := iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key1", "key2", "key3", "key3", "key6"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.3", "value1.11", "value3.1", "value3.3", "value6.1"}, values)
+
+	k, v, err = c.Last()
+	require.Nil(t, err)
+	require.Equal(t, k, []byte("key6"))
+	require.Equal(t, v, []byte("value6.1"))
+
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key6"}, keys)
+	require.Equal(t, []string{"value6.1"}, values)
+}
+
+func testNextPrevCurrent(t *testing.T, newDB Factory) {
+	_, _, c := baseCase(t, newDB)
+
+	k, v, err := c.First()
+	require.Nil(t, err)
+	keys, values := iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
+
+	k, v, err = c.Next()
+	require.Equal(t, []byte("key1"), k)
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
+
+	k, v, err = c.Current()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
+	require.Equal(t, k, []byte("key1"))
+	require.Equal(t, v, []byte("value1.3"))
+
+	k, v, err = c.Next()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key3", "key3"}, keys)
+	require.Equal(t, []string{"value3.1", "value3.3"}, values)
+
+	k, v, err = c.Prev()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
+
+	k, v, err = c.Current()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
+
+	k, v, err = c.Prev()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
+
+	err = c.DeleteCurrent()
+	require.Nil(t, err)
+	k, v, err = c.Current()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
+}
+
+func testSeek(t *testing.T, newDB Factory) {
+	_, _, c := baseCase(t, newDB)
+
+	k, v, err := c.Seek([]byte("k"))
+	require.Nil(t, err)
+	keys, values := iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
+
+	k, v, err = c.Seek([]byte("key3"))
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key3", "key3"}, keys)
+	require.Equal(t, []string{"value3.1", "value3.3"}, values)
+
+	k, v, err = c.Seek([]byte("xyz"))
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Nil(t, keys)
+	require.Nil(t, values)
+}
+
+func testSeekExact(t *testing.T, newDB Factory) {
+	_, _, c := baseCase(t, newDB)
+
+	k, v, err := c.SeekExact([]byte("key3"))
+	require.Nil(t, err)
+	keys, values := iteration(t, c, k, v)
+	require.Equal(t, []string{"key3", "key3"}, keys)
+	require.Equal(t, []string{"value3.1", "value3.3"}, values)
+
+	k, v, err = c.SeekExact([]byte("key"))
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Nil(t, keys)
+	require.Nil(t, values)
+}
+
+// testMultipleCursors - cursors of the same tx don't affect each other, tx can be walked while cursors move
+func testMultipleCursors(t *testing.T, newDB Factory) {
+	db, ctx := newDB(t), context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for _, k := range []string{"\x00", "\x00\x00\x01", "\x00\x00\x00\x00\x00\x01", "\x01", "\x02", "\x03"} {
+			if err := tx.Put(plainTable, []byte(k), []byte{1}); err != nil {
+				return err
+			}
+			if err := tx.Put(dupTable, []byte(k), []byte{1}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		c1, err := tx.Cursor(plainTable)
+		require.NoError(t, err)
+		defer c1.Close()
+		c2, err := tx.Cursor(dupTable)
+		require.NoError(t, err)
+		defer c2.Close()
+
+		same := func(f func(c kv.Cursor) ([]byte, []byte, error)) {
+			t.Helper()
+			k1, v1, err := f(c1)
+			require.NoError(t, err)
+			k2, v2, err := f(c2)
+			require.NoError(t, err)
+			require.Equal(t, k1, k2)
+			require.Equal(t, v1, v2)
+		}
+		next := func(c kv.Cursor) ([]byte, []byte, error) { return c.Next() }
+		seek := func(k ...byte) func(c kv.Cursor) ([]byte, []byte, error) {
+			return func(c kv.Cursor) ([]byte, []byte, error) { return c.Seek(k) }
+		}
+		same(func(c kv.Cursor) ([]byte, []byte, error) { return c.First() })
+		same(next)
+		same(seek(0))
+		same(seek(0, 0))
+		same(seek(0, 0, 0, 0))
+		same(next)
+		same(seek(2))
+		same(next)
+
+		cnt := 0
+		require.NoError(t, tx.ForEach(plainTable, nil, func(_, _ []byte) error {
+			if cnt == 0 {
+				k, _, err := c1.Prev()
+				require.NoError(t, err)
+				require.Equal(t, []byte{2}, k)
+			}
+			cnt++
+			return nil
+		}))
+		require.Equal(t, 6, cnt)
+		return nil
+	}))
+}
+
+func testSeekBothRange(t *testing.T, newDB Factory) {
+	_, _, c := baseCase(t, newDB)
+
+	v, err := c.SeekBothRange([]byte("key2"), []byte("value1.2"))
+	require.NoError(t, err)
+	// SeekBothRange does exact match of the key, but range match of the value, so we get nil here
+	require.Nil(t, v)
+
+	v, err = c.SeekBothRange([]byte("key3"), []byte("value3.2"))
+	require.NoError(t, err)
+	require.Equal(t, "value3.3", string(v))
+}
+
+func testSeekBothExact(t *testing.T, newDB Factory) {
+	_, _, c := baseCase(t, newDB)
+
+	k, v, err := c.SeekBothExact([]byte("key1"), []byte("value1.2"))
+	require.Nil(t, err)
+	keys, values := iteration(t, c, k, v)
+	require.Nil(t, keys)
+	require.Nil(t, values)
+
+	k, v, err = c.SeekBothExact([]byte("key2"), []byte("value1.1"))
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Nil(t, keys)
+	require.Nil(t, values)
+
+	k, v, err = c.SeekBothExact([]byte("key1"), []byte("value1.1"))
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
+
+	k, v, err = c.SeekBothExact([]byte("key3"), []byte("value3.3"))
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key3"}, keys)
+	require.Equal(t, []string{"value3.3"}, values)
+}
+
+func testNextDups(t *testing.T, newDB Factory) {
+	_, tx, _ := baseCase(t, newDB)
+
+	table := dupTable
+
+	c, err := tx.RwCursorDupSort(table)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.1")))
+	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.3")))
+	require.NoError(t, c.DeleteExact([]byte("key3"), []byte("value3.1"))) //valid but already deleted
+	require.NoError(t, c.DeleteExact([]byte("key3"), []byte("value3.3"))) //valid key but wrong value
+
+	require.NoError(t, tx.Put(table, []byte("key2"), []byte("value1.1")))
+	require.NoError(t, c.Put([]byte("key2"), []byte("value1.2")))
+	require.NoError(t, c.Put([]byte("key3"), []byte("value1.6")))
+	require.NoError(t, c.Put([]byte("key"), []byte("value1.7")))
+
+	k, v, err := c.Current()
+	require.Nil(t, err)
+	keys, values := iteration(t, c, k, v)
+	require.Equal(t, []string{"key", "key2", "key2", "key3"}, keys)
+	require.Equal(t, []string{"value1.7", "value1.1", "value1.2", "value1.6"}, values)
+
+	v, err = c.FirstDup()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key", "key2", "key2", "key3"}, keys)
+	require.Equal(t, []string{"value1.7", "value1.1", "value1.2", "value1.6"}, values)
+
+	k, v, err = c.NextNoDup()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key2", "key2", "key3"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.2", "value1.6"}, values)
+
+	k, v, err = c.NextDup()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key2", "key3"}, keys)
+	require.Equal(t, []string{"value1.2", "value1.6"}, values)
+
+	v, err = c.LastDup()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key2", "key3"}, keys)
+	require.Equal(t, []string{"value1.2", "value1.6"}, values)
+
+	k, v, err = c.NextDup()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Nil(t, keys)
+	require.Nil(t, values)
+
+	k, v, err = c.NextNoDup()
+	require.Nil(t, err)
+	keys, values = iteration(t, c, k, v)
+	require.Equal(t, []string{"key3"}, keys)
+	require.Equal(t, []string{"value1.6"}, values)
+}
+
+func testLastDup(t *testing.T, newDB Factory) {
+	db, tx, _ := baseCase(t, newDB)
+
+	err := tx.Commit()
+	require.NoError(t, err)
+	roTx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer roTx.Rollback()
+
+	roC, err := roTx.CursorDupSort(dupTable)
+	require.NoError(t, err)
+	defer roC.Close()
+
+	var keys, vals []string
+	var k, v []byte
+	for k, _, err = roC.First(); err == nil && k != nil; k, _, err = roC.NextNoDup() {
+		v, err = roC.LastDup()
+		require.NoError(t, err)
+		keys = append(keys, string(k))
+		vals = append(vals, string(v))
+	}
+	require.NoError(t, err)
+	require.Equal(t, []string{"key1", "key3"}, keys)
+	require.Equal(t, []string{"value1.3", "value3.3"}, vals)
+}
+
+func testCurrentDup(t *testing.T, newDB Factory) {
+	_, _, c := baseCase(t, newDB)
+
+	count, err := c.CountDuplicates()
+	require.Nil(t, err)
+	require.Equal(t, count, uint64(2))
+
+	require.Error(t, c.PutNoDupData([]byte("key3"), []byte("value3.3")))
+	require.NoError(t, c.DeleteCurrentDuplicates())
+
+	k, v, err := c.SeekExact([]byte("key1"))
+	require.Nil(t, err)
+	keys, values := iteration(t, c, k, v)
+	require.Equal(t, []string{"key1", "key1"}, keys)
+	require.Equal(t, []string{"value1.1", "value1.3"}, values)
+}
+
+func testDupDelete(t *testing.T, newDB Factory) {
+	_, _, c := baseCase(t, newDB)
+
+	k, _, err := c.Current()
+	require.Nil(t, err)
+	require.Equal(t, []byte("key3"), k)
+
+	err = c.DeleteCurrentDuplicates()
+	require.Nil(t, err)
+
+	err = c.Delete([]byte("key1"))
+	require.Nil(t, err)
+
+	count, err := c.Count()
+	require.Nil(t, err)
+	assert.Zero(t, count)
+}
+
+// autoConversionCase - keys of autoTable: short ones are stored as is, keys of DupFromLen are stored as DupToLen
+// prefix with the rest of key prepended to value. Returns cursor of new tx over committed entries.
+func autoConversionCase(t *testing.T, newDB Factory) kv.RwCursor {
+	t.Helper()
+	db := newDB(t)
+	fill := beginRw(t, db)
+	for _, e := range [][2]string{
+		{"A", "0"},
+		{"A..........................._______________________________A", "1"},
+		{"A..........................._______________________________C", "2"},
+		{"B", "8"},
+		{"C", "9"},
+		{"D..........................._______________________________A", "3"},
+		{"D..........................._______________________________C", "4"},
+	} {
+		require.NoError(t, fill.Put(autoTable, []byte(e[0]), []byte(e[1])))
+	}
+	require.NoError(t, fill.Commit())
+	c, err := beginRw(t, db).RwCursor(autoTable)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func testAutoConversion(t *testing.T, newDB Factory) {
+	c := autoConversionCase(t, newDB)
+
+	// key length conflict
+	require.Error(t, c.Put([]byte("A..........................."), []byte("?")))
+
+	require.NoError(t, c.Delete([]byte("A..........................._______________________________A")))
+	require.NoError(t, c.Put([]byte("B"), []byte("7")))
+	require.NoError(t, c.Delete([]byte("C")))
+	require.NoError(t, c.Put([]byte("D..........................._______________________________C"), []byte("6")))
+	require.NoError(t, c.Put([]byte("D..........................._______________________________E"), []byte("5")))
+
+	k, v, err := c.First()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("A"), k)
+	assert.Equal(t, []byte("0"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("A..........................._______________________________C"), k)
+	assert.Equal(t, []byte("2"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("B"), k)
+	assert.Equal(t, []byte("7"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("D..........................._______________________________A"), k)
+	assert.Equal(t, []byte("3"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("D..........................._______________________________C"), k)
+	assert.Equal(t, []byte("6"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("D..........................._______________________________E"), k)
+	assert.Equal(t, []byte("5"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Nil(t, k)
+	assert.Nil(t, v)
+
+	_, v, err = c.SeekExact([]byte("D..........................._______________________________C"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("6"), v)
+}
+
+func testAutoConversionDelete(t *testing.T, newDB Factory) {
+	c := autoConversionCase(t, newDB)
+
+	require.NoError(t, c.Delete([]byte("A..........................._______________________________A")))
+	require.NoError(t, c.Delete([]byte("A..........................._______________________________C")))
+	require.NoError(t, c.Delete([]byte("B")))
+	require.NoError(t, c.Delete([]byte("C")))
+
+	k, v, err := c.First()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("A"), k)
+	assert.Equal(t, []byte("0"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("D..........................._______________________________A"), k)
+	assert.Equal(t, []byte("3"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("D..........................._______________________________C"), k)
+	assert.Equal(t, []byte("4"), v)
+
+	k, v, err = c.Next()
+	require.NoError(t, err)
+	assert.Nil(t, k)
+	assert.Nil(t, v)
+}
@@ -0,0 +1,441 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package kvtest - conformance tests of kv.RwDB implementations: every backend (MdbxKV, TemporaryMdbx, memkv,
+// MemoryMutation, wrappers) runs the same tests and must behave as MdbxKV does.
+//
+//	func TestConformance(t *testing.T) {
+//		kvtest.Run(t, func(tb testing.TB) kv.RwDB { return memkv.NewTestDB(tb, kvtest.Tables) })
+//	}
+package kvtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+// Factory - opens empty db with Tables and closes it on tb.Cleanup. Tests may close db themselves, so Close must be
+// idempotent.
+type Factory func(tb testing.TB) kv.RwDB
+
+const (
+	plainTable = "HashedAccount"
+	dupTable   = "AccountChangeSet"
+	autoTable  = "PlainState"
+	deprecated = "Clique"
+)
+
+// Tables - tables which db of Factory must have. Names and configs are the same as in kv.ChaindataTablesCfg of
+// `erigon` builds, so dbs with chaindata tables (like TemporaryMdbx) can be tested too.
+var Tables = kv.TableCfg{
+	kv.Sequence: {},
+	plainTable:  {},
+	dupTable:    {Flags: kv.DupSort},
+	autoTable:   {Flags: kv.DupSort, AutoDupSortKeysConversion: true, DupFromLen: 60, DupToLen: 28},
+	deprecated:  {IsDeprecated: true},
+}
+
+var tests = []struct {
+	name string
+	run  func(t *testing.T, newDB Factory)
+}{
+	{"PutGet", testPutGet},
+	{"HasDelete", testHasDelete},
+	{"Sequence", testSequence},
+	{"ForAmount", testForAmount},
+	{"ForPrefix", testForPrefix},
+	{"AppendFirstLast", testAppendFirstLast},
+	{"NextPrevCurrent", testNextPrevCurrent},
+	{"Seek", testSeek},
+	{"SeekExact", testSeekExact},
+	{"MultipleCursors", testMultipleCursors},
+	{"SeekBothRange", testSeekBothRange},
+	{"SeekBothExact", testSeekBothExact},
+	{"NextDups", testNextDups},
+	{"LastDup", testLastDup},
+	{"CurrentDup", testCurrentDup},
+	{"DupDelete", testDupDelete},
+	{"AutoConversion", testAutoConversion},
+	{"AutoConversionDelete", testAutoConversionDelete},
+	{"Range", testRange},
+	{"RangeLimit", testRangeLimit},
+	{"RangeDupSort", testRangeDupSort},
+	{"RangeClose", testRangeClose},
+	{"Prefix", testPrefix},
+	{"CommittedLast", testCommittedLast},
+	{"CommittedDelete", testCommittedDelete},
+	{"CommittedWalk", testCommittedWalk},
+	{"CommittedClear", testCommittedClear},
+	{"CommittedSequence", testCommittedSequence},
+	{"CommittedDupSort", testCommittedDupSort},
+	{"MultipleBuckets", testMultipleBuckets},
+	{"ReadAfterPut", testReadAfterPut},
+	{"Buckets", testBuckets},
+	{"SnapshotIsolation", testSnapshotIsolation},
+	{"Rollback", testRollback},
+	{"CloseAndContext", testCloseAndContext},
+}
+
+// Run - runs all conformance tests as subtests of t, every test gets new db from newDB
+func Run(t *testing.T, newDB Factory) {
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) { test.run(t, newDB) })
+	}
+}
+
+func beginRw(t *testing.T, db kv.RwDB) kv.RwTx {
+	t.Helper()
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(tx.Rollback)
+	return tx
+}
+
+// baseCase - rw tx with some duplicates of 2 keys in dupTable, and cursor of dupTable positioned at last put
+func baseCase(t *testing.T, newDB Factory) (kv.RwDB, kv.RwTx, kv.RwCursorDupSort) {
+	t.Helper()
+	db := newDB(t)
+	tx := beginRw(t, db)
+
+	c, err := tx.RwCursorDupSort(dupTable)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+
+	// Insert some dupsorted records
+	require.NoError(t, c.Put([]byte("key1"), []byte("value1.1")))
+	require.NoError(t, c.Put([]byte("key3"), []byte("value3.1")))
+	require.NoError(t, c.Put([]byte("key1"), []byte("value1.3")))
+	require.NoError(t, c.Put([]byte("key3"), []byte("value3.3")))
+
+	return db, tx, c
+}
+
+// iteration - entries from (start, val) to the end of table, then moves cursor back to start
+func iteration(t *testing.T, c kv.RwCursorDupSort, start []byte, val []byte) ([]string, []string) {
+	t.Helper()
+	var keys []string
+	var values []string
+	var err error
+	i := 0
+	for k, v, err := start, val, err; k != nil; k, v, err = c.Next() {
+		require.Nil(t, err)
+		keys = append(keys, string(k))
+		values = append(values, string(v))
+		i += 1
+	}
+	for ind := i; ind > 1; ind-- {
+		c.Prev()
+	}
+
+	return keys, values
+}
+
+// entries - "k=v" of all entries of table in order of table
+func entries(t *testing.T, tx kv.Tx, table string) (res []string) {
+	t.Helper()
+	require.NoError(t, tx.ForEach(table, nil, func(k, v []byte) error {
+		res = append(res, string(k)+"="+string(v))
+		return nil
+	}))
+	return res
+}
+
+func testPutGet(t *testing.T, newDB Factory) {
+	_, tx, c := baseCase(t, newDB)
+
+	require.NoError(t, c.Put([]byte(""), []byte("value1.1")))
+
+	var v []byte
+	v, err := tx.GetOne(dupTable, []byte("key1"))
+	require.Nil(t, err)
+	require.Equal(t, v, []byte("value1.1"))
+
+	v, err = tx.GetOne(dupTable, []byte("key2"))
+	require.Nil(t, err)
+	require.Nil(t, v)
+
+	// writes of one cursor don't affect each other (for example by sharing buffers)
+	for i := uint8(0); i < 10; i++ {
+		require.NoError(t, tx.Put(plainTable, []byte{i}, []byte{i}))
+	}
+	for i := uint8(0); i < 10; i++ {
+		v, err := tx.GetOne(plainTable, []byte{i})
+		require.NoError(t, err)
+		require.Equal(t, []byte{i}, v)
+	}
+	require.NoError(t, tx.Put(plainTable, []byte{5}, []byte{50}))
+	v, err = tx.GetOne(plainTable, []byte{5})
+	require.NoError(t, err)
+	require.Equal(t, []byte{50}, v)
+
+	v, err = tx.GetOne("RANDOM", []byte("key1"))
+	require.Error(t, err) // Error from non-existent bucket returns error
+	require.Nil(t, v)
+}
+
+func testHasDelete(t *testing.T, newDB Factory) {
+	_, tx, _ := baseCase(t, newDB)
+
+	table := dupTable
+
+	require.NoError(t, tx.Put(table, []byte("key2"), []byte("value2.1")))
+	require.NoError(t, tx.Put(table, []byte("key4"), []byte("value4.1")))
+	require.NoError(t, tx.Put(table, []byte("key5"), []byte("value5.1")))
+
+	c, err := tx.RwCursorDupSort(table)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.1")))
+	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.3")))
+	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.1"))) //valid but already deleted
+	require.NoError(t, c.DeleteExact([]byte("key2"), []byte("value1.1"))) //valid key but wrong value
+
+	res, err := tx.Has(table, []byte("key1"))
+	require.Nil(t, err)
+	require.False(t, res)
+
+	res, err = tx.Has(table, []byte("key2"))
+	require.Nil(t, err)
+	require.True(t, res)
+
+	res, err = tx.Has(table, []byte("key3"))
+	require.Nil(t, err)
+	require.True(t, res) //There is another key3 left
+
+	res, err = tx.Has(table, []byte("k"))
+	require.Nil(t, err)
+	require.False(t, res)
+
+	// Delete of key removes all its values, delete of not existing key is not an error
+	require.NoError(t, tx.Delete(table, []byte("key3")))
+	require.NoError(t, tx.Delete(table, []byte("key6")))
+	require.Equal(t, []string{"key2=value2.1", "key4=value4.1", "key5=value5.1"}, entries(t, tx, table))
+}
+
+func testSequence(t *testing.T, newDB Factory) {
+	tx := beginRw(t, newDB(t))
+
+	for _, table := range []string{plainTable, dupTable} {
+		i, err := tx.ReadSequence(table)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), i)
+		i, err = tx.IncrementSequence(table, 1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), i)
+		i, err = tx.IncrementSequence(table, 6)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), i)
+		i, err = tx.IncrementSequence(table, 1)
+		require.NoError(t, err)
+		require.Equal(t, uint64(7), i)
+	}
+	i, err := tx.ReadSequence(plainTable)
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), i)
+}
+
+func testForAmount(t *testing.T, newDB Factory) {
+	_, tx, _ := baseCase(t, newDB)
+
+	table := dupTable
+
+	require.NoError(t, tx.Put(table, []byte("key2"), []byte("value2.1")))
+	require.NoError(t, tx.Put(table, []byte("key4"), []byte("value4.1")))
+	require.NoError(t, tx.Put(table, []byte("key5"), []byte("value5.1")))
+
+	var keys []string
+
+	err := tx.ForAmount(table, []byte("key3"), uint32(2), func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"key3", "key3"}, keys)
+
+	var keys1 []string
+
+	err1 := tx.ForAmount(table, []byte("key1"), 100, func(k, v []byte) error {
+		keys1 = append(keys1, string(k))
+		return nil
+	})
+	require.Nil(t, err1)
+	require.Equal(t, []string{"key1", "key1", "key2", "key3", "key3", "key4", "key5"}, keys1)
+
+	var keys2 []string
+
+	err2 := tx.ForAmount(table, []byte("value"), 100, func(k, v []byte) error {
+		keys2 = append(keys2, string(k))
+		return nil
+	})
+	require.Nil(t, err2)
+	require.Nil(t, keys2)
+
+	var keys3 []string
+
+	err3 := tx.ForAmount(table, []byte("key1"), 0, func(k, v []byte) error {
+		keys3 = append(keys3, string(k))
+		return nil
+	})
+	require.Nil(t, err3)
+	require.Nil(t, keys3)
+}
+
+func testForPrefix(t *testing.T, newDB Factory) {
+	_, tx, _ := baseCase(t, newDB)
+
+	table := dupTable
+
+	var keys []string
+
+	err := tx.ForPrefix(table, []byte("key"), func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
+
+	var keys1 []string
+
+	err = tx.ForPrefix(table, []byte("key1"), func(k, v []byte) error {
+		keys1 = append(keys1, string(k))
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"key1", "key1"}, keys1)
+
+	var keys2 []string
+
+	err = tx.ForPrefix(table, []byte("e"), func(k, v []byte) error {
+		keys2 = append(keys2, string(k))
+		return nil
+	})
+	require.Nil(t, err)
+	require.Nil(t, keys2)
+}
+
+func testBuckets(t *testing.T, newDB Factory) {
+	tx := beginRw(t, newDB(t))
+
+	buckets, err := tx.ListBuckets()
+	require.NoError(t, err)
+	require.Contains(t, buckets, plainTable)
+	require.Contains(t, buckets, dupTable)
+
+	exists, err := tx.ExistsBucket(plainTable)
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = tx.ExistsBucket("RANDOM")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, tx.Put(plainTable, []byte("a"), []byte("1")))
+	require.NoError(t, tx.ClearBucket(plainTable))
+	require.Nil(t, entries(t, tx, plainTable))
+	require.NoError(t, tx.Put(plainTable, []byte("b"), []byte("2")))
+	require.Equal(t, []string{"b=2"}, entries(t, tx, plainTable))
+
+	// only deprecated tables can be dropped
+	require.ErrorIs(t, tx.DropBucket(plainTable), kv.ErrAttemptToDeleteNonDeprecatedBucket)
+	require.NoError(t, tx.CreateBucket(deprecated))
+	exists, err = tx.ExistsBucket(deprecated)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.NoError(t, tx.Put(deprecated, []byte("a"), []byte("1")))
+	require.NoError(t, tx.DropBucket(deprecated))
+	exists, err = tx.ExistsBucket(deprecated)
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.NoError(t, tx.DropBucket(deprecated)) // nothing to drop
+	require.NoError(t, tx.Commit())
+}
+
+func testSnapshotIsolation(t *testing.T, newDB Factory) {
+	db, ctx := newDB(t), context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(plainTable, []byte{1}, []byte{1})
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		c, err := tx.Cursor(plainTable)
+		require.NoError(t, err)
+		defer c.Close()
+
+		// new updates are not visible for old readers
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			return tx.Put(plainTable, []byte{2}, []byte{2})
+		}))
+		k, v, err := c.Last()
+		require.NoError(t, err)
+		require.Equal(t, []byte{1}, k)
+		require.Equal(t, []byte{1}, v)
+		require.Equal(t, []string{"\x01=\x01"}, entries(t, tx, plainTable))
+		return nil
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Equal(t, []string{"\x01=\x01", "\x02=\x02"}, entries(t, tx, plainTable))
+		return nil
+	}))
+}
+
+func testRollback(t *testing.T, newDB Factory) {
+	db, ctx := newDB(t), context.Background()
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Put(plainTable, []byte("a"), []byte("1")))
+	tx.Rollback()
+	tx.Rollback() // second call does nothing
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Nil(t, entries(t, tx, plainTable))
+		return nil
+	}))
+	require.ErrorIs(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Put(plainTable, []byte("a"), []byte("1")))
+		return context.Canceled
+	}), context.Canceled)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Nil(t, entries(t, tx, plainTable))
+		return nil
+	}))
+}
+
+func testCloseAndContext(t *testing.T, newDB Factory) {
+	db := newDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := db.BeginRo(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = db.BeginRw(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, db.View(ctx, func(tx kv.Tx) error { return nil }), context.Canceled)
+	require.ErrorIs(t, db.Update(ctx, func(tx kv.RwTx) error { return nil }), context.Canceled)
+
+	require.False(t, db.ReadOnly())
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put(plainTable, []byte("a"), []byte("1"))
+	}))
+	db.Close()
+	_, err = db.BeginRo(context.Background())
+	require.Error(t, err)
+	_, err = db.BeginRw(context.Background())
+	require.Error(t, err)
+}
@@ -0,0 +1,195 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kvtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
+)
+
+// keysOf - keys returned by stream, stream is closed: keysOf(t)(tx.Range(...))
+func keysOf(t *testing.T) func(it iter.KV, err error) []string {
+	return func(it iter.KV, err error) (res []string) {
+		t.Helper()
+		require.NoError(t, err)
+		if closer, ok := it.(kv.Closer); ok {
+			defer closer.Close()
+		}
+		for it.HasNext() {
+			k, _, err := it.Next()
+			require.NoError(t, err)
+			res = append(res, string(k))
+		}
+		return res
+	}
+}
+
+func testRange(t *testing.T, newDB Factory) {
+	t.Run("Asc", func(t *testing.T) {
+		_, tx, _ := baseCase(t, newDB)
+
+		//[from, to)
+		it, err := tx.Range(dupTable, []byte("key1"), []byte("key3"))
+		require.NoError(t, err)
+		require.True(t, it.HasNext())
+		k, v, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, "key1", string(k))
+		require.Equal(t, "value1.1", string(v))
+
+		require.True(t, it.HasNext())
+		k, v, err = it.Next()
+		require.NoError(t, err)
+		require.Equal(t, "key1", string(k))
+		require.Equal(t, "value1.3", string(v))
+
+		require.False(t, it.HasNext())
+		require.False(t, it.HasNext())
+
+		// [from, nil) means [from, INF)
+		require.Len(t, keysOf(t)(tx.Range(dupTable, []byte("key1"), nil)), 4)
+	})
+	t.Run("Desc", func(t *testing.T) {
+		_, tx, _ := baseCase(t, newDB)
+
+		//[from, to)
+		it, err := tx.RangeDescend(dupTable, []byte("key3"), []byte("key1"), kv.Unlim)
+		require.NoError(t, err)
+		require.True(t, it.HasNext())
+		k, v, err := it.Next()
+		require.NoError(t, err)
+		require.Equal(t, "key3", string(k))
+		require.Equal(t, "value3.3", string(v))
+
+		require.True(t, it.HasNext())
+		k, v, err = it.Next()
+		require.NoError(t, err)
+		require.Equal(t, "key3", string(k))
+		require.Equal(t, "value3.1", string(v))
+
+		require.False(t, it.HasNext())
+
+		// from is not in table: starts from previous key
+		it, err = tx.RangeDescend(dupTable, []byte("key2"), nil, kv.Unlim)
+		require.NoError(t, err)
+		keys, values := iter.ToArrKVMust(it)
+		require.Equal(t, [][]byte{[]byte("key1"), []byte("key1")}, keys)
+		require.Equal(t, [][]byte{[]byte("value1.3"), []byte("value1.1")}, values)
+	})
+	t.Run("Bounds", func(t *testing.T) {
+		_, tx, _ := baseCase(t, newDB)
+
+		_, err := tx.RangeAscend(dupTable, []byte("key3"), []byte("key1"), kv.Unlim)
+		require.Error(t, err)
+		_, err = tx.RangeDescend(dupTable, []byte("key1"), []byte("key3"), kv.Unlim)
+		require.Error(t, err)
+		require.Nil(t, keysOf(t)(tx.Range(dupTable, []byte("key4"), nil)))
+		require.Nil(t, keysOf(t)(tx.RangeDescend(dupTable, []byte("key0"), nil, kv.Unlim)))
+	})
+}
+
+func testRangeLimit(t *testing.T, newDB Factory) {
+	tx := beginRw(t, newDB(t))
+	for i := byte(1); i <= 4; i++ {
+		require.NoError(t, tx.Put(plainTable, []byte{i}, []byte{i}))
+	}
+	cnt := func(it iter.KV, err error) int { return len(keysOf(t)(it, err)) }
+
+	require.Equal(t, 2, cnt(tx.Range(plainTable, []byte{2}, []byte{4})))
+	require.Equal(t, 3, cnt(tx.Range(plainTable, nil, []byte{4})))
+	require.Equal(t, 3, cnt(tx.Range(plainTable, []byte{2}, nil)))
+	require.Equal(t, 4, cnt(tx.Range(plainTable, nil, nil)))
+
+	require.Equal(t, 2, cnt(tx.RangeAscend(plainTable, []byte{2}, []byte{4}, 2)))
+	require.Equal(t, 2, cnt(tx.RangeAscend(plainTable, nil, []byte{4}, 2)))
+	require.Equal(t, 2, cnt(tx.RangeAscend(plainTable, []byte{2}, nil, 2)))
+	require.Equal(t, 2, cnt(tx.RangeAscend(plainTable, nil, nil, 2)))
+	require.Equal(t, 0, cnt(tx.RangeAscend(plainTable, nil, nil, 0)))
+
+	require.Equal(t, 2, cnt(tx.RangeDescend(plainTable, []byte{4}, []byte{2}, 2)))
+	require.Equal(t, 0, cnt(tx.RangeDescend(plainTable, nil, []byte{4}, 2)))
+	require.Equal(t, 2, cnt(tx.RangeDescend(plainTable, []byte{2}, nil, 2)))
+	require.Equal(t, 2, cnt(tx.RangeDescend(plainTable, nil, nil, 2)))
+
+	require.Equal(t, []string{"\x04", "\x03"}, keysOf(t)(tx.RangeDescend(plainTable, nil, []byte{2}, kv.Unlim)))
+	require.Equal(t, []string{"\x02", "\x03"}, keysOf(t)(tx.RangeAscend(plainTable, []byte{2}, nil, 2)))
+}
+
+func testRangeDupSort(t *testing.T, newDB Factory) {
+	_, tx, _ := baseCase(t, newDB)
+	require.NoError(t, tx.Put(dupTable, []byte("key1"), []byte("value1.2")))
+
+	values := func(it iter.KV, err error) (res []string) {
+		require.NoError(t, err)
+		for it.HasNext() {
+			k, v, err := it.Next()
+			require.NoError(t, err)
+			require.Equal(t, "key1", string(k))
+			res = append(res, string(v))
+		}
+		return res
+	}
+	require.Equal(t, []string{"value1.1", "value1.2", "value1.3"}, values(tx.RangeDupSort(dupTable, []byte("key1"), nil, nil, order.Asc, kv.Unlim)))
+	require.Equal(t, []string{"value1.3", "value1.2", "value1.1"}, values(tx.RangeDupSort(dupTable, []byte("key1"), nil, nil, order.Desc, kv.Unlim)))
+	require.Equal(t, []string{"value1.2"}, values(tx.RangeDupSort(dupTable, []byte("key1"), []byte("value1.2"), []byte("value1.3"), order.Asc, kv.Unlim)))
+	require.Equal(t, []string{"value1.2", "value1.1"}, values(tx.RangeDupSort(dupTable, []byte("key1"), []byte("value1.2"), nil, order.Desc, kv.Unlim)))
+	require.Equal(t, []string{"value1.1", "value1.2"}, values(tx.RangeDupSort(dupTable, []byte("key1"), nil, nil, order.Asc, 2)))
+	require.Nil(t, values(tx.RangeDupSort(dupTable, []byte("key2"), nil, nil, order.Asc, kv.Unlim)))
+}
+
+// testRangeClose - explicitly closed stream ends: HasNext is false, Next fails
+func testRangeClose(t *testing.T, newDB Factory) {
+	_, tx, _ := baseCase(t, newDB)
+	streams := []func() (iter.KV, error){
+		func() (iter.KV, error) { return tx.Range(dupTable, nil, nil) },
+		func() (iter.KV, error) { return tx.RangeDescend(dupTable, nil, nil, kv.Unlim) },
+		func() (iter.KV, error) {
+			return tx.RangeDupSort(dupTable, []byte("key1"), nil, nil, order.Asc, kv.Unlim)
+		},
+	}
+	for i, open := range streams { // no subtests: tx can't be used from other goroutine
+		it, err := open()
+		require.NoError(t, err, i)
+		_, _, err = it.Next()
+		require.NoError(t, err, i)
+		require.True(t, it.HasNext(), i)
+
+		it.(kv.Closer).Close()
+		require.False(t, it.HasNext(), i)
+		_, _, err = it.Next()
+		require.Error(t, err, i)
+		it.(kv.Closer).Close()
+		require.False(t, it.HasNext(), i)
+	}
+}
+
+func testPrefix(t *testing.T, newDB Factory) {
+	tx := beginRw(t, newDB(t))
+	for _, k := range []string{"a", "aa", "ab", "b", "\xff", "\xff\xff"} {
+		require.NoError(t, tx.Put(plainTable, []byte(k), []byte(k)))
+	}
+	require.Equal(t, []string{"a", "aa", "ab"}, keysOf(t)(tx.Prefix(plainTable, []byte("a"))))
+	require.Equal(t, []string{"aa"}, keysOf(t)(tx.Prefix(plainTable, []byte("aa"))))
+	require.Nil(t, keysOf(t)(tx.Prefix(plainTable, []byte("c"))))
+	require.Equal(t, []string{"\xff", "\xff\xff"}, keysOf(t)(tx.Prefix(plainTable, []byte("\xff"))))
+	require.Len(t, keysOf(t)(tx.Prefix(plainTable, nil)), 6)
+}
@@ -70,6 +70,12 @@ type MdbxOpts struct {
 	verbosity         kv.DBVerbosityLvl
 	label             kv.Label // marker to distinct db instances - one process may open many databases. for example to collect metrics of only 1 database
 	inMem             bool
+	commitMetrics     bool // observe commit latency into kv.DBCommitMetrics of label
+	tableStatsEvery   time.Duration
+	readTxPolicy      ReadTxPolicy
+	maxBatchSize      int
+	maxBatchDelay     time.Duration
+	mapFullPolicy     MapFullPolicy
 	customEnvOtionsFn EnvOptionsFunc
 }
 
@@ -88,6 +94,8 @@ func NewMDBX(log log.Logger) MdbxOpts {
 		mergeThreshold:  3 * 8192,
 		shrinkThreshold: -1, // default
 		label:           kv.InMem,
+		maxBatchSize:    DefaultMaxBatchSize,
+		maxBatchDelay:   DefaultMaxBatchDelay,
 	}
 	return opts
 }
@@ -101,6 +109,39 @@ func (opts MdbxOpts) Label(label kv.Label) MdbxOpts {
 	return opts
 }
 
+// CommitMetrics - enables commit latency metrics of db, series are labelled by Label
+func (opts MdbxOpts) CommitMetrics() MdbxOpts {
+	opts.commitMetrics = true
+	return opts
+}
+
+// TableStatsInterval - exports stats of all tables (see MdbxKV.Stats) and readers every `every` in background, 0 - disabled
+func (opts MdbxOpts) TableStatsInterval(every time.Duration) MdbxOpts {
+	opts.tableStatsEvery = every
+	return opts
+}
+
+// BatchLimits - MdbxKV.Batch commits queued calls when there are maxSize of them or after maxDelay since first one.
+// Both must be positive, Open fails otherwise.
+func (opts MdbxOpts) BatchLimits(maxSize int, maxDelay time.Duration) MdbxOpts {
+	opts.maxBatchSize = maxSize
+	opts.maxBatchDelay = maxDelay
+	return opts
+}
+
+// MapFullPolicy - allows Update and UpdateNosync to increase size limit of db when it's reached. Size limit may be
+// impossible to increase above MapSize, see UnableExtendMapSize.
+func (opts MdbxOpts) MapFullPolicy(p MapFullPolicy) MdbxOpts {
+	opts.mapFullPolicy = p
+	return opts
+}
+
+// ReadTxPolicy - limits lifetime of read transactions of db
+func (opts MdbxOpts) ReadTxPolicy(p ReadTxPolicy) MdbxOpts {
+	opts.readTxPolicy = p
+	return opts
+}
+
 func (opts MdbxOpts) DirtySpace(s uint64) MdbxOpts {
 	opts.dirtySpace = s
 	return opts
@@ -264,6 +305,9 @@ func (opts MdbxOpts) Open(ctx context.Context) (kv.RwDB, error) {
 	if dbg.MdbxReadAhead(ctx) {
 		opts = opts.Flags(func(u uint) uint { return u &^ mdbx.NoReadahead }) //nolint
 	}
+	if opts.maxBatchSize <= 0 || opts.maxBatchDelay <= 0 {
+		return nil, fmt.Errorf("label: %s, BatchLimits must be positive, maxSize: %d, maxDelay: %s", opts.label, opts.maxBatchSize, opts.maxBatchDelay)
+	}
 	if opts.flags&mdbx.Accede != 0 || opts.flags&mdbx.Readonly != 0 {
 		for retry := 0; ; retry++ {
 			exists := dir.FileExist(filepath.Join(opts.path, "mdbx.dat"))
@@ -299,6 +343,9 @@ func (opts MdbxOpts) Open(ctx context.Context) (kv.RwDB, error) {
 		return nil, err
 	}
 
+	if opts.mapFullPolicy.GrowStep != 0 && opts.mapFullPolicy.MaxUpper == 0 {
+		opts.mapFullPolicy.MaxUpper = 4 * opts.mapSize
+	}
 	if !opts.HasFlag(mdbx.Accede) {
 		if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(opts.growthStep), opts.shrinkThreshold, int(opts.pageSize)); err != nil {
 			return nil, err
@@ -406,14 +453,30 @@ func (opts MdbxOpts) Open(ctx context.Context) (kv.RwDB, error) {
 
 		leakDetector: dbg.NewLeakDetector(ctx, "db."+string(opts.label), dbg.SlowTx(ctx)),
 	}
+	if db.metrics, err = kv.AcquireDBMetrics(opts.label); err != nil {
+		env.Close()
+		return nil, err
+	}
+	if opts.commitMetrics {
+		db.commitMetrics = db.metrics.CommitMetrics()
+	}
 
 	customBuckets := opts.bucketsCfg(kv.TableCfg{})
 	for name, cfg := range customBuckets { // copy map to avoid changing global variable
 		db.buckets[name] = cfg
 	}
 
+	if db.comparators, db.comparatorSlots, err = registerTableComparators(db.buckets); err != nil {
+		env.Close()
+		kv.ReleaseDBMetrics(db.metrics)
+		return nil, err
+	}
+
 	buckets := bucketSlice(db.buckets)
 	if err := db.openDBIs(buckets); err != nil {
+		env.Close()
+		unregisterComparators(db.comparatorSlots)
+		kv.ReleaseDBMetrics(db.metrics)
 		return nil, err
 	}
 
@@ -425,7 +488,8 @@ func (opts MdbxOpts) Open(ctx context.Context) (kv.RwDB, error) {
 				continue
 			}
 			cnfCopy := db.buckets[name]
-			dbi, createErr := tx.OpenDBI(name, mdbx.DBAccede, nil, nil)
+			cmps := db.comparators[name]
+			dbi, createErr := tx.OpenDBI(name, mdbx.DBAccede, cmps.keyCmp, cmps.dupCmp)
 			if createErr != nil {
 				if mdbx.IsNotFound(createErr) {
 					cnfCopy.DBI = NonExistingDBI
@@ -440,19 +504,26 @@ func (opts MdbxOpts) Open(ctx context.Context) (kv.RwDB, error) {
 		}
 		return nil
 	}); err != nil {
+		env.Close()
+		unregisterComparators(db.comparatorSlots)
+		kv.ReleaseDBMetrics(db.metrics)
 		return nil, err
 	}
 
 	if !opts.inMem {
-		if staleReaders, err := db.env.ReaderCheck(); err != nil {
+		if _, err := db.ReaderCheck(); err != nil {
 			db.log.Error("failed ReaderCheck", "err", err)
-		} else if staleReaders > 0 {
-			db.log.Info("cleared reader slots from dead processes", "amount", staleReaders)
 		}
-
 	}
 	db.path = opts.path
 	addToPathDbMap(opts.path, db)
+	if opts.tableStatsEvery > 0 {
+		db.stopCollector = make(chan struct{})
+		go db.collectTableStats(opts.tableStatsEvery, db.stopCollector)
+	}
+	if opts.readTxPolicy.MaxDuration > 0 {
+		db.readTxWatchdog = newReadTxWatchdog(db, opts.readTxPolicy)
+	}
 	return db, nil
 }
 
@@ -479,6 +550,23 @@ type MdbxKV struct {
 	txsAllDoneOnCloseCond *sync.Cond
 
 	leakDetector *dbg.LeakDetector
+
+	comparators     map[string]tableComparators // custom comparators of tables, see kv.TableCfgItem.KeyCmp
+	comparatorSlots []int                       // to release on Close
+	tablesMu        sync.RWMutex                // guards buckets and comparators after Open: txs change them by CreateBucket, RenameBucket, etc.
+
+	metrics        *kv.DBMetrics       // of this db, released on Close
+	commitMetrics  *kv.DBCommitMetrics // nil if MdbxOpts.CommitMetrics not enabled
+	stopCollector  chan struct{}       // nil if MdbxOpts.TableStatsInterval not set
+	readTxWatchdog *readTxWatchdog     // nil if MdbxOpts.ReadTxPolicy not set
+
+	readersMu   sync.Mutex
+	readersSeen map[readerKey]time.Time // when snapshot of reader was seen first time, see Readers
+
+	batchMu sync.Mutex
+	batch   *batch // calls of Batch which wait for commit
+
+	geometryMu sync.Mutex // serializes growOnMapFull of concurrent Update calls
 }
 
 func (db *MdbxKV) PageSize() uint64 { return db.opts.pageSize }
@@ -565,10 +653,19 @@ func (db *MdbxKV) Close() {
 	if ok := db.closed.CompareAndSwap(false, true); !ok {
 		return
 	}
+	if db.stopCollector != nil {
+		close(db.stopCollector)
+	}
 	db.waitTxsAllDoneOnClose()
+	if db.readTxWatchdog != nil {
+		db.readTxWatchdog.close()
+	}
+	db.leakDetector.Close()
 
 	db.env.Close()
 	db.env = nil
+	unregisterComparators(db.comparatorSlots)
+	kv.ReleaseDBMetrics(db.metrics)
 
 	if db.opts.inMem {
 		if err := os.RemoveAll(db.opts.path); err != nil {
@@ -611,13 +708,17 @@ func (db *MdbxKV) BeginRo(ctx context.Context) (txn kv.Tx, err error) {
 		return nil, fmt.Errorf("%w, label: %s, trace: %s", err, db.opts.label, stack2.Trace().String())
 	}
 
-	return &MdbxTx{
+	res := &MdbxTx{
 		ctx:      ctx,
 		db:       db,
 		tx:       tx,
 		readOnly: true,
 		id:       db.leakDetector.Add(),
-	}, nil
+	}
+	if db.readTxWatchdog != nil {
+		res.guard = db.readTxWatchdog.add(tx)
+	}
+	return res, nil
 }
 
 func (db *MdbxKV) BeginRw(ctx context.Context) (kv.RwTx, error) {
@@ -661,12 +762,16 @@ type MdbxTx struct {
 	statelessCursors map[string]kv.RwCursor
 	readOnly         bool
 	ctx              context.Context
+	guard            *readTxGuard // nil if MdbxOpts.ReadTxPolicy not set or tx is not read-only
+	parent, child    *MdbxTx      // see BeginNested
 
-	cursors  map[uint64]*mdbx.Cursor
+	cursors  map[uint64]*MdbxCursor
 	cursorID uint64
 
-	streams  map[int]kv.Closer
+	streams  map[int]txStream
 	streamID int
+
+	tablesUndo map[string]tableUndo // changes of MdbxKV.buckets to revert on Rollback, see setTable
 }
 
 type MdbxCursor struct {
@@ -683,6 +788,8 @@ func (db *MdbxKV) Env() *mdbx.Env {
 }
 
 func (db *MdbxKV) AllDBI() map[string]kv.DBI {
+	db.tablesMu.RLock()
+	defer db.tablesMu.RUnlock()
 	res := map[string]kv.DBI{}
 	for name, cfg := range db.buckets {
 		res[name] = cfg.DBI
@@ -690,8 +797,31 @@ func (db *MdbxKV) AllDBI() map[string]kv.DBI {
 	return res
 }
 
+// AllTables - copy of configs of tables: given by WithTableCfg and created by transactions
 func (db *MdbxKV) AllTables() kv.TableCfg {
-	return db.buckets
+	db.tablesMu.RLock()
+	defer db.tablesMu.RUnlock()
+	res := make(kv.TableCfg, len(db.buckets))
+	for name, cfg := range db.buckets {
+		res[name] = cfg
+	}
+	return res
+}
+
+// tableCfg - config of table, see tablesMu
+func (db *MdbxKV) tableCfg(name string) (kv.TableCfgItem, bool) {
+	db.tablesMu.RLock()
+	defer db.tablesMu.RUnlock()
+	cfg, ok := db.buckets[name]
+	return cfg, ok
+}
+
+// tableCmps - comparators of table, see tablesMu
+func (db *MdbxKV) tableCmps(name string) (tableComparators, bool) {
+	db.tablesMu.RLock()
+	defer db.tablesMu.RUnlock()
+	cmps, ok := db.comparators[name]
+	return cmps, ok
 }
 
 func (tx *MdbxTx) IsRo() bool     { return tx.readOnly }
@@ -703,40 +833,40 @@ func (tx *MdbxTx) CollectMetrics() {
 		return
 	}
 	if info.SinceReaderCheck.Hours() > 1 {
-		if staleReaders, err := tx.db.env.ReaderCheck(); err != nil {
+		if _, err := tx.db.ReaderCheck(); err != nil {
 			tx.db.log.Error("failed ReaderCheck", "err", err)
-		} else if staleReaders > 0 {
-			tx.db.log.Info("cleared reader slots from dead processes", "amount", staleReaders)
 		}
 	}
+	tx.db.collectReadersMetrics()
 
-	kv.DbSize.SetUint64(info.Geo.Current)
-	kv.DbPgopsNewly.SetUint64(info.PageOps.Newly)
-	kv.DbPgopsCow.SetUint64(info.PageOps.Cow)
-	kv.DbPgopsClone.SetUint64(info.PageOps.Clone)
-	kv.DbPgopsSplit.SetUint64(info.PageOps.Split)
-	kv.DbPgopsMerge.SetUint64(info.PageOps.Merge)
-	kv.DbPgopsSpill.SetUint64(info.PageOps.Spill)
-	kv.DbPgopsUnspill.SetUint64(info.PageOps.Unspill)
-	kv.DbPgopsWops.SetUint64(info.PageOps.Wops)
+	m := tx.db.metrics
+	m.DbSize.SetUint64(info.Geo.Current)
+	m.DbPgopsNewly.SetUint64(info.PageOps.Newly)
+	m.DbPgopsCow.SetUint64(info.PageOps.Cow)
+	m.DbPgopsClone.SetUint64(info.PageOps.Clone)
+	m.DbPgopsSplit.SetUint64(info.PageOps.Split)
+	m.DbPgopsMerge.SetUint64(info.PageOps.Merge)
+	m.DbPgopsSpill.SetUint64(info.PageOps.Spill)
+	m.DbPgopsUnspill.SetUint64(info.PageOps.Unspill)
+	m.DbPgopsWops.SetUint64(info.PageOps.Wops)
 
 	txInfo, err := tx.tx.Info(true)
 	if err != nil {
 		return
 	}
 
-	kv.TxDirty.SetUint64(txInfo.SpaceDirty)
-	kv.TxLimit.SetUint64(tx.db.txSize)
-	kv.TxSpill.SetUint64(txInfo.Spill)
-	kv.TxUnspill.SetUint64(txInfo.Unspill)
+	m.TxDirty.SetUint64(txInfo.SpaceDirty)
+	m.TxLimit.SetUint64(tx.db.txSize)
+	m.TxSpill.SetUint64(txInfo.Spill)
+	m.TxUnspill.SetUint64(txInfo.Unspill)
 
 	gc, err := tx.BucketStat("gc")
 	if err != nil {
 		return
 	}
-	kv.GcLeafMetric.SetUint64(gc.LeafPages)
-	kv.GcOverflowMetric.SetUint64(gc.OverflowPages)
-	kv.GcPagesMetric.SetUint64((gc.LeafPages + gc.OverflowPages) * tx.db.opts.pageSize / 8)
+	m.GcLeaf.SetUint64(gc.LeafPages)
+	m.GcOverflow.SetUint64(gc.OverflowPages)
+	m.GcPages.SetUint64((gc.LeafPages + gc.OverflowPages) * tx.db.opts.pageSize / 8)
 }
 
 // ListBuckets - all buckets stored as keys of un-named bucket
@@ -754,7 +884,28 @@ func (db *MdbxKV) View(ctx context.Context, f func(tx kv.Tx) error) (err error)
 }
 
 func (db *MdbxKV) UpdateNosync(ctx context.Context, f func(tx kv.RwTx) error) (err error) {
-	tx, err := db.BeginRwNosync(ctx)
+	return db.update(ctx, db.BeginRwNosync, f)
+}
+
+func (db *MdbxKV) Update(ctx context.Context, f func(tx kv.RwTx) error) (err error) {
+	return db.update(ctx, db.BeginRw, f)
+}
+
+// update - runs f in new tx, retries it if size limit of db was increased by MapFullPolicy
+func (db *MdbxKV) update(ctx context.Context, begin func(ctx context.Context) (kv.RwTx, error), f func(tx kv.RwTx) error) error {
+	for {
+		err := db.updateOnce(ctx, begin, f)
+		if err == nil || db.opts.mapFullPolicy.GrowStep == 0 || !isMapFull(err) {
+			return err
+		}
+		if growErr := db.growOnMapFull(); growErr != nil {
+			return fmt.Errorf("%w, %w", err, growErr)
+		}
+	}
+}
+
+func (db *MdbxKV) updateOnce(ctx context.Context, begin func(ctx context.Context) (kv.RwTx, error), f func(tx kv.RwTx) error) (err error) {
+	tx, err := begin(ctx)
 	if err != nil {
 		return err
 	}
@@ -770,26 +921,57 @@ func (db *MdbxKV) UpdateNosync(ctx context.Context, f func(tx kv.RwTx) error) (e
 	return nil
 }
 
-func (db *MdbxKV) Update(ctx context.Context, f func(tx kv.RwTx) error) (err error) {
-	tx, err := db.BeginRw(ctx)
-	if err != nil {
-		return err
+// mdbx-go doesn't export integer flags, values are from mdbx.h
+const (
+	nativeIntegerKey = 0x08 // MDBX_INTEGERKEY
+	nativeIntegerDup = 0x20 // MDBX_INTEGERDUP
+)
+
+// tableFlagsToNative - maps kv.TableFlags to flags of mdbx_dbi_open. MDBX requires IntegerDup to be used with DupSort|DupFixed.
+func tableFlagsToNative(flags kv.TableFlags) (uint, error) {
+	if flags&^kv.AllTableFlags != 0 {
+		return 0, fmt.Errorf("some not supported flag provided for bucket: %#x", uint(flags&^kv.AllTableFlags))
 	}
-	defer tx.Rollback()
-	err = f(tx)
-	if err != nil {
-		return err
+	if flags&(kv.IntegerDup|kv.ReverseDup) != 0 && flags&kv.DupSort == 0 {
+		return 0, fmt.Errorf("IntegerDup and ReverseDup flags require DupSort flag")
 	}
-	err = tx.Commit()
-	if err != nil {
-		return err
+	if flags&kv.IntegerKey != 0 && flags&kv.ReverseKey != 0 {
+		return 0, fmt.Errorf("IntegerKey and ReverseKey flags can't be used together")
 	}
-	return nil
+	if flags&kv.IntegerDup != 0 && flags&kv.ReverseDup != 0 {
+		return 0, fmt.Errorf("IntegerDup and ReverseDup flags can't be used together")
+	}
+	var nativeFlags uint
+	if flags&kv.ReverseKey != 0 {
+		nativeFlags |= mdbx.ReverseKey
+	}
+	if flags&kv.DupSort != 0 {
+		nativeFlags |= mdbx.DupSort
+	}
+	if flags&kv.IntegerKey != 0 {
+		nativeFlags |= nativeIntegerKey
+	}
+	if flags&kv.IntegerDup != 0 {
+		nativeFlags |= nativeIntegerDup | mdbx.DupFixed
+	}
+	if flags&kv.ReverseDup != 0 {
+		nativeFlags |= mdbx.ReverseDup
+	}
+	return nativeFlags, nil
+}
+
+// tableFlagsFromNative - reverse of tableFlagsToNative. DupFixed has no kv.TableFlags analog and is dropped.
+func tableFlagsFromNative(nativeFlags uint) kv.TableFlags {
+	return kv.TableFlags(nativeFlags) & kv.AllTableFlags
 }
 
 func (tx *MdbxTx) CreateBucket(name string) error {
-	cnfCopy := tx.db.buckets[name]
-	dbi, err := tx.tx.OpenDBI(name, mdbx.DBAccede, nil, nil)
+	if err := tx.checkNotNested("create", name); err != nil {
+		return err
+	}
+	cnfCopy, configured := tx.db.tableCfg(name)
+	cmps, _ := tx.db.tableCmps(name)
+	dbi, err := tx.tx.OpenDBI(name, mdbx.DBAccede, cmps.keyCmp, cmps.dupCmp)
 	if err != nil && !mdbx.IsNotFound(err) {
 		return fmt.Errorf("create table: %s, %w", name, err)
 	}
@@ -800,45 +982,45 @@ func (tx *MdbxTx) CreateBucket(name string) error {
 		if err != nil {
 			return err
 		}
-		cnfCopy.Flags = kv.TableFlags(flags)
+		onDiskFlags := tableFlagsFromNative(flags)
+		if configured && cnfCopy.Flags != onDiskFlags {
+			return fmt.Errorf("table: %s, configured flags %#x don't match flags in db %#x", name, uint(cnfCopy.Flags), uint(onDiskFlags))
+		}
+		cnfCopy.Flags = onDiskFlags
 
-		tx.db.buckets[name] = cnfCopy
+		tx.setTable(name, cnfCopy)
 		return nil
 	}
 
 	// if bucket doesn't exists - create it
 
-	var flags = tx.db.buckets[name].Flags
-	var nativeFlags uint
+	nativeFlags, err := tableFlagsToNative(cnfCopy.Flags)
+	if err != nil {
+		return fmt.Errorf("create table: %s, %w", name, err)
+	}
 	if !(tx.db.ReadOnly() || tx.db.Accede()) {
 		nativeFlags |= mdbx.Create
 	}
 
-	if flags&kv.DupSort != 0 {
-		nativeFlags |= mdbx.DupSort
-		flags ^= kv.DupSort
-	}
-	if flags != 0 {
-		return fmt.Errorf("some not supported flag provided for bucket")
-	}
-
-	dbi, err = tx.tx.OpenDBI(name, nativeFlags, nil, nil)
+	dbi, err = tx.tx.OpenDBI(name, nativeFlags, cmps.keyCmp, cmps.dupCmp)
 
 	if err != nil {
 		return fmt.Errorf("create table: %s, %w", name, err)
 	}
 	cnfCopy.DBI = kv.DBI(dbi)
 
-	tx.db.buckets[name] = cnfCopy
+	tx.setTable(name, cnfCopy)
 	return nil
 }
 
 func (tx *MdbxTx) dropEvenIfBucketIsNotDeprecated(name string) error {
-	dbi := tx.db.buckets[name].DBI
+	cnfCopy, _ := tx.db.tableCfg(name)
+	dbi := cnfCopy.DBI
 	// if bucket was not open on db start, then it's may be deprecated
 	// try to open it now without `Create` flag, and if fail then nothing to drop
 	if dbi == NonExistingDBI {
-		nativeDBI, err := tx.tx.OpenDBI(name, 0, nil, nil)
+		cmps, _ := tx.db.tableCmps(name)
+		nativeDBI, err := tx.tx.OpenDBI(name, 0, cmps.keyCmp, cmps.dupCmp)
 		if err != nil {
 			if mdbx.IsNotFound(err) {
 				return nil // DBI doesn't exists means no drop needed
@@ -851,22 +1033,24 @@ func (tx *MdbxTx) dropEvenIfBucketIsNotDeprecated(name string) error {
 	if err := tx.tx.Drop(mdbx.DBI(dbi), true); err != nil {
 		return err
 	}
-	cnfCopy := tx.db.buckets[name]
 	cnfCopy.DBI = NonExistingDBI
-	tx.db.buckets[name] = cnfCopy
+	tx.setTable(name, cnfCopy)
 	return nil
 }
 
 func (tx *MdbxTx) ClearBucket(bucket string) error {
-	dbi := tx.db.buckets[bucket].DBI
-	if dbi == NonExistingDBI {
+	cfg, _ := tx.db.tableCfg(bucket)
+	if cfg.DBI == NonExistingDBI {
 		return nil
 	}
-	return tx.tx.Drop(mdbx.DBI(dbi), false)
+	return tx.tx.Drop(mdbx.DBI(cfg.DBI), false)
 }
 
 func (tx *MdbxTx) DropBucket(bucket string) error {
-	if cfg, ok := tx.db.buckets[bucket]; !(ok && cfg.IsDeprecated) {
+	if err := tx.checkNotNested("drop", bucket); err != nil {
+		return err
+	}
+	if cfg, ok := tx.db.tableCfg(bucket); !(ok && cfg.IsDeprecated) {
 		return fmt.Errorf("%w, bucket: %s", kv.ErrAttemptToDeleteNonDeprecatedBucket, bucket)
 	}
 
@@ -874,27 +1058,74 @@ func (tx *MdbxTx) DropBucket(bucket string) error {
 }
 
 func (tx *MdbxTx) ExistsBucket(bucket string) (bool, error) {
-	if cfg, ok := tx.db.buckets[bucket]; ok {
+	if cfg, ok := tx.db.tableCfg(bucket); ok {
 		return cfg.DBI != NonExistingDBI, nil
 	}
 	return false, nil
 }
 
+// TableFlags - flags of table stored in db, may differ from configured flags of table
+func (tx *MdbxTx) TableFlags(table string) (kv.TableFlags, error) {
+	cfg, ok := tx.db.tableCfg(table)
+	if !ok || cfg.DBI == NonExistingDBI {
+		return 0, fmt.Errorf("table: %s, not found", table)
+	}
+	nativeFlags, err := tx.tx.Flags(mdbx.DBI(cfg.DBI))
+	if err != nil {
+		return 0, fmt.Errorf("table: %s, %w", table, err)
+	}
+	return tableFlagsFromNative(nativeFlags), nil
+}
+
+// RawCursor - cursor which doesn't apply AutoDupSortKeysConversion: returns keys and values as they are stored
+func (tx *MdbxTx) RawCursor(table string) (kv.Cursor, error) {
+	if cfg, ok := tx.db.tableCfg(table); !ok || cfg.DBI == NonExistingDBI {
+		return nil, fmt.Errorf("table: %s, not found", table)
+	}
+	c, err := tx.stdCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	c.(*MdbxCursor).bucketCfg.AutoDupSortKeysConversion = false
+	return c, nil
+}
+
 func (tx *MdbxTx) Commit() error {
 	if tx.tx == nil {
 		return nil
 	}
 	defer func() {
 		tx.tx = nil
+		tx.db.leakDetector.Del(tx.id)
+		if tx.parent != nil { // nested tx: thread and db tracking are owned by parent
+			tx.parent.child = nil
+			return
+		}
 		tx.db.trackTxEnd()
 		if tx.readOnly {
 			tx.db.roTxsLimiter.Release(1)
 		} else {
 			runtime.UnlockOSThread()
 		}
-		tx.db.leakDetector.Del(tx.id)
 	}()
+	if tx.child != nil { // not committed nested tx is discarded
+		tx.child.Rollback()
+	}
 	tx.closeCursors()
+	if tx.guard != nil {
+		if err := tx.db.readTxWatchdog.remove(tx.guard); err != nil {
+			tx.tx.Abort()
+			tx.revertTables()
+			return err
+		}
+	}
+
+	if tx.parent != nil {
+		if _, err := tx.tx.Commit(); err != nil {
+			return fmt.Errorf("label: %s, nested tx: %w", tx.db.opts.label, err)
+		}
+		return nil
+	}
 
 	//slowTx := 10 * time.Second
 	//if debug.SlowCommit() > 0 {
@@ -908,28 +1139,41 @@ func (tx *MdbxTx) Commit() error {
 
 	latency, err := tx.tx.Commit()
 	if err != nil {
+		tx.revertTables()
 		return fmt.Errorf("label: %s, %w", tx.db.opts.label, err)
 	}
+	tx.tablesUndo = nil
 
-	// AD: Added logging for commit latency, may need further guarding to prevent performance impact
-	//     preserved original code for reference
 	log.FromContext(tx.ctx).Debug("tx commit", "label", tx.db.opts.label, "latency", latency)
-	// if tx.db.opts.label == kv.ChainDB {
-	// 	kv.DbCommitPreparation.Observe(latency.Preparation.Seconds())
-	// 	//kv.DbCommitAudit.Update(latency.Audit.Seconds())
-	// 	kv.DbCommitWrite.Observe(latency.Write.Seconds())
-	// 	kv.DbCommitSync.Observe(latency.Sync.Seconds())
-	// 	kv.DbCommitEnding.Observe(latency.Ending.Seconds())
-	// 	kv.DbCommitTotal.Observe(latency.Whole.Seconds())
-
-	// 	//kv.DbGcWorkPnlMergeTime.Update(latency.GCDetails.WorkPnlMergeTime.Seconds())
-	// 	//kv.DbGcWorkPnlMergeVolume.Set(uint64(latency.GCDetails.WorkPnlMergeVolume))
-	// 	//kv.DbGcWorkPnlMergeCalls.Set(uint64(latency.GCDetails.WorkPnlMergeCalls))
-	// 	//
-	// 	//kv.DbGcSelfPnlMergeTime.Update(latency.GCDetails.SelfPnlMergeTime.Seconds())
-	// 	//kv.DbGcSelfPnlMergeVolume.Set(uint64(latency.GCDetails.SelfPnlMergeVolume))
-	// 	//kv.DbGcSelfPnlMergeCalls.Set(uint64(latency.GCDetails.SelfPnlMergeCalls))
-	// }
+	if m := tx.db.commitMetrics; m != nil {
+		m.Preparation.Observe(latency.Preparation.Seconds())
+		m.GCWallClock.Observe(latency.GCWallClock.Seconds())
+		m.GCCpuTime.Observe(latency.GCCpuTime.Seconds())
+		m.Audit.Observe(latency.Audit.Seconds())
+		m.Write.Observe(latency.Write.Seconds())
+		m.Sync.Observe(latency.Sync.Seconds())
+		m.Ending.Observe(latency.Ending.Seconds())
+		m.Total.Observe(latency.Whole.Seconds())
+
+		gc := latency.GCDetails
+		m.GcWorkRtime.Set(gc.WorkRtime.Seconds())
+		m.GcWorkXtime.Set(gc.WorkXtime.Seconds())
+		m.GcSelfRtime.Set(gc.SelfRtime.Seconds())
+		m.GcSelfXtime.Set(gc.SelfXtime.Seconds())
+		m.GcWorkRsteps.SetUint32(gc.WorkRsteps)
+		m.GcWorkRxpages.SetUint32(gc.WorkRxpages)
+		m.GcWorkMajflt.SetUint32(gc.WorkMajflt)
+		m.GcWorkCounter.SetUint32(gc.WorkCounter)
+		m.GcSelfRsteps.SetUint32(gc.SelfRsteps)
+		m.GcSelfXpages.SetUint32(gc.SelfXpages)
+		m.GcSelfMajflt.SetUint32(gc.SelfMajflt)
+		m.GcSelfCounter.SetUint32(gc.SelfCounter)
+		m.GcWloops.SetUint32(gc.Wloops)
+		m.GcCoalescences.SetUint32(gc.Coalescences)
+		m.GcWipes.SetUint32(gc.Wipes)
+		m.GcFlushes.SetUint32(gc.Flushes)
+		m.GcKicks.SetUint32(gc.Kicks)
+	}
 
 	return nil
 }
@@ -940,17 +1184,82 @@ func (tx *MdbxTx) Rollback() {
 	}
 	defer func() {
 		tx.tx = nil
+		tx.db.leakDetector.Del(tx.id)
+		if tx.parent != nil { // nested tx: thread and db tracking are owned by parent
+			tx.parent.child = nil
+			return
+		}
 		tx.db.trackTxEnd()
 		if tx.readOnly {
 			tx.db.roTxsLimiter.Release(1)
 		} else {
 			runtime.UnlockOSThread()
 		}
-		tx.db.leakDetector.Del(tx.id)
 	}()
+	if tx.child != nil { // not committed nested tx is discarded
+		tx.child.Rollback()
+	}
 	tx.closeCursors()
+	if tx.guard != nil {
+		_ = tx.db.readTxWatchdog.remove(tx.guard) // tx is aborted anyway
+	}
 	// tx.printDebugInfo()
 	tx.tx.Abort()
+	tx.revertTables()
+}
+
+// ErrCursorClosed - cursor is used after its Close, or after Renew/Commit/Rollback of its tx
+var ErrCursorClosed = kv.ErrCursorClosed
+
+// Renew - moves read-only tx to the latest snapshot of db. Unlike Rollback and BeginRo, keeps slot of roTxsLimiter and
+// lifetime of ReadTxPolicy starts from scratch. Cursors and streams of tx are closed: their reads return ErrCursorClosed.
+// Keys and values read before Renew must not be used after it. If Renew fails, tx can only be rolled back.
+func (tx *MdbxTx) Renew() error {
+	if !tx.readOnly {
+		return fmt.Errorf("label: %s, only read-only tx can be renewed", tx.db.opts.label)
+	}
+	tx.closeCursors()
+	if g := tx.guard; g != nil {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.expired == nil { // otherwise already reset by watchdog
+			tx.tx.Reset()
+		}
+		g.started, g.expired, g.warned = time.Now(), nil, false
+	} else {
+		tx.tx.Reset()
+	}
+	if err := tx.tx.Renew(); err != nil {
+		return fmt.Errorf("label: %s, %w", tx.db.opts.label, err)
+	}
+	return nil
+}
+
+// BeginNested - starts nested transaction: savepoint which can be rolled back without rolling back tx. Changes of
+// nested tx become visible in tx after its Commit. tx must not be used until nested tx is committed or rolled back,
+// not finished nested tx is rolled back by Commit/Rollback of tx. Not supported in WriteMap mode.
+func (tx *MdbxTx) BeginNested() (kv.RwTx, error) {
+	if tx.readOnly {
+		return nil, fmt.Errorf("%w: read-only tx, label: %s", kv.ErrNestedTxUnsupported, tx.db.opts.label)
+	}
+	if tx.db.opts.HasFlag(mdbx.WriteMap) {
+		return nil, fmt.Errorf("%w: db opened with WriteMap, label: %s", kv.ErrNestedTxUnsupported, tx.db.opts.label)
+	}
+	if tx.child != nil {
+		return nil, fmt.Errorf("label: %s, nested tx already started", tx.db.opts.label)
+	}
+	txn, err := tx.db.env.BeginTxn(tx.tx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("label: %s, nested tx: %w", tx.db.opts.label, err)
+	}
+	tx.child = &MdbxTx{
+		db:     tx.db,
+		tx:     txn,
+		ctx:    tx.ctx,
+		id:     tx.db.leakDetector.Add(),
+		parent: tx,
+	}
+	return tx.child, nil
 }
 
 func (tx *MdbxTx) SpaceDirty() (uint64, uint64, error) {
@@ -993,10 +1302,8 @@ func (tx *MdbxTx) closeCursors() {
 		}
 	}
 	tx.cursors = nil
-	for _, c := range tx.streams {
-		if c != nil {
-			c.Close()
-		}
+	for _, s := range tx.streams {
+		s.closeByTx()
 	}
 	tx.streams = nil
 	tx.statelessCursors = nil
@@ -1127,7 +1434,8 @@ func (tx *MdbxTx) BucketStat(name string) (*mdbx.Stat, error) {
 	if name == "root" {
 		return tx.tx.StatDBI(mdbx.DBI(1))
 	}
-	st, err := tx.tx.StatDBI(mdbx.DBI(tx.db.buckets[name].DBI))
+	cfg, _ := tx.db.tableCfg(name)
+	st, err := tx.tx.StatDBI(mdbx.DBI(cfg.DBI))
 	if err != nil {
 		return nil, fmt.Errorf("bucket: %s, %w", name, err)
 	}
@@ -1143,7 +1451,7 @@ func (tx *MdbxTx) DBSize() (uint64, error) {
 }
 
 func (tx *MdbxTx) RwCursor(bucket string) (kv.RwCursor, error) {
-	b := tx.db.buckets[bucket]
+	b, _ := tx.db.tableCfg(bucket)
 	if b.AutoDupSortKeysConversion {
 		return tx.stdCursor(bucket)
 	}
@@ -1160,8 +1468,8 @@ func (tx *MdbxTx) Cursor(bucket string) (kv.Cursor, error) {
 }
 
 func (tx *MdbxTx) stdCursor(bucket string) (kv.RwCursor, error) {
-	b := tx.db.buckets[bucket]
-	c := &MdbxCursor{bucketName: bucket, tx: tx, bucketCfg: b, dbi: mdbx.DBI(tx.db.buckets[bucket].DBI), id: tx.cursorID}
+	b, _ := tx.db.tableCfg(bucket)
+	c := &MdbxCursor{bucketName: bucket, tx: tx, bucketCfg: b, dbi: mdbx.DBI(b.DBI), id: tx.cursorID}
 	tx.cursorID++
 
 	var err error
@@ -1172,9 +1480,9 @@ func (tx *MdbxTx) stdCursor(bucket string) (kv.RwCursor, error) {
 
 	// add to auto-cleanup on end of transactions
 	if tx.cursors == nil {
-		tx.cursors = map[uint64]*mdbx.Cursor{}
+		tx.cursors = map[uint64]*MdbxCursor{}
 	}
-	tx.cursors[c.id] = c.c
+	tx.cursors[c.id] = c
 	return c, nil
 }
 
@@ -1191,42 +1499,62 @@ func (tx *MdbxTx) CursorDupSort(bucket string) (kv.CursorDupSort, error) {
 }
 
 // methods here help to see better pprof picture
-func (c *MdbxCursor) set(k []byte) ([]byte, []byte, error) { return c.c.Get(k, nil, mdbx.Set) }
-func (c *MdbxCursor) getCurrent() ([]byte, []byte, error)  { return c.c.Get(nil, nil, mdbx.GetCurrent) }
-func (c *MdbxCursor) first() ([]byte, []byte, error)       { return c.c.Get(nil, nil, mdbx.First) }
-func (c *MdbxCursor) next() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Next) }
-func (c *MdbxCursor) nextDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, mdbx.NextDup) }
-func (c *MdbxCursor) nextNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, mdbx.NextNoDup) }
-func (c *MdbxCursor) prev() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Prev) }
-func (c *MdbxCursor) prevDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, mdbx.PrevDup) }
-func (c *MdbxCursor) prevNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, mdbx.PrevNoDup) }
-func (c *MdbxCursor) last() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Last) }
+// get - all reads of cursor go through it, to not race with reset of expired read tx (see ReadTxPolicy)
+func (c *MdbxCursor) get(k, v []byte, op uint) ([]byte, []byte, error) {
+	if c.c == nil {
+		return nil, nil, ErrCursorClosed
+	}
+	if g := c.tx.guard; g != nil && !g.warnOnly {
+		if err := g.lock(); err != nil {
+			return nil, nil, err
+		}
+		defer g.unlock()
+	}
+	return c.c.Get(k, v, op)
+}
+
+func (c *MdbxCursor) set(k []byte) ([]byte, []byte, error) { return c.get(k, nil, mdbx.Set) }
+func (c *MdbxCursor) getCurrent() ([]byte, []byte, error)  { return c.get(nil, nil, mdbx.GetCurrent) }
+func (c *MdbxCursor) first() ([]byte, []byte, error)       { return c.get(nil, nil, mdbx.First) }
+func (c *MdbxCursor) next() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Next) }
+func (c *MdbxCursor) nextDup() ([]byte, []byte, error)     { return c.get(nil, nil, mdbx.NextDup) }
+func (c *MdbxCursor) nextNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, mdbx.NextNoDup) }
+func (c *MdbxCursor) prev() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Prev) }
+func (c *MdbxCursor) prevDup() ([]byte, []byte, error)     { return c.get(nil, nil, mdbx.PrevDup) }
+func (c *MdbxCursor) prevNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, mdbx.PrevNoDup) }
+func (c *MdbxCursor) last() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Last) }
 func (c *MdbxCursor) delCurrent() error                    { return c.c.Del(mdbx.Current) }
 func (c *MdbxCursor) delAllDupData() error                 { return c.c.Del(mdbx.AllDups) }
 func (c *MdbxCursor) put(k, v []byte) error                { return c.c.Put(k, v, 0) }
 func (c *MdbxCursor) putCurrent(k, v []byte) error         { return c.c.Put(k, v, mdbx.Current) }
 func (c *MdbxCursor) putNoOverwrite(k, v []byte) error     { return c.c.Put(k, v, mdbx.NoOverwrite) }
 func (c *MdbxCursor) getBoth(k, v []byte) ([]byte, error) {
-	_, v, err := c.c.Get(k, v, mdbx.GetBoth)
+	_, v, err := c.get(k, v, mdbx.GetBoth)
 	return v, err
 }
 func (c *MdbxCursor) setRange(k []byte) ([]byte, []byte, error) {
-	return c.c.Get(k, nil, mdbx.SetRange)
+	return c.get(k, nil, mdbx.SetRange)
 }
 func (c *MdbxCursor) getBothRange(k, v []byte) ([]byte, error) {
-	_, v, err := c.c.Get(k, v, mdbx.GetBothRange)
+	_, v, err := c.get(k, v, mdbx.GetBothRange)
 	return v, err
 }
 func (c *MdbxCursor) firstDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, mdbx.FirstDup)
+	_, v, err := c.get(nil, nil, mdbx.FirstDup)
 	return v, err
 }
 func (c *MdbxCursor) lastDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, mdbx.LastDup)
+	_, v, err := c.get(nil, nil, mdbx.LastDup)
 	return v, err
 }
 
 func (c *MdbxCursor) Count() (uint64, error) {
+	if g := c.tx.guard; g != nil && !g.warnOnly {
+		if err := g.lock(); err != nil {
+			return 0, err
+		}
+		defer g.unlock()
+	}
 	st, err := c.tx.tx.StatDBI(c.dbi)
 	if err != nil {
 		return 0, err
@@ -1720,6 +2048,15 @@ func (c *MdbxDupSortCursor) DeleteCurrentDuplicates() error {
 
 // CountDuplicates returns the number of duplicates for the current key. See mdb_cursor_count
 func (c *MdbxDupSortCursor) CountDuplicates() (uint64, error) {
+	if c.c == nil {
+		return 0, ErrCursorClosed
+	}
+	if g := c.tx.guard; g != nil && !g.warnOnly {
+		if err := g.lock(); err != nil {
+			return 0, err
+		}
+		defer g.unlock()
+	}
 	res, err := c.c.Count()
 	if err != nil {
 		return 0, fmt.Errorf("in CountDuplicates: %w", err)
@@ -1795,6 +2132,12 @@ func (tx *MdbxTx) RangeDescend(table string, fromPrefix, toPrefix []byte, limit
 	return tx.rangeOrderLimit(table, fromPrefix, toPrefix, order.Desc, limit)
 }
 
+// txStream - stream of tx, closed by tx on Renew/Commit/Rollback
+type txStream interface {
+	kv.Closer
+	closeByTx()
+}
+
 type cursor2iter struct {
 	c  kv.Cursor
 	id int
@@ -1805,22 +2148,25 @@ type cursor2iter struct {
 	orderAscend                        order.By
 	limit                              int64
 	ctx                                context.Context
+	cmp                                func(a, b []byte) int // keys order of table
 }
 
 func (tx *MdbxTx) rangeOrderLimit(table string, fromPrefix, toPrefix []byte, orderAscend order.By, limit int) (*cursor2iter, error) {
 	s := &cursor2iter{ctx: tx.ctx, tx: tx, fromPrefix: fromPrefix, toPrefix: toPrefix, orderAscend: orderAscend, limit: int64(limit), id: tx.streamID}
 	tx.streamID++
 	if tx.streams == nil {
-		tx.streams = map[int]kv.Closer{}
+		tx.streams = map[int]txStream{}
 	}
 	tx.streams[s.id] = s
 	return s.init(table, tx)
 }
 func (s *cursor2iter) init(table string, tx kv.Tx) (*cursor2iter, error) {
-	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && bytes.Compare(s.fromPrefix, s.toPrefix) >= 0 {
+	cfg, _ := s.tx.db.tableCfg(table)
+	s.cmp = cfg.CompareKeys
+	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) >= 0 {
 		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.fromPrefix, s.toPrefix)
 	}
-	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && bytes.Compare(s.fromPrefix, s.toPrefix) <= 0 {
+	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) <= 0 {
 		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.toPrefix, s.fromPrefix)
 	}
 	c, err := tx.Cursor(table)
@@ -1838,24 +2184,20 @@ func (s *cursor2iter) init(table string, tx kv.Tx) (*cursor2iter, error) {
 		return s, s.err
 	}
 
-	if s.orderAscend {
-		s.nextK, s.nextV, s.err = s.c.Seek(s.fromPrefix)
-		return s, s.err
-	} else {
-		// seek exactly to given key or previous one
-		s.nextK, s.nextV, s.err = s.c.SeekExact(s.fromPrefix)
-		if s.err != nil {
-			return s, s.err
-		}
-		if s.nextK != nil { // go to last value of this key
-			if casted, ok := s.c.(kv.CursorDupSort); ok {
-				s.nextV, s.err = casted.LastDup()
-			}
-		} else { // key not found, go to prev one
-			s.nextK, s.nextV, s.err = s.c.Prev()
-		}
+	s.nextK, s.nextV, s.err = s.c.Seek(s.fromPrefix)
+	if s.orderAscend || s.err != nil {
 		return s, s.err
 	}
+	// descend: start from given key or previous one. Prev after not found SeekExact is undefined in DupSort table.
+	switch {
+	case s.nextK == nil: // all keys are before fromPrefix
+		s.nextK, s.nextV, s.err = s.c.Last()
+	case s.cmp(s.nextK, s.fromPrefix) != 0:
+		s.nextK, s.nextV, s.err = s.c.Prev()
+	case cfg.Flags&kv.DupSort != 0 && !cfg.AutoDupSortKeysConversion: // go to last value of this key
+		s.nextV, s.err = s.c.(kv.CursorDupSort).LastDup()
+	}
+	return s, s.err
 }
 
 func (s *cursor2iter) Close() {
@@ -1863,8 +2205,15 @@ func (s *cursor2iter) Close() {
 		s.c.Close()
 		delete(s.tx.streams, s.id)
 		s.c = nil
+		s.nextK, s.err = nil, nil
 	}
 }
+
+// closeByTx - stream closed by tx (see MdbxTx.Renew) returns error instead of silent end
+func (s *cursor2iter) closeByTx() {
+	s.Close()
+	s.err = ErrCursorClosed
+}
 func (s *cursor2iter) HasNext() bool {
 	if s.err != nil { // always true, then .Next() call will return this error
 		return true
@@ -1881,7 +2230,7 @@ func (s *cursor2iter) HasNext() bool {
 
 	//Asc:  [from, to) AND from > to
 	//Desc: [from, to) AND from < to
-	cmp := bytes.Compare(s.nextK, s.toPrefix)
+	cmp := s.cmp(s.nextK, s.toPrefix)
 	return (bool(s.orderAscend) && cmp < 0) || (!bool(s.orderAscend) && cmp > 0)
 }
 func (s *cursor2iter) Next() (k, v []byte, err error) {
@@ -1890,6 +2239,9 @@ func (s *cursor2iter) Next() (k, v []byte, err error) {
 		return nil, nil, s.ctx.Err()
 	default:
 	}
+	if s.c == nil {
+		return nil, nil, ErrCursorClosed
+	}
 	s.limit--
 	k, v, err = s.nextK, s.nextV, s.err
 	if s.orderAscend {
@@ -1904,7 +2256,7 @@ func (tx *MdbxTx) RangeDupSort(table string, key []byte, fromPrefix, toPrefix []
 	s := &cursorDup2iter{ctx: tx.ctx, tx: tx, key: key, fromPrefix: fromPrefix, toPrefix: toPrefix, orderAscend: bool(asc), limit: int64(limit), id: tx.streamID}
 	tx.streamID++
 	if tx.streams == nil {
-		tx.streams = map[int]kv.Closer{}
+		tx.streams = map[int]txStream{}
 	}
 	tx.streams[s.id] = s
 	return s.init(table, tx)
@@ -1921,13 +2273,16 @@ type cursorDup2iter struct {
 	orderAscend                 bool
 	limit                       int64
 	ctx                         context.Context
+	cmp                         func(a, b []byte) int // values order of table
 }
 
 func (s *cursorDup2iter) init(table string, tx kv.Tx) (*cursorDup2iter, error) {
-	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && bytes.Compare(s.fromPrefix, s.toPrefix) >= 0 {
+	cfg, _ := s.tx.db.tableCfg(table)
+	s.cmp = cfg.CompareDups
+	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) >= 0 {
 		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.fromPrefix, s.toPrefix)
 	}
-	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && bytes.Compare(s.fromPrefix, s.toPrefix) <= 0 {
+	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) <= 0 {
 		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.toPrefix, s.fromPrefix)
 	}
 	c, err := tx.CursorDupSort(table)
@@ -1970,8 +2325,15 @@ func (s *cursorDup2iter) Close() {
 		s.c.Close()
 		delete(s.tx.streams, s.id)
 		s.c = nil
+		s.nextV, s.err = nil, nil
 	}
 }
+
+// closeByTx - see cursor2iter.closeByTx
+func (s *cursorDup2iter) closeByTx() {
+	s.Close()
+	s.err = ErrCursorClosed
+}
 func (s *cursorDup2iter) HasNext() bool {
 	if s.err != nil { // always true, then .Next() call will return this error
 		return true
@@ -1988,7 +2350,7 @@ func (s *cursorDup2iter) HasNext() bool {
 
 	//Asc:  [from, to) AND from > to
 	//Desc: [from, to) AND from < to
-	cmp := bytes.Compare(s.nextV, s.toPrefix)
+	cmp := s.cmp(s.nextV, s.toPrefix)
 	return (s.orderAscend && cmp < 0) || (!s.orderAscend && cmp > 0)
 }
 func (s *cursorDup2iter) Next() (k, v []byte, err error) {
@@ -1997,6 +2359,9 @@ func (s *cursorDup2iter) Next() (k, v []byte, err error) {
 		return nil, nil, s.ctx.Err()
 	default:
 	}
+	if s.c == nil {
+		return nil, nil, ErrCursorClosed
+	}
 	s.limit--
 	v, err = s.nextV, s.err
 	if s.orderAscend {
@@ -0,0 +1,279 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/erigontech/mdbx-go/mdbx"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/common/dir"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+const (
+	backupCommitEvery   = 1_000_000 // amount of entries written by 1 transaction of backup
+	backupProgressEvery = 64 * 1024 // how often (in entries) ctx is checked and progress reported
+)
+
+// BackupOpts - options of MdbxKV.Backup
+type BackupOpts struct {
+	// KeepSize - copy preserves file size of source db: keeps same reserve for growth. Otherwise, copy has minimal file
+	// size. Copy is logical - entries are re-inserted, so it's always compact: free pages of source are never copied.
+	KeepSize bool
+	// Progress - called periodically during copy and after each table. Called from the goroutine of Backup.
+	Progress func(p BackupProgress)
+}
+
+type BackupProgress struct {
+	Table       string
+	TablesDone  int
+	TablesTotal int
+	Entries     uint64 // copied entries of Table
+	Total       uint64 // entries in Table
+}
+
+// BackupInfo - describes snapshot which was copied by Backup, used by VerifyBackup
+type BackupInfo struct {
+	ViewID uint64            // id of read transaction which was copied
+	Tables map[string]uint64 // table -> amount of entries
+}
+
+// Backup - writes consistent snapshot of db to dstDir. Db stays available for readers and writers during backup:
+// copy is done by 1 read transaction, which holds old pages of db from re-use until Backup returns.
+//
+// Copy is logical, not page-by-page: entries of every table are re-inserted into new db, so free pages of source are
+// dropped and copy is compacted. Copy is opened with default label kv.InMem - it doesn't export series of db's label.
+func (db *MdbxKV) Backup(ctx context.Context, dstDir string, opts BackupOpts) (*BackupInfo, error) {
+	if dir.FileExist(filepath.Join(dstDir, "mdbx.dat")) {
+		return nil, fmt.Errorf("backup: db already exists in %s", dstDir)
+	}
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	info, err := tx.(*MdbxTx).backup(ctx, dstDir, opts)
+	if err != nil {
+		// don't leave partial copy
+		_ = os.Remove(filepath.Join(dstDir, "mdbx.dat"))
+		_ = os.Remove(filepath.Join(dstDir, "mdbx.lck"))
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	return info, nil
+}
+
+// BackupTo - same as Backup, but streams copy to w. tmpDir is used to build copy before streaming.
+func (db *MdbxKV) BackupTo(ctx context.Context, w io.Writer, tmpDir string, opts BackupOpts) (*BackupInfo, error) {
+	dstDir, err := os.MkdirTemp(tmpDir, "mdbx-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dstDir)
+
+	info, err := db.Backup(ctx, dstDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dstDir, "mdbx.dat"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(w, f, int64(16*datasize.MB)); err != nil {
+			if errors.Is(err, io.EOF) {
+				return info, nil
+			}
+			return nil, fmt.Errorf("backup: %w", err)
+		}
+	}
+}
+
+func (tx *MdbxTx) backup(ctx context.Context, dstDir string, opts BackupOpts) (*BackupInfo, error) {
+	tables, err := tx.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tables)
+
+	info := &BackupInfo{ViewID: tx.ViewID(), Tables: make(map[string]uint64, len(tables))}
+	dstCfg := make(kv.TableCfg, len(tables))
+	srcDBIs := make(map[string]mdbx.DBI, len(tables))
+	for _, name := range tables {
+		cfg, ok := tx.db.tableCfg(name)
+		dbi := mdbx.DBI(cfg.DBI)
+		if !ok || cfg.DBI == NonExistingDBI {
+			cmps, _ := tx.db.tableCmps(name)
+			if dbi, err = tx.tx.OpenDBI(name, 0, cmps.keyCmp, cmps.dupCmp); err != nil {
+				return nil, fmt.Errorf("table: %s, %w", name, err)
+			}
+		}
+		nativeFlags, err := tx.tx.Flags(dbi)
+		if err != nil {
+			return nil, fmt.Errorf("table: %s, %w", name, err)
+		}
+		st, err := tx.tx.StatDBI(dbi)
+		if err != nil {
+			return nil, fmt.Errorf("table: %s, %w", name, err)
+		}
+		srcDBIs[name] = dbi
+		info.Tables[name] = st.Entries
+		dstCfg[name] = kv.TableCfgItem{Flags: tableFlagsFromNative(nativeFlags), KeyCmp: cfg.KeyCmp, DupCmp: cfg.DupCmp}
+	}
+
+	envInfo, err := tx.db.env.Info(tx.tx)
+	if err != nil {
+		return nil, err
+	}
+	dstOpts := NewMDBX(tx.db.log).Path(dstDir).Label(kv.InMem).
+		PageSize(tx.db.opts.pageSize).MapSize(datasize.ByteSize(envInfo.Geo.Upper)).GrowthStep(tx.db.opts.growthStep).
+		WithTableCfg(dstCfg)
+	dstOpts = dstOpts.WithEnvOptions(func(dstOpts MdbxOpts, env *mdbx.Env) error {
+		if opts.KeepSize {
+			return env.SetGeometry(-1, int(envInfo.Geo.Current), int(envInfo.Geo.Upper), int(dstOpts.growthStep), dstOpts.shrinkThreshold, int(dstOpts.pageSize))
+		}
+		// minimal size and default growth step of MDBX: growth step of source may be bigger than whole copy
+		return env.SetGeometry(-1, 0, int(envInfo.Geo.Upper), -1, -1, int(dstOpts.pageSize))
+	})
+	dst, err := dstOpts.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	for i, name := range tables {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p := BackupProgress{Table: name, TablesDone: i, TablesTotal: len(tables), Total: info.Tables[name]}
+		if err := tx.backupTable(ctx, dst.(*MdbxKV), srcDBIs[name], &p, opts.Progress); err != nil {
+			return nil, fmt.Errorf("table: %s, %w", name, err)
+		}
+		p.TablesDone++
+		if opts.Progress != nil {
+			opts.Progress(p)
+		}
+	}
+	return info, nil
+}
+
+func (tx *MdbxTx) backupTable(ctx context.Context, dst *MdbxKV, dbi mdbx.DBI, p *BackupProgress, progress func(p BackupProgress)) error {
+	c, err := tx.tx.OpenCursor(dbi)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	putFlags := uint(mdbx.Append)
+	if dst.buckets[p.Table].Flags&kv.DupSort != 0 {
+		putFlags = mdbx.AppendDup
+	}
+	k, v, err := c.Get(nil, nil, mdbx.First)
+	if mdbx.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for done := false; !done; {
+		// every batch is own write transaction - to not accumulate too much dirty pages
+		if err := dst.Update(ctx, func(dstTx kv.RwTx) error {
+			dstC, err := dstTx.(*MdbxTx).tx.OpenCursor(mdbx.DBI(dst.buckets[p.Table].DBI))
+			if err != nil {
+				return err
+			}
+			defer dstC.Close()
+			for batch := 0; batch < backupCommitEvery; batch++ {
+				if err = dstC.Put(k, v, putFlags); err != nil {
+					return err
+				}
+				p.Entries++
+				if p.Entries%backupProgressEvery == 0 {
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					if progress != nil {
+						progress(*p)
+					}
+				}
+				k, v, err = c.Get(nil, nil, mdbx.Next)
+				if mdbx.IsNotFound(err) {
+					done = true
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyBackup - opens copy made by Backup in read-only mode and checks that it has same tables with same amount of
+// entries as source snapshot.
+func VerifyBackup(ctx context.Context, path string, info *BackupInfo, logger log.Logger) error {
+	db, err := NewMDBX(logger).Path(path).Readonly().WithTableCfg(kv.TableCfg{}).Open(ctx)
+	if err != nil {
+		return fmt.Errorf("verify backup: %w", err)
+	}
+	defer db.Close()
+
+	return db.(*MdbxKV).env.View(func(txn *mdbx.Txn) error {
+		tables, err := txn.ListDBI()
+		if err != nil {
+			return err
+		}
+		if len(tables) != len(info.Tables) {
+			return fmt.Errorf("verify backup: expected %d tables, got %d", len(info.Tables), len(tables))
+		}
+		for _, name := range tables {
+			expected, ok := info.Tables[name]
+			if !ok {
+				return fmt.Errorf("verify backup: unexpected table %s", name)
+			}
+			dbi, err := txn.OpenDBI(name, 0, nil, nil)
+			if err != nil {
+				return fmt.Errorf("verify backup: table: %s, %w", name, err)
+			}
+			st, err := txn.StatDBI(dbi)
+			if err != nil {
+				return fmt.Errorf("verify backup: table: %s, %w", name, err)
+			}
+			if st.Entries != expected {
+				return fmt.Errorf("verify backup: table: %s, expected %d entries, got %d", name, expected, st.Entries)
+			}
+		}
+		return nil
+	})
+}
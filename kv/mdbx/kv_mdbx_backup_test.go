@@ -0,0 +1,182 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func backupTestDB(t *testing.T) kv.RwDB {
+	t.Helper()
+	db := NewMDBX(log.NewNoop()).Path(t.TempDir()).WithTableCfg(kv.TableCfg{
+		"Plain":   {},
+		"DupSort": {Flags: kv.DupSort},
+	}).MapSize(128 * datasize.MB).MustOpen()
+	t.Cleanup(db.Close)
+
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := uint64(0); i < 1000; i++ {
+			k := binary.BigEndian.AppendUint64(nil, i)
+			if err := tx.Put("Plain", k, k); err != nil {
+				return err
+			}
+			if err := tx.Put("DupSort", k[:7], k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	return db
+}
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	db := backupTestDB(t)
+
+	dst := t.TempDir()
+	var progressCalls int
+	info, err := db.(*MdbxKV).Backup(ctx, dst, BackupOpts{Progress: func(p BackupProgress) { progressCalls++ }})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), info.Tables["Plain"])
+	require.Equal(t, uint64(1000), info.Tables["DupSort"])
+	require.Equal(t, len(info.Tables), progressCalls)
+
+	// writes after backup are not visible in copy
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put("Plain", []byte{0xff}, []byte{0xff}) }))
+	require.NoError(t, VerifyBackup(ctx, dst, info, log.NewNoop()))
+
+	_, err = db.(*MdbxKV).Backup(ctx, dst, BackupOpts{})
+	require.ErrorContains(t, err, "already exists")
+
+	copyDB := NewMDBX(log.NewNoop()).Path(dst).Readonly().WithTableCfg(kv.TableCfg{"Plain": {}, "DupSort": {Flags: kv.DupSort}}).MustOpen()
+	defer copyDB.Close()
+	require.NoError(t, copyDB.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne("Plain", binary.BigEndian.AppendUint64(nil, 999))
+		require.NoError(t, err)
+		require.Equal(t, binary.BigEndian.AppendUint64(nil, 999), v)
+		st, err := tx.(*MdbxTx).BucketStat("DupSort")
+		require.NoError(t, err)
+		require.Equal(t, uint64(1000), st.Entries)
+		return nil
+	}))
+}
+
+func TestBackupLabel(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).Label("backup_test").WithTableCfg(kv.TableCfg{"Plain": {}}).MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put("Plain", []byte{1}, []byte{1}) }))
+
+	// copy doesn't take label of db: it's in use while db is open
+	dst := t.TempDir()
+	info, err := db.(*MdbxKV).Backup(ctx, dst, BackupOpts{})
+	require.NoError(t, err)
+	require.NoError(t, VerifyBackup(ctx, dst, info, log.NewNoop()))
+	require.Contains(t, db.(*MdbxKV).metrics.Set.ListMetricNames(), `db_size{label="backup_test"}`)
+}
+
+func TestBackupTo(t *testing.T) {
+	ctx := context.Background()
+	db := backupTestDB(t)
+
+	var buf bytes.Buffer
+	info, err := db.(*MdbxKV).BackupTo(ctx, &buf, t.TempDir(), BackupOpts{})
+	require.NoError(t, err)
+
+	dst := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "mdbx.dat"), buf.Bytes(), 0644))
+	require.NoError(t, VerifyBackup(ctx, dst, info, log.NewNoop()))
+
+	info.Tables["Plain"]++
+	require.ErrorContains(t, VerifyBackup(ctx, dst, info, log.NewNoop()), "entries")
+}
+
+func TestBackupCancel(t *testing.T) {
+	db := backupTestDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dst := t.TempDir()
+	_, err := db.(*MdbxKV).Backup(ctx, dst, BackupOpts{})
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoFileExists(t, filepath.Join(dst, "mdbx.dat"))
+
+	// cancel in the middle of table
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := uint64(1000); i < 3*backupProgressEvery; i++ {
+			k := binary.BigEndian.AppendUint64(nil, i)
+			if err := tx.Put("Plain", k, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var last BackupProgress
+	_, err = db.(*MdbxKV).Backup(ctx, dst, BackupOpts{Progress: func(p BackupProgress) {
+		last = p
+		if p.Table == "Plain" && p.Entries > 0 {
+			cancel()
+		}
+	}})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, "Plain", last.Table)
+	require.Equal(t, uint64(backupProgressEvery), last.Entries)
+	require.NoFileExists(t, filepath.Join(dst, "mdbx.dat"))
+
+	// cancel between tables
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	_, err = db.(*MdbxKV).Backup(ctx, dst, BackupOpts{Progress: func(p BackupProgress) {
+		if p.TablesDone == 1 {
+			cancel()
+		}
+	}})
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoFileExists(t, filepath.Join(dst, "mdbx.dat"))
+}
+
+func TestBackupKeepSize(t *testing.T) {
+	ctx := context.Background()
+	db := backupTestDB(t)
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.ClearBucket("Plain") })) // free pages
+
+	fileSize := func(dir string) int64 {
+		st, err := os.Stat(filepath.Join(dir, "mdbx.dat"))
+		require.NoError(t, err)
+		return st.Size()
+	}
+	compact, keepSize := t.TempDir(), t.TempDir()
+	_, err := db.(*MdbxKV).Backup(ctx, compact, BackupOpts{})
+	require.NoError(t, err)
+	_, err = db.(*MdbxKV).Backup(ctx, keepSize, BackupOpts{KeepSize: true})
+	require.NoError(t, err)
+	require.Equal(t, fileSize(db.(*MdbxKV).opts.path), fileSize(keepSize))
+	require.Less(t, fileSize(compact), fileSize(keepSize))
+}
@@ -0,0 +1,127 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+const (
+	DefaultMaxBatchSize  = 1000
+	DefaultMaxBatchDelay = 10 * time.Millisecond
+)
+
+// errBatchTrySolo - call failed inside of batch and must be re-run in own transaction
+var errBatchTrySolo = errors.New("batch: call failed, re-run in own transaction")
+
+// batch - calls of Batch which will be executed in one transaction. New calls are added while batch is
+// MdbxKV.batch, it's detached from db when full or when its delay expires.
+type batch struct {
+	calls []batchCall
+	full  chan struct{} // closed by Batch call which fills batch
+}
+
+type batchCall struct {
+	fn  func(kv.RwTx) error
+	err chan<- error // buffered, receives result of call
+}
+
+// Batch - runs f in write transaction shared with concurrent Batch calls: one commit for many small writes.
+// Batch returns when transaction which executed f is committed.
+//
+// Batch is useful only when many goroutines call it. Queued calls are executed when MdbxOpts.BatchLimits size is
+// reached or after its delay. If f returns error, transaction is rolled back, f is removed from batch and executed
+// in own transaction, other calls are re-run. So f may be called multiple times and must not have side effects
+// outside of tx. ctx is checked only before queueing and by own transaction of f.
+func (db *MdbxKV) Batch(ctx context.Context, f func(tx kv.RwTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	errCh := make(chan error, 1)
+
+	db.batchMu.Lock()
+	b := db.batch
+	if b == nil {
+		b = &batch{full: make(chan struct{})}
+		db.batch = b
+		go db.runBatch(b)
+	}
+	b.calls = append(b.calls, batchCall{fn: f, err: errCh})
+	if len(b.calls) >= db.opts.maxBatchSize {
+		db.batch = nil
+		close(b.full)
+	}
+	db.batchMu.Unlock()
+
+	err := <-errCh
+	if errors.Is(err, errBatchTrySolo) {
+		err = db.Update(ctx, f)
+	}
+	return err
+}
+
+// runBatch - waits until b is full or its delay expires, then executes its calls
+func (db *MdbxKV) runBatch(b *batch) {
+	timer := time.NewTimer(db.opts.maxBatchDelay)
+	select {
+	case <-b.full:
+		timer.Stop()
+	case <-timer.C:
+	}
+	db.batchMu.Lock()
+	if db.batch == b {
+		db.batch = nil
+	}
+	calls := b.calls // b is detached: calls are not changed anymore
+	db.batchMu.Unlock()
+
+	for len(calls) > 0 {
+		failed := -1
+		err := db.Update(context.Background(), func(tx kv.RwTx) error {
+			for i, c := range calls {
+				if err := callRecovered(c.fn, tx); err != nil {
+					failed = i
+					return err
+				}
+			}
+			return nil
+		})
+		if failed < 0 { // committed, or error of db - same for all calls
+			for _, c := range calls {
+				c.err <- err
+			}
+			return
+		}
+		calls[failed].err <- errBatchTrySolo
+		calls = append(calls[:failed], calls[failed+1:]...)
+	}
+}
+
+// callRecovered - panic of f is returned as error: f is re-run in own transaction and panics in goroutine of caller
+func callRecovered(f func(kv.RwTx) error, tx kv.RwTx) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("batch: call panicked: %v", p)
+		}
+	}()
+	return f(tx)
+}
@@ -0,0 +1,113 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).
+		BatchLimits(50, time.Second).MustOpen().(*MdbxKV)
+	defer db.Close()
+
+	errFailed := errors.New("failed")
+	var mu sync.Mutex
+	txIDs := map[uint64]struct{}{}
+	errs := make([]error, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.Batch(ctx, func(tx kv.RwTx) error {
+				mu.Lock()
+				txIDs[tx.ViewID()] = struct{}{}
+				mu.Unlock()
+				if err := tx.Put("Table", []byte{byte(i)}, []byte{byte(i)}); err != nil {
+					return err
+				}
+				if i == 7 {
+					return errFailed
+				}
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i == 7 {
+			require.ErrorIs(t, err, errFailed)
+			continue
+		}
+		require.NoError(t, err)
+	}
+	// 2 full batches, re-run of batch without failed call and solo run of failed call
+	require.LessOrEqual(t, len(txIDs), 4)
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		for i := 0; i < 100; i++ {
+			v, err := tx.GetOne("Table", []byte{byte(i)})
+			require.NoError(t, err)
+			if i == 7 {
+				require.Nil(t, v)
+				continue
+			}
+			require.Equal(t, []byte{byte(i)}, v)
+		}
+		return nil
+	}))
+}
+
+func TestBatchPanic(t *testing.T) {
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).
+		BatchLimits(1, time.Millisecond).MustOpen().(*MdbxKV)
+	defer db.Close()
+
+	// panic is re-raised in goroutine of caller
+	require.PanicsWithValue(t, "boom", func() {
+		_ = db.Batch(context.Background(), func(tx kv.RwTx) error { panic("boom") })
+	})
+	require.NoError(t, db.Batch(context.Background(), func(tx kv.RwTx) error { return tx.Put("Table", []byte{1}, []byte{1}) }))
+}
+
+func TestBatchLimits(t *testing.T) {
+	for _, limits := range []struct {
+		size  int
+		delay time.Duration
+	}{{0, time.Second}, {-1, time.Second}, {10, 0}, {10, -time.Second}} {
+		_, err := NewMDBX(log.NewNoop()).InMem(t.TempDir()).BatchLimits(limits.size, limits.delay).Open(context.Background())
+		require.ErrorContains(t, err, "BatchLimits", limits)
+	}
+
+	// not full batch is executed after delay
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).
+		BatchLimits(50, time.Millisecond).MustOpen().(*MdbxKV)
+	defer db.Close()
+	require.NoError(t, db.Batch(context.Background(), func(tx kv.RwTx) error { return tx.Put("Table", []byte{1}, []byte{1}) }))
+}
@@ -0,0 +1,165 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+/*
+#include <stddef.h>
+
+// same layout as MDBX_val
+typedef struct {
+	void *iov_base;
+	size_t iov_len;
+} mdbxgo_cmp_val;
+
+typedef int (mdbxgo_cmp_func)(const mdbxgo_cmp_val *a, const mdbxgo_cmp_val *b);
+
+extern int mdbxgoCmp(int slot, void *a, size_t aLen, void *b, size_t bLen);
+
+// MDBX doesn't pass any context to comparator - so each registered Go comparator gets own C function
+#define MDBXGO_CMP(n, i) \
+	static int mdbxgo_cmp_##n##_##i(const mdbxgo_cmp_val *a, const mdbxgo_cmp_val *b) { \
+		return mdbxgoCmp(n * 8 + i, a->iov_base, a->iov_len, b->iov_base, b->iov_len); \
+	}
+#define MDBXGO_CMP8(n) MDBXGO_CMP(n, 0) MDBXGO_CMP(n, 1) MDBXGO_CMP(n, 2) MDBXGO_CMP(n, 3) \
+	MDBXGO_CMP(n, 4) MDBXGO_CMP(n, 5) MDBXGO_CMP(n, 6) MDBXGO_CMP(n, 7)
+
+MDBXGO_CMP8(0) MDBXGO_CMP8(1) MDBXGO_CMP8(2) MDBXGO_CMP8(3)
+MDBXGO_CMP8(4) MDBXGO_CMP8(5) MDBXGO_CMP8(6) MDBXGO_CMP8(7)
+
+#define MDBXGO_CMP8_REF(n) mdbxgo_cmp_##n##_0, mdbxgo_cmp_##n##_1, mdbxgo_cmp_##n##_2, mdbxgo_cmp_##n##_3, \
+	mdbxgo_cmp_##n##_4, mdbxgo_cmp_##n##_5, mdbxgo_cmp_##n##_6, mdbxgo_cmp_##n##_7
+
+// index in array is slot number
+static mdbxgo_cmp_func *const mdbxgo_cmps[] = {
+	MDBXGO_CMP8_REF(0), MDBXGO_CMP8_REF(1), MDBXGO_CMP8_REF(2), MDBXGO_CMP8_REF(3),
+	MDBXGO_CMP8_REF(4), MDBXGO_CMP8_REF(5), MDBXGO_CMP8_REF(6), MDBXGO_CMP8_REF(7),
+};
+
+static void *mdbxgo_cmp_func_ptr(int i) { return (void *)mdbxgo_cmps[i]; }
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/erigontech/mdbx-go/mdbx"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+// MaxCustomComparators - how many kv.TableCfgItem.KeyCmp/DupCmp can be used by all opened databases of process
+const MaxCustomComparators = 64
+
+// comparators - registry of Go comparators called by C functions from `mdbxgo_cmps`. Slot `i` of registry is called by
+// C function with `i` slot number.
+var comparators struct {
+	mu    sync.Mutex
+	slots [MaxCustomComparators]atomic.Pointer[kv.CmpFunc]
+	dup   [MaxCustomComparators]bool // slot is used to compare values of DupSort table
+}
+
+//export mdbxgoCmp
+func mdbxgoCmp(slot C.int, a unsafe.Pointer, aLen C.size_t, b unsafe.Pointer, bLen C.size_t) C.int {
+	cmp := *comparators.slots[slot].Load()
+	// slices point to mmap or to memory of caller - valid only during this call and must not be retained by comparator
+	k1, k2 := unsafe.Slice((*byte)(a), int(aLen)), unsafe.Slice((*byte)(b), int(bLen))
+	var res int
+	if comparators.dup[slot] {
+		res = cmp(nil, nil, k1, k2)
+	} else {
+		res = cmp(k1, k2, nil, nil)
+	}
+	switch {
+	case res < 0:
+		return -1
+	case res > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// registerComparator - binds cmp to free C comparator. Slot must be released by unregisterComparator after env closing.
+func registerComparator(cmp kv.CmpFunc, dup bool) (slot int, nativeCmp mdbx.CmpFunc, err error) {
+	comparators.mu.Lock()
+	defer comparators.mu.Unlock()
+	for i := range comparators.slots {
+		if comparators.slots[i].Load() != nil {
+			continue
+		}
+		comparators.dup[i] = dup
+		comparators.slots[i].Store(&cmp)
+		return i, mdbx.CmpFunc(C.mdbxgo_cmp_func_ptr(C.int(i))), nil
+	}
+	return 0, nil, fmt.Errorf("too many custom comparators, max: %d", MaxCustomComparators)
+}
+
+func unregisterComparator(slot int) {
+	comparators.mu.Lock()
+	defer comparators.mu.Unlock()
+	comparators.slots[slot].Store(nil)
+}
+
+// tableComparators - C comparators of table, nil means default comparator
+type tableComparators struct {
+	keyCmp, dupCmp mdbx.CmpFunc
+}
+
+// registerTableComparators - registers KeyCmp and DupCmp of all tables, returns slots to release on db close
+func registerTableComparators(tables kv.TableCfg) (map[string]tableComparators, []int, error) {
+	res := map[string]tableComparators{}
+	var slots []int
+	for name, cfg := range tables {
+		if cfg.KeyCmp == nil && cfg.DupCmp == nil {
+			continue
+		}
+		if cfg.DupCmp != nil && cfg.Flags&kv.DupSort == 0 {
+			unregisterComparators(slots)
+			return nil, nil, fmt.Errorf("table: %s, DupCmp requires DupSort flag", name)
+		}
+		var cmps tableComparators
+		if cfg.KeyCmp != nil {
+			slot, nativeCmp, err := registerComparator(cfg.KeyCmp, false)
+			if err != nil {
+				unregisterComparators(slots)
+				return nil, nil, fmt.Errorf("table: %s, %w", name, err)
+			}
+			slots = append(slots, slot)
+			cmps.keyCmp = nativeCmp
+		}
+		if cfg.DupCmp != nil {
+			slot, nativeCmp, err := registerComparator(cfg.DupCmp, true)
+			if err != nil {
+				unregisterComparators(slots)
+				return nil, nil, fmt.Errorf("table: %s, %w", name, err)
+			}
+			slots = append(slots, slot)
+			cmps.dupCmp = nativeCmp
+		}
+		res[name] = cmps
+	}
+	return res, slots, nil
+}
+
+func unregisterComparators(slots []int) {
+	for _, slot := range slots {
+		unregisterComparator(slot)
+	}
+}
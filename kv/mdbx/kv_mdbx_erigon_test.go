@@ -12,9 +12,20 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/kvtest"
 	"github.com/uncommoncorrelation/go-mdbx-db/log"
 )
 
+// TestTemporaryMdbxConformance - chaindata tables of TemporaryMdbx include kvtest.Tables
+func TestTemporaryMdbxConformance(t *testing.T) {
+	kvtest.Run(t, func(tb testing.TB) kv.RwDB {
+		db, err := NewTemporaryMdbx(context.Background(), tb.TempDir())
+		require.NoError(tb, err)
+		tb.Cleanup(db.Close)
+		return db
+	})
+}
+
 func baseAutoConversion(t *testing.T) (kv.RwDB, kv.RwTx, kv.RwCursor) {
 	t.Helper()
 	path := t.TempDir()
@@ -0,0 +1,117 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/erigontech/mdbx-go/mdbx"
+)
+
+// Geometry - size limits of db file
+type Geometry struct {
+	Lower           datasize.ByteSize // file is not shrunk below it
+	Current         datasize.ByteSize // read-only: file grows and shrinks by GrowthStep and ShrinkThreshold
+	Upper           datasize.ByteSize // max size of db, writes fail with MDBX_MAP_FULL when it's reached
+	GrowthStep      datasize.ByteSize
+	ShrinkThreshold datasize.ByteSize
+}
+
+// MapFullPolicy - what Update and UpdateNosync do when db reaches Geometry.Upper (MDBX_MAP_FULL)
+type MapFullPolicy struct {
+	GrowStep datasize.ByteSize // Upper is increased by GrowStep and closure is retried in new tx. 0 - return error
+	MaxUpper datasize.ByteSize // Upper isn't increased above it. 0 - 4 * MapSize
+}
+
+// UnableExtendMapSize - MDBX_UNABLE_EXTEND_MAPSIZE, not defined by mdbx-go. Returned by SetGeometry, and by Update with
+// MapFullPolicy, when Upper can't be increased: mdbx-go works in NOTLS mode, in which mdbx can't move mapping of db
+// file - only extend it in place, if address space after mapping is free. Upper decreased after Open can be increased
+// up to MapSize given to Open. Check by IsUnableExtendMapSize.
+const UnableExtendMapSize mdbx.Errno = -30785
+
+// IsUnableExtendMapSize - err is or wraps UnableExtendMapSize
+func IsUnableExtendMapSize(err error) bool { return isErrno(err, UnableExtendMapSize) }
+
+// Geometry - current limits of db file
+func (db *MdbxKV) Geometry() (Geometry, error) {
+	info, err := db.env.Info(nil)
+	if err != nil {
+		return Geometry{}, fmt.Errorf("label: %s, %w", db.opts.label, err)
+	}
+	return Geometry{
+		Lower:           datasize.ByteSize(info.Geo.Lower),
+		Current:         datasize.ByteSize(info.Geo.Current),
+		Upper:           datasize.ByteSize(info.Geo.Upper),
+		GrowthStep:      datasize.ByteSize(info.Geo.Grow),
+		ShrinkThreshold: datasize.ByteSize(info.Geo.Shrink),
+	}, nil
+}
+
+// SetGeometry - changes limits of open db, zero fields of g are not changed (Current is ignored). MDBX rounds sizes
+// to page size. Waits for write transactions of all processes to finish - so must not be called inside of write tx.
+func (db *MdbxKV) SetGeometry(g Geometry) error {
+	orKeep := func(v datasize.ByteSize) int {
+		if v == 0 {
+			return -1
+		}
+		return int(v)
+	}
+	if err := db.env.SetGeometry(orKeep(g.Lower), -1, orKeep(g.Upper), orKeep(g.GrowthStep), orKeep(g.ShrinkThreshold), -1); err != nil {
+		return fmt.Errorf("label: %s, %w", db.opts.label, err)
+	}
+	return nil
+}
+
+// growOnMapFull - increases Upper according to MapFullPolicy
+func (db *MdbxKV) growOnMapFull() error {
+	db.geometryMu.Lock()
+	defer db.geometryMu.Unlock()
+	policy := db.opts.mapFullPolicy
+	geo, err := db.Geometry()
+	if err != nil {
+		return err
+	}
+	upper := geo.Upper + policy.GrowStep
+	if policy.MaxUpper > 0 && upper > policy.MaxUpper {
+		if geo.Upper >= policy.MaxUpper {
+			return fmt.Errorf("label: %s, db size reached MapFullPolicy.MaxUpper: %s", db.opts.label, policy.MaxUpper)
+		}
+		upper = policy.MaxUpper
+	}
+	db.log.Warn("[db] map is full, increasing size limit", "label", db.opts.label, "from", geo.Upper, "to", upper)
+	return db.SetGeometry(Geometry{Upper: upper})
+}
+
+// isMapFull - like mdbx.IsMapFull, but also checks wrapped errors
+func isMapFull(err error) bool { return isErrno(err, mdbx.MapFull) }
+
+// isErrno - err or any error wrapped by it is errno or *mdbx.OpError with errno. Update with MapFullPolicy wraps both
+// MDBX_MAP_FULL and error of growth.
+func isErrno(err error, errno mdbx.Errno) bool {
+	switch e := err.(type) {
+	case *mdbx.OpError:
+		return errors.Is(e.Errno, errno)
+	case interface{ Unwrap() error }:
+		return isErrno(e.Unwrap(), errno)
+	case interface{ Unwrap() []error }:
+		return slices.ContainsFunc(e.Unwrap(), func(err error) bool { return isErrno(err, errno) })
+	}
+	return errors.Is(err, errno)
+}
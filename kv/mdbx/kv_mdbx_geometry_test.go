@@ -0,0 +1,111 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func geometryTestDB(t *testing.T, mapSize datasize.ByteSize, policy MapFullPolicy) *MdbxKV {
+	t.Helper()
+	db := NewMDBX(log.NewNoop()).Path(t.TempDir()).WithTableCfg(kv.TableCfg{"T": {}}).
+		MapSize(mapSize).GrowthStep(datasize.MB).MapFullPolicy(policy).MustOpen()
+	t.Cleanup(db.Close)
+	return db.(*MdbxKV)
+}
+
+// fillDB - writes ~8MB in 1 tx
+func fillDB(db *MdbxKV) error {
+	return db.Update(context.Background(), func(tx kv.RwTx) error {
+		v := make([]byte, 1024)
+		for i := uint64(0); i < 8*1024; i++ {
+			if err := tx.Put("T", binary.BigEndian.AppendUint64(nil, i), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestMapFullPolicy(t *testing.T) {
+	db := geometryTestDB(t, 2*datasize.MB, MapFullPolicy{})
+	err := fillDB(db)
+	require.Error(t, err)
+	require.True(t, isMapFull(err))
+
+	// MapSize is not changed by policy
+	policy := MapFullPolicy{GrowStep: 4 * datasize.MB, MaxUpper: 32 * datasize.MB}
+	db = geometryTestDB(t, 2*datasize.MB, policy)
+	geo, err := db.Geometry()
+	require.NoError(t, err)
+	require.Equal(t, 2*datasize.MB, geo.Upper)
+	// Upper can be increased above size of mapping created by Open only if address space after it is free
+	if err := fillDB(db); err != nil {
+		require.True(t, isMapFull(err))
+		require.True(t, IsUnableExtendMapSize(err), err)
+	}
+
+	// Upper decreased after Open can be increased again in place
+	db = geometryTestDB(t, 32*datasize.MB, policy)
+	require.NoError(t, db.SetGeometry(Geometry{Upper: 2 * datasize.MB}))
+	require.NoError(t, fillDB(db))
+	after, err := db.Geometry()
+	require.NoError(t, err)
+	require.Greater(t, after.Upper, 2*datasize.MB)
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		st, err := tx.(*MdbxTx).BucketStat("T")
+		require.NoError(t, err)
+		require.Equal(t, uint64(8*1024), st.Entries)
+		return nil
+	}))
+
+	db = geometryTestDB(t, 32*datasize.MB, MapFullPolicy{GrowStep: 4 * datasize.MB, MaxUpper: 4 * datasize.MB})
+	require.NoError(t, db.SetGeometry(Geometry{Upper: 2 * datasize.MB}))
+	err = fillDB(db)
+	require.True(t, isMapFull(err))
+	require.ErrorContains(t, err, "MaxUpper")
+}
+
+func TestSetGeometry(t *testing.T) {
+	db := geometryTestDB(t, 2*datasize.MB, MapFullPolicy{})
+	require.NoError(t, db.SetGeometry(Geometry{GrowthStep: 2 * datasize.MB}))
+	geo, err := db.Geometry()
+	require.NoError(t, err)
+	require.Equal(t, 2*datasize.MB, geo.GrowthStep)
+
+	db = geometryTestDB(t, 32*datasize.MB, MapFullPolicy{})
+	require.NoError(t, db.SetGeometry(Geometry{Upper: 2 * datasize.MB}))
+	before, err := db.Geometry()
+	require.NoError(t, err)
+	require.Equal(t, 2*datasize.MB, before.Upper)
+
+	require.NoError(t, db.SetGeometry(Geometry{Upper: 16 * datasize.MB, GrowthStep: 2 * datasize.MB}))
+	after, err := db.Geometry()
+	require.NoError(t, err)
+	require.Equal(t, 16*datasize.MB, after.Upper)
+	require.Equal(t, 2*datasize.MB, after.GrowthStep)
+	require.Equal(t, before.Lower, after.Lower)
+	require.NoError(t, fillDB(db))
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"fmt"
+
+	"github.com/erigontech/mdbx-go/mdbx"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+// tableUndo - state of table in MdbxKV.buckets and MdbxKV.comparators before its first change by tx
+type tableUndo struct {
+	cfg             kv.TableCfgItem
+	cmps            tableComparators
+	configured, cmp bool
+}
+
+// checkNotNested - tables can't be created or dropped by nested tx: mdbx may invalidate handles of parent's tables on
+// abort of nested tx, and config of tables is reverted only on rollback of top-level tx
+func (tx *MdbxTx) checkNotNested(op, table string) error {
+	if tx.parent != nil {
+		return fmt.Errorf("%w: %s table: %s, label: %s", kv.ErrNestedTxUnsupported, op, table, tx.db.opts.label)
+	}
+	return nil
+}
+
+// setTable - changes config of table, previous config is restored if tx is rolled back. Not called by nested tx, see
+// checkNotNested.
+func (tx *MdbxTx) setTable(name string, cfg kv.TableCfgItem) {
+	tx.db.tablesMu.Lock()
+	defer tx.db.tablesMu.Unlock()
+	if _, ok := tx.tablesUndo[name]; !ok {
+		if tx.tablesUndo == nil {
+			tx.tablesUndo = map[string]tableUndo{}
+		}
+		u := tableUndo{}
+		u.cfg, u.configured = tx.db.buckets[name]
+		u.cmps, u.cmp = tx.db.comparators[name]
+		tx.tablesUndo[name] = u
+	}
+	tx.db.buckets[name] = cfg
+}
+
+// setTableCmps - changes comparators of table, must be called after setTable of this table
+func (tx *MdbxTx) setTableCmps(name string, cmps tableComparators) {
+	tx.db.tablesMu.Lock()
+	defer tx.db.tablesMu.Unlock()
+	tx.db.comparators[name] = cmps
+}
+
+// revertTables - reverts changes of tables config made by aborted tx. Handles of tables opened or dropped by aborted tx
+// are closed by mdbx - tables which existed before tx are opened again.
+func (tx *MdbxTx) revertTables() {
+	for name, u := range tx.tablesUndo {
+		if u.configured && u.cfg.DBI != NonExistingDBI {
+			if err := tx.db.env.View(func(txn *mdbx.Txn) error {
+				dbi, err := txn.OpenDBI(name, 0, u.cmps.keyCmp, u.cmps.dupCmp)
+				u.cfg.DBI = kv.DBI(dbi)
+				return err
+			}); err != nil {
+				tx.db.log.Warn("[db] failed to open table after rollback", "label", tx.db.opts.label, "table", name, "err", err)
+				u.cfg.DBI = NonExistingDBI
+			}
+		}
+		tx.db.tablesMu.Lock()
+		if u.cmp {
+			tx.db.comparators[name] = u.cmps
+		} else {
+			delete(tx.db.comparators, name)
+		}
+		if u.configured {
+			tx.db.buckets[name] = u.cfg
+		} else {
+			delete(tx.db.buckets, name)
+		}
+		tx.db.tablesMu.Unlock()
+	}
+	tx.tablesUndo = nil
+}
+
+// CopyBucket - copies all entries of src to dst. If dst is not configured, it's created with flags and comparators of
+// src. Otherwise, dst must have same flags as src and be empty. Entries are written in order of src by Append/AppendDup.
+// Config of dst is reverted if tx is rolled back.
+func (tx *MdbxTx) CopyBucket(src, dst string) error {
+	if err := tx.checkNotNested("copy", src); err != nil {
+		return err
+	}
+	if src == dst {
+		return fmt.Errorf("copy table: %s, source and destination are the same", src)
+	}
+	srcCfg, ok := tx.db.tableCfg(src)
+	if !ok || srcCfg.DBI == NonExistingDBI {
+		return fmt.Errorf("copy table: %s, not found", src)
+	}
+	nativeFlags, err := tx.tx.Flags(mdbx.DBI(srcCfg.DBI))
+	if err != nil {
+		return fmt.Errorf("copy table: %s, %w", src, err)
+	}
+	flags := tableFlagsFromNative(nativeFlags)
+
+	dstCfg, configured := tx.db.tableCfg(dst)
+	if configured {
+		if dstCfg.Flags != flags {
+			return fmt.Errorf("copy table: %s to %s, flags %#x don't match flags of destination %#x", src, dst, uint(flags), uint(dstCfg.Flags))
+		}
+		if (dstCfg.KeyCmp == nil) != (srcCfg.KeyCmp == nil) || (dstCfg.DupCmp == nil) != (srcCfg.DupCmp == nil) {
+			return fmt.Errorf("copy table: %s to %s, comparators of destination don't match", src, dst)
+		}
+	} else {
+		dstCfg = srcCfg
+		dstCfg.Flags, dstCfg.DBI, dstCfg.IsDeprecated = flags, NonExistingDBI, false
+		tx.setTable(dst, dstCfg)
+		if cmps, ok := tx.db.tableCmps(src); ok {
+			tx.setTableCmps(dst, cmps)
+		}
+	}
+	if err := tx.CreateBucket(dst); err != nil {
+		return fmt.Errorf("copy table: %s to %s, %w", src, dst, err)
+	}
+	dstCfg, _ = tx.db.tableCfg(dst)
+	if err := tx.copyTable(mdbx.DBI(srcCfg.DBI), mdbx.DBI(dstCfg.DBI), flags); err != nil {
+		return fmt.Errorf("copy table: %s to %s, %w", src, dst, err)
+	}
+	return nil
+}
+
+func (tx *MdbxTx) copyTable(src, dst mdbx.DBI, flags kv.TableFlags) error {
+	st, err := tx.tx.StatDBI(dst)
+	if err != nil {
+		return err
+	}
+	if st.Entries > 0 {
+		return fmt.Errorf("destination is not empty")
+	}
+	srcC, err := tx.tx.OpenCursor(src)
+	if err != nil {
+		return err
+	}
+	defer srcC.Close()
+	dstC, err := tx.tx.OpenCursor(dst)
+	if err != nil {
+		return err
+	}
+	defer dstC.Close()
+
+	putFlags := uint(mdbx.Append)
+	if flags&kv.DupSort != 0 {
+		putFlags = mdbx.AppendDup
+	}
+	for k, v, err := srcC.Get(nil, nil, mdbx.First); ; k, v, err = srcC.Get(nil, nil, mdbx.Next) {
+		if mdbx.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := dstC.Put(k, v, putFlags); err != nil {
+			return err
+		}
+	}
+}
+
+// RenameBucket - CopyBucket and drop of `from`, even if it's not deprecated
+func (tx *MdbxTx) RenameBucket(from, to string) error {
+	if err := tx.CopyBucket(from, to); err != nil {
+		return err
+	}
+	if err := tx.dropEvenIfBucketIsNotDeprecated(from); err != nil {
+		return fmt.Errorf("rename table: %s to %s, %w", from, to, err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func migratorTestDB(t *testing.T, opts ...mdbx.MdbxOpts) kv.RwDB {
+	t.Helper()
+	o := mdbx.NewMDBX(log.NewNoop())
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	db := o.InMem(t.TempDir()).WithTableCfg(kv.TableCfg{
+		"Plain":   {},
+		"DupSort": {Flags: kv.DupSort},
+		"Rev":     {KeyCmp: func(k1, k2, _, _ []byte) int { return -bytes.Compare(k1, k2) }},
+		"Target":  {},
+	}).MustOpen()
+	t.Cleanup(db.Close)
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := byte(0); i < 10; i++ {
+			require.NoError(t, tx.Put("Plain", []byte{i}, []byte{i}))
+			require.NoError(t, tx.Put("Rev", []byte{i}, []byte{i}))
+			require.NoError(t, tx.Put("DupSort", []byte{i % 3}, []byte{i}))
+		}
+		return nil
+	}))
+	return db
+}
+
+func tableEntries(t *testing.T, tx kv.Tx, table string) (res [][2][]byte) {
+	t.Helper()
+	require.NoError(t, tx.ForEach(table, nil, func(k, v []byte) error {
+		res = append(res, [2][]byte{bytes.Clone(k), bytes.Clone(v)})
+		return nil
+	}))
+	return res
+}
+
+func TestCopyBucket(t *testing.T) {
+	ctx := context.Background()
+	db := migratorTestDB(t)
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		// not configured destinations are created with flags and comparator of source
+		for _, table := range []string{"Plain", "DupSort", "Rev"} {
+			require.NoError(t, tx.CopyBucket(table, table+"Copy"))
+			require.Equal(t, tableEntries(t, tx, table), tableEntries(t, tx, table+"Copy"))
+			require.Equal(t, db.AllTables()[table].Flags, db.AllTables()[table+"Copy"].Flags)
+		}
+		require.NoError(t, tx.CopyBucket("Plain", "Target"))
+
+		require.ErrorContains(t, tx.CopyBucket("Plain", "Target"), "not empty")
+		require.ErrorContains(t, tx.CopyBucket("DupSort", "Plain"), "flags")
+		require.ErrorContains(t, tx.CopyBucket("Rev", "Plain"), "comparators")
+		require.ErrorContains(t, tx.CopyBucket("NotExists", "Plain2"), "not found")
+		return nil
+	}))
+
+	// copies are visible to next transactions
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		cnt, err := tx.(*mdbx.MdbxTx).BucketStat("DupSortCopy")
+		require.NoError(t, err)
+		require.Equal(t, uint64(10), cnt.Entries)
+		k, _, err := mustCursor(t, tx, "RevCopy").First()
+		require.NoError(t, err)
+		require.Equal(t, []byte{9}, k)
+		return nil
+	}))
+}
+
+func mustCursor(t *testing.T, tx kv.Tx, table string) kv.Cursor {
+	t.Helper()
+	c, err := tx.Cursor(table)
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestRenameBucket(t *testing.T) {
+	ctx := context.Background()
+	db := migratorTestDB(t)
+
+	var expected [][2][]byte
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		expected = tableEntries(t, tx, "DupSort")
+		require.NoError(t, tx.RenameBucket("DupSort", "Renamed"))
+		exists, err := tx.ExistsBucket("DupSort")
+		require.NoError(t, err)
+		require.False(t, exists)
+		return nil
+	}))
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Equal(t, expected, tableEntries(t, tx, "Renamed"))
+		tables, err := tx.ListBuckets()
+		require.NoError(t, err)
+		require.NotContains(t, tables, "DupSort")
+		return nil
+	}))
+	require.Equal(t, kv.DupSort, db.AllTables()["Renamed"].Flags)
+}
+
+func TestRenameBucketRollback(t *testing.T) {
+	ctx := context.Background()
+	db := migratorTestDB(t)
+
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.RenameBucket("Plain", "Renamed"))
+	tx.Rollback()
+
+	// config of tables is restored: source is available, destination doesn't exist
+	_, ok := db.AllTables()["Renamed"]
+	require.False(t, ok)
+	require.NotEqual(t, mdbx.NonExistingDBI, db.AllTables()["Plain"].DBI)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Len(t, tableEntries(t, tx, "Plain"), 10)
+		return nil
+	}))
+
+	// changes of tables config are reverted by rollback of top-level tx
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.CopyBucket("Plain", "Copy1") }))
+	tx, err = db.BeginRw(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.RenameBucket("Copy1", "Copy2"))
+	require.ErrorContains(t, kv.Savepoint(tx, func(tx kv.RwTx) error { return tx.CopyBucket("Copy2", "Copy3") }), "nested")
+	tx.Rollback()
+	_, ok = db.AllTables()["Copy2"]
+	require.False(t, ok)
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Len(t, tableEntries(t, tx, "Copy1"), 10)
+		return nil
+	}))
+}
+
+// TestRenameBucketConcurrentReaders - config of tables is changed by writer and by rollback while readers open cursors
+// and collector of table stats iterates tables, run with -race
+func TestRenameBucketConcurrentReaders(t *testing.T) {
+	ctx := context.Background()
+	db := migratorTestDB(t, mdbx.NewMDBX(log.NewNoop()).TableStatsInterval(time.Millisecond))
+	errRollback := errors.New("rollback")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if err := db.View(ctx, func(tx kv.Tx) error {
+					if _, err := tx.(kv.BucketMigrator).ExistsBucket("Plain"); err != nil {
+						return err
+					}
+					if err := tx.ForEach("Rev", nil, func(k, v []byte) error { return nil }); err != nil {
+						return err
+					}
+					it, err := tx.RangeDescend("DupSort", []byte{2}, nil, -1)
+					if err != nil {
+						return err
+					}
+					for it.HasNext() {
+						if _, _, err := it.Next(); err != nil {
+							return err
+						}
+					}
+					return nil
+				}); err != nil {
+					t.Error(err)
+					return
+				}
+				_ = db.AllTables()
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			if err := tx.RenameBucket("Plain", "Renamed"); err != nil {
+				return err
+			}
+			return tx.RenameBucket("Renamed", "Plain")
+		}))
+		require.ErrorIs(t, db.Update(ctx, func(tx kv.RwTx) error {
+			if err := tx.RenameBucket("Plain", "Renamed"); err != nil {
+				return err
+			}
+			return errRollback
+		}), errRollback)
+	}
+	close(stop)
+	wg.Wait()
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Len(t, tableEntries(t, tx, "Plain"), 10)
+		exists, err := tx.(kv.BucketMigrator).ExistsBucket("Renamed")
+		require.NoError(t, err)
+		require.False(t, exists)
+		return nil
+	}))
+}
@@ -0,0 +1,147 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+/*
+#include <stdint.h>
+#include <stddef.h>
+#include <pthread.h>
+#include <sys/types.h>
+
+// from mdbx.h - libmdbx is linked by mdbx-go
+typedef struct MDBX_env MDBX_env;
+typedef int(MDBX_reader_list_func)(void *ctx, int num, int slot, pid_t pid, pthread_t thread, uint64_t txnid,
+	uint64_t lag, size_t bytes_used, size_t bytes_retained);
+int mdbx_reader_list(const MDBX_env *env, MDBX_reader_list_func *func, void *ctx);
+
+extern int mdbxgoReaderListItem(uintptr_t ctx, int slot, int pid, uint64_t thread, uint64_t txnid, uint64_t lag,
+	size_t bytes_used, size_t bytes_retained);
+
+static int mdbxgo_reader_list_item(void *ctx, int num, int slot, pid_t pid, pthread_t thread, uint64_t txnid,
+	uint64_t lag, size_t bytes_used, size_t bytes_retained) {
+	return mdbxgoReaderListItem((uintptr_t)ctx, slot, (int)pid, (uint64_t)thread, txnid, lag, bytes_used, bytes_retained);
+}
+
+static int mdbxgo_reader_list(void *env, uintptr_t ctx) {
+	return mdbx_reader_list((const MDBX_env *)env, mdbxgo_reader_list_item, (void *)ctx);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime/cgo"
+	"sort"
+	"time"
+)
+
+// ReaderInfo - slot of reader lock table, occupied by read transaction of this or another process
+type ReaderInfo struct {
+	Slot          int
+	PID           int
+	Thread        uint64
+	TxnID         uint64 // id of snapshot which reader holds
+	Lag           uint64 // amount of transactions committed after snapshot of reader
+	BytesUsed     uint64 // size of snapshot
+	BytesRetained uint64 // space which can't be reused by writers while reader holds snapshot
+	// Age - approximate time for which reader holds snapshot. MDBX doesn't track time: age is counted from first call
+	// of Readers in this process which saw reader with same PID, Thread and TxnID, so it's less than real age by up to
+	// interval of Readers calls (see MdbxOpts.TableStatsInterval). 0 for reader seen first time.
+	Age time.Duration
+}
+
+//export mdbxgoReaderListItem
+func mdbxgoReaderListItem(ctx C.uintptr_t, slot C.int, pid C.int, thread C.uint64_t, txnid C.uint64_t, lag C.uint64_t, bytesUsed C.size_t, bytesRetained C.size_t) C.int {
+	if txnid == 0 { // slot is reserved by thread, but has no read transaction now
+		return 0
+	}
+	readers := cgo.Handle(ctx).Value().(*[]ReaderInfo)
+	*readers = append(*readers, ReaderInfo{
+		Slot:          int(slot),
+		PID:           int(pid),
+		Thread:        uint64(thread),
+		TxnID:         uint64(txnid),
+		Lag:           uint64(lag),
+		BytesUsed:     uint64(bytesUsed),
+		BytesRetained: uint64(bytesRetained),
+	})
+	return 0
+}
+
+// readerKey - identifies snapshot held by reader, to measure ReaderInfo.Age
+type readerKey struct {
+	pid    int
+	thread uint64
+	txnID  uint64
+}
+
+// Readers - active readers of db from all processes, sorted by lag (most lagging first). Slots of dead processes
+// are listed too - until ReaderCheck.
+func (db *MdbxKV) Readers() ([]ReaderInfo, error) {
+	var readers []ReaderInfo
+	h := cgo.NewHandle(&readers)
+	defer h.Delete()
+	if rc := C.mdbxgo_reader_list(db.env.CHandle(), C.uintptr_t(h)); rc != 0 && rc != -1 { // -1 - MDBX_RESULT_TRUE: no readers
+		return nil, fmt.Errorf("mdbx_reader_list: label: %s, code: %d", db.opts.label, int(rc))
+	}
+
+	// readers which are not listed anymore are forgotten: same key may be seen later only for new snapshot
+	now := time.Now()
+	db.readersMu.Lock()
+	seen := make(map[readerKey]time.Time, len(readers))
+	for i := range readers {
+		key := readerKey{pid: readers[i].PID, thread: readers[i].Thread, txnID: readers[i].TxnID}
+		since, ok := db.readersSeen[key]
+		if !ok {
+			since = now
+		}
+		seen[key] = since
+		readers[i].Age = now.Sub(since)
+	}
+	db.readersSeen = seen
+	db.readersMu.Unlock()
+
+	sort.Slice(readers, func(i, j int) bool { return readers[i].Lag > readers[j].Lag })
+	return readers, nil
+}
+
+// ReaderCheck - clears reader slots of dead processes, returns amount of cleared slots
+func (db *MdbxKV) ReaderCheck() (int, error) {
+	staleReaders, err := db.env.ReaderCheck()
+	if err != nil {
+		return 0, fmt.Errorf("label: %s, %w", db.opts.label, err)
+	}
+	if staleReaders > 0 {
+		db.log.Info("cleared reader slots from dead processes", "label", db.opts.label, "amount", staleReaders)
+	}
+	return staleReaders, nil
+}
+
+// collectReadersMetrics - exports amount of readers and lag of the oldest one
+func (db *MdbxKV) collectReadersMetrics() {
+	readers, err := db.Readers()
+	if err != nil {
+		db.log.Warn("failed to list readers", "err", err)
+		return
+	}
+	db.metrics.Readers.SetInt(len(readers))
+	if len(readers) == 0 {
+		db.metrics.ReadersOldestLag.SetUint64(0)
+		return
+	}
+	db.metrics.ReadersOldestLag.SetUint64(readers[0].Lag)
+}
@@ -0,0 +1,76 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func TestReaders(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).Label("readers_test").WithTableCfg(kv.TableCfg{"Table": {}}).MustOpen().(*MdbxKV)
+	defer db.Close()
+
+	readers, err := db.Readers()
+	require.NoError(t, err)
+	require.Empty(t, readers)
+
+	roTx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer roTx.Rollback()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put("Table", []byte{byte(i)}, []byte{byte(i)}) }))
+	}
+
+	readers, err = db.Readers()
+	require.NoError(t, err)
+	require.Len(t, readers, 1)
+	require.Equal(t, os.Getpid(), readers[0].PID)
+	require.Equal(t, roTx.ViewID(), readers[0].TxnID)
+	require.Equal(t, uint64(3), readers[0].Lag)
+
+	// age is counted from first Readers call which saw snapshot of reader
+	time.Sleep(10 * time.Millisecond)
+	readers, err = db.Readers()
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, readers[0].Age, 10*time.Millisecond)
+	roTx2, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	readers, err = db.Readers()
+	require.NoError(t, err)
+	require.Len(t, readers, 2)
+	require.Equal(t, roTx.ViewID(), readers[0].TxnID)
+	require.Zero(t, readers[1].Age) // seen first time
+	roTx2.Rollback()
+
+	m := &dto.Metric{}
+	require.NoError(t, db.metrics.ReadersOldestLag.Write(m))
+	require.Equal(t, float64(2), m.GetGauge().GetValue()) // collected before last commit
+
+	dead, err := db.ReaderCheck()
+	require.NoError(t, err)
+	require.Zero(t, dead)
+}
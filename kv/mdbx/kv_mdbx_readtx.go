@@ -0,0 +1,151 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/erigontech/mdbx-go/mdbx"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/common/dbg"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+// ReadTxPolicy - limits lifetime of read transactions. Reader holds snapshot of db: pages of snapshot can't be reused
+// by writers, so db file grows until reader finishes.
+type ReadTxPolicy struct {
+	MaxDuration time.Duration // 0 - unlimited
+	// WarnOnly - only log transactions which live longer than MaxDuration, with stack of their creation. Otherwise,
+	// transaction is reset: its snapshot is released, next cursor operation and Commit return kv.TxExpiredError.
+	// Keys and values read before reset must not be used after it.
+	WarnOnly bool
+}
+
+// readTxGuard - state of 1 read transaction, shared by its owner and readTxWatchdog
+type readTxGuard struct {
+	mu       sync.Mutex // held by owner during cursor operation and by watchdog during reset
+	txn      *mdbx.Txn
+	started  time.Time
+	stack    string // where tx was created, only in WarnOnly mode
+	warnOnly bool
+	warned   bool
+	done     bool               // finished by owner
+	expired  *kv.TxExpiredError // reset by watchdog
+}
+
+// readTxWatchdog - checks lifetime of read transactions of 1 db in background
+type readTxWatchdog struct {
+	db     *MdbxKV
+	policy ReadTxPolicy
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu  sync.Mutex
+	txs map[*readTxGuard]struct{}
+}
+
+func newReadTxWatchdog(db *MdbxKV, policy ReadTxPolicy) *readTxWatchdog {
+	w := &readTxWatchdog{db: db, policy: policy, stop: make(chan struct{}), done: make(chan struct{}), txs: map[*readTxGuard]struct{}{}}
+	go w.loop()
+	return w
+}
+
+func (w *readTxWatchdog) loop() {
+	defer close(w.done)
+	every := min(max(w.policy.MaxDuration/10, time.Millisecond), time.Second)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+func (w *readTxWatchdog) check() {
+	w.mu.Lock()
+	guards := make([]*readTxGuard, 0, len(w.txs))
+	for g := range w.txs {
+		if time.Since(g.started) > w.policy.MaxDuration {
+			guards = append(guards, g)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, g := range guards {
+		g.mu.Lock()
+		lived := time.Since(g.started)
+		switch {
+		case g.done || g.expired != nil || g.warned:
+		case g.warnOnly:
+			g.warned = true
+			w.db.log.Warn("read transaction lives too long", "label", w.db.opts.label, "lived", lived, "limit", w.policy.MaxDuration, "stack", g.stack)
+		default:
+			g.txn.Reset()
+			g.expired = &kv.TxExpiredError{Label: w.db.opts.label, Lived: lived, Limit: w.policy.MaxDuration}
+			w.db.log.Warn("read transaction reset", "label", w.db.opts.label, "lived", lived, "limit", w.policy.MaxDuration)
+		}
+		g.mu.Unlock()
+	}
+}
+
+func (w *readTxWatchdog) add(txn *mdbx.Txn) *readTxGuard {
+	g := &readTxGuard{txn: txn, started: time.Now(), warnOnly: w.policy.WarnOnly}
+	if g.warnOnly {
+		g.stack = dbg.StackSkip(2)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.txs[g] = struct{}{}
+	return g
+}
+
+// remove - called by owner when tx finished, returns error if tx was reset by watchdog
+func (w *readTxWatchdog) remove(g *readTxGuard) error {
+	w.mu.Lock()
+	delete(w.txs, g)
+	w.mu.Unlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.done = true
+	if g.expired != nil {
+		return g.expired
+	}
+	return nil
+}
+
+func (w *readTxWatchdog) close() {
+	close(w.stop)
+	<-w.done
+}
+
+// lock - must be held during operations which access snapshot of tx. Returns error if tx was reset by watchdog
+func (g *readTxGuard) lock() error {
+	g.mu.Lock()
+	if g.expired != nil {
+		g.mu.Unlock()
+		return g.expired
+	}
+	return nil
+}
+
+func (g *readTxGuard) unlock() { g.mu.Unlock() }
@@ -0,0 +1,141 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func TestReadTxPolicy(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).
+		ReadTxPolicy(ReadTxPolicy{MaxDuration: 20 * time.Millisecond}).MustOpen().(*MdbxKV)
+	defer db.Close()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := byte(0); i < 10; i++ {
+			if err := tx.Put("Table", []byte{i}, []byte{i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	c, err := tx.Cursor("Table")
+	require.NoError(t, err)
+	k, _, err := c.First()
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, k)
+
+	// snapshot is released by watchdog
+	require.Eventually(t, func() bool {
+		readers, err := db.Readers()
+		require.NoError(t, err)
+		return len(readers) == 0
+	}, 5*time.Second, time.Millisecond)
+
+	_, _, err = c.Next()
+	require.ErrorIs(t, err, kv.ErrTxExpired)
+	var expired *kv.TxExpiredError
+	require.True(t, errors.As(err, &expired))
+	require.Equal(t, 20*time.Millisecond, expired.Limit)
+	require.ErrorIs(t, tx.Commit(), kv.ErrTxExpired)
+
+	// short transactions are not affected
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne("Table", []byte{9})
+		require.Equal(t, []byte{9}, v)
+		return err
+	}))
+}
+
+func TestReadTxPolicyWarnOnly(t *testing.T) {
+	ctx := context.Background()
+	var buf bytes.Buffer
+	db := NewMDBX(log.NewBuffered(&buf)).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).
+		ReadTxPolicy(ReadTxPolicy{MaxDuration: 10 * time.Millisecond, WarnOnly: true}).MustOpen().(*MdbxKV)
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put("Table", []byte{1}, []byte{1}) }))
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	v, err := tx.GetOne("Table", []byte{1})
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, v)
+	require.NoError(t, tx.Commit())
+	db.Close()
+
+	require.Contains(t, buf.String(), "read transaction lives too long")
+	require.Contains(t, buf.String(), "kv_mdbx_readtx_test.go") // stack of BeginRo caller
+}
+
+func TestRenew(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).
+		ReadTxPolicy(ReadTxPolicy{MaxDuration: 20 * time.Millisecond}).MustOpen().(*MdbxKV)
+	defer db.Close()
+	put := func(v string) {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put("Table", []byte("k"), []byte(v)) }))
+	}
+	put("1")
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	c, err := tx.Cursor("Table")
+	require.NoError(t, err)
+	it, err := tx.Range("Table", nil, nil)
+	require.NoError(t, err)
+
+	put("2")
+	v, err := tx.GetOne("Table", []byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("1"), v)
+
+	require.NoError(t, tx.(kv.RenewableTx).Renew())
+	v, err = tx.GetOne("Table", []byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), v)
+	_, _, err = c.First()
+	require.ErrorIs(t, err, ErrCursorClosed)
+	require.True(t, it.HasNext())
+	_, _, err = it.Next()
+	require.ErrorIs(t, err, ErrCursorClosed)
+
+	// tx reset by watchdog can be renewed
+	require.Eventually(t, func() bool {
+		_, err := tx.GetOne("Table", []byte("k"))
+		return errors.Is(err, kv.ErrTxExpired)
+	}, 5*time.Second, time.Millisecond)
+	put("3")
+	require.NoError(t, tx.(kv.RenewableTx).Renew())
+	v, err = tx.GetOne("Table", []byte("k"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("3"), v)
+	require.NoError(t, tx.Commit())
+}
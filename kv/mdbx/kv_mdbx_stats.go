@@ -0,0 +1,106 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+// TableStat - stat of table from AllTables
+func (tx *MdbxTx) TableStat(name string) (kv.TableStat, error) {
+	st, err := tx.BucketStat(name)
+	if err != nil {
+		return kv.TableStat{}, err
+	}
+	return kv.TableStat{
+		Name:          name,
+		Entries:       st.Entries,
+		Depth:         uint64(st.Depth),
+		BranchPages:   st.BranchPages,
+		LeafPages:     st.LeafPages,
+		OverflowPages: st.OverflowPages,
+		Size:          (st.LeafPages + st.BranchPages + st.OverflowPages) * tx.db.opts.pageSize,
+	}, nil
+}
+
+// TableStats - stats of all tables from AllTables which exist in db, sorted by name. Runs in background collector -
+// iterates copy of config of tables, which txs can change.
+func (tx *MdbxTx) TableStats() ([]kv.TableStat, error) {
+	tables := tx.db.AllTables()
+	names := make([]string, 0, len(tables))
+	for name, cfg := range tables {
+		if cfg.DBI == NonExistingDBI {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]kv.TableStat, 0, len(names))
+	for _, name := range names {
+		st, err := tx.TableStat(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, st)
+	}
+	return res, nil
+}
+
+// Stats - see MdbxTx.TableStats
+func (db *MdbxKV) Stats(ctx context.Context) (res []kv.TableStat, err error) {
+	err = db.View(ctx, func(tx kv.Tx) error {
+		res, err = tx.(*MdbxTx).TableStats()
+		return err
+	})
+	return res, err
+}
+
+// collectTableStats - exports Stats and readers metrics every `every` until db close. Works for read-only db - which
+// never commits and doesn't run MdbxTx.CollectMetrics.
+func (db *MdbxKV) collectTableStats(every time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		// metrics are updated inside of transaction - Close waits for it, so env can't be closed in the middle
+		if err := db.View(context.Background(), func(tx kv.Tx) error {
+			stats, err := tx.(*MdbxTx).TableStats()
+			if err != nil {
+				return err
+			}
+			db.metrics.SetTableStats(stats)
+			db.collectReadersMetrics()
+			return nil
+		}); err != nil {
+			select {
+			case <-stop: // db closed in the middle of collection
+				return
+			default:
+			}
+			db.log.Warn("failed to collect table stats", "label", db.opts.label, "err", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
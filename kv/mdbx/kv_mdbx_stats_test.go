@@ -0,0 +1,97 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir()
+	cfg := kv.TableCfg{"Plain": {}, "Big": {}}
+	db := NewMDBX(log.NewNoop()).Path(path).WithTableCfg(cfg).MustOpen()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := uint64(0); i < 1000; i++ {
+			k := binary.BigEndian.AppendUint64(nil, i)
+			if err := tx.Put("Plain", k, make([]byte, 100)); err != nil {
+				return err
+			}
+		}
+		return tx.Put("Big", []byte{1}, make([]byte, 10_000))
+	}))
+
+	stats, err := db.(*MdbxKV).Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "Big", stats[0].Name)
+	require.Equal(t, "Plain", stats[1].Name)
+	require.Equal(t, uint64(1000), stats[1].Entries)
+	require.Equal(t, uint64(2), stats[1].Depth)
+	require.NotZero(t, stats[1].BranchPages)
+	require.Equal(t, (stats[1].BranchPages+stats[1].LeafPages)*db.(*MdbxKV).PageSize(), stats[1].Size)
+	require.Equal(t, uint64(1), stats[0].Entries)
+	require.NotZero(t, stats[0].OverflowPages)
+	db.Close()
+
+	// read-only db never commits - stats are exported by collector
+	label := kv.Label("stats_test")
+	roDB := NewMDBX(log.NewNoop()).Path(path).Readonly().Label(label).WithTableCfg(cfg).
+		TableStatsInterval(time.Millisecond).MustOpen()
+	defer roDB.Close()
+	name := `db_table_entries{table="Plain",label="stats_test"}`
+	require.Eventually(t, func() bool {
+		for _, m := range roDB.(*MdbxKV).metrics.Set.ListMetricNames() {
+			if m == name {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestTableStatsPerDB(t *testing.T) {
+	ctx := context.Background()
+	open := func(label kv.Label, table string) *MdbxKV {
+		db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).Label(label).
+			WithTableCfg(kv.TableCfg{table: {}}).MustOpen().(*MdbxKV)
+		t.Cleanup(db.Close)
+		stats, err := db.Stats(ctx)
+		require.NoError(t, err)
+		db.metrics.SetTableStats(stats)
+		return db
+	}
+	a, b := open("table_stats_test_a", "A"), open("table_stats_test_b", "B")
+	require.Contains(t, a.metrics.Set.ListMetricNames(), `db_table_entries{table="A",label="table_stats_test_a"}`)
+	require.Contains(t, b.metrics.Set.ListMetricNames(), `db_table_entries{table="B",label="table_stats_test_b"}`)
+
+	// stats of a don't have table B - but series of B belong to b and stay
+	stats, err := a.Stats(ctx)
+	require.NoError(t, err)
+	a.metrics.SetTableStats(stats)
+	require.Contains(t, b.metrics.Set.ListMetricNames(), `db_table_entries{table="B",label="table_stats_test_b"}`)
+
+	a.Close()
+	require.Contains(t, b.metrics.Set.ListMetricNames(), `db_table_entries{table="B",label="table_stats_test_b"}`)
+}
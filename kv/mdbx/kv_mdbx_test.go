@@ -17,630 +17,364 @@
 package mdbx
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"testing"
 
 	"github.com/c2h5oh/datasize"
-	"github.com/stretchr/testify/assert"
+	"github.com/erigontech/mdbx-go/mdbx"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/require"
 
 	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/kvtest"
 	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
 	"github.com/uncommoncorrelation/go-mdbx-db/log"
 )
 
-func BaseCase(t *testing.T) (kv.RwDB, kv.RwTx, kv.RwCursorDupSort) {
-	t.Helper()
-	path := t.TempDir()
-	table := "Table"
-	db := NewMDBX(log.NewNoop()).InMem(path).WithTableCfgFn(func(_ kv.TableCfg) kv.TableCfg {
-		return kv.TableCfg{
-			table:       kv.TableCfgItem{Flags: kv.DupSort},
-			kv.Sequence: kv.TableCfgItem{},
-		}
-	}).MapSize(128 * datasize.MB).MustOpen()
-	t.Cleanup(db.Close)
-
-	tx, err := db.BeginRw(context.Background())
-	require.NoError(t, err)
-	t.Cleanup(tx.Rollback)
-
-	c, err := tx.RwCursorDupSort(table)
-	require.NoError(t, err)
-	t.Cleanup(c.Close)
-
-	// Insert some dupsorted records
-	require.NoError(t, c.Put([]byte("key1"), []byte("value1.1")))
-	require.NoError(t, c.Put([]byte("key3"), []byte("value3.1")))
-	require.NoError(t, c.Put([]byte("key1"), []byte("value1.3")))
-	require.NoError(t, c.Put([]byte("key3"), []byte("value3.3")))
-
-	return db, tx, c
+func TestConformance(t *testing.T) {
+	kvtest.Run(t, func(tb testing.TB) kv.RwDB {
+		db := NewMDBX(log.NewNoop()).InMem(tb.TempDir()).WithTableCfg(kvtest.Tables).MapSize(128 * datasize.MB).MustOpen()
+		tb.Cleanup(db.Close)
+		return db
+	})
 }
 
-func iteration(t *testing.T, c kv.RwCursorDupSort, start []byte, val []byte) ([]string, []string) {
-	t.Helper()
-	var keys []string
-	var values []string
-	var err error
-	i := 0
-	for k, v, err := start, val, err; k != nil; k, v, err = c.Next() {
-		require.Nil(t, err)
-		keys = append(keys, string(k))
-		values = append(values, string(v))
-		i += 1
-	}
-	for ind := i; ind > 1; ind-- {
-		c.Prev()
-	}
-
-	return keys, values
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.NativeEndian.PutUint64(b, v)
+	return b
 }
 
-func TestSeekBothRange(t *testing.T) {
-	_, _, c := BaseCase(t)
-
-	v, err := c.SeekBothRange([]byte("key2"), []byte("value1.2"))
-	require.NoError(t, err)
-	// SeekBothRange does exact match of the key, but range match of the value, so we get nil here
-	require.Nil(t, v)
+func TestTableFlags(t *testing.T) {
+	path := t.TempDir()
+	tables := kv.TableCfg{
+		"IntegerKey": {Flags: kv.IntegerKey},
+		"ReverseKey": {Flags: kv.ReverseKey},
+		"IntegerDup": {Flags: kv.DupSort | kv.IntegerDup},
+		"ReverseDup": {Flags: kv.DupSort | kv.ReverseDup},
+	}
+	db := NewMDBX(log.NewNoop()).InMem(path).WithTableCfg(tables).MapSize(128 * datasize.MB).MustOpen()
+	t.Cleanup(db.Close)
 
-	v, err = c.SeekBothRange([]byte("key3"), []byte("value3.2"))
+	tx, err := db.BeginRw(context.Background())
 	require.NoError(t, err)
-	require.Equal(t, "value3.3", string(v))
-}
-
-func TestRange(t *testing.T) {
-	t.Run("Asc", func(t *testing.T) {
-		_, tx, _ := BaseCase(t)
-
-		//[from, to)
-		it, err := tx.Range("Table", []byte("key1"), []byte("key3"))
-		require.NoError(t, err)
-		require.True(t, it.HasNext())
-		k, v, err := it.Next()
-		require.NoError(t, err)
-		require.Equal(t, "key1", string(k))
-		require.Equal(t, "value1.1", string(v))
+	t.Cleanup(tx.Rollback)
 
-		require.True(t, it.HasNext())
-		k, v, err = it.Next()
+	for name, cfg := range tables {
+		flags, err := tx.(*MdbxTx).tx.Flags(mdbx.DBI(tx.(*MdbxTx).db.buckets[name].DBI))
 		require.NoError(t, err)
-		require.Equal(t, "key1", string(k))
-		require.Equal(t, "value1.3", string(v))
-
-		require.False(t, it.HasNext())
-		require.False(t, it.HasNext())
+		require.Equal(t, cfg.Flags, tableFlagsFromNative(flags), name)
+	}
 
-		// [from, nil) means [from, INF)
-		it, err = tx.Range("Table", []byte("key1"), nil)
-		require.NoError(t, err)
-		cnt := 0
-		for it.HasNext() {
-			_, _, err := it.Next()
-			require.NoError(t, err)
-			cnt++
+	{ // IntegerKey
+		for _, v := range []uint64{256, 1, 65536, 2} {
+			require.NoError(t, tx.Put("IntegerKey", u64(v), []byte("v")))
 		}
-		require.Equal(t, 4, cnt)
-	})
-	t.Run("Desc", func(t *testing.T) {
-		_, tx, _ := BaseCase(t)
-
-		//[from, to)
-		it, err := tx.RangeDescend("Table", []byte("key3"), []byte("key1"), kv.Unlim)
-		require.NoError(t, err)
-		require.True(t, it.HasNext())
-		k, v, err := it.Next()
+		keys, _, err := iter.ToDualArray[[]byte, []byte](mustRange(t, tx, "IntegerKey", nil, nil))
 		require.NoError(t, err)
-		require.Equal(t, "key3", string(k))
-		require.Equal(t, "value3.3", string(v))
+		require.Equal(t, [][]byte{u64(1), u64(2), u64(256), u64(65536)}, keys)
 
-		require.True(t, it.HasNext())
-		k, v, err = it.Next()
+		keys, _, err = iter.ToDualArray[[]byte, []byte](mustRange(t, tx, "IntegerKey", u64(2), u64(65536)))
 		require.NoError(t, err)
-		require.Equal(t, "key3", string(k))
-		require.Equal(t, "value3.1", string(v))
-
-		require.False(t, it.HasNext())
-
-		it, err = tx.RangeDescend("Table", nil, nil, 2)
-		require.NoError(t, err)
-
-		cnt := 0
-		for it.HasNext() {
-			_, _, err := it.Next()
-			require.NoError(t, err)
-			cnt++
+		require.Equal(t, [][]byte{u64(2), u64(256)}, keys)
+	}
+	{ // ReverseKey
+		for _, k := range []string{"ab", "ba", "b", "ca"} {
+			require.NoError(t, tx.Put("ReverseKey", []byte(k), []byte("v")))
 		}
-		require.Equal(t, 2, cnt)
-	})
-}
-
-func TestRangeDupSort(t *testing.T) {
-	t.Run("Asc", func(t *testing.T) {
-		_, tx, _ := BaseCase(t)
-
-		//[from, to)
-		it, err := tx.RangeDupSort("Table", []byte("key1"), nil, nil, order.Asc, -1)
+		keys, _, err := iter.ToDualArray[[]byte, []byte](mustRange(t, tx, "ReverseKey", nil, nil))
 		require.NoError(t, err)
-		require.True(t, it.HasNext())
-		k, v, err := it.Next()
-		require.NoError(t, err)
-		require.Equal(t, "key1", string(k))
-		require.Equal(t, "value1.1", string(v))
+		require.Equal(t, [][]byte{[]byte("ba"), []byte("ca"), []byte("b"), []byte("ab")}, keys)
 
-		require.True(t, it.HasNext())
-		k, v, err = it.Next()
+		keys, _, err = iter.ToDualArray[[]byte, []byte](mustRange(t, tx, "ReverseKey", []byte("ca"), []byte("ab")))
 		require.NoError(t, err)
-		require.Equal(t, "key1", string(k))
-		require.Equal(t, "value1.3", string(v))
-
-		require.False(t, it.HasNext())
-		require.False(t, it.HasNext())
-
-		// [from, nil) means [from, INF)
-		it, err = tx.Range("Table", []byte("key1"), nil)
-		require.NoError(t, err)
-		cnt := 0
-		for it.HasNext() {
-			_, _, err := it.Next()
-			require.NoError(t, err)
-			cnt++
+		require.Equal(t, [][]byte{[]byte("ca"), []byte("b")}, keys)
+	}
+	{ // IntegerDup
+		for _, v := range []uint64{256, 1, 65536, 2} {
+			require.NoError(t, tx.Put("IntegerDup", []byte("k"), u64(v)))
 		}
-		require.Equal(t, 4, cnt)
-	})
-	t.Run("Desc", func(t *testing.T) {
-		_, tx, _ := BaseCase(t)
-
-		//[from, to)
-		it, err := tx.RangeDupSort("Table", []byte("key3"), nil, nil, order.Desc, -1)
-		require.NoError(t, err)
-		require.True(t, it.HasNext())
-		k, v, err := it.Next()
-		require.NoError(t, err)
-		require.Equal(t, "key3", string(k))
-		require.Equal(t, "value3.3", string(v))
-
-		require.True(t, it.HasNext())
-		k, v, err = it.Next()
+		it, err := tx.RangeDupSort("IntegerDup", []byte("k"), u64(2), nil, order.Asc, kv.Unlim)
 		require.NoError(t, err)
-		require.Equal(t, "key3", string(k))
-		require.Equal(t, "value3.1", string(v))
-
-		require.False(t, it.HasNext())
-
-		it, err = tx.RangeDescend("Table", nil, nil, 2)
+		_, values, err := iter.ToDualArray[[]byte, []byte](it)
 		require.NoError(t, err)
+		require.Equal(t, [][]byte{u64(2), u64(256), u64(65536)}, values)
 
-		cnt := 0
-		for it.HasNext() {
-			_, _, err := it.Next()
-			require.NoError(t, err)
-			cnt++
+		// IntegerDup tables accept only values of the same size
+		require.Error(t, tx.Put("IntegerDup", []byte("k"), []byte{1, 2, 3}))
+	}
+	{ // ReverseDup
+		for _, v := range []string{"ab", "ba", "b", "ca"} {
+			require.NoError(t, tx.Put("ReverseDup", []byte("k"), []byte(v)))
 		}
-		require.Equal(t, 2, cnt)
-	})
-}
-
-func TestLastDup(t *testing.T) {
-	db, tx, _ := BaseCase(t)
-
-	err := tx.Commit()
-	require.NoError(t, err)
-	roTx, err := db.BeginRo(context.Background())
-	require.NoError(t, err)
-	defer roTx.Rollback()
-
-	roC, err := roTx.CursorDupSort("Table")
-	require.NoError(t, err)
-	defer roC.Close()
-
-	var keys, vals []string
-	var k, v []byte
-	for k, _, err = roC.First(); err == nil && k != nil; k, _, err = roC.NextNoDup() {
-		v, err = roC.LastDup()
+		it, err := tx.RangeDupSort("ReverseDup", []byte("k"), nil, nil, order.Desc, kv.Unlim)
+		require.NoError(t, err)
+		_, values, err := iter.ToDualArray[[]byte, []byte](it)
 		require.NoError(t, err)
-		keys = append(keys, string(k))
-		vals = append(vals, string(v))
+		require.Equal(t, [][]byte{[]byte("ab"), []byte("b"), []byte("ca"), []byte("ba")}, values)
 	}
-	require.NoError(t, err)
-	require.Equal(t, []string{"key1", "key3"}, keys)
-	require.Equal(t, []string{"value1.3", "value3.3"}, vals)
-}
-
-func TestPutGet(t *testing.T) {
-	_, tx, c := BaseCase(t)
-
-	require.NoError(t, c.Put([]byte(""), []byte("value1.1")))
-
-	var v []byte
-	v, err := tx.GetOne("Table", []byte("key1"))
-	require.Nil(t, err)
-	require.Equal(t, v, []byte("value1.1"))
-
-	v, err = tx.GetOne("RANDOM", []byte("key1"))
-	require.Error(t, err) // Error from non-existent bucket returns error
-	require.Nil(t, v)
-}
-
-func TestIncrementRead(t *testing.T) {
-	_, tx, _ := BaseCase(t)
-
-	table := "Table"
-
-	_, err := tx.IncrementSequence(table, uint64(12))
-	require.Nil(t, err)
-	chaV, err := tx.ReadSequence(table)
-	require.Nil(t, err)
-	require.Equal(t, chaV, uint64(12))
-	_, err = tx.IncrementSequence(table, uint64(240))
-	require.Nil(t, err)
-	chaV, err = tx.ReadSequence(table)
-	require.Nil(t, err)
-	require.Equal(t, chaV, uint64(252))
 }
 
-func TestHasDelete(t *testing.T) {
-	_, tx, _ := BaseCase(t)
-
-	table := "Table"
-
-	require.NoError(t, tx.Put(table, []byte("key2"), []byte("value2.1")))
-	require.NoError(t, tx.Put(table, []byte("key4"), []byte("value4.1")))
-	require.NoError(t, tx.Put(table, []byte("key5"), []byte("value5.1")))
-
-	c, err := tx.RwCursorDupSort(table)
+func mustRange(t *testing.T, tx kv.Tx, table string, from, to []byte) iter.KV {
+	t.Helper()
+	it, err := tx.Range(table, from, to)
 	require.NoError(t, err)
-	defer c.Close()
-	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.1")))
-	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.3")))
-	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.1"))) //valid but already deleted
-	require.NoError(t, c.DeleteExact([]byte("key2"), []byte("value1.1"))) //valid key but wrong value
-
-	res, err := tx.Has(table, []byte("key1"))
-	require.Nil(t, err)
-	require.False(t, res)
-
-	res, err = tx.Has(table, []byte("key2"))
-	require.Nil(t, err)
-	require.True(t, res)
-
-	res, err = tx.Has(table, []byte("key3"))
-	require.Nil(t, err)
-	require.True(t, res) //There is another key3 left
-
-	res, err = tx.Has(table, []byte("k"))
-	require.Nil(t, err)
-	require.False(t, res)
+	return it
 }
 
-func TestForAmount(t *testing.T) {
-	_, tx, _ := BaseCase(t)
-
-	table := "Table"
-
-	require.NoError(t, tx.Put(table, []byte("key2"), []byte("value2.1")))
-	require.NoError(t, tx.Put(table, []byte("key4"), []byte("value4.1")))
-	require.NoError(t, tx.Put(table, []byte("key5"), []byte("value5.1")))
-
-	var keys []string
-
-	err := tx.ForAmount(table, []byte("key3"), uint32(2), func(k, v []byte) error {
-		keys = append(keys, string(k))
-		return nil
-	})
-	require.Nil(t, err)
-	require.Equal(t, []string{"key3", "key3"}, keys)
-
-	var keys1 []string
-
-	err1 := tx.ForAmount(table, []byte("key1"), 100, func(k, v []byte) error {
-		keys1 = append(keys1, string(k))
-		return nil
-	})
-	require.Nil(t, err1)
-	require.Equal(t, []string{"key1", "key1", "key2", "key3", "key3", "key4", "key5"}, keys1)
-
-	var keys2 []string
-
-	err2 := tx.ForAmount(table, []byte("value"), 100, func(k, v []byte) error {
-		keys2 = append(keys2, string(k))
-		return nil
-	})
-	require.Nil(t, err2)
-	require.Nil(t, keys2)
+func TestTableFlagsMismatch(t *testing.T) {
+	path := t.TempDir()
+	logger := log.NewNoop()
+	db := NewMDBX(logger).Path(path).WithTableCfg(kv.TableCfg{"T": {Flags: kv.IntegerKey}}).MapSize(128 * datasize.MB).MustOpen()
+	db.Close()
 
-	var keys3 []string
+	_, err := NewMDBX(logger).Path(path).WithTableCfg(kv.TableCfg{"T": {}}).MapSize(128 * datasize.MB).Open(context.Background())
+	require.ErrorContains(t, err, "don't match")
 
-	err3 := tx.ForAmount(table, []byte("key1"), 0, func(k, v []byte) error {
-		keys3 = append(keys3, string(k))
-		return nil
-	})
-	require.Nil(t, err3)
-	require.Nil(t, keys3)
+	db, err = NewMDBX(logger).Path(path).WithTableCfg(kv.TableCfg{"T": {Flags: kv.IntegerKey}}).MapSize(128 * datasize.MB).Open(context.Background())
+	require.NoError(t, err)
+	db.Close()
 }
 
-func TestForPrefix(t *testing.T) {
-	_, tx, _ := BaseCase(t)
-
-	table := "Table"
-
-	var keys []string
-
-	err := tx.ForPrefix(table, []byte("key"), func(k, v []byte) error {
-		keys = append(keys, string(k))
-		return nil
-	})
-	require.Nil(t, err)
-	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
-
-	var keys1 []string
-
-	err = tx.ForPrefix(table, []byte("key1"), func(k, v []byte) error {
-		keys1 = append(keys1, string(k))
-		return nil
-	})
-	require.Nil(t, err)
-	require.Equal(t, []string{"key1", "key1"}, keys1)
-
-	var keys2 []string
-
-	err = tx.ForPrefix(table, []byte("e"), func(k, v []byte) error {
-		keys2 = append(keys2, string(k))
-		return nil
-	})
-	require.Nil(t, err)
-	require.Nil(t, keys2)
+func TestUnsupportedTableFlags(t *testing.T) {
+	_, err := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"T": {Flags: kv.IntegerDup}}).MapSize(128 * datasize.MB).Open(context.Background())
+	require.Error(t, err)
 }
 
-func TestAppendFirstLast(t *testing.T) {
-	_, tx, c := BaseCase(t)
-
-	table := "Table"
+func TestCustomComparators(t *testing.T) {
+	descending := func(k1, k2, v1, v2 []byte) int { return bytes.Compare(k2, k1) }
+	descendingDups := func(k1, k2, v1, v2 []byte) int { return bytes.Compare(v2, v1) }
+	tables := kv.TableCfg{
+		"Desc":    {KeyCmp: descending},
+		"DescDup": {Flags: kv.DupSort, DupCmp: descendingDups},
+	}
+	path := t.TempDir()
+	logger := log.NewNoop()
+	for i := 0; i < MaxCustomComparators+1; i++ { // comparators must be released on Close
+		db := NewMDBX(logger).Path(path).WithTableCfg(tables).MapSize(128 * datasize.MB).MustOpen()
+		db.Close()
+	}
+	db := NewMDBX(logger).Path(path).WithTableCfg(tables).MapSize(128 * datasize.MB).MustOpen()
+	t.Cleanup(db.Close)
 
-	require.Error(t, tx.Append(table, []byte("key2"), []byte("value2.1")))
-	require.NoError(t, tx.Append(table, []byte("key6"), []byte("value6.1")))
-	require.Error(t, tx.Append(table, []byte("key4"), []byte("value4.1")))
-	require.NoError(t, tx.AppendDup(table, []byte("key2"), []byte("value1.11")))
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(tx.Rollback)
 
-	k, v, err := c.First()
-	require.Nil(t, err)
-	require.Equal(t, k, []byte("key1"))
-	require.Equal(t, v, []byte("value1.1"))
+	for _, k := range []string{"b", "d", "a", "c"} {
+		require.NoError(t, tx.Put("Desc", []byte(k), []byte("v")))
+		require.NoError(t, tx.Put("DescDup", []byte("k"), []byte(k)))
+	}
+	keys, _, err := iter.ToKVArray(mustRange(t, tx, "Desc", []byte("c"), []byte("a")))
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("c"), []byte("b")}, keys)
 
-	keys, values := iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key1", "key2", "key3", "key3", "key6"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.3", "value1.11", "value3.1", "value3.3", "value6.1"}, values)
+	it, err := tx.RangeDupSort("DescDup", []byte("k"), nil, nil, order.Asc, kv.Unlim)
+	require.NoError(t, err)
+	_, values, err := iter.ToKVArray(it)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("d"), []byte("c"), []byte("b"), []byte("a")}, values)
 
-	k, v, err = c.Last()
-	require.Nil(t, err)
-	require.Equal(t, k, []byte("key6"))
-	require.Equal(t, v, []byte("value6.1"))
+	union := iter.UnionKVFunc(mustRange(t, tx, "Desc", []byte("d"), []byte("b")), mustRange(t, tx, "Desc", []byte("b"), nil), kv.Unlim, tables["Desc"].CompareKeys)
+	keys, _, err = iter.ToKVArray(union)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("d"), []byte("c"), []byte("b"), []byte("a")}, keys)
 
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key6"}, keys)
-	require.Equal(t, []string{"value6.1"}, values)
+	_, err = NewMDBX(logger).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"T": {DupCmp: descendingDups}}).MapSize(128 * datasize.MB).Open(context.Background())
+	require.ErrorContains(t, err, "DupSort")
 }
 
-func TestNextPrevCurrent(t *testing.T) {
-	_, _, c := BaseCase(t)
-
-	k, v, err := c.First()
-	require.Nil(t, err)
-	keys, values := iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
-
-	k, v, err = c.Next()
-	require.Equal(t, []byte("key1"), k)
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
-
-	k, v, err = c.Current()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
-	require.Equal(t, k, []byte("key1"))
-	require.Equal(t, v, []byte("value1.3"))
-
-	k, v, err = c.Next()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key3", "key3"}, keys)
-	require.Equal(t, []string{"value3.1", "value3.3"}, values)
-
-	k, v, err = c.Prev()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
-
-	k, v, err = c.Current()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
-
-	k, v, err = c.Prev()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
-
-	err = c.DeleteCurrent()
-	require.Nil(t, err)
-	k, v, err = c.Current()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.3", "value3.1", "value3.3"}, values)
-
-}
+func TestCommitMetrics(t *testing.T) {
+	label := kv.Label("commit_metrics_test")
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).Label(label).CommitMetrics().
+		WithTableCfg(kv.TableCfg{"Table": {}}).MustOpen()
+	defer db.Close()
+
+	total := db.(*MdbxKV).commitMetrics.Total
+	m := &dto.Metric{}
+	require.NoError(t, total.Write(m))
+	before := m.GetSummary().GetSampleCount() // Open also commits
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+			return tx.Put("Table", []byte{byte(i)}, []byte{byte(i)})
+		}))
+	}
 
-func TestSeek(t *testing.T) {
-	_, _, c := BaseCase(t)
-
-	k, v, err := c.Seek([]byte("k"))
-	require.Nil(t, err)
-	keys, values := iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
-
-	k, v, err = c.Seek([]byte("key3"))
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key3", "key3"}, keys)
-	require.Equal(t, []string{"value3.1", "value3.3"}, values)
-
-	k, v, err = c.Seek([]byte("xyz"))
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Nil(t, keys)
-	require.Nil(t, values)
+	require.NoError(t, total.Write(m))
+	require.Equal(t, before+3, m.GetSummary().GetSampleCount())
+	require.Equal(t, "label", m.GetLabel()[0].GetName())
+	require.Equal(t, string(label), m.GetLabel()[0].GetValue())
 }
 
-func TestSeekExact(t *testing.T) {
-	_, _, c := BaseCase(t)
-
-	k, v, err := c.SeekExact([]byte("key3"))
-	require.Nil(t, err)
-	keys, values := iteration(t, c, k, v)
-	require.Equal(t, []string{"key3", "key3"}, keys)
-	require.Equal(t, []string{"value3.1", "value3.3"}, values)
-
-	k, v, err = c.SeekExact([]byte("key"))
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Nil(t, keys)
-	require.Nil(t, values)
+func TestDBMetricsPerDB(t *testing.T) {
+	open := func(label kv.Label) *MdbxKV {
+		db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).Label(label).WithTableCfg(kv.TableCfg{"Table": {}}).MustOpen()
+		t.Cleanup(db.Close)
+		return db.(*MdbxKV)
+	}
+	a1, a2, b := open("metrics_test_a"), open("metrics_test_a2"), open("metrics_test_b")
+	require.NotSame(t, a1.metrics, a2.metrics)
+	require.Contains(t, a1.metrics.Set.ListMetricNames(), `db_size{label="metrics_test_a"}`)
+	require.Contains(t, a2.metrics.Set.ListMetricNames(), `db_size{label="metrics_test_a2"}`)
+	require.Contains(t, b.metrics.Set.ListMetricNames(), `db_size{label="metrics_test_b"}`)
+
+	// label of open db can't be reused
+	_, err := NewMDBX(log.NewNoop()).InMem(t.TempDir()).Label("metrics_test_a").WithTableCfg(kv.TableCfg{"Table": {}}).Open(context.Background())
+	require.ErrorIs(t, err, kv.ErrLabelInUse)
+
+	require.NoError(t, a2.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put("Table", make([]byte, 8), make([]byte, 16*1024))
+	}))
+	dirty := func(db *MdbxKV) float64 {
+		m := &dto.Metric{}
+		require.NoError(t, db.metrics.TxDirty.Write(m))
+		return m.GetGauge().GetValue()
+	}
+	require.Greater(t, dirty(a2), dirty(a1))
+
+	// series of db are removed on its Close, label is free to use again
+	a1.Close()
+	require.Empty(t, a1.metrics.Set.ListMetricNames())
+	require.NotEmpty(t, a2.metrics.Set.ListMetricNames())
+	a3 := open("metrics_test_a")
+	require.Contains(t, a3.metrics.Set.ListMetricNames(), `db_size{label="metrics_test_a"}`)
+	a2.Close()
+	require.Empty(t, a2.metrics.Set.ListMetricNames())
+	require.NotEmpty(t, a3.metrics.Set.ListMetricNames())
+	require.NotEmpty(t, b.metrics.Set.ListMetricNames())
+
+	// deprecated package-level metrics are metrics of db with default label, many dbs with default label can be open:
+	// only one of them exports its series
+	var inMem []*MdbxKV
+	for i := 0; i < 2; i++ {
+		inMem = append(inMem, open(kv.InMem))
+	}
+	require.NotSame(t, inMem[0].metrics, inMem[1].metrics)
+	require.True(t, inMem[0].metrics.DbSize == kv.DbSize || inMem[1].metrics.DbSize == kv.DbSize)
+	for _, db := range inMem {
+		require.Equal(t, kv.InMem, db.metrics.Label)
+	}
 }
 
-func TestSeekBothExact(t *testing.T) {
-	_, _, c := BaseCase(t)
-
-	k, v, err := c.SeekBothExact([]byte("key1"), []byte("value1.2"))
-	require.Nil(t, err)
-	keys, values := iteration(t, c, k, v)
-	require.Nil(t, keys)
-	require.Nil(t, values)
-
-	k, v, err = c.SeekBothExact([]byte("key2"), []byte("value1.1"))
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Nil(t, keys)
-	require.Nil(t, values)
-
-	k, v, err = c.SeekBothExact([]byte("key1"), []byte("value1.1"))
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key1", "key3", "key3"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.3", "value3.1", "value3.3"}, values)
-
-	k, v, err = c.SeekBothExact([]byte("key3"), []byte("value3.3"))
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key3"}, keys)
-	require.Equal(t, []string{"value3.3"}, values)
-}
+func TestNestedTx(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).MustOpen()
+	defer db.Close()
+
+	errRollback := errors.New("rollback")
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Put("Table", []byte("a"), []byte("1")))
+		require.ErrorIs(t, kv.Savepoint(tx, func(tx kv.RwTx) error {
+			require.NoError(t, tx.Put("Table", []byte("b"), []byte("2")))
+			require.NoError(t, tx.Delete("Table", []byte("a")))
+			return errRollback
+		}), errRollback)
+		require.NoError(t, kv.Savepoint(tx, func(tx kv.RwTx) error {
+			v, err := tx.GetOne("Table", []byte("a")) // changes of parent are visible
+			require.NoError(t, err)
+			require.Equal(t, []byte("1"), v)
+			return tx.Put("Table", []byte("c"), []byte("3"))
+		}))
 
-func TestNextDups(t *testing.T) {
-	_, tx, _ := BaseCase(t)
+		// not finished nested tx is discarded by parent
+		nested, err := tx.(kv.NestedRwTx).BeginNested()
+		require.NoError(t, err)
+		require.NoError(t, nested.Put("Table", []byte("d"), []byte("4")))
+		return nil
+	}))
 
-	table := "Table"
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		for k, expected := range map[string][]byte{"a": []byte("1"), "b": nil, "c": []byte("3"), "d": nil} {
+			v, err := tx.GetOne("Table", []byte(k))
+			require.NoError(t, err)
+			require.Equal(t, expected, v, k)
+		}
+		_, err := tx.(*MdbxTx).BeginNested()
+		require.ErrorIs(t, err, kv.ErrNestedTxUnsupported)
+		return nil
+	}))
 
-	c, err := tx.RwCursorDupSort(table)
-	require.NoError(t, err)
-	defer c.Close()
-	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.1")))
-	require.NoError(t, c.DeleteExact([]byte("key1"), []byte("value1.3")))
-	require.NoError(t, c.DeleteExact([]byte("key3"), []byte("value3.1"))) //valid but already deleted
-	require.NoError(t, c.DeleteExact([]byte("key3"), []byte("value3.3"))) //valid key but wrong value
-
-	require.NoError(t, tx.Put(table, []byte("key2"), []byte("value1.1")))
-	require.NoError(t, c.Put([]byte("key2"), []byte("value1.2")))
-	require.NoError(t, c.Put([]byte("key3"), []byte("value1.6")))
-	require.NoError(t, c.Put([]byte("key"), []byte("value1.7")))
-
-	k, v, err := c.Current()
-	require.Nil(t, err)
-	keys, values := iteration(t, c, k, v)
-	require.Equal(t, []string{"key", "key2", "key2", "key3"}, keys)
-	require.Equal(t, []string{"value1.7", "value1.1", "value1.2", "value1.6"}, values)
-
-	v, err = c.FirstDup()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key", "key2", "key2", "key3"}, keys)
-	require.Equal(t, []string{"value1.7", "value1.1", "value1.2", "value1.6"}, values)
-
-	k, v, err = c.NextNoDup()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key2", "key2", "key3"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.2", "value1.6"}, values)
-
-	k, v, err = c.NextDup()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key2", "key3"}, keys)
-	require.Equal(t, []string{"value1.2", "value1.6"}, values)
-
-	v, err = c.LastDup()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key2", "key3"}, keys)
-	require.Equal(t, []string{"value1.2", "value1.6"}, values)
-
-	k, v, err = c.NextDup()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Nil(t, keys)
-	require.Nil(t, values)
-
-	k, v, err = c.NextNoDup()
-	require.Nil(t, err)
-	keys, values = iteration(t, c, k, v)
-	require.Equal(t, []string{"key3"}, keys)
-	require.Equal(t, []string{"value1.6"}, values)
+	writeMapDB := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WriteMap().WithTableCfg(kv.TableCfg{"Table": {}}).MustOpen()
+	defer writeMapDB.Close()
+	require.ErrorIs(t, writeMapDB.Update(ctx, func(tx kv.RwTx) error {
+		return kv.Savepoint(tx, func(tx kv.RwTx) error { return nil })
+	}), kv.ErrNestedTxUnsupported)
 }
 
-func TestCurrentDup(t *testing.T) {
-	_, _, c := BaseCase(t)
-
-	count, err := c.CountDuplicates()
-	require.Nil(t, err)
-	require.Equal(t, count, uint64(2))
-
-	require.Error(t, c.PutNoDupData([]byte("key3"), []byte("value3.3")))
-	require.NoError(t, c.DeleteCurrentDuplicates())
-
-	k, v, err := c.SeekExact([]byte("key1"))
-	require.Nil(t, err)
-	keys, values := iteration(t, c, k, v)
-	require.Equal(t, []string{"key1", "key1"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.3"}, values)
-
-	require.Equal(t, []string{"key1", "key1"}, keys)
-	require.Equal(t, []string{"value1.1", "value1.3"}, values)
+func TestNestedTxTablesChanges(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}, "Deprecated": {IsDeprecated: true}}).MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.CreateBucket("Deprecated"); err != nil {
+			return err
+		}
+		return tx.Put("Table", []byte("a"), []byte("1"))
+	}))
+
+	errRollback := errors.New("rollback")
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for _, f := range []func(tx kv.RwTx) error{
+			func(tx kv.RwTx) error { return tx.CreateBucket("New") },
+			func(tx kv.RwTx) error { return tx.DropBucket("Deprecated") },
+			func(tx kv.RwTx) error { return tx.(kv.BucketMigrator).RenameBucket("Table", "Renamed") },
+			func(tx kv.RwTx) error { return tx.(kv.BucketMigrator).CopyBucket("Table", "Copy") },
+		} {
+			err := kv.Savepoint(tx, func(tx kv.RwTx) error {
+				if err := f(tx); err != nil {
+					return err
+				}
+				return errRollback
+			})
+			require.ErrorIs(t, err, kv.ErrNestedTxUnsupported)
+		}
+		// config of tables is not changed: parent sees tables as they are in db
+		for table, expected := range map[string]bool{"Table": true, "Deprecated": true, "New": false, "Renamed": false, "Copy": false} {
+			exists, err := tx.(kv.BucketMigrator).ExistsBucket(table)
+			require.NoError(t, err)
+			require.Equal(t, expected, exists, table)
+		}
+		v, err := tx.GetOne("Table", []byte("a"))
+		require.NoError(t, err)
+		require.Equal(t, []byte("1"), v)
+		return nil
+	}))
+	for _, table := range []string{"New", "Renamed", "Copy"} {
+		_, ok := db.AllTables()[table]
+		require.False(t, ok, table)
+	}
 }
 
-func TestDupDelete(t *testing.T) {
-	_, _, c := BaseCase(t)
-
-	k, _, err := c.Current()
-	require.Nil(t, err)
-	require.Equal(t, []byte("key3"), k)
-
-	err = c.DeleteCurrentDuplicates()
-	require.Nil(t, err)
-
-	err = c.Delete([]byte("key1"))
-	require.Nil(t, err)
-
-	count, err := c.Count()
-	require.Nil(t, err)
-	assert.Zero(t, count)
+func TestBigChunks(t *testing.T) {
+	ctx := context.Background()
+	db := NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"Table": {}}).MustOpen()
+	defer db.Close()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := uint64(0); i < 1000; i++ {
+			if err := tx.Put("Table", binary.BigEndian.AppendUint64(nil, i), binary.BigEndian.AppendUint64(nil, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var seen uint64
+	require.NoError(t, kv.BigChunks(db, "Table", binary.BigEndian.AppendUint64(nil, 10), func(tx kv.Tx, k, v []byte) (bool, error) {
+		require.Equal(t, binary.BigEndian.AppendUint64(nil, seen+10), k)
+		seen++
+		return true, nil
+	}))
+	require.Equal(t, uint64(990), seen)
+
+	seen = 0
+	require.NoError(t, kv.BigChunks(db, "Table", nil, func(tx kv.Tx, k, v []byte) (bool, error) {
+		seen++
+		return seen < 5, nil
+	}))
+	require.Equal(t, uint64(5), seen)
 }
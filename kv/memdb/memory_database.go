@@ -23,23 +23,8 @@ import (
 	"testing"
 
 	"github.com/uncommoncorrelation/go-mdbx-db/kv"
-	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
-	"github.com/uncommoncorrelation/go-mdbx-db/log"
 )
 
-func New(tmpDir string, tblConfig kv.TableCfg) kv.RwDB {
-	return mdbx.NewMDBX(log.NewNoop()).InMem(tmpDir).WithTableCfg(tblConfig).MustOpen()
-}
-
-func NewTestDB(tb testing.TB, tblConfig kv.TableCfg) kv.RwDB {
-	tb.Helper()
-	tmpDir := tb.TempDir()
-	tb.Helper()
-	db := New(tmpDir, tblConfig)
-	tb.Cleanup(db.Close)
-	return db
-}
-
 func BeginRw(tb testing.TB, db kv.RwDB) kv.RwTx {
 	tb.Helper()
 	tx, err := db.BeginRw(context.Background())
@@ -59,16 +44,3 @@ func BeginRo(tb testing.TB, db kv.RoDB) kv.Tx {
 	tb.Cleanup(tx.Rollback)
 	return tx
 }
-
-func NewTestTx(tb testing.TB, tblConfig kv.TableCfg) (kv.RwDB, kv.RwTx) {
-	tb.Helper()
-	tmpDir := tb.TempDir()
-	db := New(tmpDir, tblConfig)
-	tb.Cleanup(db.Close)
-	tx, err := db.BeginRw(context.Background())
-	if err != nil {
-		tb.Fatal(err)
-	}
-	tb.Cleanup(tx.Rollback)
-	return db, tx
-}
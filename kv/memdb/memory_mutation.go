@@ -16,52 +16,49 @@ package memdb
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"sort"
+	"unsafe"
 
 	"github.com/uncommoncorrelation/go-mdbx-db/common"
 	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
 	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
 
 	"github.com/uncommoncorrelation/go-mdbx-db/kv"
-	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
-	"github.com/uncommoncorrelation/go-mdbx-db/log"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/memkv"
+)
+
+var (
+	_ kv.RwTx             = (*MemoryMutation)(nil)
+	_ kv.PendingMutations = (*MemoryMutation)(nil)
 )
 
 type MemoryMutation struct {
 	memTx            kv.RwTx
 	memDb            kv.RwDB
 	deletedEntries   map[string]map[string]struct{}
+	deletedDups      map[string]map[string]map[string]struct{} // table -> key -> value, deleted values of DupSort tables
 	clearedTables    map[string]struct{}
+	droppedTables    map[string]struct{}
+	migrations       []bucketMigration
+	sizes            map[string]int // table -> bytes of written entries and deleted keys/values, see BatchSize
 	db               kv.Tx
 	statelessCursors map[string]kv.RwCursor
 	tblConfig        kv.TableCfg
 }
 
-// NewMemoryBatch - starts in-mem batch
-//
-// Common pattern:
-//
-// batch := NewMemoryBatch(db, tmpDir)
-// defer batch.Rollback()
-// ... some calculations on `batch`
-// batch.Commit()
-func NewMemoryBatch(tx kv.Tx, tmpDir string, tblConfig kv.TableCfg) *MemoryMutation {
-	tmpDB := mdbx.NewMDBX(log.NewNoop()).InMem(tmpDir).WithTableCfg(tblConfig).MustOpen()
-	memTx, err := tmpDB.BeginRw(context.Background())
+// NewPureGoMemoryBatch - same as NewMemoryBatch, but keeps changes in memkv: no tmp files and no mdbx environment.
+// Available without cgo.
+func NewPureGoMemoryBatch(tx kv.Tx, tblConfig kv.TableCfg) *MemoryMutation {
+	memDB := memkv.New(tblConfig)
+	memTx, err := memDB.BeginRw(context.Background())
 	if err != nil {
 		panic(err)
 	}
 	if err := initSequences(tx, memTx); err != nil {
 		return nil
 	}
-
-	return &MemoryMutation{
-		db:             tx,
-		memDb:          tmpDB,
-		memTx:          memTx,
-		deletedEntries: make(map[string]map[string]struct{}),
-		clearedTables:  make(map[string]struct{}),
-		tblConfig:      tblConfig,
-	}
+	return NewMemoryBatchWithCustomDB(tx, memDB, memTx, "", tblConfig)
 }
 
 func NewMemoryBatchWithCustomDB(tx kv.Tx, db kv.RwDB, uTx kv.RwTx, tmpDir string, tblConfig kv.TableCfg) *MemoryMutation {
@@ -70,7 +67,10 @@ func NewMemoryBatchWithCustomDB(tx kv.Tx, db kv.RwDB, uTx kv.RwTx, tmpDir string
 		memDb:          db,
 		memTx:          uTx,
 		deletedEntries: make(map[string]map[string]struct{}),
+		deletedDups:    make(map[string]map[string]map[string]struct{}),
 		clearedTables:  make(map[string]struct{}),
+		droppedTables:  make(map[string]struct{}),
+		sizes:          make(map[string]int),
 		tblConfig:      tblConfig,
 	}
 }
@@ -94,8 +94,14 @@ func (m *MemoryMutation) isEntryDeleted(table string, key []byte) bool {
 	return ok
 }
 
+func (m *MemoryMutation) isDupDeleted(table string, key, value []byte) bool {
+	_, ok := m.deletedDups[table][string(key)][string(value)]
+	return ok
+}
+
+// DBSize - size of underlying db. Size of in-memory changes is reported by BatchSize.
 func (m *MemoryMutation) DBSize() (uint64, error) {
-	panic("not implemented")
+	return m.db.DBSize()
 }
 
 func initSequences(db kv.Tx, memTx kv.RwTx) error {
@@ -171,7 +177,11 @@ func (m *MemoryMutation) GetOne(table string, key []byte) ([]byte, error) {
 }
 
 func (m *MemoryMutation) Last(table string) ([]byte, []byte, error) {
-	panic("not implemented. (MemoryMutation.Last)")
+	c, err := m.statelessCursor(table)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.Last()
 }
 
 // Has return whether a key is present in a certain table.
@@ -188,11 +198,19 @@ func (m *MemoryMutation) Has(table string, key []byte) (bool, error) {
 }
 
 func (m *MemoryMutation) Put(table string, k, v []byte) error {
-	return m.memTx.Put(table, k, v)
+	if err := m.memTx.Put(table, k, v); err != nil {
+		return err
+	}
+	m.sizes[table] += len(k) + len(v)
+	return nil
 }
 
 func (m *MemoryMutation) Append(table string, key []byte, value []byte) error {
-	return m.memTx.Append(table, key, value)
+	if err := m.memTx.Append(table, key, value); err != nil {
+		return err
+	}
+	m.sizes[table] += len(key) + len(value)
+	return nil
 }
 
 func (m *MemoryMutation) AppendDup(table string, key []byte, value []byte) error {
@@ -229,25 +247,212 @@ func (m *MemoryMutation) Prefix(table string, prefix []byte) (iter.KV, error) {
 	return m.Stream(table, prefix, nextPrefix)
 }
 func (m *MemoryMutation) Stream(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
-	panic("please implement me")
+	return m.Range(table, fromPrefix, toPrefix)
 }
 func (m *MemoryMutation) StreamAscend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error) {
-	panic("please implement me")
+	return m.RangeAscend(table, fromPrefix, toPrefix, limit)
 }
 func (m *MemoryMutation) StreamDescend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error) {
-	panic("please implement me")
+	return m.RangeDescend(table, fromPrefix, toPrefix, limit)
 }
 func (m *MemoryMutation) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
-	panic("please implement me")
+	return m.RangeAscend(table, fromPrefix, toPrefix, -1)
 }
 func (m *MemoryMutation) RangeAscend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error) {
-	panic("please implement me")
+	return m.rangeOrderLimit(table, fromPrefix, toPrefix, order.Asc, limit)
 }
 func (m *MemoryMutation) RangeDescend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error) {
-	panic("please implement me")
+	return m.rangeOrderLimit(table, fromPrefix, toPrefix, order.Desc, limit)
+}
+
+// rangeOrderLimit - same semantic as MdbxTx.RangeAscend/RangeDescend: [from, to) in given order, limit -1 means
+// no limit. Iterates over memoryMutationCursor, so sees both: writes of MemoryMutation and entries of underlying tx.
+func (m *MemoryMutation) rangeOrderLimit(table string, fromPrefix, toPrefix []byte, orderAscend order.By, limit int) (*rangeIter, error) {
+	s := &rangeIter{fromPrefix: fromPrefix, toPrefix: toPrefix, orderAscend: orderAscend, limit: int64(limit), cmp: m.tblConfig[table].CompareKeys}
+	return s.init(m, table)
+}
+
+type rangeIter struct {
+	c kv.CursorDupSort
+
+	fromPrefix, toPrefix, nextK, nextV []byte
+	err                                error
+	orderAscend                        order.By
+	limit                              int64
+	cmp                                func(a, b []byte) int // keys order of table
+}
+
+func (s *rangeIter) init(m *MemoryMutation, table string) (*rangeIter, error) {
+	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) >= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.fromPrefix, s.toPrefix)
+	}
+	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) <= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.toPrefix, s.fromPrefix)
+	}
+	c, err := m.CursorDupSort(table)
+	if err != nil {
+		return s, err
+	}
+	s.c = c
+
+	if s.fromPrefix == nil { // no initial position
+		if s.orderAscend {
+			s.nextK, s.nextV, s.err = s.c.First()
+		} else {
+			s.nextK, s.nextV, s.err = s.c.Last()
+		}
+		return s, s.err
+	}
+
+	s.nextK, s.nextV, s.err = s.c.Seek(s.fromPrefix)
+	if s.orderAscend || s.err != nil {
+		return s, s.err
+	}
+	// descend: start from given key or previous one
+	switch {
+	case s.nextK == nil: // all keys are before fromPrefix
+		s.nextK, s.nextV, s.err = s.c.Last()
+	case s.cmp(s.nextK, s.fromPrefix) != 0:
+		s.nextK, s.nextV, s.err = s.c.Prev()
+	case m.isTablePurelyDupsort(table): // go to last value of this key
+		s.nextV, s.err = s.c.LastDup()
+	}
+	return s, s.err
+}
+
+func (s *rangeIter) Close() {
+	if s.c != nil {
+		s.c.Close()
+		s.c = nil
+		s.nextK, s.err = nil, nil
+	}
+}
+func (s *rangeIter) HasNext() bool {
+	if s.err != nil { // always true, then .Next() call will return this error
+		return true
+	}
+	if s.limit == 0 { // limit reached
+		return false
+	}
+	if s.nextK == nil { // EndOfTable
+		return false
+	}
+	if s.toPrefix == nil { // s.nextK == nil check is above
+		return true
+	}
+
+	//Asc:  [from, to) AND from < to
+	//Desc: [from, to) AND from > to
+	cmp := s.cmp(s.nextK, s.toPrefix)
+	return (bool(s.orderAscend) && cmp < 0) || (!bool(s.orderAscend) && cmp > 0)
 }
+func (s *rangeIter) Next() (k, v []byte, err error) {
+	if s.c == nil {
+		return nil, nil, kv.ErrCursorClosed
+	}
+	s.limit--
+	k, v, err = s.nextK, s.nextV, s.err
+	if s.orderAscend {
+		s.nextK, s.nextV, s.err = s.c.Next()
+	} else {
+		s.nextK, s.nextV, s.err = s.c.Prev()
+	}
+	return k, v, err
+}
+
+// RangeDupSort - same semantic as MdbxTx.RangeDupSort: values of key in [from, to) in given order, limit -1 means
+// no limit
 func (m *MemoryMutation) RangeDupSort(table string, key []byte, fromPrefix, toPrefix []byte, asc order.By, limit int) (iter.KV, error) {
-	panic("please implement me")
+	s := &rangeDupSortIter{key: key, fromPrefix: fromPrefix, toPrefix: toPrefix, orderAscend: asc, limit: int64(limit), cmp: m.tblConfig[table].CompareDups}
+	return s.init(m, table)
+}
+
+type rangeDupSortIter struct {
+	c kv.CursorDupSort
+
+	key                         []byte
+	fromPrefix, toPrefix, nextV []byte
+	err                         error
+	orderAscend                 order.By
+	limit                       int64
+	cmp                         func(a, b []byte) int // values order of table
+}
+
+func (s *rangeDupSortIter) init(m *MemoryMutation, table string) (*rangeDupSortIter, error) {
+	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) >= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.fromPrefix, s.toPrefix)
+	}
+	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) <= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.toPrefix, s.fromPrefix)
+	}
+	c, err := m.CursorDupSort(table)
+	if err != nil {
+		return s, err
+	}
+	s.c = c
+	k, _, err := c.SeekExact(s.key)
+	if err != nil || k == nil {
+		return s, err
+	}
+
+	switch {
+	case s.fromPrefix == nil && bool(s.orderAscend):
+		s.nextV, s.err = s.c.FirstDup()
+	case s.fromPrefix == nil:
+		s.nextV, s.err = s.c.LastDup()
+	case bool(s.orderAscend):
+		s.nextV, s.err = s.c.SeekBothRange(s.key, s.fromPrefix)
+	default: // given value or previous one
+		if s.nextV, s.err = s.c.SeekBothRange(s.key, s.fromPrefix); s.err != nil {
+			return s, s.err
+		}
+		switch {
+		case s.nextV == nil: // all values are before fromPrefix
+			if _, _, s.err = c.SeekExact(s.key); s.err == nil {
+				s.nextV, s.err = s.c.LastDup()
+			}
+		case s.cmp(s.nextV, s.fromPrefix) != 0:
+			_, s.nextV, s.err = s.c.PrevDup()
+		}
+	}
+	return s, s.err
+}
+
+func (s *rangeDupSortIter) Close() {
+	if s.c != nil {
+		s.c.Close()
+		s.c = nil
+		s.nextV, s.err = nil, nil
+	}
+}
+func (s *rangeDupSortIter) HasNext() bool {
+	if s.err != nil { // always true, then .Next() call will return this error
+		return true
+	}
+	if s.limit == 0 { // limit reached
+		return false
+	}
+	if s.nextV == nil { // end of values of key
+		return false
+	}
+	if s.toPrefix == nil {
+		return true
+	}
+	cmp := s.cmp(s.nextV, s.toPrefix)
+	return (bool(s.orderAscend) && cmp < 0) || (!bool(s.orderAscend) && cmp > 0)
+}
+func (s *rangeDupSortIter) Next() (k, v []byte, err error) {
+	if s.c == nil {
+		return nil, nil, kv.ErrCursorClosed
+	}
+	s.limit--
+	v, err = s.nextV, s.err
+	if s.orderAscend {
+		_, s.nextV, s.err = s.c.NextDup()
+	} else {
+		_, s.nextV, s.err = s.c.PrevDup()
+	}
+	return s.key, v, err
 }
 
 func (m *MemoryMutation) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
@@ -275,10 +480,33 @@ func (m *MemoryMutation) Delete(table string, k []byte) error {
 	if _, ok := m.deletedEntries[table]; !ok {
 		m.deletedEntries[table] = make(map[string]struct{})
 	}
-	m.deletedEntries[table][string(k)] = struct{}{}
+	if _, ok := m.deletedEntries[table][string(k)]; !ok {
+		m.deletedEntries[table][string(k)] = struct{}{}
+		m.sizes[table] += len(k)
+	}
 	return m.memTx.Delete(table, k)
 }
 
+// deleteDup - deletes 1 value of key in DupSort table
+func (m *MemoryMutation) deleteDup(table string, k, v []byte) error {
+	if _, ok := m.deletedDups[table]; !ok {
+		m.deletedDups[table] = make(map[string]map[string]struct{})
+	}
+	if _, ok := m.deletedDups[table][string(k)]; !ok {
+		m.deletedDups[table][string(k)] = make(map[string]struct{})
+	}
+	if _, ok := m.deletedDups[table][string(k)][string(v)]; !ok {
+		m.deletedDups[table][string(k)][string(v)] = struct{}{}
+		m.sizes[table] += len(k) + len(v)
+	}
+	c, err := m.memTx.RwCursorDupSort(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.DeleteExact(k, v)
+}
+
 func (m *MemoryMutation) Commit() error {
 	m.statelessCursors = nil
 	return nil
@@ -294,40 +522,265 @@ func (m *MemoryMutation) Close() {
 	m.Rollback()
 }
 
+// BucketSize - size of table in underlying db, 0 if table was cleared or dropped. Size of in-memory changes is
+// reported by BatchSize.
 func (m *MemoryMutation) BucketSize(bucket string) (uint64, error) {
-	return m.memTx.BucketSize(bucket)
+	if m.isTableCleared(bucket) || m.isTableDropped(bucket) {
+		return 0, nil
+	}
+	return m.db.BucketSize(bucket)
 }
 
+// DropBucket - same restrictions as MdbxTx.DropBucket: only deprecated tables can be dropped.
+// Table of underlying db is dropped by Flush.
 func (m *MemoryMutation) DropBucket(bucket string) error {
-	panic("Not implemented")
+	if err := m.memTx.DropBucket(bucket); err != nil {
+		return err
+	}
+	m.droppedTables[bucket] = struct{}{}
+	delete(m.clearedTables, bucket)
+	delete(m.deletedEntries, bucket)
+	delete(m.deletedDups, bucket)
+	delete(m.sizes, bucket)
+	m.statelessCursors = nil
+	return nil
+}
+
+func (m *MemoryMutation) isTableDropped(table string) bool {
+	_, ok := m.droppedTables[table]
+	return ok
+}
+
+// RenameBucket - same semantic as MdbxTx.RenameBucket: CopyBucket and drop of `from`, even if it's not deprecated.
+// Tables of underlying db are renamed by Flush.
+func (m *MemoryMutation) RenameBucket(from, to string) error {
+	return m.migrateBucket(from, to, true)
+}
+
+// CopyBucket - same semantic as MdbxTx.CopyBucket: not existing dst is created with config of src, existing one must
+// be empty. Tables of underlying db are copied by Flush.
+func (m *MemoryMutation) CopyBucket(src, dst string) error {
+	return m.migrateBucket(src, dst, false)
+}
+
+// migrateBucket - keeps all entries of src, as seen through batch, in memTx's dst: dst doesn't depend on underlying
+// db anymore
+func (m *MemoryMutation) migrateBucket(src, dst string, rename bool) error {
+	op := "copy"
+	if rename {
+		op = "rename"
+	}
+	if src == dst {
+		return fmt.Errorf("%s table: %s, source and destination are the same", op, src)
+	}
+	if exists, err := m.ExistsBucket(src); err != nil || !exists {
+		if err == nil {
+			err = fmt.Errorf("not found")
+		}
+		return fmt.Errorf("%s table: %s, %w", op, src, err)
+	}
+	if exists, err := m.ExistsBucket(dst); err != nil {
+		return err
+	} else if exists {
+		c, err := m.Cursor(dst)
+		if err != nil {
+			return err
+		}
+		k, _, err := c.First()
+		c.Close()
+		if err != nil {
+			return err
+		}
+		if k != nil {
+			return fmt.Errorf("%s table: %s to %s, destination is not empty", op, src, dst)
+		}
+	}
+	var entries [][2][]byte
+	if err := m.ForEach(src, nil, func(k, v []byte) error {
+		entries = append(entries, [2][]byte{common.Copy(k), common.Copy(v)})
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// memTx creates dst with config of src, then entries of batch are written there
+	if err := m.memTx.CreateBucket(src); err != nil {
+		return err
+	}
+	if rename {
+		if err := m.memTx.RenameBucket(src, dst); err != nil {
+			return err
+		}
+	} else if err := m.memTx.CopyBucket(src, dst); err != nil {
+		return err
+	}
+	if err := m.memTx.ClearBucket(dst); err != nil {
+		return err
+	}
+	m.sizes[dst] = 0
+	for _, e := range entries {
+		if err := m.memTx.Put(dst, e[0], e[1]); err != nil {
+			return err
+		}
+		m.sizes[dst] += len(e[0]) + len(e[1])
+	}
+
+	if _, ok := m.tblConfig[dst]; !ok {
+		cfg := make(kv.TableCfg, len(m.tblConfig)+1) // map of caller must not change
+		for name, item := range m.tblConfig {
+			cfg[name] = item
+		}
+		cfg[dst] = m.tblConfig[src]
+		m.tblConfig = cfg
+	}
+	delete(m.droppedTables, dst)
+	delete(m.deletedEntries, dst)
+	delete(m.deletedDups, dst)
+	m.clearedTables[dst] = struct{}{}
+	if rename {
+		m.droppedTables[src] = struct{}{}
+		delete(m.clearedTables, src)
+		delete(m.deletedEntries, src)
+		delete(m.deletedDups, src)
+		delete(m.sizes, src)
+	}
+	m.migrations = append(m.migrations, bucketMigration{src: src, dst: dst, rename: rename})
+	m.statelessCursors = nil
+	return nil
+}
+
+// bucketMigration - RenameBucket or CopyBucket, replayed on underlying db by Flush: it creates dst there with config of
+// src and drops renamed src
+type bucketMigration struct {
+	src, dst string
+	rename   bool
+}
+
+func (mig bucketMigration) apply(tx kv.RwTx) error {
+	if err := tx.CreateBucket(mig.src); err != nil { // src may be created only in batch
+		return err
+	}
+	if exists, err := tx.ExistsBucket(mig.dst); err != nil {
+		return err
+	} else if exists { // entries of dst may be deleted only in batch
+		if err := tx.ClearBucket(mig.dst); err != nil {
+			return err
+		}
+	}
+	if mig.rename {
+		return tx.RenameBucket(mig.src, mig.dst)
+	}
+	return tx.CopyBucket(mig.src, mig.dst)
 }
 
 func (m *MemoryMutation) ExistsBucket(bucket string) (bool, error) {
-	panic("Not implemented")
+	exists, err := m.memTx.ExistsBucket(bucket)
+	if err != nil || exists || m.isTableDropped(bucket) {
+		return exists, err
+	}
+	if migrator, ok := m.db.(kv.BucketMigrator); ok {
+		return migrator.ExistsBucket(bucket)
+	}
+	dbBuckets, err := m.db.ListBuckets()
+	if err != nil {
+		return false, err
+	}
+	for _, name := range dbBuckets {
+		if name == bucket {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
+// ListBuckets - sorted tables of underlying db and of in-memory db, without dropped ones
 func (m *MemoryMutation) ListBuckets() ([]string, error) {
-	panic("Not implemented")
+	memBuckets, err := m.memTx.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+	dbBuckets, err := m.db.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(memBuckets)+len(dbBuckets))
+	res := make([]string, 0, len(memBuckets)+len(dbBuckets))
+	for _, bucket := range memBuckets {
+		seen[bucket] = struct{}{}
+		res = append(res, bucket)
+	}
+	for _, bucket := range dbBuckets {
+		if _, ok := seen[bucket]; ok || m.isTableDropped(bucket) {
+			continue
+		}
+		seen[bucket] = struct{}{}
+		res = append(res, bucket)
+	}
+	sort.Strings(res)
+	return res, nil
 }
 
 func (m *MemoryMutation) ClearBucket(bucket string) error {
+	if err := m.memTx.ClearBucket(bucket); err != nil {
+		return err
+	}
 	m.clearedTables[bucket] = struct{}{}
-	return m.memTx.ClearBucket(bucket)
+	delete(m.deletedEntries, bucket) // entries of underlying db aren't visible anymore
+	delete(m.deletedDups, bucket)
+	delete(m.sizes, bucket)
+	return nil
 }
 
 func (m *MemoryMutation) CollectMetrics() {
 }
 
 func (m *MemoryMutation) CreateBucket(bucket string) error {
-	return m.memTx.CreateBucket(bucket)
+	if err := m.memTx.CreateBucket(bucket); err != nil {
+		return err
+	}
+	if m.isTableDropped(bucket) { // re-created table must not see entries of underlying db
+		delete(m.droppedTables, bucket)
+		m.clearedTables[bucket] = struct{}{}
+		m.statelessCursors = nil
+	}
+	return nil
+}
+
+// BatchSize - amount of bytes of keys and values kept in memory: written entries and deleted keys/values. Entry
+// written again is counted again, sequences are not counted.
+func (m *MemoryMutation) BatchSize() int {
+	size := 0
+	for _, tableSize := range m.sizes {
+		size += tableSize
+	}
+	return size
 }
 
-func (m *MemoryMutation) Flush(tx kv.RwTx) error {
+// Flush - applies all changes to `tx`. Returns ctx.Err() if ctx is cancelled, then `tx` may contain only part of changes
+// and must be rolled back.
+func (m *MemoryMutation) Flush(ctx context.Context, tx kv.RwTx) error {
 	// Obtain buckets touched.
 	buckets, err := m.memTx.ListBuckets()
 	if err != nil {
 		return err
 	}
+	// Copy and rename buckets, entries of destinations are written below
+	for _, mig := range m.migrations {
+		if err := mig.apply(tx); err != nil {
+			return err
+		}
+	}
+	// Drop buckets who are to be dropped
+	for bucket := range m.droppedTables {
+		if exists, err := tx.ExistsBucket(bucket); err != nil {
+			return err
+		} else if !exists { // renamed one or never created
+			continue
+		}
+		if err := tx.DropBucket(bucket); err != nil {
+			return err
+		}
+	}
 	// Obliterate buckets who are to be deleted
 	for bucket := range m.clearedTables {
 		if err := tx.ClearBucket(bucket); err != nil {
@@ -336,14 +789,23 @@ func (m *MemoryMutation) Flush(tx kv.RwTx) error {
 	}
 	// Obliterate entries who are to be deleted
 	for bucket, keys := range m.deletedEntries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		for key := range keys {
 			if err := tx.Delete(bucket, []byte(key)); err != nil {
 				return err
 			}
 		}
 	}
+	if err := flushDeletedDups(tx, m.deletedDups); err != nil {
+		return err
+	}
 	// Iterate over each bucket and apply changes accordingly.
 	for _, bucket := range buckets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if m.isTablePurelyDupsort(bucket) {
 			cbucket, err := m.memTx.CursorDupSort(bucket)
 			if err != nil {
@@ -362,6 +824,11 @@ func (m *MemoryMutation) Flush(tx kv.RwTx) error {
 				if err := dbCursor.Put(k, v); err != nil {
 					return err
 				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
 			}
 		} else {
 			cbucket, err := m.memTx.Cursor(bucket)
@@ -376,6 +843,11 @@ func (m *MemoryMutation) Flush(tx kv.RwTx) error {
 				if err := tx.Put(bucket, k, v); err != nil {
 					return err
 				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
 			}
 		}
 	}
@@ -386,6 +858,7 @@ func (m *MemoryMutation) Diff() (*MemoryDiff, error) {
 	memDiff := &MemoryDiff{
 		diff:           make(map[table][]entry),
 		deletedEntries: make(map[string][]string),
+		deletedDups:    make(map[string]map[string]map[string]struct{}, len(m.deletedDups)),
 	}
 	// Obtain buckets touched.
 	buckets, err := m.memTx.ListBuckets()
@@ -402,6 +875,15 @@ func (m *MemoryMutation) Diff() (*MemoryDiff, error) {
 			memDiff.deletedEntries[bucket] = append(memDiff.deletedEntries[bucket], key)
 		}
 	}
+	for bucket, keys := range m.deletedDups {
+		memDiff.deletedDups[bucket] = make(map[string]map[string]struct{}, len(keys))
+		for key, values := range keys {
+			memDiff.deletedDups[bucket][key] = make(map[string]struct{}, len(values))
+			for value := range values {
+				memDiff.deletedDups[bucket][key][value] = struct{}{}
+			}
+		}
+	}
 	// Iterate over each bucket and apply changes accordingly.
 	for _, bucket := range buckets {
 		if m.isTablePurelyDupsort(bucket) {
@@ -455,7 +937,7 @@ func (m *MemoryMutation) isTablePurelyDupsort(bucket string) bool {
 	if !ok {
 		return false
 	}
-	return !config.AutoDupSortKeysConversion && config.Flags == kv.DupSort
+	return !config.AutoDupSortKeysConversion && config.Flags&kv.DupSort != 0
 }
 
 func (m *MemoryMutation) MemDB() kv.RwDB {
@@ -471,11 +953,13 @@ func (m *MemoryMutation) makeCursor(bucket string) (kv.RwCursorDupSort, error) {
 	c := &memoryMutationCursor{}
 	// We can filter duplicates in dup sorted table
 	c.table = bucket
+	c.cfg = m.tblConfig[bucket]
 
 	var err error
-	c.cursor, err = m.db.CursorDupSort(bucket)
-	if err != nil {
-		return nil, err
+	if !m.isTableCleared(bucket) { // table may not exist in underlying db: created by CopyBucket or RenameBucket
+		if c.cursor, err = m.db.CursorDupSort(bucket); err != nil {
+			return nil, err
+		}
 	}
 	c.memCursor, err = m.memTx.RwCursorDupSort(bucket)
 	if err != nil {
@@ -506,5 +990,10 @@ func (m *MemoryMutation) Cursor(bucket string) (kv.Cursor, error) {
 }
 
 func (m *MemoryMutation) ViewID() uint64 {
-	panic("ViewID Not implemented")
+	return m.db.ViewID()
+}
+
+// CHandle - MemoryMutation has no single native transaction: changes are split between underlying and in-memory db
+func (m *MemoryMutation) CHandle() unsafe.Pointer {
+	return nil
 }
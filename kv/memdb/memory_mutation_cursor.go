@@ -21,487 +21,612 @@ import (
 	"github.com/uncommoncorrelation/go-mdbx-db/kv"
 )
 
-type NextType int
-
-const (
-	Normal NextType = iota
-	Dup
-	NoDup
-)
-
 // entry for the cursor
 type cursorEntry struct {
 	key   []byte
 	value []byte
 }
 
-// cursor
+type cursorState int
+
+const (
+	unpositioned cursorState = iota
+	positioned
+	afterLast // Seek didn't find entry: Next returns nothing, Prev returns last entry
+)
+
+// memoryMutationCursor - cursor over merged view of table: entries of mem overlay, and entries of underlying tx which
+// are not deleted (see MemoryMutation.deletedEntries and MemoryMutation.deletedDups) and not overwritten by mem. Only
+// mem entries are visible in cleared table.
+//
+// Cursor doesn't keep positions of underlying cursors between calls: every move searches entry nearest to current one
+// in both of them and picks nearest of the two. So moves in both directions work the same way.
+//
+// Keys of AutoDupSortKeysConversion table are merged as keys of not-DupSort table (underlying cursors convert them),
+// and methods which work with duplicates return entries in stored form, like MdbxDupSortCursor does. Every key of
+// not-DupSort table is treated as key with 1 duplicate.
 type memoryMutationCursor struct {
-	// entry history
-	cursor    kv.CursorDupSort
-	memCursor kv.RwCursorDupSort
+	cursor    kv.CursorDupSort   // underlying tx
+	memCursor kv.RwCursorDupSort // mem overlay
 	// we keep the mining mutation so that we can insert new elements in db
-	mutation        *MemoryMutation
-	table           string
-	currentPair     cursorEntry
-	currentDbEntry  cursorEntry
-	currentMemEntry cursorEntry
-	isPrevFromDb    bool
-	TableConfig     kv.TableCfg
-}
+	mutation *MemoryMutation
+	table    string
+	cfg      kv.TableCfgItem
 
-func (m *memoryMutationCursor) isTableCleared() bool {
-	return m.mutation.isTableCleared(m.table)
+	state   cursorState
+	current cursorEntry // copy of entry, valid if state is positioned
+	deleted bool        // current entry was deleted by DeleteCurrent: moves start from it, Current returns next entry
 }
 
-func (m *memoryMutationCursor) isEntryDeleted(key []byte, value []byte, t NextType) bool {
-	if t == Normal {
-		return m.mutation.isEntryDeleted(m.table, key)
-	} else {
-		return m.mutation.isEntryDeleted(m.table, m.convertAutoDupsort(key, value))
-	}
+// dupSort - table has multiple values per key. AutoDupSortKeysConversion table has 1 value per key (see stored).
+func (m *memoryMutationCursor) dupSort() bool {
+	return m.cfg.Flags&kv.DupSort != 0 && !m.cfg.AutoDupSortKeysConversion
 }
 
-// First move cursor to first position and return key and value accordingly.
-func (m *memoryMutationCursor) First() ([]byte, []byte, error) {
-	memKey, memValue, err := m.memCursor.First()
-	if err != nil || m.isTableCleared() {
-		return memKey, memValue, err
-	}
-
-	dbKey, dbValue, err := m.cursor.First()
-	if err != nil {
-		return nil, nil, err
+// compare - order of entries in the table (see kv.IntegerKey, kv.ReverseKey). Values are compared only in DupSort
+// table.
+func (m *memoryMutationCursor) compare(a, b cursorEntry) int {
+	if c := m.cfg.CompareKeys(a.key, b.key); c != 0 || !m.dupSort() {
+		return c
 	}
+	return m.cfg.CompareDups(a.value, b.value)
+}
 
-	if dbKey != nil && m.isEntryDeleted(dbKey, dbValue, Normal) {
-		if dbKey, dbValue, err = m.getNextOnDb(Normal); err != nil {
-			return nil, nil, err
-		}
-	}
+// isTableCleared - entries of underlying db are not visible, cursor of underlying db isn't opened then
+func (m *memoryMutationCursor) isTableCleared() bool {
+	return m.cursor == nil || m.mutation.isTableCleared(m.table)
+}
 
-	return m.resolveCursorPriority(memKey, memValue, dbKey, dbValue, Normal)
+func (m *memoryMutationCursor) isEntryDeleted(key, value []byte) bool {
+	return m.mutation.isEntryDeleted(m.table, key) || (m.dupSort() && m.mutation.isDupDeleted(m.table, key, value))
 }
 
-func (m *memoryMutationCursor) getNextOnDb(t NextType) (key []byte, value []byte, err error) {
-	switch t {
-	case Normal:
-		key, value, err = m.cursor.Next()
+// forward - first entry of c after (k, v) if strict, or at (k, v). If !withValue or table is not DupSort, only
+// keys are compared.
+func (m *memoryMutationCursor) forward(c kv.CursorDupSort, k, v []byte, withValue, strict bool) ([]byte, []byte, error) {
+	if withValue && m.dupSort() {
+		val, err := c.SeekBothRange(k, v)
 		if err != nil {
-			return
-		}
-	case Dup:
-		key, value, err = m.cursor.NextDup()
-		if err != nil {
-			return
-		}
-	case NoDup:
-		key, value, err = m.cursor.NextNoDup()
-		if err != nil {
-			return
+			return nil, nil, err
 		}
-	default:
-		err = fmt.Errorf("invalid next type")
-		return
-	}
-
-	for key != nil && value != nil && m.isEntryDeleted(key, value, t) {
-		switch t {
-		case Normal:
-			key, value, err = m.cursor.Next()
-			if err != nil {
-				return
+		if val != nil {
+			if !strict || m.cfg.CompareDups(val, v) != 0 {
+				return k, val, nil
 			}
-		case Dup:
-			key, value, err = m.cursor.NextDup()
-			if err != nil {
-				return
-			}
-		case NoDup:
-			key, value, err = m.cursor.NextNoDup()
-			if err != nil {
-				return
-			}
-		default:
-			err = fmt.Errorf("invalid next type")
-			return
+			return c.Next()
 		}
+		strict = true // all values of k are before v
 	}
-	return
-}
-
-func (m *memoryMutationCursor) convertAutoDupsort(key []byte, value []byte) []byte {
-	config, ok := m.TableConfig[m.table]
-	// If we do not have the configuration we assume it is not dupsorted
-	if !ok || !config.AutoDupSortKeysConversion {
-		return key
+	key, val, err := c.Seek(k)
+	if err != nil || key == nil || !strict || m.cfg.CompareKeys(key, k) != 0 {
+		return key, val, err
 	}
-	if len(key) != config.DupToLen {
-		return key
+	if m.dupSort() {
+		return c.NextNoDup()
 	}
-	return append(key, value[:config.DupFromLen-config.DupToLen]...)
+	return c.Next()
 }
 
-// Current return the current key and values the cursor is on.
-func (m *memoryMutationCursor) Current() ([]byte, []byte, error) {
-	if m.isTableCleared() {
-		return m.memCursor.Current()
-	}
-	return common.Copy(m.currentPair.key), common.Copy(m.currentPair.value), nil
-}
-
-func (m *memoryMutationCursor) skipIntersection(memKey, memValue, dbKey, dbValue []byte, t NextType) (newDbKey []byte, newDbValue []byte, err error) {
-	newDbKey = dbKey
-	newDbValue = dbValue
-	config, ok := m.TableConfig[m.table]
-	dupSortTable := ok && ((config.Flags & kv.DupSort) != 0)
-	autoKeyConversion := ok && config.AutoDupSortKeysConversion
-	dupsortOffset := 0
-	if autoKeyConversion {
-		dupsortOffset = config.DupFromLen - config.DupToLen
-	}
-	// Check for duplicates
-	if bytes.Equal(memKey, dbKey) {
-		var skip bool
-		if t == Normal {
-			skip = !dupSortTable || autoKeyConversion || bytes.Equal(memValue, dbValue)
-		} else {
-			skip = bytes.Equal(memValue, dbValue) ||
-				(dupsortOffset != 0 && len(memValue) >= dupsortOffset && len(dbValue) >= dupsortOffset && bytes.Equal(memValue[:dupsortOffset], dbValue[:dupsortOffset]))
+// backward - last entry of c before (k, v) if strict, or at (k, v). If !withValue or table is not DupSort, only
+// keys are compared: for DupSort table it's last value of key.
+func (m *memoryMutationCursor) backward(c kv.CursorDupSort, k, v []byte, withValue, strict bool) ([]byte, []byte, error) {
+	if withValue && m.dupSort() {
+		val, err := c.SeekBothRange(k, v)
+		if err != nil {
+			return nil, nil, err
 		}
-		if skip {
-			if newDbKey, newDbValue, err = m.getNextOnDb(t); err != nil {
-				return
+		if val != nil {
+			if !strict && m.cfg.CompareDups(val, v) == 0 {
+				return k, val, nil
 			}
+			return c.Prev()
 		}
+		strict = false // all values of k are before v
 	}
-	return
-}
-
-func (m *memoryMutationCursor) resolveCursorPriority(memKey, memValue, dbKey, dbValue []byte, t NextType) ([]byte, []byte, error) {
-	if memValue == nil && dbValue == nil {
-		return nil, nil, nil
-	}
-
-	var err error
-	dbKey, dbValue, err = m.skipIntersection(memKey, memValue, dbKey, dbValue, t)
+	key, val, err := c.Seek(k)
 	if err != nil {
 		return nil, nil, err
 	}
-
-	m.currentDbEntry = cursorEntry{dbKey, dbValue}
-	m.currentMemEntry = cursorEntry{memKey, memValue}
-	// compare entries
-	if bytes.Equal(memKey, dbKey) {
-		m.isPrevFromDb = dbValue != nil && (memValue == nil || bytes.Compare(memValue, dbValue) > 0)
-	} else {
-		m.isPrevFromDb = dbValue != nil && (memKey == nil || bytes.Compare(memKey, dbKey) > 0)
-	}
-	if dbValue == nil {
-		m.currentDbEntry = cursorEntry{}
+	if key == nil {
+		return c.Last()
 	}
-	if memValue == nil {
-		m.currentMemEntry = cursorEntry{}
+	if strict || m.cfg.CompareKeys(key, k) != 0 {
+		return c.Prev()
 	}
-	if m.isPrevFromDb {
-		m.currentPair = cursorEntry{dbKey, dbValue}
-		return dbKey, dbValue, nil
+	if m.dupSort() {
+		val, err = c.LastDup()
 	}
-
-	m.currentPair = cursorEntry{memKey, memValue}
-	return memKey, memValue, nil
+	return key, val, err
 }
 
-// Next returns the next element of the mutation.
-func (m *memoryMutationCursor) Next() ([]byte, []byte, error) {
-	if m.isTableCleared() {
-		return m.memCursor.Next()
+// nearest - nearest of entries in direction of move, mem entry overwrites db entry
+func (m *memoryMutationCursor) nearest(mem, db cursorEntry, forward bool) cursorEntry {
+	if db.key == nil {
+		return mem
 	}
-
-	if m.isPrevFromDb {
-		k, v, err := m.getNextOnDb(Normal)
-		if err != nil {
-			return nil, nil, err
-		}
-		return m.resolveCursorPriority(m.currentMemEntry.key, m.currentMemEntry.value, k, v, Normal)
+	if mem.key == nil {
+		return db
 	}
-
-	memK, memV, err := m.memCursor.Next()
-	if err != nil {
-		return nil, nil, err
+	if c := m.compare(mem, db); c == 0 || (c < 0) == forward {
+		return mem
 	}
-
-	return m.resolveCursorPriority(memK, memV, m.currentDbEntry.key, m.currentDbEntry.value, Normal)
+	return db
 }
 
-// NextDup returns the next element of the mutation.
-func (m *memoryMutationCursor) NextDup() ([]byte, []byte, error) {
-	if m.isTableCleared() {
-		return m.memCursor.NextDup()
+// seekForward - first entry of merged view after (k, v) if strict, or at (k, v), see forward
+func (m *memoryMutationCursor) seekForward(k, v []byte, withValue, strict bool) (cursorEntry, error) {
+	memK, memV, err := m.forward(m.memCursor, k, v, withValue, strict)
+	if err != nil || m.isTableCleared() {
+		return cursorEntry{memK, memV}, err
 	}
-
-	if m.isPrevFromDb {
-		k, v, err := m.getNextOnDb(Dup)
-
-		if err != nil {
-			return nil, nil, err
-		}
-		return m.resolveCursorPriority(m.currentMemEntry.key, m.currentMemEntry.value, k, v, Dup)
+	dbK, dbV, err := m.forward(m.cursor, k, v, withValue, strict)
+	for err == nil && dbK != nil && m.isEntryDeleted(dbK, dbV) {
+		dbK, dbV, err = m.cursor.Next()
 	}
-
-	memK, memV, err := m.memCursor.NextDup()
 	if err != nil {
-		return nil, nil, err
+		return cursorEntry{}, err
 	}
-
-	return m.resolveCursorPriority(memK, memV, m.currentDbEntry.key, m.currentDbEntry.value, Dup)
+	return m.nearest(cursorEntry{memK, memV}, cursorEntry{dbK, dbV}, true), nil
 }
 
-// Seek move pointer to a key at a certain position.
-func (m *memoryMutationCursor) Seek(seek []byte) ([]byte, []byte, error) {
-	if m.isTableCleared() {
-		return m.memCursor.Seek(seek)
+// seekBackward - last entry of merged view before (k, v) if strict, or at (k, v), see backward
+func (m *memoryMutationCursor) seekBackward(k, v []byte, withValue, strict bool) (cursorEntry, error) {
+	memK, memV, err := m.backward(m.memCursor, k, v, withValue, strict)
+	if err != nil || m.isTableCleared() {
+		return cursorEntry{memK, memV}, err
+	}
+	dbK, dbV, err := m.backward(m.cursor, k, v, withValue, strict)
+	for err == nil && dbK != nil && m.isEntryDeleted(dbK, dbV) {
+		dbK, dbV, err = m.cursor.Prev()
 	}
-
-	dbKey, dbValue, err := m.cursor.Seek(seek)
 	if err != nil {
-		return nil, nil, err
+		return cursorEntry{}, err
 	}
+	return m.nearest(cursorEntry{memK, memV}, cursorEntry{dbK, dbV}, false), nil
+}
 
-	// If the entry is marked as deleted find one that is not
-	if dbKey != nil && m.isEntryDeleted(dbKey, dbValue, Normal) {
-		dbKey, dbValue, err = m.getNextOnDb(Normal)
-		if err != nil {
-			return nil, nil, err
-		}
+func (m *memoryMutationCursor) last() (cursorEntry, error) {
+	memK, memV, err := m.memCursor.Last()
+	if err != nil || m.isTableCleared() {
+		return cursorEntry{memK, memV}, err
+	}
+	dbK, dbV, err := m.cursor.Last()
+	for err == nil && dbK != nil && m.isEntryDeleted(dbK, dbV) {
+		dbK, dbV, err = m.cursor.Prev()
 	}
+	if err != nil {
+		return cursorEntry{}, err
+	}
+	return m.nearest(cursorEntry{memK, memV}, cursorEntry{dbK, dbV}, false), nil
+}
 
-	memKey, memValue, err := m.memCursor.Seek(seek)
+// moveTo - positions cursor at e. If e is not found, cursor gets state notFound, and positioned cursor keeps its
+// position if notFound is positioned - as MdbxCursor does after unsuccessful move.
+func (m *memoryMutationCursor) moveTo(e cursorEntry, err error, notFound cursorState) ([]byte, []byte, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	if e.key == nil {
+		m.state = notFound
+		return nil, nil, nil
+	}
+	m.state, m.deleted = positioned, false
+	m.current = cursorEntry{common.Copy(e.key), common.Copy(e.value)}
+	return m.current.key, m.current.value, nil
+}
 
-	return m.resolveCursorPriority(memKey, memValue, dbKey, dbValue, Normal)
+// leaveDeleted - cursor at entry deleted by DeleteCurrent moves to next entry
+func (m *memoryMutationCursor) leaveDeleted() error {
+	e, err := m.seekForward(m.current.key, m.current.value, true, true)
+	_, _, err = m.moveTo(e, err, afterLast)
+	return err
 }
 
-// Seek move pointer to a key at a certain position.
-func (m *memoryMutationCursor) SeekExact(seek []byte) ([]byte, []byte, error) {
-	memKey, memValue, err := m.memCursor.SeekExact(seek)
-	if err != nil || m.isTableCleared() {
-		return memKey, memValue, err
+// settle - cursor at deleted entry which was the only value of its key moves to next entry, so methods which work
+// with duplicates use key of next entry, like MdbxCursor does
+func (m *memoryMutationCursor) settle() error {
+	if !m.deleted {
+		return nil
 	}
-
-	if memKey != nil {
-		m.currentMemEntry.key = memKey
-		m.currentMemEntry.value = memValue
-		m.currentDbEntry.key, m.currentDbEntry.value, err = m.cursor.Seek(seek)
-		m.isPrevFromDb = false
-		m.currentPair = cursorEntry{memKey, memValue}
-		return memKey, memValue, err
+	exists, err := m.keyExists(m.current)
+	if err != nil || exists {
+		return err
 	}
+	return m.leaveDeleted()
+}
 
-	dbKey, dbValue, err := m.cursor.SeekExact(seek)
-	if err != nil {
-		return nil, nil, err
+// keyExists - merged view has values of stored key of e
+func (m *memoryMutationCursor) keyExists(e cursorEntry) (bool, error) {
+	var first cursorEntry
+	var err error
+	if m.dupSort() || m.cfg.AutoDupSortKeysConversion && len(e.key) == m.cfg.DupFromLen {
+		first, err = m.firstDup(e)
+	} else {
+		first, err = m.seekForward(e.key, nil, false, false)
 	}
+	return err == nil && m.sameKey(e, first), err
+}
 
-	if dbKey != nil && !m.mutation.isEntryDeleted(m.table, seek) {
-		m.currentDbEntry.key = dbKey
-		m.currentDbEntry.value = dbValue
-		m.currentMemEntry.key, m.currentMemEntry.value, err = m.memCursor.Seek(seek)
-		m.isPrevFromDb = true
-		m.currentPair = cursorEntry{dbKey, dbValue}
-		return dbKey, dbValue, err
-	}
-	return nil, nil, nil
+// First move cursor to first position and return key and value accordingly.
+func (m *memoryMutationCursor) First() ([]byte, []byte, error) {
+	e, err := m.seekForward(nil, nil, false, false)
+	return m.moveTo(e, err, unpositioned)
 }
 
-func (m *memoryMutationCursor) Put(k, v []byte) error {
-	return m.mutation.Put(m.table, common.Copy(k), common.Copy(v))
+func (m *memoryMutationCursor) Last() ([]byte, []byte, error) {
+	e, err := m.last()
+	return m.moveTo(e, err, unpositioned)
 }
 
-func (m *memoryMutationCursor) Append(k []byte, v []byte) error {
-	return m.mutation.Append(m.table, common.Copy(k), common.Copy(v))
+// Current return the current key and values the cursor is on.
+func (m *memoryMutationCursor) Current() ([]byte, []byte, error) {
+	if m.state == positioned && m.deleted {
+		if err := m.leaveDeleted(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if m.state != positioned {
+		return nil, nil, nil
+	}
+	return common.Copy(m.current.key), common.Copy(m.current.value), nil
+}
 
+// Next returns the next element of the mutation.
+func (m *memoryMutationCursor) Next() ([]byte, []byte, error) {
+	switch m.state {
+	case unpositioned:
+		return m.First()
+	case afterLast:
+		return nil, nil, nil
+	}
+	e, err := m.seekForward(m.current.key, m.current.value, true, true)
+	return m.moveTo(e, err, positioned)
 }
 
-func (m *memoryMutationCursor) AppendDup(k []byte, v []byte) error {
-	return m.memCursor.AppendDup(common.Copy(k), common.Copy(v))
+func (m *memoryMutationCursor) Prev() ([]byte, []byte, error) {
+	switch m.state {
+	case unpositioned, afterLast:
+		return m.Last()
+	}
+	e, err := m.seekBackward(m.current.key, m.current.value, true, true)
+	if err == nil && e.key == nil && m.deleted { // MdbxCursor moves from deleted entry to next one
+		return nil, nil, m.leaveDeleted()
+	}
+	return m.moveTo(e, err, positioned)
 }
 
-func (m *memoryMutationCursor) PutNoDupData(key, value []byte) error {
-	panic("Not implemented")
+// Seek move pointer to a key at a certain position.
+func (m *memoryMutationCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	e, err := m.seekForward(seek, nil, false, false)
+	return m.moveTo(e, err, afterLast)
 }
 
-func (m *memoryMutationCursor) Delete(k []byte) error {
-	return m.mutation.Delete(m.table, k)
+// SeekExact move pointer to a key at a certain position.
+func (m *memoryMutationCursor) SeekExact(seek []byte) ([]byte, []byte, error) {
+	e, err := m.seekForward(seek, nil, false, false)
+	if err == nil && e.key != nil && m.cfg.CompareKeys(e.key, seek) != 0 {
+		e = cursorEntry{}
+	}
+	return m.moveTo(e, err, unpositioned)
 }
 
-func (m *memoryMutationCursor) DeleteCurrent() error {
-	panic("DeleteCurrent Not implemented")
+// stored - entry as it's stored in AutoDupSortKeysConversion table: key of DupToLen bytes and value prefixed by rest of
+// key. Entries of other tables are stored as is.
+func (m *memoryMutationCursor) stored(e cursorEntry) cursorEntry {
+	if !m.cfg.AutoDupSortKeysConversion || len(e.key) != m.cfg.DupFromLen {
+		return e
+	}
+	to := m.cfg.DupToLen
+	return cursorEntry{e.key[:to], append(common.Copy(e.key[to:]), e.value...)}
 }
-func (m *memoryMutationCursor) DeleteExact(_, _ []byte) error {
-	panic("DeleteExact Not implemented")
+
+// sameKey - entries have the same stored key: are duplicates
+func (m *memoryMutationCursor) sameKey(a, b cursorEntry) bool {
+	return b.key != nil && m.cfg.CompareKeys(m.stored(a).key, m.stored(b).key) == 0
 }
 
-func (m *memoryMutationCursor) DeleteCurrentDuplicates() error {
-	config, ok := m.TableConfig[m.table]
-	autoKeyConversion := ok && config.AutoDupSortKeysConversion
-	if autoKeyConversion {
-		panic("DeleteCurrentDuplicates Not implemented for AutoDupSortKeysConversion tables")
+// firstDup - first entry with the same stored key as e
+func (m *memoryMutationCursor) firstDup(e cursorEntry) (cursorEntry, error) {
+	switch {
+	case m.dupSort():
+		return m.seekForward(e.key, nil, false, false)
+	case m.cfg.AutoDupSortKeysConversion && len(e.key) == m.cfg.DupFromLen:
+		return m.seekForward(e.key[:m.cfg.DupToLen], nil, false, false)
+	default:
+		return e, nil
 	}
+}
 
-	k, _, err := m.Current()
-	if err != nil {
-		return err
-	}
-	if k != nil {
-		return m.Delete(k)
+// lastDup - last entry with the same stored key as e
+func (m *memoryMutationCursor) lastDup(e cursorEntry) (cursorEntry, error) {
+	switch {
+	case m.dupSort():
+		return m.seekBackward(e.key, nil, false, false)
+	case m.cfg.AutoDupSortKeysConversion && len(e.key) == m.cfg.DupFromLen:
+		next, ok := kv.NextSubtree(e.key[:m.cfg.DupToLen])
+		if !ok {
+			return m.last()
+		}
+		return m.seekBackward(next, nil, false, true)
+	default:
+		return e, nil
 	}
-	return nil
 }
 
-// Seek move pointer to a key at a certain position.
-func (m *memoryMutationCursor) SeekBothRange(key, value []byte) ([]byte, error) {
-	if m.isTableCleared() {
-		return m.memCursor.SeekBothRange(key, value)
+func (m *memoryMutationCursor) NextDup() ([]byte, []byte, error) {
+	if m.state != positioned {
+		return nil, nil, nil
 	}
+	e, err := m.seekForward(m.current.key, m.current.value, true, true)
+	if err != nil || !m.sameKey(m.current, e) {
+		return nil, nil, err
+	}
+	return m.moveToStored(e, nil, positioned)
+}
 
-	dbValue, err := m.cursor.SeekBothRange(key, value)
+func (m *memoryMutationCursor) PrevDup() ([]byte, []byte, error) {
+	if m.state != positioned {
+		return nil, nil, nil
+	}
+	e, err := m.seekBackward(m.current.key, m.current.value, true, true)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	if dbValue != nil && m.isEntryDeleted(key, dbValue, Dup) {
-		_, dbValue, err = m.getNextOnDb(Dup)
-		if err != nil {
-			return nil, err
+	if !m.sameKey(m.current, e) {
+		if m.deleted { // MdbxCursor moves from deleted entry to next one, if its key still has values
+			if exists, err := m.keyExists(m.current); err != nil || exists {
+				if err == nil {
+					err = m.leaveDeleted()
+				}
+				return nil, nil, err
+			}
 		}
+		return nil, nil, nil
 	}
+	return m.moveToStored(e, nil, positioned)
+}
 
-	memValue, err := m.memCursor.SeekBothRange(key, value)
+func (m *memoryMutationCursor) NextNoDup() ([]byte, []byte, error) {
+	switch m.state {
+	case unpositioned:
+		e, err := m.seekForward(nil, nil, false, false)
+		return m.moveToStored(e, err, unpositioned)
+	case afterLast:
+		return nil, nil, nil
+	}
+	last, err := m.lastDup(m.current)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if !m.sameKey(m.current, last) { // all values of key are deleted
+		last = m.current
+	}
+	e, err := m.seekForward(last.key, last.value, true, true)
+	if err == nil && e.key == nil {
+		return nil, nil, nil
 	}
-	_, retValue, err := m.resolveCursorPriority(key, memValue, key, dbValue, Dup)
-	return retValue, err
+	return m.moveToStored(e, err, positioned)
 }
 
-func (m *memoryMutationCursor) Last() ([]byte, []byte, error) {
-	memKey, memValue, err := m.memCursor.Last()
-	if err != nil || m.isTableCleared() {
-		return memKey, memValue, err
+func (m *memoryMutationCursor) PrevNoDup() ([]byte, []byte, error) {
+	switch m.state {
+	case unpositioned, afterLast:
+		e, err := m.last()
+		return m.moveToStored(e, err, unpositioned)
 	}
-
-	dbKey, dbValue, err := m.cursor.Last()
+	first, err := m.firstDup(m.current)
 	if err != nil {
 		return nil, nil, err
 	}
+	if !m.sameKey(m.current, first) { // all values of key are deleted
+		first = m.current
+	}
+	e, err := m.seekBackward(first.key, first.value, true, true)
+	if err == nil && e.key == nil {
+		return nil, nil, nil
+	}
+	return m.moveToStored(e, err, positioned)
+}
 
-	dbKey, dbValue, err = m.skipIntersection(memKey, memValue, dbKey, dbValue, Normal)
-	if err != nil {
+// moveToStored - moveTo which returns stored form of entry
+func (m *memoryMutationCursor) moveToStored(e cursorEntry, err error, notFound cursorState) ([]byte, []byte, error) {
+	if _, _, err = m.moveTo(e, err, notFound); err != nil || m.state != positioned {
 		return nil, nil, err
 	}
+	e = m.stored(m.current)
+	return e.key, e.value, nil
+}
 
-	m.currentDbEntry = cursorEntry{dbKey, dbValue}
-	m.currentMemEntry = cursorEntry{memKey, memValue}
-
-	// Basic checks
-	if dbKey != nil && m.isEntryDeleted(dbKey, dbValue, Normal) {
-		m.currentDbEntry = cursorEntry{}
-		m.isPrevFromDb = false
-		return memKey, memValue, nil
+// FirstDup - position at first data item of current key
+func (m *memoryMutationCursor) FirstDup() ([]byte, error) {
+	if err := m.settle(); err != nil || m.state != positioned {
+		return nil, err
 	}
+	e, err := m.firstDup(m.current)
+	_, v, err := m.moveToStored(e, err, unpositioned)
+	return v, err
+}
 
-	if dbValue == nil {
-		m.isPrevFromDb = false
-		return memKey, memValue, nil
+// LastDup - position at last data item of current key
+func (m *memoryMutationCursor) LastDup() ([]byte, error) {
+	if err := m.settle(); err != nil || m.state != positioned {
+		return nil, err
 	}
+	e, err := m.lastDup(m.current)
+	_, v, err := m.moveToStored(e, err, unpositioned)
+	return v, err
+}
 
-	if memValue == nil {
-		m.isPrevFromDb = true
-		return dbKey, dbValue, nil
+// CountDuplicates returns the number of duplicates for the current key
+func (m *memoryMutationCursor) CountDuplicates() (uint64, error) {
+	if err := m.settle(); err != nil {
+		return 0, err
 	}
-	// Check which one is last and return it
-	keyCompare := bytes.Compare(memKey, dbKey)
-	if keyCompare == 0 {
-		if bytes.Compare(memValue, dbValue) > 0 {
-			m.currentDbEntry = cursorEntry{}
-			m.isPrevFromDb = false
-			return memKey, memValue, nil
-		}
-		m.currentMemEntry = cursorEntry{}
-		m.isPrevFromDb = true
-		return dbKey, dbValue, nil
+	if m.state != positioned {
+		return 0, fmt.Errorf("CountDuplicates: cursor is not positioned, table: %s", m.table)
 	}
-
-	if keyCompare > 0 {
-		m.currentDbEntry = cursorEntry{}
-		m.isPrevFromDb = false
-		return memKey, memValue, nil
+	e, err := m.firstDup(m.current)
+	var count uint64
+	for ; err == nil && m.sameKey(m.current, e); e, err = m.seekForward(e.key, e.value, true, true) {
+		count++
 	}
-
-	m.currentMemEntry = cursorEntry{}
-	m.isPrevFromDb = true
-	return dbKey, dbValue, nil
+	return count, err
 }
 
-func (m *memoryMutationCursor) Prev() ([]byte, []byte, error) {
-	panic("Prev is not implemented!")
-}
-func (m *memoryMutationCursor) PrevDup() ([]byte, []byte, error) {
-	panic("Prev is not implemented!")
-}
-func (m *memoryMutationCursor) PrevNoDup() ([]byte, []byte, error) {
-	panic("Prev is not implemented!")
+// Count - amount of entries in merged view, it iterates over all of them
+func (m *memoryMutationCursor) Count() (uint64, error) {
+	var count uint64
+	e, err := m.seekForward(nil, nil, false, false)
+	for ; err == nil && e.key != nil; e, err = m.seekForward(e.key, e.value, true, true) {
+		count++
+	}
+	return count, err
 }
 
-func (m *memoryMutationCursor) Close() {
-	if m.cursor != nil {
-		m.cursor.Close()
+// seekBoth - first entry with stored key equal to key, and stored value >= value (or equal if exact)
+func (m *memoryMutationCursor) seekBoth(key, value []byte, exact bool) (e cursorEntry, err error) {
+	if m.dupSort() {
+		e, err = m.seekForward(key, value, true, false)
+	} else {
+		// every key has 1 value: search first logical key which can have stored value >= value
+		seek := key
+		if m.cfg.AutoDupSortKeysConversion && len(key) == m.cfg.DupToLen {
+			seek = append(common.Copy(key), value[:min(len(value), m.cfg.DupFromLen-m.cfg.DupToLen)]...)
+		}
+		e, err = m.seekForward(seek, nil, false, false)
+		for err == nil && e.key != nil && bytes.Equal(m.stored(e).key, key) && bytes.Compare(m.stored(e).value, value) < 0 {
+			e, err = m.seekForward(e.key, nil, false, true)
+		}
 	}
-	if m.memCursor != nil {
-		m.memCursor.Close()
+	if err != nil || e.key == nil {
+		return cursorEntry{}, err
+	}
+	s := m.stored(e)
+	if m.cfg.CompareKeys(s.key, key) != 0 || (exact && !bytes.Equal(s.value, value)) {
+		return cursorEntry{}, nil
 	}
+	return e, nil
 }
 
-func (m *memoryMutationCursor) Count() (uint64, error) {
-	panic("Not implemented")
+// SeekBothRange - exact match of the key, but range match of the value
+func (m *memoryMutationCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	e, err := m.seekBoth(key, value, false)
+	_, v, err := m.moveToStored(e, err, unpositioned)
+	return v, err
 }
 
-func (m *memoryMutationCursor) FirstDup() ([]byte, error) {
-	panic("Not implemented")
+func (m *memoryMutationCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	e, err := m.seekBoth(key, value, true)
+	return m.moveToStored(e, err, unpositioned)
 }
 
-func (m *memoryMutationCursor) NextNoDup() ([]byte, []byte, error) {
-	if m.isTableCleared() {
-		return m.memCursor.NextNoDup()
+// putAt - positions cursor at written entry, like MdbxCursor does after successful write
+func (m *memoryMutationCursor) putAt(k, v []byte, err error) error {
+	if err != nil {
+		return err
 	}
+	m.state, m.deleted = positioned, false
+	m.current = cursorEntry{k, v}
+	return nil
+}
 
-	if m.isPrevFromDb {
-		k, v, err := m.getNextOnDb(NoDup)
-		if err != nil {
-			return nil, nil, err
-		}
-		return m.resolveCursorPriority(m.currentMemEntry.key, m.currentMemEntry.value, k, v, NoDup)
+func (m *memoryMutationCursor) Put(k, v []byte) error {
+	k, v = common.Copy(k), common.Copy(v)
+	return m.putAt(k, v, m.mutation.Put(m.table, k, v))
+}
+
+func (m *memoryMutationCursor) Append(k []byte, v []byte) error {
+	k, v = common.Copy(k), common.Copy(v)
+	return m.putAt(k, v, m.mutation.Append(m.table, k, v))
+}
+
+func (m *memoryMutationCursor) AppendDup(k []byte, v []byte) error {
+	k, v = common.Copy(k), common.Copy(v)
+	err := m.memCursor.AppendDup(k, v)
+	if err == nil {
+		m.mutation.sizes[m.table] += len(k) + len(v)
 	}
+	return m.putAt(k, v, err)
+}
 
-	memK, memV, err := m.memCursor.NextNoDup()
+// PutNoDupData - puts key/value pair if merged view doesn't have it
+func (m *memoryMutationCursor) PutNoDupData(key, value []byte) error {
+	e, err := m.seekBoth(key, value, true)
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	if e.key != nil {
+		return fmt.Errorf("PutNoDupData: key/data pair already exists, table: %s, key: %x", m.table, key)
 	}
+	return m.Put(key, value)
+}
 
-	return m.resolveCursorPriority(memK, memV, m.currentDbEntry.key, m.currentDbEntry.value, NoDup)
+func (m *memoryMutationCursor) Delete(k []byte) error {
+	return m.mutation.Delete(m.table, k)
 }
 
-func (m *memoryMutationCursor) LastDup() ([]byte, error) {
-	panic("Not implemented")
+// DeleteCurrent - deletes entry at current position. Cursor keeps position of deleted entry, like MdbxCursor: Next and
+// Current return entry after it, Prev returns entry before it.
+func (m *memoryMutationCursor) DeleteCurrent() error {
+	if m.state == positioned && m.deleted {
+		if err := m.leaveDeleted(); err != nil {
+			return err
+		}
+	}
+	if m.state != positioned {
+		return fmt.Errorf("DeleteCurrent: cursor is not positioned, table: %s", m.table)
+	}
+	var err error
+	if m.dupSort() {
+		err = m.mutation.deleteDup(m.table, m.current.key, m.current.value)
+	} else {
+		err = m.mutation.Delete(m.table, m.current.key)
+	}
+	m.deleted = err == nil
+	return err
 }
 
-func (m *memoryMutationCursor) CountDuplicates() (uint64, error) {
-	panic("Not implemented")
+// DeleteExact - deletes 1 value of key, key and value are in stored form
+func (m *memoryMutationCursor) DeleteExact(k1, k2 []byte) error {
+	if m.dupSort() {
+		return m.mutation.deleteDup(m.table, common.Copy(k1), common.Copy(k2))
+	}
+	e, err := m.seekBoth(k1, k2, true)
+	if err != nil || e.key == nil {
+		return err
+	}
+	return m.mutation.Delete(m.table, common.Copy(e.key))
 }
 
-func (m *memoryMutationCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
-	panic("SeekBothExact Not implemented")
+// DeleteCurrentDuplicates - deletes all values of current key
+func (m *memoryMutationCursor) DeleteCurrentDuplicates() error {
+	if err := m.settle(); err != nil || m.state != positioned {
+		return err
+	}
+	if !m.cfg.AutoDupSortKeysConversion {
+		return m.mutation.Delete(m.table, m.current.key)
+	}
+	var keys [][]byte
+	e, err := m.firstDup(m.current)
+	for ; err == nil && m.sameKey(m.current, e); e, err = m.seekForward(e.key, e.value, true, true) {
+		keys = append(keys, common.Copy(e.key))
+	}
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := m.mutation.Delete(m.table, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryMutationCursor) Close() {
+	if m.cursor != nil {
+		m.cursor.Close()
+	}
+	if m.memCursor != nil {
+		m.memCursor.Close()
+	}
 }
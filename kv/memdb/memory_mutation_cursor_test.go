@@ -0,0 +1,391 @@
+//go:build cgo
+
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/memkv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+var cursorTestTables = kv.TableCfg{
+	kv.Sequence: {},
+	"Plain":     {},
+	"Dup":       {Flags: kv.DupSort},
+	"Auto":      {Flags: kv.DupSort, AutoDupSortKeysConversion: true, DupFromLen: 6, DupToLen: 4},
+}
+
+// cursorTestWriter - writes which MdbxTx and MemoryMutation both support
+type cursorTestWriter interface {
+	kv.Putter
+	kv.Deleter
+	RwCursorDupSort(table string) (kv.RwCursorDupSort, error)
+}
+
+// cursorTestCandidate - implementation which must behave as MdbxTx filled with the same data
+type cursorTestCandidate struct {
+	name string
+	open func(t *testing.T, fill func(w cursorTestWriter)) kv.RwTx
+}
+
+var cursorTestCandidates = []cursorTestCandidate{
+	{"MemoryMutation", func(t *testing.T, fill func(w cursorTestWriter)) kv.RwTx {
+		batch := NewMemoryBatch(openCursorTestTx(t, fill), t.TempDir(), cursorTestTables)
+		t.Cleanup(batch.Close)
+		return batch
+	}},
+	{"PureGoMemoryMutation", func(t *testing.T, fill func(w cursorTestWriter)) kv.RwTx {
+		batch := NewPureGoMemoryBatch(openCursorTestTx(t, fill), cursorTestTables)
+		t.Cleanup(batch.Close)
+		return batch
+	}},
+	{"memkv", func(t *testing.T, fill func(w cursorTestWriter)) kv.RwTx {
+		_, tx := memkv.NewTestTx(t, cursorTestTables)
+		fill(tx)
+		return tx
+	}},
+}
+
+func openCursorTestTx(t *testing.T, fill func(w cursorTestWriter)) kv.RwTx {
+	t.Helper()
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(cursorTestTables).MustOpen()
+	t.Cleanup(db.Close)
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(tx.Rollback)
+	fill(tx)
+	return tx
+}
+
+// cursorTestBackends - MdbxTx and MemoryMutation over other MdbxTx, both with the same data
+func cursorTestBackends(t *testing.T, fill func(w cursorTestWriter)) (ref kv.RwTx, batch *MemoryMutation) {
+	t.Helper()
+	return openCursorTestTx(t, fill), cursorTestCandidates[0].open(t, fill).(*MemoryMutation)
+}
+
+// testKey - random key of table, keys of Auto table are either shorter than DupToLen, or of DupFromLen
+func testKey(rnd *rand.Rand, table string) []byte {
+	const alphabet = "abcd"
+	n := 1 + rnd.Intn(2)
+	if table == "Auto" {
+		if n = 1 + rnd.Intn(3); rnd.Intn(2) == 0 {
+			n = 6
+		}
+	}
+	k := make([]byte, n)
+	for i := range k {
+		k[i] = alphabet[rnd.Intn(2+i%3)] // keys of the same prefix
+	}
+	return k
+}
+
+func testValue(rnd *rand.Rand) []byte { return []byte{'0' + byte(rnd.Intn(6))} }
+
+// storedKey - key as cursors of AutoDupSortKeysConversion table return it in methods which work with duplicates
+func storedKey(table string, k []byte) ([]byte, []byte) {
+	if cfg := cursorTestTables[table]; cfg.AutoDupSortKeysConversion && len(k) == cfg.DupFromLen {
+		return k[:cfg.DupToLen], k[cfg.DupToLen:]
+	}
+	return k, nil
+}
+
+type cursorOp struct {
+	name string
+	do   func(c kv.RwCursorDupSort) ([]byte, []byte, error)
+}
+
+func cursorOps(rnd *rand.Rand, table string) []cursorOp {
+	k := testKey(rnd, table)
+	sk, prefix := storedKey(table, k)
+	v := testValue(rnd)
+	sv := append(append([]byte{}, prefix...), v...)
+	ops := []cursorOp{
+		{"First", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.First() }},
+		{"Last", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Last() }},
+		{"Next", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Next() }},
+		{"Prev", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Prev() }},
+		{"Current", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Current() }},
+		{fmt.Sprintf("Seek(%s)", k), func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Seek(k) }},
+		{"Count", func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			n, err := c.Count()
+			return []byte(fmt.Sprint(n)), nil, err
+		}},
+		// cursor keeps position after move which didn't find entry
+		{"First,Prev,Next", func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			if _, _, err := c.First(); err != nil {
+				return nil, nil, err
+			}
+			if _, _, err := c.Prev(); err != nil {
+				return nil, nil, err
+			}
+			return c.Next()
+		}},
+		{"Last,Next,Prev", func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			if _, _, err := c.Last(); err != nil {
+				return nil, nil, err
+			}
+			if _, _, err := c.Next(); err != nil {
+				return nil, nil, err
+			}
+			return c.Prev()
+		}},
+		// writes position cursor
+		{"DeleteCurrent,Next", func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			if err := c.DeleteCurrent(); err != nil {
+				return nil, nil, err
+			}
+			k, v, err := c.Next()
+			if err != nil || k == nil {
+				return k, v, err
+			}
+			// state of MdbxCursor after delete from DupSort table is broken in libmdbx: later Put fails with
+			// MDBX_FATAL, and CountDuplicates counts wrong, so cursor is positioned at the same entry again
+			switch table {
+			case "Plain":
+				_, _, err = c.SeekExact(k)
+			case "Dup":
+				_, _, err = c.SeekBothExact(k, v)
+			default:
+				_, _, err = c.Seek(k)
+			}
+			return k, v, err
+		}},
+		{fmt.Sprintf("Put(%s, %s),Current", k, v), func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			if err := c.Put(k, v); err != nil {
+				return nil, nil, err
+			}
+			return c.Current()
+		}},
+	}
+	if prefix == nil { // MdbxCursor returns stored key of found AutoDupSortKeysConversion key
+		ops = append(ops, cursorOp{fmt.Sprintf("SeekExact(%s)", k), func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.SeekExact(k) }})
+	}
+	if table == "Plain" {
+		return ops
+	}
+	return append(ops,
+		cursorOp{"NextDup", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.NextDup() }},
+		cursorOp{"PrevDup", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.PrevDup() }},
+		cursorOp{"NextNoDup", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.NextNoDup() }},
+		cursorOp{"PrevNoDup", func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.PrevNoDup() }},
+		cursorOp{"FirstDup", func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			v, err := c.FirstDup()
+			return nil, v, err
+		}},
+		cursorOp{"LastDup", func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			v, err := c.LastDup()
+			return nil, v, err
+		}},
+		cursorOp{"CountDuplicates", func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			n, err := c.CountDuplicates()
+			return []byte(fmt.Sprint(n)), nil, err
+		}},
+		cursorOp{fmt.Sprintf("SeekBothRange(%s, %s)", sk, sv), func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			v, err := c.SeekBothRange(sk, sv)
+			return nil, v, err
+		}},
+		cursorOp{fmt.Sprintf("SeekBothExact(%s, %s)", sk, sv), func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			return c.SeekBothExact(sk, sv)
+		}},
+	)
+}
+
+func fillCursorTestTables(seed int64) func(w cursorTestWriter) {
+	return func(w cursorTestWriter) {
+		rnd := rand.New(rand.NewSource(seed))
+		for _, table := range []string{"Plain", "Dup", "Auto"} {
+			for i := 0; i < 20; i++ {
+				if err := w.Put(table, testKey(rnd, table), testValue(rnd)); err != nil {
+					panic(err)
+				}
+			}
+		}
+	}
+}
+
+// mutate - the same random writes to both backends
+func mutate(t *testing.T, rnd *rand.Rand, table string, ref, batch cursorTestWriter) {
+	t.Helper()
+	refC, err := ref.RwCursorDupSort(table)
+	require.NoError(t, err)
+	defer refC.Close()
+	batchC, err := batch.RwCursorDupSort(table)
+	require.NoError(t, err)
+	defer batchC.Close()
+
+	for i := 0; i < 15; i++ {
+		k, v := testKey(rnd, table), testValue(rnd)
+		sk, prefix := storedKey(table, k)
+		var name string
+		var write func(w cursorTestWriter, c kv.RwCursorDupSort) error
+		switch op := rnd.Intn(5); {
+		case op == 0 || op == 1:
+			name, write = "Put", func(w cursorTestWriter, c kv.RwCursorDupSort) error { return w.Put(table, k, v) }
+		case op == 2:
+			name, write = "Delete", func(w cursorTestWriter, c kv.RwCursorDupSort) error { return w.Delete(table, k) }
+		case op == 3:
+			name, write = "DeleteCurrent", func(w cursorTestWriter, c kv.RwCursorDupSort) error {
+				if k, _, err := c.Seek(k); err != nil || k == nil {
+					return err
+				}
+				return c.DeleteCurrent()
+			}
+		case table != "Plain":
+			name, write = "DeleteExact", func(w cursorTestWriter, c kv.RwCursorDupSort) error {
+				return c.DeleteExact(sk, append(append([]byte{}, prefix...), v...))
+			}
+		default:
+			continue
+		}
+		require.NoError(t, write(ref, refC), "%s %s %s", name, k, v)
+		require.NoError(t, write(batch, batchC), "%s %s %s", name, k, v)
+	}
+}
+
+// TestCursorAgainstMdbx - cursors of MemoryMutation and memkv return the same as MdbxTx cursor after the same writes
+func TestCursorAgainstMdbx(t *testing.T) {
+	for _, candidate := range cursorTestCandidates {
+		for seed := int64(0); seed < 20; seed++ {
+			for _, table := range []string{"Plain", "Dup", "Auto"} {
+				candidate, seed, table := candidate, seed, table
+				t.Run(fmt.Sprintf("%s/%s/%d", candidate.name, table, seed), func(t *testing.T) {
+					ref, batch := openCursorTestTx(t, fillCursorTestTables(seed)), candidate.open(t, fillCursorTestTables(seed))
+					rnd := rand.New(rand.NewSource(seed))
+					mutate(t, rnd, table, ref, batch)
+
+					refC, err := ref.RwCursorDupSort(table)
+					require.NoError(t, err)
+					defer refC.Close()
+					batchC, err := batch.RwCursorDupSort(table)
+					require.NoError(t, err)
+					defer batchC.Close()
+
+					var trace []string
+					var atLast, unpositioned, afterPut bool
+					for i := 0; i < 200; i++ {
+						ops := cursorOps(rnd, table)
+						op := ops[rnd.Intn(len(ops))]
+						if i == 0 {
+							op = ops[0]
+						}
+						if op.name == "DeleteCurrent,Next" && afterPut { // libmdbx fails with MDBX_FATAL on Next
+							continue
+						}
+						switch op.name {
+						case "Current", "Count", "CountDuplicates":
+						default:
+							afterPut = strings.HasPrefix(op.name, "Put(")
+						}
+						switch op.name {
+						case "Last":
+							atLast, unpositioned = true, false
+						case "FirstDup":
+							if atLast || unpositioned { // mdbx keeps eof flag of Last, NextDup after it finds nothing
+								continue
+							}
+						case "Current", "LastDup", "CountDuplicates", "DeleteCurrent,Next":
+							if unpositioned { // mdbx returns error on empty table
+								continue
+							}
+						case "Count":
+						default:
+							atLast, unpositioned = false, false
+						}
+						refK, refV, refErr := op.do(refC)
+						k, v, err := op.do(batchC)
+						trace = append(trace, fmt.Sprintf("%s -> %s %s", op.name, refK, refV))
+						require.NoError(t, refErr, "%v", trace)
+						require.NoError(t, err, "%v", trace)
+						require.Equal(t, string(refK), string(k), "%v", trace)
+						require.Equal(t, string(refV), string(v), "%v", trace)
+						if refK == nil && refV == nil {
+							// position of cursor which didn't find entry is undefined
+							refK, _, err = refC.First()
+							require.NoError(t, err)
+							unpositioned = refK == nil
+							_, _, err = batchC.First()
+							require.NoError(t, err)
+							trace = append(trace, "First")
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestCursorDupWrites(t *testing.T) {
+	fill := func(w cursorTestWriter) {
+		for _, v := range []string{"1", "2", "3"} {
+			require.NoError(t, w.Put("Dup", []byte("a"), []byte(v)))
+			require.NoError(t, w.Put("Dup", []byte("b"), []byte(v)))
+		}
+	}
+	writers := []cursorTestWriter{openCursorTestTx(t, fill)}
+	for _, candidate := range cursorTestCandidates {
+		writers = append(writers, candidate.open(t, fill))
+	}
+	for _, w := range writers {
+		c, err := w.RwCursorDupSort("Dup")
+		require.NoError(t, err)
+		defer c.Close()
+
+		require.Error(t, c.PutNoDupData([]byte("a"), []byte("2")))
+		require.NoError(t, c.PutNoDupData([]byte("a"), []byte("4")))
+		require.NoError(t, c.DeleteExact([]byte("a"), []byte("1")))
+
+		v, err := c.SeekBothRange([]byte("a"), []byte("1"))
+		require.NoError(t, err)
+		require.Equal(t, "2", string(v))
+		n, err := c.CountDuplicates()
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), n)
+
+		k, v, err := c.PrevNoDup()
+		require.NoError(t, err)
+		require.Nil(t, k)
+		require.Nil(t, v)
+
+		_, _, err = c.SeekExact([]byte("b"))
+		require.NoError(t, err)
+		require.NoError(t, c.DeleteCurrentDuplicates())
+		k, v, err = c.Last()
+		require.NoError(t, err)
+		require.Equal(t, "a", string(k))
+		require.Equal(t, "4", string(v))
+
+		k, v, err = c.PrevDup()
+		require.NoError(t, err)
+		require.Equal(t, "a", string(k))
+		require.Equal(t, "3", string(v))
+		require.NoError(t, c.DeleteCurrent())
+		n, err = c.Count()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), n)
+	}
+}
@@ -10,6 +10,7 @@ type entry struct {
 type MemoryDiff struct {
 	diff              map[table][]entry // god.
 	deletedEntries    map[string][]string
+	deletedDups       map[string]map[string]map[string]struct{}
 	clearedTableNames []string
 }
 
@@ -33,6 +34,9 @@ func (m *MemoryDiff) Flush(tx kv.RwTx) error {
 			}
 		}
 	}
+	if err := flushDeletedDups(tx, m.deletedDups); err != nil {
+		return err
+	}
 	// Iterate over each bucket and apply changes accordingly.
 	for bucketInfo, bucketDiff := range m.diff {
 		if bucketInfo.dupsort {
@@ -56,3 +60,23 @@ func (m *MemoryDiff) Flush(tx kv.RwTx) error {
 	}
 	return nil
 }
+
+// flushDeletedDups - deletes values of DupSort tables: table -> key -> value
+func flushDeletedDups(tx kv.RwTx, deletedDups map[string]map[string]map[string]struct{}) error {
+	for bucket, keys := range deletedDups {
+		c, err := tx.RwCursorDupSort(bucket)
+		if err != nil {
+			return err
+		}
+		for key, values := range keys {
+			for value := range values {
+				if err := c.DeleteExact([]byte(key), []byte(value)); err != nil {
+					c.Close()
+					return err
+				}
+			}
+		}
+		c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build cgo
+
+/*
+   Copyright 2022 Erigon contributors
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+       http://www.apache.org/licenses/LICENSE-2.0
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memdb
+
+import (
+	"context"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+// NewMemoryBatch - starts in-mem batch
+//
+// Common pattern:
+//
+// batch := NewMemoryBatch(db, tmpDir)
+// defer batch.Rollback()
+// ... some calculations on `batch`
+// batch.Commit()
+func NewMemoryBatch(tx kv.Tx, tmpDir string, tblConfig kv.TableCfg) *MemoryMutation {
+	tmpDB := mdbx.NewMDBX(log.NewNoop()).InMem(tmpDir).WithTableCfg(tblConfig).MustOpen()
+	memTx, err := tmpDB.BeginRw(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	if err := initSequences(tx, memTx); err != nil {
+		return nil
+	}
+
+	return &MemoryMutation{
+		db:             tx,
+		memDb:          tmpDB,
+		memTx:          memTx,
+		deletedEntries: make(map[string]map[string]struct{}),
+		deletedDups:    make(map[string]map[string]map[string]struct{}),
+		clearedTables:  make(map[string]struct{}),
+		droppedTables:  make(map[string]struct{}),
+		sizes:          make(map[string]int),
+		tblConfig:      tblConfig,
+	}
+}
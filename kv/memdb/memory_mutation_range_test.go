@@ -0,0 +1,185 @@
+//go:build cgo
+
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memdb
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
+)
+
+// TestRangeAgainstMdbx - ranges of MemoryMutation and memkv return the same as MdbxTx ranges after the same writes
+func TestRangeAgainstMdbx(t *testing.T) {
+	for _, candidate := range cursorTestCandidates {
+		for seed := int64(0); seed < 20; seed++ {
+			for _, table := range []string{"Plain", "Dup", "Auto"} {
+				candidate, seed, table := candidate, seed, table
+				t.Run(fmt.Sprintf("%s/%s/%d", candidate.name, table, seed), func(t *testing.T) {
+					ref, batch := openCursorTestTx(t, fillCursorTestTables(seed)), candidate.open(t, fillCursorTestTables(seed))
+					rnd := rand.New(rand.NewSource(seed))
+					if seed%5 == 0 {
+						require.NoError(t, ref.ClearBucket(table))
+						require.NoError(t, batch.ClearBucket(table))
+					}
+					mutate(t, rnd, table, ref, batch)
+
+					for i := 0; i < 50; i++ {
+						var from, to []byte
+						if rnd.Intn(4) > 0 {
+							from = testKey(rnd, table)
+						}
+						if rnd.Intn(4) > 0 {
+							to = testKey(rnd, table)
+						}
+						limit := rnd.Intn(8) - 1
+						asc := rnd.Intn(2) == 0
+						if from != nil && to != nil && string(from) == string(to) {
+							continue
+						}
+						if from != nil && to != nil && (string(from) < string(to)) != asc {
+							from, to = to, from
+						}
+
+						name := fmt.Sprintf("asc=%t [%s, %s) limit=%d", asc, from, to, limit)
+						rangeOf := func(tx interface {
+							RangeAscend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error)
+							RangeDescend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error)
+						}) []string {
+							var it iter.KV
+							var err error
+							if asc {
+								it, err = tx.RangeAscend(table, from, to, limit)
+							} else {
+								it, err = tx.RangeDescend(table, from, to, limit)
+							}
+							require.NoError(t, err, name)
+							defer it.(kv.Closer).Close()
+							var res []string
+							for it.HasNext() {
+								k, v, err := it.Next()
+								require.NoError(t, err, name)
+								res = append(res, string(k)+"="+string(v))
+							}
+							return res
+						}
+						require.Equal(t, rangeOf(ref), rangeOf(batch), name)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestRangeBounds(t *testing.T) {
+	_, batch := cursorTestBackends(t, func(w cursorTestWriter) {
+		for _, k := range []string{"a", "b", "c"} {
+			require.NoError(t, w.Put("Plain", []byte(k), []byte(k)))
+		}
+	})
+	require.NoError(t, batch.Put("Plain", []byte("bb"), []byte("bb")))
+	require.NoError(t, batch.Delete("Plain", []byte("c")))
+
+	keys := func(it iter.KV, err error) (res []string) {
+		require.NoError(t, err)
+		k, _ := iter.ToArrKVMust(it)
+		for _, key := range k {
+			res = append(res, string(key))
+		}
+		return res
+	}
+	require.Equal(t, []string{"b", "bb"}, keys(batch.Range("Plain", []byte("b"), nil)))
+	require.Equal(t, []string{"bb", "b"}, keys(batch.RangeDescend("Plain", []byte("bz"), []byte("a"), -1)))
+	require.Equal(t, []string{"bb"}, keys(batch.RangeDescend("Plain", nil, nil, 1)))
+	require.Equal(t, []string{"b", "bb"}, keys(batch.Prefix("Plain", []byte("b"))))
+
+	_, err := batch.RangeAscend("Plain", []byte("b"), []byte("a"), -1)
+	require.Error(t, err)
+}
+
+// TestRangeDupSortAgainstMdbx - values of key of MemoryMutation and memkv are the same as MdbxTx.RangeDupSort returns
+func TestRangeDupSortAgainstMdbx(t *testing.T) {
+	for _, candidate := range cursorTestCandidates {
+		for seed := int64(0); seed < 20; seed++ {
+			candidate, seed := candidate, seed
+			t.Run(fmt.Sprintf("%s/%d", candidate.name, seed), func(t *testing.T) {
+				ref, batch := openCursorTestTx(t, fillCursorTestTables(seed)), candidate.open(t, fillCursorTestTables(seed))
+				rnd := rand.New(rand.NewSource(seed))
+				mutate(t, rnd, "Dup", ref, batch)
+
+				for i := 0; i < 50; i++ {
+					key := testKey(rnd, "Dup")
+					var from, to []byte
+					if rnd.Intn(4) > 0 {
+						from = testValue(rnd)
+					}
+					if rnd.Intn(4) > 0 {
+						to = testValue(rnd)
+					}
+					limit := rnd.Intn(4) - 1
+					asc := order.By(rnd.Intn(2) == 0)
+					if from != nil && to != nil && string(from) == string(to) {
+						continue
+					}
+					if from != nil && to != nil && (string(from) < string(to)) != bool(asc) {
+						from, to = to, from
+					}
+
+					if !bool(asc) && from != nil && singleValue(t, ref, key) {
+						continue // MdbxTx returns nothing if the only value of key is before `from`: libmdbx doesn't PrevDup after failed SeekBothExact then
+					}
+
+					name := fmt.Sprintf("%s asc=%t [%s, %s) limit=%d", key, asc, from, to, limit)
+					rangeOf := func(tx kv.Tx) []string {
+						it, err := tx.RangeDupSort("Dup", key, from, to, asc, limit)
+						require.NoError(t, err, name)
+						defer it.(kv.Closer).Close()
+						var res []string
+						for it.HasNext() {
+							k, v, err := it.Next()
+							require.NoError(t, err, name)
+							res = append(res, string(k)+"="+string(v))
+						}
+						return res
+					}
+					require.Equal(t, rangeOf(ref), rangeOf(batch), name)
+				}
+			})
+		}
+	}
+}
+
+func singleValue(t *testing.T, tx kv.Tx, key []byte) bool {
+	c, err := tx.CursorDupSort("Dup")
+	require.NoError(t, err)
+	defer c.Close()
+	k, _, err := c.SeekExact(key)
+	require.NoError(t, err)
+	if k == nil {
+		return false
+	}
+	n, err := c.CountDuplicates()
+	require.NoError(t, err)
+	return n == 1
+}
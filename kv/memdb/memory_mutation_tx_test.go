@@ -0,0 +1,218 @@
+//go:build cgo
+
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/kvtest"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/memkv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func TestMemoryMutationTx(t *testing.T) {
+	ref, batch := cursorTestBackends(t, func(w cursorTestWriter) {
+		require.NoError(t, w.Put("Plain", []byte("a"), []byte("1")))
+		require.NoError(t, w.Put("Plain", []byte("c"), []byte("3")))
+		require.NoError(t, w.Put(kv.Sequence, []byte("Plain"), make([]byte, 8)))
+	})
+	require.Equal(t, 0, batch.BatchSize()) // sequences copied from underlying db are not changes
+
+	k, v, err := batch.Last("Plain")
+	require.NoError(t, err)
+	require.Equal(t, "c=3", string(k)+"="+string(v))
+
+	require.NoError(t, batch.Put("Plain", []byte("d"), []byte("4")))
+	require.NoError(t, batch.Delete("Plain", []byte("a")))
+	require.NoError(t, batch.Delete("Plain", []byte("a")))
+	require.Equal(t, len("d4")+len("a"), batch.BatchSize())
+
+	k, v, err = batch.Last("Plain")
+	require.NoError(t, err)
+	require.Equal(t, "d=4", string(k)+"="+string(v))
+
+	exists, err := batch.ExistsBucket("Dup")
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = batch.ExistsBucket("NotExisting")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	buckets, err := batch.ListBuckets()
+	require.NoError(t, err)
+	refBuckets, err := ref.ListBuckets()
+	require.NoError(t, err)
+	require.Equal(t, refBuckets, buckets)
+
+	require.Equal(t, batch.db.ViewID(), batch.ViewID())
+
+	c, err := batch.RwCursorDupSort("Dup")
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.Put([]byte("a"), []byte("1")))
+	require.NoError(t, c.AppendDup([]byte("a"), []byte("2")))
+	require.NoError(t, c.DeleteExact([]byte("a"), []byte("1")))
+	require.Equal(t, len("d4")+len("a")+len("a1a2")+len("a1"), batch.BatchSize())
+	require.NoError(t, batch.ClearBucket("Plain"))
+	require.Equal(t, len("a1a2")+len("a1"), batch.BatchSize())
+}
+
+func TestFlushContext(t *testing.T) {
+	ref, batch := cursorTestBackends(t, func(w cursorTestWriter) {
+		require.NoError(t, w.Put("Plain", []byte("a"), []byte("1")))
+	})
+	require.NoError(t, batch.Put("Plain", []byte("b"), []byte("2")))
+	require.NoError(t, batch.Delete("Plain", []byte("a")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, batch.Flush(ctx, ref), context.Canceled)
+
+	require.NoError(t, batch.Flush(context.Background(), ref))
+	has, err := ref.Has("Plain", []byte("a"))
+	require.NoError(t, err)
+	require.False(t, has)
+	v, err := ref.GetOne("Plain", []byte("b"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), v)
+}
+
+func TestRenameCopyBucket(t *testing.T) {
+	for _, candidate := range cursorTestCandidates[:2] {
+		t.Run(candidate.name, func(t *testing.T) {
+			fill := func(w cursorTestWriter) {
+				require.NoError(t, w.Put("Plain", []byte("a"), []byte("1")))
+				require.NoError(t, w.Put("Dup", []byte("a"), []byte("1")))
+				require.NoError(t, w.Put("Dup", []byte("a"), []byte("2")))
+				require.NoError(t, w.Put("Dup", []byte("b"), []byte("1")))
+			}
+			ref, batch := openCursorTestTx(t, fill), candidate.open(t, fill).(*MemoryMutation)
+			require.NoError(t, batch.deleteDup("Dup", []byte("a"), []byte("2")))
+			require.NoError(t, batch.Put("Dup", []byte("c"), []byte("1")))
+			require.NoError(t, batch.Put("Plain", []byte("b"), []byte("2")))
+			require.NoError(t, batch.Delete("Plain", []byte("a")))
+
+			require.Error(t, batch.CopyBucket("Dup", "Plain")) // not empty
+			require.Error(t, batch.CopyBucket("NotExisting", "DupCopy"))
+			require.NoError(t, batch.CopyBucket("Dup", "DupCopy"))
+			require.NoError(t, batch.RenameBucket("Plain", "Renamed"))
+
+			entries := func(tx kv.Tx, table string) (res []string) {
+				require.NoError(t, tx.ForEach(table, nil, func(k, v []byte) error {
+					res = append(res, string(k)+"="+string(v))
+					return nil
+				}))
+				return res
+			}
+			for _, tx := range []kv.Tx{batch, ref} {
+				if tx == ref {
+					require.NoError(t, batch.Flush(context.Background(), ref))
+				}
+				require.Equal(t, []string{"a=1", "b=1", "c=1"}, entries(tx, "Dup"))
+				require.Equal(t, []string{"a=1", "b=1", "c=1"}, entries(tx, "DupCopy"))
+				require.Equal(t, []string{"b=2"}, entries(tx, "Renamed"))
+				exists, err := tx.(kv.RwTx).ExistsBucket("Plain")
+				require.NoError(t, err)
+				require.False(t, exists)
+			}
+			c, err := ref.CursorDupSort("DupCopy")
+			require.NoError(t, err)
+			defer c.Close()
+			_, _, err = c.SeekExact([]byte("a"))
+			require.NoError(t, err)
+			n, err := c.CountDuplicates()
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), n)
+		})
+	}
+}
+
+// batchDB - db which writes through MemoryMutation: it's flushed to write tx of db on Commit
+type batchDB struct {
+	kv.RwDB
+	newBatch func(tx kv.Tx) *MemoryMutation
+}
+
+type batchTx struct {
+	*MemoryMutation
+	tx kv.RwTx
+}
+
+func (db *batchDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &batchTx{MemoryMutation: db.newBatch(tx), tx: tx}, nil
+}
+func (db *batchDB) BeginRwNosync(ctx context.Context) (kv.RwTx, error) { return db.BeginRw(ctx) }
+
+func (db *batchDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+func (db *batchDB) UpdateNosync(ctx context.Context, f func(tx kv.RwTx) error) error {
+	return db.Update(ctx, f)
+}
+
+func (tx *batchTx) Commit() error {
+	err := tx.MemoryMutation.Flush(context.Background(), tx.tx)
+	tx.MemoryMutation.Rollback()
+	if err != nil {
+		tx.tx.Rollback()
+		return err
+	}
+	return tx.tx.Commit()
+}
+
+func (tx *batchTx) Rollback() {
+	tx.MemoryMutation.Rollback()
+	tx.tx.Rollback()
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("MemoryMutation", func(t *testing.T) {
+		kvtest.Run(t, func(tb testing.TB) kv.RwDB {
+			db := mdbx.NewMDBX(log.NewNoop()).InMem(tb.TempDir()).WithTableCfg(kvtest.Tables).MustOpen()
+			tb.Cleanup(db.Close)
+			return &batchDB{RwDB: db, newBatch: func(tx kv.Tx) *MemoryMutation {
+				return NewMemoryBatch(tx, tb.TempDir(), kvtest.Tables)
+			}}
+		})
+	})
+	t.Run("PureGoMemoryMutation", func(t *testing.T) {
+		kvtest.Run(t, func(tb testing.TB) kv.RwDB {
+			return &batchDB{RwDB: memkv.NewTestDB(tb, kvtest.Tables), newBatch: func(tx kv.Tx) *MemoryMutation {
+				return NewPureGoMemoryBatch(tx, kvtest.Tables)
+			}}
+		})
+	})
+}
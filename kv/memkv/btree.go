@@ -0,0 +1,313 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memkv
+
+import "sort"
+
+const (
+	degree   = 32
+	maxItems = 2*degree - 1
+	minItems = degree - 1
+)
+
+// item - entry of table. Every value of DupSort table is separate item.
+type item struct {
+	k, v []byte
+}
+
+// owner - write transaction which may change nodes in place. Nodes of committed versions belong to finished
+// transactions, so they are never changed again: readers of old versions don't need locks.
+type owner struct {
+	_ byte // non-zero size: pointers to different owners must be different
+}
+
+type node struct {
+	items    []item
+	children []*node
+	owner    *owner
+}
+
+// btree - copy-on-write B-tree. Value of btree is a snapshot: copy it and set another owner to change it without
+// affecting the original.
+type btree struct {
+	root   *node
+	length int
+	size   int // bytes of keys and values
+	cmp    func(a, b item) int
+	owner  *owner
+}
+
+func itemSize(it item) int { return len(it.k) + len(it.v) }
+
+func (t *btree) newNode() *node { return &node{owner: t.owner} }
+
+// mutable - node which can be changed in place: n itself if it belongs to t, otherwise its copy
+func (t *btree) mutable(n *node) *node {
+	if n.owner == t.owner {
+		return n
+	}
+	c := &node{owner: t.owner, items: make([]item, len(n.items), cap(n.items))}
+	copy(c.items, n.items)
+	if len(n.children) > 0 {
+		c.children = make([]*node, len(n.children), cap(n.children))
+		copy(c.children, n.children)
+	}
+	return c
+}
+
+// find - index of first item >= it, and whether it's equal to it
+func (n *node) find(it item, cmp func(a, b item) int) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool { return cmp(n.items[i], it) >= 0 })
+	return i, i < len(n.items) && cmp(n.items[i], it) == 0
+}
+
+func (n *node) insertItemAt(i int, it item) {
+	n.items = append(n.items, item{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = it
+}
+
+func (n *node) insertChildAt(i int, c *node) {
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = c
+}
+
+func (n *node) removeItemAt(i int) item {
+	it := n.items[i]
+	copy(n.items[i:], n.items[i+1:])
+	n.items[len(n.items)-1] = item{}
+	n.items = n.items[:len(n.items)-1]
+	return it
+}
+
+func (n *node) removeChildAt(i int) *node {
+	c := n.children[i]
+	copy(n.children[i:], n.children[i+1:])
+	n.children[len(n.children)-1] = nil
+	n.children = n.children[:len(n.children)-1]
+	return c
+}
+
+// split - moves items after i and their children to new node, returns item i and new node
+func (t *btree) split(n *node, i int) (item, *node) {
+	it := n.items[i]
+	next := t.newNode()
+	next.items = append(next.items, n.items[i+1:]...)
+	for j := i; j < len(n.items); j++ {
+		n.items[j] = item{}
+	}
+	n.items = n.items[:i]
+	if len(n.children) > 0 {
+		next.children = append(next.children, n.children[i+1:]...)
+		for j := i + 1; j < len(n.children); j++ {
+			n.children[j] = nil
+		}
+		n.children = n.children[:i+1]
+	}
+	return it, next
+}
+
+// set - inserts it or replaces equal item, returns replaced item
+func (t *btree) set(it item) (old item, replaced bool) {
+	if t.root == nil {
+		t.root = t.newNode()
+	}
+	t.root = t.mutable(t.root)
+	if len(t.root.items) >= maxItems {
+		mid, second := t.split(t.root, maxItems/2)
+		first := t.root
+		t.root = t.newNode()
+		t.root.items = append(t.root.items, mid)
+		t.root.children = append(t.root.children, first, second)
+	}
+	old, replaced = t.insert(t.root, it)
+	if replaced {
+		t.size -= itemSize(old)
+	} else {
+		t.length++
+	}
+	t.size += itemSize(it)
+	return old, replaced
+}
+
+func (t *btree) insert(n *node, it item) (item, bool) {
+	i, found := n.find(it, t.cmp)
+	if found {
+		old := n.items[i]
+		n.items[i] = it
+		return old, true
+	}
+	if len(n.children) == 0 {
+		n.insertItemAt(i, it)
+		return item{}, false
+	}
+	if len(n.children[i].items) >= maxItems {
+		child := t.mutable(n.children[i])
+		n.children[i] = child
+		mid, second := t.split(child, maxItems/2)
+		n.insertItemAt(i, mid)
+		n.insertChildAt(i+1, second)
+		switch c := t.cmp(it, mid); {
+		case c > 0:
+			i++
+		case c == 0:
+			n.items[i] = it
+			return mid, true
+		}
+	}
+	n.children[i] = t.mutable(n.children[i])
+	return t.insert(n.children[i], it)
+}
+
+// delete - removes item equal to it
+func (t *btree) delete(it item) (item, bool) {
+	if t.root == nil || len(t.root.items) == 0 {
+		return item{}, false
+	}
+	t.root = t.mutable(t.root)
+	old, ok := t.remove(t.root, it, false)
+	if len(t.root.items) == 0 && len(t.root.children) > 0 {
+		t.root = t.root.children[0]
+	}
+	if ok {
+		t.length--
+		t.size -= itemSize(old)
+	}
+	return old, ok
+}
+
+// remove - removes it from subtree of n (or max item of subtree if removeMax), n must be mutable and have more than
+// minItems items, unless it's root
+func (t *btree) remove(n *node, it item, removeMax bool) (item, bool) {
+	var i int
+	var found bool
+	if removeMax {
+		if len(n.children) == 0 {
+			return n.removeItemAt(len(n.items) - 1), true
+		}
+		i = len(n.items)
+	} else {
+		i, found = n.find(it, t.cmp)
+		if len(n.children) == 0 {
+			if found {
+				return n.removeItemAt(i), true
+			}
+			return item{}, false
+		}
+	}
+	if len(n.children[i].items) <= minItems {
+		t.growChild(n, i)
+		return t.remove(n, it, removeMax)
+	}
+	child := t.mutable(n.children[i])
+	n.children[i] = child
+	if found {
+		old := n.items[i]
+		n.items[i], _ = t.remove(child, item{}, true)
+		return old, true
+	}
+	return t.remove(child, it, removeMax)
+}
+
+// growChild - makes child i of n bigger than minItems: by item from sibling or by merge with sibling
+func (t *btree) growChild(n *node, i int) {
+	switch {
+	case i > 0 && len(n.children[i-1].items) > minItems:
+		child, left := t.mutable(n.children[i]), t.mutable(n.children[i-1])
+		n.children[i], n.children[i-1] = child, left
+		child.insertItemAt(0, n.items[i-1])
+		n.items[i-1] = left.removeItemAt(len(left.items) - 1)
+		if len(left.children) > 0 {
+			child.insertChildAt(0, left.removeChildAt(len(left.children)-1))
+		}
+	case i < len(n.items) && len(n.children[i+1].items) > minItems:
+		child, right := t.mutable(n.children[i]), t.mutable(n.children[i+1])
+		n.children[i], n.children[i+1] = child, right
+		child.items = append(child.items, n.items[i])
+		n.items[i] = right.removeItemAt(0)
+		if len(right.children) > 0 {
+			child.children = append(child.children, right.removeChildAt(0))
+		}
+	default:
+		if i >= len(n.items) {
+			i--
+		}
+		child := t.mutable(n.children[i])
+		n.children[i] = child
+		mid := n.removeItemAt(i)
+		right := n.removeChildAt(i + 1)
+		child.items = append(child.items, mid)
+		child.items = append(child.items, right.items...)
+		child.children = append(child.children, right.children...)
+	}
+}
+
+// first - first item for which f is true, f must be false for all items before it and true after it
+func (t *btree) first(f func(it item) bool) (item, bool) { return t.root.first(f) }
+
+// last - last item for which f is true, f must be true for all items before it and false after it
+func (t *btree) last(f func(it item) bool) (item, bool) { return t.root.last(f) }
+
+func (n *node) first(f func(it item) bool) (item, bool) {
+	if n == nil {
+		return item{}, false
+	}
+	i := sort.Search(len(n.items), func(i int) bool { return f(n.items[i]) })
+	if len(n.children) > 0 {
+		if it, ok := n.children[i].first(f); ok {
+			return it, true
+		}
+	}
+	if i < len(n.items) {
+		return n.items[i], true
+	}
+	return item{}, false
+}
+
+func (n *node) last(f func(it item) bool) (item, bool) {
+	if n == nil {
+		return item{}, false
+	}
+	i := sort.Search(len(n.items), func(i int) bool { return !f(n.items[i]) })
+	if len(n.children) > 0 {
+		if it, ok := n.children[i].last(f); ok {
+			return it, true
+		}
+	}
+	if i > 0 {
+		return n.items[i-1], true
+	}
+	return item{}, false
+}
+
+// ceil - first item >= it
+func (t *btree) ceil(it item) (item, bool) {
+	return t.first(func(x item) bool { return t.cmp(x, it) >= 0 })
+}
+
+// get - item equal to it
+func (t *btree) get(it item) (item, bool) {
+	found, ok := t.ceil(it)
+	if !ok || t.cmp(found, it) != 0 {
+		return item{}, false
+	}
+	return found, true
+}
+
+func (t *btree) min() (item, bool) { return t.first(func(item) bool { return true }) }
+func (t *btree) max() (item, bool) { return t.last(func(item) bool { return true }) }
@@ -0,0 +1,113 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func treeItems(t *btree) (res []string) {
+	var walk func(n *node)
+	walk = func(n *node) {
+		if n == nil {
+			return
+		}
+		for i, it := range n.items {
+			if len(n.children) > 0 {
+				walk(n.children[i])
+			}
+			res = append(res, string(it.k))
+		}
+		if len(n.children) > 0 {
+			walk(n.children[len(n.items)])
+		}
+	}
+	walk(t.root)
+	return res
+}
+
+// TestBtreeSnapshots - random inserts and deletes match sorted set, old snapshots are not affected by later changes
+func TestBtreeSnapshots(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	cmp := func(a, b item) int { return bytes.Compare(a.k, b.k) }
+	tree := btree{cmp: cmp, owner: &owner{}}
+	expect := map[string]struct{}{}
+
+	type snapshot struct {
+		tree btree
+		keys []string
+	}
+	var snapshots []snapshot
+	sorted := func() []string {
+		res := make([]string, 0, len(expect))
+		for k := range expect {
+			res = append(res, k)
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	for round := 0; round < 30; round++ {
+		for i := 0; i < 1000; i++ {
+			k := make([]byte, 4)
+			binary.BigEndian.PutUint32(k, uint32(rnd.Intn(5000)))
+			if rnd.Intn(3) == 0 {
+				_, ok := tree.delete(item{k: k})
+				_, expected := expect[string(k)]
+				require.Equal(t, expected, ok)
+				delete(expect, string(k))
+				continue
+			}
+			_, replaced := tree.set(item{k: k, v: k})
+			_, expected := expect[string(k)]
+			require.Equal(t, expected, replaced)
+			expect[string(k)] = struct{}{}
+		}
+		require.Equal(t, len(expect), tree.length)
+		require.Equal(t, len(expect)*8, tree.size)
+		keys := sorted()
+		require.Equal(t, keys, treeItems(&tree))
+
+		if len(keys) > 0 {
+			it, ok := tree.min()
+			require.True(t, ok)
+			require.Equal(t, keys[0], string(it.k))
+			it, ok = tree.max()
+			require.True(t, ok)
+			require.Equal(t, keys[len(keys)-1], string(it.k))
+			seek := keys[rnd.Intn(len(keys))]
+			it, ok = tree.last(func(x item) bool { return string(x.k) < seek })
+			j := sort.SearchStrings(keys, seek)
+			require.Equal(t, j > 0, ok)
+			if ok {
+				require.Equal(t, keys[j-1], string(it.k))
+			}
+		}
+
+		snapshots = append(snapshots, snapshot{tree: tree, keys: keys})
+		tree.owner = &owner{} // next round is next transaction
+	}
+	for _, s := range snapshots {
+		require.Equal(t, s.keys, treeItems(&s.tree))
+	}
+}
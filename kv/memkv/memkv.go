@@ -0,0 +1,612 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package memkv - pure-Go in-memory implementation of kv.RwDB. Doesn't use cgo, files and OS-thread locking: suitable
+// for unit tests (can run in parallel and with CGO_ENABLED=0) and as in-memory store of memdb.MemoryMutation.
+//
+// Every table is copy-on-write B-tree. Read transactions see snapshot of last commit and don't block anything,
+// write transactions are serialized - like in MDBX.
+package memkv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
+)
+
+var (
+	ErrCursorClosed = kv.ErrCursorClosed
+	ErrTxClosed     = errors.New("tx closed")
+	// ErrKeyExists - analog of MDBX_KEYEXIST: PutNoOverwrite of existing key or PutNoDupData of existing key/value
+	ErrKeyExists = errors.New("key/data pair already exists")
+	// ErrKeyMismatch - analog of MDBX_EKEYMISMATCH: Append or AppendDup of key/value which is not after last one
+	ErrKeyMismatch = errors.New("key/data pair is not greater than last one")
+)
+
+var (
+	_ kv.RwDB            = (*MemKV)(nil)
+	_ kv.RwTx            = (*MemTx)(nil)
+	_ kv.RwCursorDupSort = (*MemCursor)(nil)
+)
+
+type MemKV struct {
+	cfg       kv.TableCfg
+	committed atomic.Pointer[version]
+	writer    chan struct{} // one write tx at a time
+	closed    atomic.Bool
+}
+
+// version - state of all tables after commit. Never changed after commit.
+type version struct {
+	id     uint64
+	tables map[string]*table
+}
+
+type table struct {
+	cfg  kv.TableCfgItem
+	tree btree
+}
+
+// New - opens empty db with tables of tblConfig, deprecated tables are not created
+func New(tblConfig kv.TableCfg) *MemKV {
+	db := &MemKV{cfg: make(kv.TableCfg, len(tblConfig)), writer: make(chan struct{}, 1)}
+	v := &version{tables: make(map[string]*table, len(tblConfig))}
+	for name, cfg := range tblConfig {
+		db.cfg[name] = cfg
+		if !cfg.IsDeprecated {
+			v.tables[name] = newTable(cfg)
+		}
+	}
+	db.committed.Store(v)
+	return db
+}
+
+func NewTestDB(tb testing.TB, tblConfig kv.TableCfg) *MemKV {
+	tb.Helper()
+	db := New(tblConfig)
+	tb.Cleanup(db.Close)
+	return db
+}
+
+func NewTestTx(tb testing.TB, tblConfig kv.TableCfg) (kv.RwDB, kv.RwTx) {
+	tb.Helper()
+	db := NewTestDB(tb, tblConfig)
+	tx, err := db.BeginRw(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(tx.Rollback)
+	return db, tx
+}
+
+func newTable(cfg kv.TableCfgItem) *table {
+	cmp := func(a, b item) int { return cfg.CompareKeys(a.k, b.k) }
+	if cfg.Flags&kv.DupSort != 0 {
+		cmp = func(a, b item) int {
+			if c := cfg.CompareKeys(a.k, b.k); c != 0 {
+				return c
+			}
+			return cfg.CompareDups(a.v, b.v)
+		}
+	}
+	return &table{cfg: cfg, tree: btree{cmp: cmp}}
+}
+
+func (db *MemKV) ReadOnly() bool          { return false }
+func (db *MemKV) PageSize() uint64        { return kv.DefaultPageSize() }
+func (db *MemKV) CHandle() unsafe.Pointer { return nil }
+
+// Close - transactions which are still open keep working with their snapshots, new ones can't be started
+func (db *MemKV) Close() { db.closed.Store(true) }
+
+// AllTables - configs of tables: given to New and created by transactions
+func (db *MemKV) AllTables() kv.TableCfg {
+	res := make(kv.TableCfg, len(db.cfg))
+	for name, cfg := range db.cfg {
+		res[name] = cfg
+	}
+	for name, t := range db.committed.Load().tables {
+		res[name] = t.cfg
+	}
+	return res
+}
+
+func (db *MemKV) BeginRo(ctx context.Context) (kv.Tx, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	if db.closed.Load() {
+		return nil, fmt.Errorf("db closed")
+	}
+	return &MemTx{db: db, v: db.committed.Load(), readOnly: true}, nil
+}
+
+func (db *MemKV) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	if err := ctx.Err(); err != nil { // select below chooses randomly if writer is free
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case db.writer <- struct{}{}:
+	}
+	if db.closed.Load() {
+		<-db.writer
+		return nil, fmt.Errorf("db closed")
+	}
+	committed := db.committed.Load()
+	v := &version{id: committed.id + 1, tables: make(map[string]*table, len(committed.tables))}
+	for name, t := range committed.tables {
+		v.tables[name] = t
+	}
+	return &MemTx{db: db, v: v, owner: &owner{}}, nil
+}
+
+// BeginRwNosync - same as BeginRw: there is nothing to sync
+func (db *MemKV) BeginRwNosync(ctx context.Context) (kv.RwTx, error) { return db.BeginRw(ctx) }
+
+func (db *MemKV) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *MemKV) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (db *MemKV) UpdateNosync(ctx context.Context, f func(tx kv.RwTx) error) error {
+	return db.Update(ctx, f)
+}
+
+type MemTx struct {
+	db               *MemKV
+	v                *version // nil after Commit/Rollback
+	owner            *owner   // nodes which tx can change in place, nil for read-only tx
+	readOnly         bool
+	statelessCursors map[string]kv.RwCursor
+}
+
+func (tx *MemTx) ViewID() uint64 {
+	if tx.v == nil {
+		return 0
+	}
+	return tx.v.id
+}
+
+func (tx *MemTx) CHandle() unsafe.Pointer { return nil }
+func (tx *MemTx) CollectMetrics()         {}
+
+func (tx *MemTx) Commit() error {
+	if tx.v == nil {
+		return ErrTxClosed
+	}
+	if !tx.readOnly {
+		tx.db.committed.Store(tx.v)
+	}
+	tx.Rollback()
+	return nil
+}
+
+func (tx *MemTx) Rollback() {
+	if tx.v == nil {
+		return
+	}
+	tx.v = nil
+	tx.statelessCursors = nil
+	if !tx.readOnly {
+		<-tx.db.writer
+	}
+}
+
+// table - table as tx sees it
+func (tx *MemTx) table(name string) (*table, error) {
+	if tx.v == nil {
+		return nil, ErrTxClosed
+	}
+	t, ok := tx.v.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table: %s, not found", name)
+	}
+	return t, nil
+}
+
+// writableTable - table which tx can change: copy of committed one on first change
+func (tx *MemTx) writableTable(name string) (*table, error) {
+	t, err := tx.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if tx.readOnly {
+		return nil, fmt.Errorf("table: %s, write in read-only tx", name)
+	}
+	if t.tree.owner != tx.owner {
+		cp := *t
+		cp.tree.owner = tx.owner
+		t = &cp
+		tx.v.tables[name] = t
+	}
+	return t, nil
+}
+
+func (tx *MemTx) tableCfg(name string) (kv.TableCfgItem, bool) {
+	if tx.v != nil {
+		if t, ok := tx.v.tables[name]; ok {
+			return t.cfg, true
+		}
+	}
+	cfg, ok := tx.db.cfg[name]
+	return cfg, ok
+}
+
+func (tx *MemTx) ListBuckets() ([]string, error) {
+	if tx.v == nil {
+		return nil, ErrTxClosed
+	}
+	res := make([]string, 0, len(tx.v.tables))
+	for name := range tx.v.tables {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (tx *MemTx) ExistsBucket(name string) (bool, error) {
+	if tx.v == nil {
+		return false, ErrTxClosed
+	}
+	_, ok := tx.v.tables[name]
+	return ok, nil
+}
+
+// CreateBucket - creates empty table with configured flags, does nothing if table exists
+func (tx *MemTx) CreateBucket(name string) error {
+	if tx.v == nil {
+		return ErrTxClosed
+	}
+	if tx.readOnly {
+		return fmt.Errorf("create table: %s, read-only tx", name)
+	}
+	if _, ok := tx.v.tables[name]; ok {
+		return nil
+	}
+	cfg := tx.db.cfg[name]
+	cfg.IsDeprecated = false
+	tx.v.tables[name] = newTable(cfg)
+	return nil
+}
+
+func (tx *MemTx) ClearBucket(name string) error {
+	if exists, err := tx.ExistsBucket(name); err != nil || !exists {
+		return err
+	}
+	t, err := tx.writableTable(name)
+	if err != nil {
+		return err
+	}
+	t.tree.root, t.tree.length, t.tree.size = nil, 0, 0
+	tx.statelessCursors = nil
+	return nil
+}
+
+// DropBucket - same as MdbxTx.DropBucket: only deprecated tables can be dropped
+func (tx *MemTx) DropBucket(name string) error {
+	if cfg, ok := tx.db.cfg[name]; !(ok && cfg.IsDeprecated) {
+		return fmt.Errorf("%w, bucket: %s", kv.ErrAttemptToDeleteNonDeprecatedBucket, name)
+	}
+	return tx.drop(name)
+}
+
+func (tx *MemTx) drop(name string) error {
+	if tx.v == nil {
+		return ErrTxClosed
+	}
+	if tx.readOnly {
+		return fmt.Errorf("drop table: %s, read-only tx", name)
+	}
+	delete(tx.v.tables, name)
+	delete(tx.statelessCursors, name)
+	return nil
+}
+
+// CopyBucket - same semantic as MdbxTx.CopyBucket: not existing dst is created with config of src, existing one must
+// have same flags and be empty
+func (tx *MemTx) CopyBucket(src, dst string) error {
+	if src == dst {
+		return fmt.Errorf("copy table: %s, source and destination are the same", src)
+	}
+	srcT, err := tx.table(src)
+	if err != nil {
+		return fmt.Errorf("copy table: %s, %w", src, err)
+	}
+	if tx.readOnly {
+		return fmt.Errorf("copy table: %s, read-only tx", src)
+	}
+	dstCfg, configured := tx.tableCfg(dst)
+	if configured {
+		if dstCfg.Flags != srcT.cfg.Flags {
+			return fmt.Errorf("copy table: %s to %s, flags %#x don't match flags of destination %#x", src, dst, uint(srcT.cfg.Flags), uint(dstCfg.Flags))
+		}
+		if (dstCfg.KeyCmp == nil) != (srcT.cfg.KeyCmp == nil) || (dstCfg.DupCmp == nil) != (srcT.cfg.DupCmp == nil) {
+			return fmt.Errorf("copy table: %s to %s, comparators of destination don't match", src, dst)
+		}
+	} else {
+		dstCfg = srcT.cfg
+	}
+	if dstT, ok := tx.v.tables[dst]; ok && dstT.tree.length > 0 {
+		return fmt.Errorf("copy table: %s to %s, destination is not empty", src, dst)
+	}
+	dstCfg.IsDeprecated = false
+	cp := newTable(dstCfg)
+	cp.tree.root, cp.tree.length, cp.tree.size = srcT.tree.root, srcT.tree.length, srcT.tree.size
+	tx.v.tables[dst] = cp
+	tx.owner = &owner{} // nodes shared by src and dst must not be changed in place anymore
+	delete(tx.statelessCursors, dst)
+	return nil
+}
+
+// RenameBucket - CopyBucket and drop of `from`, even if it's not deprecated
+func (tx *MemTx) RenameBucket(from, to string) error {
+	if err := tx.CopyBucket(from, to); err != nil {
+		return err
+	}
+	return tx.drop(from)
+}
+
+// BucketSize - bytes of keys and values of table
+func (tx *MemTx) BucketSize(name string) (uint64, error) {
+	t, err := tx.table(name)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(t.tree.size), nil
+}
+
+// DBSize - bytes of keys and values of all tables
+func (tx *MemTx) DBSize() (uint64, error) {
+	if tx.v == nil {
+		return 0, ErrTxClosed
+	}
+	var size uint64
+	for _, t := range tx.v.tables {
+		size += uint64(t.tree.size)
+	}
+	return size, nil
+}
+
+func (tx *MemTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	cfg, _ := tx.tableCfg(table)
+	if _, err := tx.table(table); err != nil {
+		return nil, err
+	}
+	return &MemCursor{tx: tx, table: table, cfg: cfg}, nil
+}
+func (tx *MemTx) RwCursor(table string) (kv.RwCursor, error) { return tx.RwCursorDupSort(table) }
+func (tx *MemTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	return tx.RwCursorDupSort(table)
+}
+func (tx *MemTx) Cursor(table string) (kv.Cursor, error) { return tx.RwCursorDupSort(table) }
+
+func (tx *MemTx) statelessCursor(table string) (kv.RwCursor, error) {
+	if tx.statelessCursors == nil {
+		tx.statelessCursors = make(map[string]kv.RwCursor)
+	}
+	c, ok := tx.statelessCursors[table]
+	if !ok {
+		var err error
+		c, err = tx.RwCursor(table)
+		if err != nil {
+			return nil, err
+		}
+		tx.statelessCursors[table] = c
+	}
+	return c, nil
+}
+
+func (tx *MemTx) Put(table string, k, v []byte) error {
+	c, err := tx.statelessCursor(table)
+	if err != nil {
+		return err
+	}
+	return c.Put(k, v)
+}
+
+func (tx *MemTx) Delete(table string, k []byte) error {
+	c, err := tx.statelessCursor(table)
+	if err != nil {
+		return err
+	}
+	return c.Delete(k)
+}
+
+func (tx *MemTx) GetOne(table string, k []byte) ([]byte, error) {
+	c, err := tx.statelessCursor(table)
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.SeekExact(k)
+	return v, err
+}
+
+func (tx *MemTx) Has(table string, key []byte) (bool, error) {
+	c, err := tx.statelessCursor(table)
+	if err != nil {
+		return false, err
+	}
+	k, _, err := c.Seek(key)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(key, k), nil
+}
+
+func (tx *MemTx) Append(table string, k, v []byte) error {
+	c, err := tx.statelessCursor(table)
+	if err != nil {
+		return err
+	}
+	return c.Append(k, v)
+}
+
+func (tx *MemTx) AppendDup(table string, k, v []byte) error {
+	c, err := tx.statelessCursor(table)
+	if err != nil {
+		return err
+	}
+	return c.(*MemCursor).AppendDup(k, v)
+}
+
+func (tx *MemTx) IncrementSequence(table string, amount uint64) (uint64, error) {
+	c, err := tx.statelessCursor(kv.Sequence)
+	if err != nil {
+		return 0, err
+	}
+	_, v, err := c.SeekExact([]byte(table))
+	if err != nil {
+		return 0, err
+	}
+
+	var currentV uint64
+	if len(v) > 0 {
+		currentV = binary.BigEndian.Uint64(v)
+	}
+
+	newVBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(newVBytes, currentV+amount)
+	if err = c.Put([]byte(table), newVBytes); err != nil {
+		return 0, err
+	}
+	return currentV, nil
+}
+
+func (tx *MemTx) ReadSequence(table string) (uint64, error) {
+	c, err := tx.statelessCursor(kv.Sequence)
+	if err != nil {
+		return 0, err
+	}
+	_, v, err := c.SeekExact([]byte(table))
+	if err != nil {
+		return 0, err
+	}
+
+	var currentV uint64
+	if len(v) > 0 {
+		currentV = binary.BigEndian.Uint64(v)
+	}
+	return currentV, nil
+}
+
+func (tx *MemTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *MemTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *MemTx) ForAmount(table string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	if amount == 0 {
+		return nil
+	}
+	c, err := tx.Cursor(table)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil && amount > 0; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+		amount--
+	}
+	return nil
+}
+
+func (tx *MemTx) Prefix(table string, prefix []byte) (iter.KV, error) {
+	nextPrefix, ok := kv.NextSubtree(prefix)
+	if !ok {
+		return tx.Range(table, prefix, nil)
+	}
+	return tx.Range(table, prefix, nextPrefix)
+}
+
+func (tx *MemTx) Range(table string, fromPrefix, toPrefix []byte) (iter.KV, error) {
+	return tx.RangeAscend(table, fromPrefix, toPrefix, -1)
+}
+func (tx *MemTx) RangeAscend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error) {
+	return tx.rangeOrderLimit(table, fromPrefix, toPrefix, order.Asc, limit)
+}
+func (tx *MemTx) RangeDescend(table string, fromPrefix, toPrefix []byte, limit int) (iter.KV, error) {
+	return tx.rangeOrderLimit(table, fromPrefix, toPrefix, order.Desc, limit)
+}
@@ -0,0 +1,685 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memkv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+)
+
+type cursorState uint8
+
+const (
+	unpositioned cursorState = iota
+	positioned
+	eof // after failed seek or delete of last item: Next fails, Prev goes to last item
+)
+
+// MemCursor - cursor of MemTx, works as MdbxCursor: including AutoDupSortKeysConversion and position after delete.
+// Cursor keeps item it points to and finds its neighbours in table on every move, so it sees changes of table made by
+// other cursors of same tx. After delete cursor keeps deleted item: moves find its neighbours, as in MDBX.
+type MemCursor struct {
+	tx     *MemTx
+	table  string
+	cfg    kv.TableCfgItem
+	cur    item
+	state  cursorState
+	closed bool
+}
+
+// --- positioning over items of table, dup-related ops treat non-DupSort table as table with 1 value per key ---
+
+func (c *MemCursor) tree() (*btree, error) {
+	if c.closed {
+		return nil, ErrCursorClosed
+	}
+	t, err := c.tx.table(c.table)
+	if err != nil {
+		return nil, err
+	}
+	return &t.tree, nil
+}
+
+func (c *MemCursor) writableTree() (*btree, error) {
+	if c.closed {
+		return nil, ErrCursorClosed
+	}
+	t, err := c.tx.writableTable(c.table)
+	if err != nil {
+		return nil, err
+	}
+	return &t.tree, nil
+}
+
+// moveTo - positions cursor at it if found, otherwise keeps position
+func (c *MemCursor) moveTo(it item, found bool) (item, bool, error) {
+	if !found {
+		return item{}, false, nil
+	}
+	c.cur, c.state = it, positioned
+	return it, true, nil
+}
+
+// seekTo - positions cursor at it if found, otherwise cursor is at eof
+func (c *MemCursor) seekTo(it item, found bool) (item, bool, error) {
+	if !found {
+		c.state = eof
+	}
+	return c.moveTo(it, found)
+}
+
+func (c *MemCursor) keyIs(k []byte) func(it item) bool {
+	return func(it item) bool { return c.cfg.CompareKeys(it.k, k) == 0 }
+}
+
+func (c *MemCursor) first() (item, bool, error) {
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	it, ok := t.min()
+	return c.seekTo(it, ok)
+}
+
+func (c *MemCursor) last() (item, bool, error) {
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	it, ok := t.max()
+	return c.seekTo(it, ok)
+}
+
+// setRange - first value of first key >= k
+func (c *MemCursor) setRange(k []byte) (item, bool, error) {
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	it, ok := t.first(func(it item) bool { return c.cfg.CompareKeys(it.k, k) >= 0 })
+	return c.seekTo(it, ok)
+}
+
+// set - first value of key k
+func (c *MemCursor) set(k []byte) (item, bool, error) {
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	it, ok := t.first(func(it item) bool { return c.cfg.CompareKeys(it.k, k) >= 0 })
+	return c.seekTo(it, ok && c.keyIs(k)(it))
+}
+
+// getBoth - exactly k and v
+func (c *MemCursor) getBoth(k, v []byte) (item, bool, error) {
+	it, ok, err := c.getBothRange(k, v)
+	if err != nil || !ok {
+		return it, ok, err
+	}
+	if c.cfg.Flags&kv.DupSort == 0 && !bytes.Equal(it.v, v) || c.cfg.Flags&kv.DupSort != 0 && c.cfg.CompareDups(it.v, v) != 0 {
+		c.state = eof
+		return item{}, false, nil
+	}
+	return it, true, nil
+}
+
+// getBothRange - first value >= v of key k
+func (c *MemCursor) getBothRange(k, v []byte) (item, bool, error) {
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	if c.cfg.Flags&kv.DupSort == 0 {
+		it, ok := t.get(item{k: k})
+		return c.seekTo(it, ok && bytes.Compare(it.v, v) >= 0)
+	}
+	it, ok := t.ceil(item{k: k, v: v})
+	return c.seekTo(it, ok && c.keyIs(k)(it))
+}
+
+// after - first item after current
+func (c *MemCursor) after(t *btree) (item, bool) {
+	return t.first(func(it item) bool { return t.cmp(it, c.cur) > 0 })
+}
+
+// before - last item before current
+func (c *MemCursor) before(t *btree) (item, bool) {
+	return t.last(func(it item) bool { return t.cmp(it, c.cur) < 0 })
+}
+
+func (c *MemCursor) next() (item, bool, error) {
+	switch c.state {
+	case unpositioned:
+		return c.first()
+	case eof:
+		return item{}, false, nil
+	}
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	return c.moveTo(c.after(t))
+}
+
+func (c *MemCursor) prev() (item, bool, error) {
+	if c.state != positioned {
+		return c.last()
+	}
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	it, ok := c.before(t)
+	if !ok {
+		c.leaveDeleted(t)
+	}
+	return c.moveTo(it, ok)
+}
+
+// leaveDeleted - cursor at deleted item moves to next item after unsuccessful Prev, or PrevDup if deleted item wasn't
+// the only value of its key, as in MDBX
+func (c *MemCursor) leaveDeleted(t *btree) {
+	if _, ok := t.get(c.cur); !ok {
+		c.seekTo(t.ceil(c.cur))
+	}
+}
+
+func (c *MemCursor) nextDup() (item, bool, error) {
+	if c.state != positioned {
+		return item{}, false, nil
+	}
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	it, ok := c.after(t)
+	return c.moveTo(it, ok && c.keyIs(c.cur.k)(it))
+}
+
+func (c *MemCursor) prevDup() (item, bool, error) {
+	if c.state != positioned {
+		return item{}, false, nil
+	}
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	it, ok := c.before(t)
+	if ok = ok && c.keyIs(c.cur.k)(it); !ok && c.hasKey(t, c.cur.k) {
+		c.leaveDeleted(t)
+	}
+	return c.moveTo(it, ok)
+}
+
+func (c *MemCursor) nextNoDup() (item, bool, error) {
+	switch c.state {
+	case unpositioned:
+		return c.first()
+	case eof:
+		return item{}, false, nil
+	}
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	k := c.cur.k
+	return c.moveTo(t.first(func(it item) bool { return c.cfg.CompareKeys(it.k, k) > 0 }))
+}
+
+// prevNoDup - last value of previous key
+func (c *MemCursor) prevNoDup() (item, bool, error) {
+	if c.state != positioned {
+		return c.last()
+	}
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	k := c.cur.k
+	return c.moveTo(t.last(func(it item) bool { return c.cfg.CompareKeys(it.k, k) < 0 }))
+}
+
+func (c *MemCursor) hasKey(t *btree, k []byte) bool {
+	it, ok := t.first(func(it item) bool { return c.cfg.CompareKeys(it.k, k) >= 0 })
+	return ok && c.keyIs(k)(it)
+}
+
+// settle - cursor at deleted item which was the only value of its key moves to next item, so dup-related methods
+// work with key of next item, as in MDBX. Returns false if there is no such item.
+func (c *MemCursor) settle(t *btree) bool {
+	if c.hasKey(t, c.cur.k) {
+		return true
+	}
+	c.seekTo(t.ceil(c.cur))
+	return c.state == positioned
+}
+
+func (c *MemCursor) firstDup() (item, bool, error) {
+	if c.state != positioned {
+		return item{}, false, nil
+	}
+	t, err := c.tree()
+	if err != nil || !c.settle(t) {
+		return item{}, false, err
+	}
+	k := c.cur.k
+	return c.moveTo(t.first(func(it item) bool { return c.cfg.CompareKeys(it.k, k) >= 0 }))
+}
+
+func (c *MemCursor) lastDup() (item, bool, error) {
+	if c.state != positioned {
+		return item{}, false, nil
+	}
+	t, err := c.tree()
+	if err != nil || !c.settle(t) {
+		return item{}, false, err
+	}
+	k := c.cur.k
+	return c.moveTo(t.last(func(it item) bool { return c.cfg.CompareKeys(it.k, k) <= 0 }))
+}
+
+// current - item at cursor, or next one if current was deleted
+func (c *MemCursor) current() (item, bool, error) {
+	if c.state != positioned {
+		return item{}, false, nil
+	}
+	t, err := c.tree()
+	if err != nil {
+		return item{}, false, err
+	}
+	return c.seekTo(t.ceil(c.cur))
+}
+
+// delCurrent - deletes item at cursor, cursor keeps deleted item: Current returns next item, Next returns it too
+func (c *MemCursor) delCurrent() error {
+	if _, ok, err := c.current(); err != nil || !ok {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("table: %s, delete: cursor is not positioned", c.table)
+	}
+	t, err := c.writableTree()
+	if err != nil {
+		return err
+	}
+	t.delete(c.cur)
+	return nil
+}
+
+// delAllDups - deletes all values of current key, cursor moves to next key
+func (c *MemCursor) delAllDups() error {
+	if c.state != positioned {
+		return fmt.Errorf("table: %s, delete: cursor is not positioned", c.table)
+	}
+	t, err := c.writableTree()
+	if err != nil || !c.settle(t) {
+		return err
+	}
+	k := c.cur.k
+	for {
+		it, ok := t.first(func(it item) bool { return c.cfg.CompareKeys(it.k, k) >= 0 })
+		if !ok || !c.keyIs(k)(it) {
+			c.seekTo(it, ok)
+			return nil
+		}
+		t.delete(it)
+	}
+}
+
+type putFlags uint8
+
+const (
+	putNoOverwrite putFlags = 1 << iota // fail if key exists
+	putNoDupData                        // fail if key/value exists
+	putAppend                           // key must be >= last key (> for not DupSort table)
+	putAppendDup                        // value must be > last value of key
+)
+
+// put - inserts copy of k, v and positions cursor at it
+func (c *MemCursor) put(k, v []byte, flags putFlags) error {
+	t, err := c.writableTree()
+	if err != nil {
+		return err
+	}
+	dupSort := c.cfg.Flags&kv.DupSort != 0
+	it := item{k: append(make([]byte, 0, len(k)), k...), v: append(make([]byte, 0, len(v)), v...)}
+
+	if flags&putNoOverwrite != 0 || !dupSort {
+		if existing, ok := t.first(func(x item) bool { return c.cfg.CompareKeys(x.k, k) >= 0 }); ok && c.keyIs(k)(existing) {
+			if flags&putNoOverwrite != 0 {
+				c.moveTo(existing, true)
+				return fmt.Errorf("table: %s, key: %x, %w", c.table, k, ErrKeyExists)
+			}
+			if flags&putAppend != 0 {
+				return fmt.Errorf("table: %s, key: %x, %w", c.table, k, ErrKeyMismatch)
+			}
+		}
+	}
+	if dupSort && flags&putNoDupData != 0 {
+		if existing, ok := t.get(it); ok {
+			c.moveTo(existing, true)
+			return fmt.Errorf("table: %s, key: %x, value: %x, %w", c.table, k, v, ErrKeyExists)
+		}
+	}
+	if flags&putAppend != 0 {
+		if lastIt, ok := t.max(); ok && (t.cmp(lastIt, it) >= 0 || !dupSort && c.cfg.CompareKeys(lastIt.k, k) >= 0) {
+			return fmt.Errorf("table: %s, key: %x, %w", c.table, k, ErrKeyMismatch)
+		}
+	}
+	if dupSort && flags&putAppendDup != 0 {
+		if lastDup, ok := t.last(func(x item) bool { return c.cfg.CompareKeys(x.k, k) <= 0 }); ok && c.keyIs(k)(lastDup) && c.cfg.CompareDups(lastDup.v, v) >= 0 {
+			return fmt.Errorf("table: %s, key: %x, value: %x, %w", c.table, k, v, ErrKeyMismatch)
+		}
+	}
+	t.set(it)
+	c.moveTo(it, true)
+	return nil
+}
+
+// putCurrent - replaces item at cursor by k, v
+func (c *MemCursor) putCurrent(k, v []byte) error {
+	if c.state != positioned {
+		return fmt.Errorf("table: %s, put current: cursor is not positioned", c.table)
+	}
+	t, err := c.writableTree()
+	if err != nil {
+		return err
+	}
+	t.delete(c.cur)
+	return c.put(k, v, 0)
+}
+
+// --- kv.Cursor: same logic as MdbxCursor ---
+
+// decode - reverse of AutoDupSortKeysConversion: key of DupToLen bytes with key part in value becomes key of
+// DupFromLen bytes
+func (c *MemCursor) decode(it item, found bool, err error) ([]byte, []byte, error) {
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if !found {
+		return nil, nil, nil
+	}
+	if c.cfg.AutoDupSortKeysConversion && len(it.k) == c.cfg.DupToLen {
+		keyPart := c.cfg.DupFromLen - c.cfg.DupToLen
+		if len(it.v) < keyPart {
+			return nil, nil, fmt.Errorf("table: %s, key with too short value: k=%x, v=%x", c.table, it.k, it.v)
+		}
+		k := make([]byte, 0, c.cfg.DupFromLen)
+		k = append(append(k, it.k...), it.v[:keyPart]...)
+		return k, it.v[keyPart:], nil
+	}
+	return it.k, it.v, nil
+}
+
+func (c *MemCursor) Count() (uint64, error) {
+	t, err := c.tree()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(t.length), nil
+}
+
+func (c *MemCursor) First() ([]byte, []byte, error) { return c.Seek(nil) }
+func (c *MemCursor) Last() ([]byte, []byte, error)  { return c.decode(c.last()) }
+func (c *MemCursor) Next() ([]byte, []byte, error)  { return c.decode(c.next()) }
+func (c *MemCursor) Prev() ([]byte, []byte, error)  { return c.decode(c.prev()) }
+
+// Current - return key/data at current cursor position
+func (c *MemCursor) Current() ([]byte, []byte, error) { return c.decode(c.current()) }
+
+func (c *MemCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	if c.cfg.AutoDupSortKeysConversion {
+		return c.seekDupSort(seek)
+	}
+	if len(seek) == 0 {
+		return c.decode(c.first())
+	}
+	return c.decode(c.setRange(seek))
+}
+
+func (c *MemCursor) seekDupSort(seek []byte) ([]byte, []byte, error) {
+	if len(seek) == 0 {
+		return c.decode(c.first())
+	}
+	to := c.cfg.DupToLen
+	var seek1, seek2 []byte
+	if len(seek) > to {
+		seek1, seek2 = seek[:to], seek[to:]
+	} else {
+		seek1 = seek
+	}
+	it, ok, err := c.setRange(seek1)
+	if err != nil || !ok {
+		return c.decode(it, ok, err)
+	}
+	if seek2 != nil && bytes.Equal(seek1, it.k) {
+		if it, ok, err = c.getBothRange(seek1, seek2); err == nil && !ok {
+			// no such value: next key. Position must be restored, getBothRange moved cursor to eof
+			c.cur, c.state = item{k: seek1, v: seek2}, positioned
+			it, ok, err = c.nextNoDup()
+			if err == nil && !ok {
+				c.state = eof
+			}
+		}
+	}
+	return c.decode(it, ok, err)
+}
+
+func (c *MemCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	if c.cfg.AutoDupSortKeysConversion && len(key) == c.cfg.DupFromLen {
+		from, to := c.cfg.DupFromLen, c.cfg.DupToLen
+		it, ok, err := c.getBothRange(key[:to], key[to:])
+		if err != nil {
+			return []byte{}, nil, err
+		}
+		if !ok || !bytes.Equal(key[to:], it.v[:from-to]) {
+			return nil, nil, nil
+		}
+		return key[:to], it.v[from-to:], nil
+	}
+	it, ok, err := c.set(key)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if !ok {
+		return nil, nil, nil
+	}
+	return it.k, it.v, nil
+}
+
+func (c *MemCursor) Put(key, value []byte) error {
+	if c.cfg.AutoDupSortKeysConversion {
+		return c.putDupSort(key, value)
+	}
+	return c.put(key, value, 0)
+}
+
+func (c *MemCursor) putDupSort(key, value []byte) error {
+	from, to := c.cfg.DupFromLen, c.cfg.DupToLen
+	if len(key) != from && len(key) >= to {
+		return fmt.Errorf("table: %s, can have keys of len==%d and len<%d. key: %x,%d", c.table, from, to, key, len(key))
+	}
+
+	if len(key) != from {
+		if err := c.put(key, value, putNoOverwrite); err != nil {
+			if errors.Is(err, ErrKeyExists) {
+				return c.putCurrent(key, value)
+			}
+			return err
+		}
+		return nil
+	}
+
+	value = append(append(make([]byte, 0, len(key)-to+len(value)), key[to:]...), value...)
+	key = key[:to]
+	it, ok, err := c.getBothRange(key, value[:from-to])
+	if err != nil {
+		return err
+	}
+	if ok && bytes.Equal(it.v[:from-to], value[:from-to]) {
+		if err := c.delCurrent(); err != nil {
+			return err
+		}
+	}
+	return c.put(key, value, 0)
+}
+
+// PutNoOverwrite - fails with ErrKeyExists if key exists
+func (c *MemCursor) PutNoOverwrite(key, value []byte) error {
+	return c.put(key, value, putNoOverwrite)
+}
+
+// Append - fails with ErrKeyMismatch if key/value is not after last one of table (of key for DupSort tables)
+func (c *MemCursor) Append(k, v []byte) error {
+	if c.cfg.AutoDupSortKeysConversion {
+		from, to := c.cfg.DupFromLen, c.cfg.DupToLen
+		if len(k) != from && len(k) >= to {
+			return fmt.Errorf("append to table: %s, can have keys of len==%d and len<%d. key: %x,%d", c.table, from, to, k, len(k))
+		}
+		if len(k) == from {
+			v = append(append(make([]byte, 0, len(k)-to+len(v)), k[to:]...), v...)
+			k = k[:to]
+		}
+		return c.put(k, v, putAppendDup)
+	}
+	if c.cfg.Flags&kv.DupSort != 0 {
+		return c.put(k, v, putAppend|putAppendDup)
+	}
+	return c.put(k, v, putAppend)
+}
+
+func (c *MemCursor) Delete(k []byte) error {
+	if c.cfg.AutoDupSortKeysConversion {
+		return c.deleteDupSort(k)
+	}
+	_, ok, err := c.set(k)
+	if err != nil || !ok {
+		return err
+	}
+	if c.cfg.Flags&kv.DupSort != 0 {
+		return c.delAllDups()
+	}
+	return c.delCurrent()
+}
+
+func (c *MemCursor) deleteDupSort(key []byte) error {
+	from, to := c.cfg.DupFromLen, c.cfg.DupToLen
+	if len(key) != from && len(key) >= to {
+		return fmt.Errorf("delete from dupsort table: %s, can have keys of len==%d and len<%d. key: %x,%d", c.table, from, to, key, len(key))
+	}
+
+	if len(key) == from {
+		it, ok, err := c.getBothRange(key[:to], key[to:])
+		if err != nil || !ok { // if key not found, or found another one - then nothing to delete
+			return err
+		}
+		if !bytes.Equal(it.v[:from-to], key[to:]) {
+			return nil
+		}
+		return c.delCurrent()
+	}
+
+	_, ok, err := c.set(key)
+	if err != nil || !ok {
+		return err
+	}
+	return c.delCurrent()
+}
+
+// DeleteCurrent - deletes key/value at cursor. Current and Next return next key/value then, Prev returns the one
+// before deleted. Same as in MDBX.
+func (c *MemCursor) DeleteCurrent() error { return c.delCurrent() }
+
+func (c *MemCursor) Close() { c.closed = true }
+
+// --- kv.CursorDupSort ---
+
+func (c *MemCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	it, ok, err := c.getBoth(key, value)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if !ok {
+		return nil, nil, nil
+	}
+	return it.k, it.v, nil
+}
+
+func (c *MemCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	it, ok, err := c.getBothRange(key, value)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return it.v, nil
+}
+
+func dupValue(it item, found bool, err error) ([]byte, error) {
+	if err != nil || !found {
+		return nil, err
+	}
+	return it.v, nil
+}
+
+func dupKeyValue(it item, found bool, err error) ([]byte, []byte, error) {
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	if !found {
+		return nil, nil, nil
+	}
+	return it.k, it.v, nil
+}
+
+func (c *MemCursor) FirstDup() ([]byte, error)          { return dupValue(c.firstDup()) }
+func (c *MemCursor) LastDup() ([]byte, error)           { return dupValue(c.lastDup()) }
+func (c *MemCursor) NextDup() ([]byte, []byte, error)   { return dupKeyValue(c.nextDup()) }
+func (c *MemCursor) NextNoDup() ([]byte, []byte, error) { return dupKeyValue(c.nextNoDup()) }
+func (c *MemCursor) PrevDup() ([]byte, []byte, error)   { return dupKeyValue(c.prevDup()) }
+func (c *MemCursor) PrevNoDup() ([]byte, []byte, error) { return dupKeyValue(c.prevNoDup()) }
+func (c *MemCursor) AppendDup(k, v []byte) error        { return c.put(k, v, putAppendDup) }
+func (c *MemCursor) PutNoDupData(k, v []byte) error     { return c.put(k, v, putNoDupData) }
+func (c *MemCursor) DeleteCurrentDuplicates() error     { return c.delAllDups() }
+func (c *MemCursor) DeleteExact(k1, k2 []byte) error {
+	_, ok, err := c.getBoth(k1, k2)
+	if err != nil || !ok { // if key not found, or found another one - then nothing to delete
+		return err
+	}
+	return c.delCurrent()
+}
+
+// CountDuplicates - number of values of current key
+func (c *MemCursor) CountDuplicates() (uint64, error) {
+	if c.state != positioned {
+		return 0, fmt.Errorf("table: %s, count duplicates: cursor is not positioned", c.table)
+	}
+	t, err := c.tree()
+	if err != nil {
+		return 0, err
+	}
+	if !c.settle(t) {
+		return 0, fmt.Errorf("table: %s, count duplicates: cursor is not positioned", c.table)
+	}
+	var n uint64
+	for it, ok := t.first(func(it item) bool { return c.cfg.CompareKeys(it.k, c.cur.k) >= 0 }); ok && c.keyIs(c.cur.k)(it); it, ok = t.first(func(x item) bool { return t.cmp(x, it) > 0 }) {
+		n++
+	}
+	return n, nil
+}
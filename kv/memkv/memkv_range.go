@@ -0,0 +1,216 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memkv
+
+import (
+	"fmt"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
+)
+
+// rangeOrderLimit - same semantic as MdbxTx.RangeAscend/RangeDescend: [from, to) in given order, limit -1 means
+// no limit
+func (tx *MemTx) rangeOrderLimit(table string, fromPrefix, toPrefix []byte, orderAscend order.By, limit int) (*rangeIter, error) {
+	cfg, _ := tx.tableCfg(table)
+	s := &rangeIter{fromPrefix: fromPrefix, toPrefix: toPrefix, orderAscend: orderAscend, limit: int64(limit), cmp: cfg.CompareKeys}
+	return s.init(tx, table, cfg)
+}
+
+type rangeIter struct {
+	c kv.CursorDupSort
+
+	fromPrefix, toPrefix, nextK, nextV []byte
+	err                                error
+	orderAscend                        order.By
+	limit                              int64
+	cmp                                func(a, b []byte) int // keys order of table
+}
+
+func (s *rangeIter) init(tx *MemTx, table string, cfg kv.TableCfgItem) (*rangeIter, error) {
+	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) >= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.fromPrefix, s.toPrefix)
+	}
+	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) <= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.toPrefix, s.fromPrefix)
+	}
+	c, err := tx.CursorDupSort(table)
+	if err != nil {
+		return s, err
+	}
+	s.c = c
+
+	if s.fromPrefix == nil { // no initial position
+		if s.orderAscend {
+			s.nextK, s.nextV, s.err = s.c.First()
+		} else {
+			s.nextK, s.nextV, s.err = s.c.Last()
+		}
+		return s, s.err
+	}
+
+	s.nextK, s.nextV, s.err = s.c.Seek(s.fromPrefix)
+	if s.orderAscend || s.err != nil {
+		return s, s.err
+	}
+	// descend: start from given key or previous one
+	switch {
+	case s.nextK == nil: // all keys are before fromPrefix
+		s.nextK, s.nextV, s.err = s.c.Last()
+	case s.cmp(s.nextK, s.fromPrefix) != 0:
+		s.nextK, s.nextV, s.err = s.c.Prev()
+	case cfg.Flags&kv.DupSort != 0 && !cfg.AutoDupSortKeysConversion: // go to last value of this key
+		s.nextV, s.err = s.c.LastDup()
+	}
+	return s, s.err
+}
+
+func (s *rangeIter) Close() {
+	if s.c != nil {
+		s.c.Close()
+		s.c = nil
+		s.nextK, s.err = nil, nil
+	}
+}
+func (s *rangeIter) HasNext() bool {
+	if s.err != nil { // always true, then .Next() call will return this error
+		return true
+	}
+	if s.limit == 0 { // limit reached
+		return false
+	}
+	if s.nextK == nil { // EndOfTable
+		return false
+	}
+	if s.toPrefix == nil { // s.nextK == nil check is above
+		return true
+	}
+
+	//Asc:  [from, to) AND from < to
+	//Desc: [from, to) AND from > to
+	cmp := s.cmp(s.nextK, s.toPrefix)
+	return (bool(s.orderAscend) && cmp < 0) || (!bool(s.orderAscend) && cmp > 0)
+}
+func (s *rangeIter) Next() (k, v []byte, err error) {
+	if s.c == nil {
+		return nil, nil, ErrCursorClosed
+	}
+	s.limit--
+	k, v, err = s.nextK, s.nextV, s.err
+	if s.orderAscend {
+		s.nextK, s.nextV, s.err = s.c.Next()
+	} else {
+		s.nextK, s.nextV, s.err = s.c.Prev()
+	}
+	return k, v, err
+}
+
+// RangeDupSort - values of key in [from, to) in given order, see MdbxTx.RangeDupSort
+func (tx *MemTx) RangeDupSort(table string, key []byte, fromPrefix, toPrefix []byte, asc order.By, limit int) (iter.KV, error) {
+	cfg, _ := tx.tableCfg(table)
+	s := &dupRangeIter{key: key, fromPrefix: fromPrefix, toPrefix: toPrefix, orderAscend: bool(asc), limit: int64(limit), cmp: cfg.CompareDups}
+	return s.init(tx, table)
+}
+
+type dupRangeIter struct {
+	c kv.CursorDupSort
+
+	key                         []byte
+	fromPrefix, toPrefix, nextV []byte
+	err                         error
+	orderAscend                 bool
+	limit                       int64
+	cmp                         func(a, b []byte) int // values order of table
+}
+
+func (s *dupRangeIter) init(tx *MemTx, table string) (*dupRangeIter, error) {
+	if s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) >= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.fromPrefix, s.toPrefix)
+	}
+	if !s.orderAscend && s.fromPrefix != nil && s.toPrefix != nil && s.cmp(s.fromPrefix, s.toPrefix) <= 0 {
+		return s, fmt.Errorf("tx.Dual: %x must be lexicographicaly before %x", s.toPrefix, s.fromPrefix)
+	}
+	c, err := tx.CursorDupSort(table)
+	if err != nil {
+		return s, err
+	}
+	s.c = c
+	k, _, err := c.SeekExact(s.key)
+	if err != nil || k == nil {
+		return s, err
+	}
+
+	switch {
+	case s.fromPrefix == nil && s.orderAscend:
+		s.nextV, s.err = s.c.FirstDup()
+	case s.fromPrefix == nil:
+		s.nextV, s.err = s.c.LastDup()
+	case s.orderAscend:
+		s.nextV, s.err = s.c.SeekBothRange(s.key, s.fromPrefix)
+	default: // given value or previous one
+		if s.nextV, s.err = s.c.SeekBothRange(s.key, s.fromPrefix); s.err != nil {
+			return s, s.err
+		}
+		switch {
+		case s.nextV == nil: // all values are before fromPrefix
+			if _, _, s.err = c.SeekExact(s.key); s.err == nil {
+				s.nextV, s.err = s.c.LastDup()
+			}
+		case s.cmp(s.nextV, s.fromPrefix) != 0:
+			_, s.nextV, s.err = s.c.PrevDup()
+		}
+	}
+	return s, s.err
+}
+
+func (s *dupRangeIter) Close() {
+	if s.c != nil {
+		s.c.Close()
+		s.c = nil
+		s.nextV, s.err = nil, nil
+	}
+}
+func (s *dupRangeIter) HasNext() bool {
+	if s.err != nil { // always true, then .Next() call will return this error
+		return true
+	}
+	if s.limit == 0 { // limit reached
+		return false
+	}
+	if s.nextV == nil { // end of values of key
+		return false
+	}
+	if s.toPrefix == nil {
+		return true
+	}
+	cmp := s.cmp(s.nextV, s.toPrefix)
+	return (s.orderAscend && cmp < 0) || (!s.orderAscend && cmp > 0)
+}
+func (s *dupRangeIter) Next() (k, v []byte, err error) {
+	if s.c == nil {
+		return nil, nil, ErrCursorClosed
+	}
+	s.limit--
+	v, err = s.nextV, s.err
+	if s.orderAscend {
+		_, s.nextV, s.err = s.c.NextDup()
+	} else {
+		_, s.nextV, s.err = s.c.PrevDup()
+	}
+	return s.key, v, err
+}
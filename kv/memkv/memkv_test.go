@@ -0,0 +1,329 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memkv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/kvtest"
+)
+
+var testTables = kv.TableCfg{
+	kv.Sequence: {},
+	"Plain":     {},
+	"Dup":       {Flags: kv.DupSort},
+	"Auto":      {Flags: kv.DupSort, AutoDupSortKeysConversion: true, DupFromLen: 6, DupToLen: 4},
+	"Old":       {IsDeprecated: true},
+}
+
+func keys(t *testing.T, tx kv.Tx, table string) (res []string) {
+	t.Helper()
+	require.NoError(t, tx.ForEach(table, nil, func(k, v []byte) error {
+		res = append(res, string(k)+"="+string(v))
+		return nil
+	}))
+	return res
+}
+
+func TestConformance(t *testing.T) {
+	kvtest.Run(t, func(tb testing.TB) kv.RwDB { return NewTestDB(tb, kvtest.Tables) })
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	db := NewTestDB(t, testTables)
+	ctx := context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put("Plain", []byte("a"), []byte("1")) }))
+
+	before, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer before.Rollback()
+
+	tx, err := db.BeginRw(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.NoError(t, tx.Put("Plain", []byte("b"), []byte("2")))
+	require.NoError(t, tx.Delete("Plain", []byte("a")))
+	require.Equal(t, []string{"b=2"}, keys(t, tx, "Plain"))
+	require.Equal(t, []string{"a=1"}, keys(t, before, "Plain"))
+
+	require.NoError(t, tx.Commit())
+	require.Equal(t, []string{"a=1"}, keys(t, before, "Plain"))
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Equal(t, []string{"b=2"}, keys(t, tx, "Plain"))
+		require.Greater(t, tx.ViewID(), before.ViewID())
+		return nil
+	}))
+
+	// changes of rolled back tx are lost
+	tx, err = db.BeginRw(ctx)
+	require.NoError(t, err)
+	require.NoError(t, tx.ClearBucket("Plain"))
+	tx.Rollback()
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		require.Equal(t, []string{"b=2"}, keys(t, tx, "Plain"))
+		return nil
+	}))
+	require.ErrorIs(t, tx.Commit(), ErrTxClosed)
+	_, err = tx.GetOne("Plain", []byte("b"))
+	require.ErrorIs(t, err, ErrTxClosed)
+}
+
+func TestOneWriter(t *testing.T) {
+	db := NewTestDB(t, testTables)
+	tx, err := db.BeginRw(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = db.BeginRw(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	tx.Rollback()
+	tx, err = db.BeginRw(context.Background())
+	require.NoError(t, err)
+	tx.Rollback()
+
+	// canceled context fails even if writer is free
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	for i := 0; i < 10; i++ {
+		_, err = db.BeginRw(canceled)
+		require.ErrorIs(t, err, context.Canceled)
+	}
+
+	db.Close()
+	_, err = db.BeginRw(context.Background())
+	require.Error(t, err)
+	_, err = db.BeginRo(context.Background())
+	require.Error(t, err)
+}
+
+// TestParallelReaders - readers of committed versions don't see changes of concurrent writers, run with -race
+func TestParallelReaders(t *testing.T) {
+	db := NewTestDB(t, testTables)
+	ctx := context.Background()
+	const writes = 100
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				if err := db.View(ctx, func(tx kv.Tx) error {
+					// every commit adds one key to both tables
+					plain, err := tx.BucketSize("Plain")
+					if err != nil {
+						return err
+					}
+					dup, err := tx.BucketSize("Dup")
+					if err != nil {
+						return err
+					}
+					if plain != dup {
+						return fmt.Errorf("partial commit is visible: %d != %d", plain, dup)
+					}
+					return nil
+				}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < writes; i++ {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			k := binary.BigEndian.AppendUint64(nil, uint64(i))
+			if err := tx.Put("Plain", k, k); err != nil {
+				return err
+			}
+			return tx.Put("Dup", k, k)
+		}))
+	}
+	wg.Wait()
+}
+
+func TestDupSort(t *testing.T) {
+	_, tx := NewTestTx(t, testTables)
+	for _, v := range []string{"3", "1", "2", "1"} {
+		require.NoError(t, tx.Put("Dup", []byte("a"), []byte(v)))
+	}
+	require.NoError(t, tx.Put("Dup", []byte("b"), []byte("1")))
+	require.Equal(t, []string{"a=1", "a=2", "a=3", "b=1"}, keys(t, tx, "Dup"))
+
+	c, err := tx.RwCursorDupSort("Dup")
+	require.NoError(t, err)
+	defer c.Close()
+	require.ErrorIs(t, c.PutNoDupData([]byte("a"), []byte("2")), ErrKeyExists)
+	require.ErrorIs(t, c.AppendDup([]byte("a"), []byte("0")), ErrKeyMismatch)
+	n, err := c.CountDuplicates()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), n)
+	require.NoError(t, c.DeleteExact([]byte("a"), []byte("2")))
+	require.NoError(t, tx.Delete("Dup", []byte("b")))
+	require.Equal(t, []string{"a=1", "a=3"}, keys(t, tx, "Dup"))
+}
+
+// TestDeleteCurrent - cursor keeps position of deleted value, as MdbxCursor does
+func TestDeleteCurrent(t *testing.T) {
+	moves := map[string]func(c kv.RwCursorDupSort) ([]byte, []byte, error){
+		"Next":      func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Next() },
+		"Prev":      func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Prev() },
+		"Current":   func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.Current() },
+		"NextDup":   func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.NextDup() },
+		"PrevDup":   func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.PrevDup() },
+		"NextNoDup": func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.NextNoDup() },
+		"PrevNoDup": func(c kv.RwCursorDupSort) ([]byte, []byte, error) { return c.PrevNoDup() },
+		"LastDup": func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			v, err := c.LastDup()
+			return nil, v, err
+		},
+		"CountDuplicates": func(c kv.RwCursorDupSort) ([]byte, []byte, error) {
+			n, err := c.CountDuplicates()
+			return []byte(fmt.Sprint(n)), nil, err
+		},
+	}
+	for _, tc := range []struct {
+		deleted string   // key/value deleted by DeleteCurrent
+		moves   []string // moves after delete
+		want    []string // "k=v" returned by moves
+	}{
+		{"b=2", []string{"Next", "Next"}, []string{"b=3", "c=1"}},
+		{"b=2", []string{"Current", "Next"}, []string{"b=3", "c=1"}},
+		{"b=2", []string{"NextDup", "PrevDup"}, []string{"b=3", "b=1"}},
+		{"b=2", []string{"NextNoDup"}, []string{"c=1"}},
+		{"b=3", []string{"NextDup", "Next"}, []string{"=", "c=1"}},
+		{"b=3", []string{"PrevNoDup"}, []string{"a=1"}},
+		{"b=3", []string{"CountDuplicates"}, []string{"2="}},
+		{"a=1", []string{"Prev", "Next"}, []string{"=", "b=2"}}, // unsuccessful Prev moves to next value
+		{"a=1", []string{"LastDup", "CountDuplicates"}, []string{"=3", "3="}},
+		{"b=1", []string{"PrevDup", "Next"}, []string{"=", "b=3"}},
+		{"c=1", []string{"Next", "Prev"}, []string{"=", "b=3"}},
+	} {
+		_, tx := NewTestTx(t, testTables)
+		for _, e := range []string{"a=1", "b=1", "b=2", "b=3", "c=1"} {
+			require.NoError(t, tx.Put("Dup", []byte(e[:1]), []byte(e[2:])))
+		}
+		c, err := tx.RwCursorDupSort("Dup")
+		require.NoError(t, err)
+		_, _, err = c.SeekBothExact([]byte(tc.deleted[:1]), []byte(tc.deleted[2:]))
+		require.NoError(t, err)
+		require.NoError(t, c.DeleteCurrent())
+		var got []string
+		for _, m := range tc.moves {
+			k, v, err := moves[m](c)
+			require.NoError(t, err)
+			got = append(got, string(k)+"="+string(v))
+		}
+		require.Equal(t, tc.want, got, "delete %s, %v", tc.deleted, tc.moves)
+		c.Close()
+	}
+}
+
+func TestAutoDupSortKeysConversion(t *testing.T) {
+	_, tx := NewTestTx(t, testTables)
+	require.NoError(t, tx.Put("Auto", []byte("key"), []byte("v")))       // shorter than DupToLen: not converted
+	require.NoError(t, tx.Put("Auto", []byte("key2s1"), []byte("v1")))   // stored as key2 -> s1v1
+	require.NoError(t, tx.Put("Auto", []byte("key2s2"), []byte("v2")))   // stored as key2 -> s2v2
+	require.NoError(t, tx.Put("Auto", []byte("key2s1"), []byte("v1.1"))) // replaces s1v1
+
+	v, err := tx.GetOne("Auto", []byte("key2s1"))
+	require.NoError(t, err)
+	require.Equal(t, "v1.1", string(v))
+	require.Equal(t, []string{"key=v", "key2s1=v1.1", "key2s2=v2"}, keys(t, tx, "Auto"))
+
+	c, err := tx.CursorDupSort("Auto")
+	require.NoError(t, err)
+	defer c.Close()
+	k, v, err := c.SeekExact([]byte("key2"))
+	require.NoError(t, err)
+	require.Equal(t, "key2", string(k))
+	require.Equal(t, "s1v1.1", string(v))
+	n, err := c.CountDuplicates()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), n)
+
+	require.NoError(t, tx.Delete("Auto", []byte("key2s1")))
+	require.Equal(t, []string{"key=v", "key2s2=v2"}, keys(t, tx, "Auto"))
+}
+
+func TestBuckets(t *testing.T) {
+	db, tx := NewTestTx(t, testTables)
+	migrator := tx.(kv.BucketMigrator)
+	exists, err := migrator.ExistsBucket("Old")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, migrator.CreateBucket("Old"))
+	require.NoError(t, tx.Put("Old", []byte("a"), []byte("1")))
+	require.NoError(t, migrator.DropBucket("Old"))
+	require.ErrorIs(t, migrator.DropBucket("Plain"), kv.ErrAttemptToDeleteNonDeprecatedBucket)
+
+	require.NoError(t, tx.Put("Plain", []byte("a"), []byte("1")))
+	require.NoError(t, migrator.RenameBucket("Plain", "Copy"))
+	buckets, err := migrator.ListBuckets()
+	require.NoError(t, err)
+	require.Equal(t, []string{"Auto", "Copy", "Dup", kv.Sequence}, buckets)
+
+	// shared nodes of copy are not changed by writes to other table
+	require.NoError(t, migrator.CopyBucket("Copy", "Plain"))
+	require.NoError(t, tx.Put("Plain", []byte("b"), []byte("2")))
+	require.Equal(t, []string{"a=1"}, keys(t, tx, "Copy"))
+	require.Equal(t, []string{"a=1", "b=2"}, keys(t, tx, "Plain"))
+	require.Error(t, migrator.CopyBucket("Plain", "Copy"))
+	require.Error(t, migrator.CopyBucket("Plain", "Dup"))
+
+	require.NoError(t, migrator.ClearBucket("Plain"))
+	size, err := tx.BucketSize("Plain")
+	require.NoError(t, err)
+	require.Zero(t, size)
+	require.NoError(t, tx.Commit())
+	require.Contains(t, db.AllTables(), "Copy")
+}
+
+func TestSequence(t *testing.T) {
+	_, tx := NewTestTx(t, testTables)
+	i, err := tx.IncrementSequence("Plain", 10)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), i)
+	i, err = tx.IncrementSequence("Plain", 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), i)
+	i, err = tx.ReadSequence("Plain")
+	require.NoError(t, err)
+	require.Equal(t, uint64(15), i)
+	i, err = tx.ReadSequence("Dup")
+	require.NoError(t, err)
+	require.Zero(t, i)
+}
+
+func TestReadOnlyTx(t *testing.T) {
+	db := NewTestDB(t, testTables)
+	tx, err := db.BeginRo(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.Error(t, tx.(kv.RwTx).Put("Plain", []byte("a"), []byte("1")))
+	require.Error(t, tx.(kv.BucketMigrator).ClearBucket("Plain"))
+}
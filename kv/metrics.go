@@ -0,0 +1,237 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/metrics"
+)
+
+// DBMetrics - metrics of 1 db. All series have `label` of db and are stored in own metrics.Set - which is exported
+// while db is open. See AcquireDBMetrics.
+type DBMetrics struct {
+	Label Label // label of series: label of db
+	Set   *metrics.Set
+
+	DbSize, TxLimit, TxSpill, TxUnspill, TxDirty metrics.Gauge
+
+	DbPgopsNewly, DbPgopsCow, DbPgopsClone, DbPgopsSplit    metrics.Gauge
+	DbPgopsMerge, DbPgopsSpill, DbPgopsUnspill, DbPgopsWops metrics.Gauge
+
+	GcLeaf, GcOverflow, GcPages metrics.Gauge
+
+	Readers, ReadersOldestLag metrics.Gauge // amount of reader slots in use, lag (in transactions) of the oldest reader
+
+	commit *DBCommitMetrics
+	tables map[string][]string // table -> names of its series, see SetTableStats
+}
+
+var dbMetrics = struct {
+	mu   sync.Mutex
+	open map[Label]*DBMetrics // label of series -> metrics of open db
+}{open: map[Label]*DBMetrics{}}
+
+// defaultDBMetrics - metrics of default label, aliased by deprecated package-level metrics. Used by first open db with
+// label InMem, exported even if no db with this label is open.
+var (
+	defaultDBMetrics       = registerDBMetrics(newDBMetrics(InMem))
+	defaultDBCommitMetrics = defaultDBMetrics.CommitMetrics()
+)
+
+// AcquireDBMetrics - returns metrics of new db and starts their export. Series are labelled by label of db, label
+// must be unique among open dbs: returns ErrLabelInUse otherwise. Exception is default label InMem - label of
+// throwaway dbs, many of them can be open at once: only first of them exports its series, metrics of others are
+// not exported. Every successful call must be paired with ReleaseDBMetrics.
+func AcquireDBMetrics(label Label) (*DBMetrics, error) {
+	dbMetrics.mu.Lock()
+	defer dbMetrics.mu.Unlock()
+	if dbMetrics.open[label] != nil {
+		if label != InMem {
+			return nil, fmt.Errorf("%w: %s", ErrLabelInUse, label)
+		}
+		return newDBMetrics(label), nil
+	}
+	m := defaultDBMetrics
+	if label != m.Label {
+		m = registerDBMetrics(newDBMetrics(label))
+	}
+	dbMetrics.open[label] = m
+	return m, nil
+}
+
+// ReleaseDBMetrics - removes series of closed db. Series of default label stay exported.
+func ReleaseDBMetrics(m *DBMetrics) {
+	dbMetrics.mu.Lock()
+	defer dbMetrics.mu.Unlock()
+	if dbMetrics.open[m.Label] != m {
+		return
+	}
+	delete(dbMetrics.open, m.Label)
+	if m == defaultDBMetrics {
+		m.setTableStats(nil) // tables belong to closed db, next db with default label may have other tables
+		return
+	}
+	metrics.UnregisterSet(m.Set)
+	m.Set.UnregisterAllMetrics()
+}
+
+func registerDBMetrics(m *DBMetrics) *DBMetrics {
+	metrics.RegisterSet(m.Set)
+	return m
+}
+
+func newDBMetrics(label Label) *DBMetrics {
+	set := metrics.NewSet()
+	gauge := func(name string) metrics.Gauge {
+		return metrics.GetOrCreateGaugeInSet(set, fmt.Sprintf(`%s{label="%s"}`, name, label))
+	}
+	pgops := func(phase string) metrics.Gauge {
+		return metrics.GetOrCreateGaugeInSet(set, fmt.Sprintf(`db_pgops{phase="%s",label="%s"}`, phase, label))
+	}
+	return &DBMetrics{
+		Label: label,
+		Set:   set,
+
+		DbSize:    gauge("db_size"),
+		TxLimit:   gauge("tx_limit"),
+		TxSpill:   gauge("tx_spill"),
+		TxUnspill: gauge("tx_unspill"),
+		TxDirty:   gauge("tx_dirty"),
+
+		DbPgopsNewly:   pgops("newly"),
+		DbPgopsCow:     pgops("cow"),
+		DbPgopsClone:   pgops("clone"),
+		DbPgopsSplit:   pgops("split"),
+		DbPgopsMerge:   pgops("merge"),
+		DbPgopsSpill:   pgops("spill"),
+		DbPgopsUnspill: pgops("unspill"),
+		DbPgopsWops:    pgops("wops"),
+
+		GcLeaf:     gauge("db_gc_leaf"),
+		GcOverflow: gauge("db_gc_overflow"),
+		GcPages:    gauge("db_gc_pages"),
+
+		Readers:          gauge("db_readers"),
+		ReadersOldestLag: gauge("db_readers_oldest_lag"),
+
+		tables: map[string][]string{},
+	}
+}
+
+// CommitMetrics - commit profile of db, created on first call
+func (m *DBMetrics) CommitMetrics() *DBCommitMetrics {
+	dbMetrics.mu.Lock()
+	defer dbMetrics.mu.Unlock()
+	if m.commit == nil {
+		m.commit = newDBCommitMetrics(m.Set, m.Label)
+	}
+	return m.commit
+}
+
+// DBCommitMetrics - commit profile of 1 db, all series have `label` of db. Durations of commit phases are observed
+// on each commit, GC profile is accumulated by MDBX since db open and is exported as is.
+type DBCommitMetrics struct {
+	Preparation, GCWallClock, GCCpuTime, Audit, Write, Sync, Ending, Total metrics.Summary
+
+	GcWorkRtime, GcWorkXtime, GcSelfRtime, GcSelfXtime metrics.Gauge // seconds
+
+	GcWorkRsteps, GcWorkRxpages, GcWorkMajflt, GcWorkCounter metrics.Gauge
+	GcSelfRsteps, GcSelfXpages, GcSelfMajflt, GcSelfCounter  metrics.Gauge
+	GcWloops, GcCoalescences, GcWipes, GcFlushes, GcKicks    metrics.Gauge
+}
+
+// SetTableStats - exports stats of tables of db. Series of tables which are not in stats anymore (dropped) are removed,
+// series of other dbs - even with same label - are not touched.
+func (m *DBMetrics) SetTableStats(stats []TableStat) {
+	dbMetrics.mu.Lock()
+	defer dbMetrics.mu.Unlock()
+	m.setTableStats(stats)
+}
+
+func (m *DBMetrics) setTableStats(stats []TableStat) {
+	seen := make(map[string]struct{}, len(stats))
+	for _, st := range stats {
+		seen[st.Name] = struct{}{}
+		names, ok := m.tables[st.Name]
+		if !ok {
+			names = []string{
+				fmt.Sprintf(`db_table_entries{table="%s",label="%s"}`, st.Name, m.Label),
+				fmt.Sprintf(`db_table_depth{table="%s",label="%s"}`, st.Name, m.Label),
+				fmt.Sprintf(`db_table_pages{type="branch",table="%s",label="%s"}`, st.Name, m.Label),
+				fmt.Sprintf(`db_table_pages{type="leaf",table="%s",label="%s"}`, st.Name, m.Label),
+				fmt.Sprintf(`db_table_pages{type="overflow",table="%s",label="%s"}`, st.Name, m.Label),
+				fmt.Sprintf(`db_table_size{table="%s",label="%s"}`, st.Name, m.Label),
+			}
+			m.tables[st.Name] = names
+		}
+		for i, v := range []uint64{st.Entries, st.Depth, st.BranchPages, st.LeafPages, st.OverflowPages, st.Size} {
+			metrics.GetOrCreateGaugeInSet(m.Set, names[i]).SetUint64(v)
+		}
+	}
+	for table, names := range m.tables {
+		if _, ok := seen[table]; ok {
+			continue
+		}
+		for _, name := range names {
+			m.Set.UnregisterMetric(name)
+		}
+		delete(m.tables, table)
+	}
+}
+
+func newDBCommitMetrics(set *metrics.Set, label Label) *DBCommitMetrics {
+	summary := func(phase string) metrics.Summary {
+		return metrics.GetOrCreateSummaryInSet(set, fmt.Sprintf(`db_commit_seconds{phase="%s",label="%s"}`, phase, label))
+	}
+	gcSeconds := func(phase string) metrics.Gauge {
+		return metrics.GetOrCreateGaugeInSet(set, fmt.Sprintf(`db_gc_seconds{phase="%s",label="%s"}`, phase, label))
+	}
+	gc := func(phase string) metrics.Gauge {
+		return metrics.GetOrCreateGaugeInSet(set, fmt.Sprintf(`db_gc{phase="%s",label="%s"}`, phase, label))
+	}
+	return &DBCommitMetrics{
+		Preparation: summary("preparation"),
+		GCWallClock: summary("gc_wall_clock"),
+		GCCpuTime:   summary("gc_cpu_time"),
+		Audit:       summary("audit"),
+		Write:       summary("write"),
+		Sync:        summary("sync"),
+		Ending:      summary("ending"),
+		Total:       summary("total"),
+
+		GcWorkRtime: gcSeconds("work_rtime"),
+		GcWorkXtime: gcSeconds("work_xtime"),
+		GcSelfRtime: gcSeconds("self_rtime"),
+		GcSelfXtime: gcSeconds("self_xtime"),
+
+		GcWorkRsteps:   gc("work_rsteps"),
+		GcWorkRxpages:  gc("work_rxpages"),
+		GcWorkMajflt:   gc("work_majflt"),
+		GcWorkCounter:  gc("work_counter"),
+		GcSelfRsteps:   gc("self_rsteps"),
+		GcSelfXpages:   gc("self_xpages"),
+		GcSelfMajflt:   gc("self_majflt"),
+		GcSelfCounter:  gc("self_counter"),
+		GcWloops:       gc("wloops"),
+		GcCoalescences: gc("coalescences"),
+		GcWipes:        gc("wipes"),
+		GcFlushes:      gc("flushes"),
+		GcKicks:        gc("kicks"),
+	}
+}
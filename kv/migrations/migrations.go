@@ -0,0 +1,232 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package migrations - versioned changes of db schema and data. Applied migrations are recorded in Table, every
+// migration is applied once, in order of registration.
+package migrations
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+// Table - applied migrations: migration_name -> applied_at_unix_seconds_u64
+const Table = "SchemaMigration"
+
+// TableCfg - must be merged into TableCfg of db
+var TableCfg = kv.TableCfg{Table: {}}
+
+// ErrUnknownMigration - db has applied migrations which are not registered in Migrator: it was migrated by newer
+// version of app, and current version may not understand its format
+var ErrUnknownMigration = errors.New("unknown migration is applied to db")
+
+type Migration struct {
+	Name string // unique, must not be changed after release
+	Up   func(tx kv.RwTx) error
+}
+
+// Migrator - ordered registry of migrations
+type Migrator struct {
+	migrations []Migration
+	logger     log.Logger
+
+	// DryRun - Apply runs all pending migrations in 1 transaction and rolls it back: to check that they succeed
+	DryRun bool
+	// AllowUnknown - don't fail with ErrUnknownMigration
+	AllowUnknown bool
+}
+
+func NewMigrator(logger log.Logger, migrations ...Migration) *Migrator {
+	return &Migrator{migrations: migrations, logger: logger}
+}
+
+// Register - adds migration to the end of registry
+func (m *Migrator) Register(migration Migration) *Migrator {
+	m.migrations = append(m.migrations, migration)
+	return m
+}
+
+func (m *Migrator) validate() error {
+	names := make(map[string]struct{}, len(m.migrations))
+	for i, migration := range m.migrations {
+		if migration.Name == "" {
+			return fmt.Errorf("migration %d: empty name", i)
+		}
+		if migration.Up == nil {
+			return fmt.Errorf("migration %s: Up is nil", migration.Name)
+		}
+		if _, ok := names[migration.Name]; ok {
+			return fmt.Errorf("migration %s: duplicated name", migration.Name)
+		}
+		names[migration.Name] = struct{}{}
+	}
+	return nil
+}
+
+// Applied - names of applied migrations with time of applying
+func Applied(ctx context.Context, db kv.RoDB) (applied map[string]time.Time, err error) {
+	if _, ok := db.AllTables()[Table]; !ok {
+		return nil, fmt.Errorf("table %s is not configured: merge migrations.TableCfg into TableCfg of db", Table)
+	}
+	err = db.View(ctx, func(tx kv.Tx) error {
+		applied, err = readApplied(tx)
+		return err
+	})
+	return applied, err
+}
+
+func readApplied(tx kv.Tx) (map[string]time.Time, error) {
+	applied := map[string]time.Time{}
+	tables, err := tx.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
+	// not created yet - nothing applied
+	if !slices.Contains(tables, Table) {
+		return applied, nil
+	}
+	if err := tx.ForEach(Table, nil, func(k, v []byte) error {
+		if len(v) != 8 {
+			return fmt.Errorf("migration %s: wrong format of record: %x", k, v)
+		}
+		applied[string(k)] = time.Unix(int64(binary.BigEndian.Uint64(v)), 0)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// Verify - returns ErrUnknownMigration if db has applied migrations which are not registered. Call it after opening
+// db - to refuse to work with db of unknown format.
+func (m *Migrator) Verify(ctx context.Context, db kv.RoDB) error {
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return err
+	}
+	return m.verify(applied)
+}
+
+func (m *Migrator) verify(applied map[string]time.Time) error {
+	if m.AllowUnknown {
+		return nil
+	}
+	known := make(map[string]struct{}, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Name] = struct{}{}
+	}
+	var unknown []string
+	for name := range applied {
+		if _, ok := known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: %v", ErrUnknownMigration, unknown)
+	}
+	return nil
+}
+
+// Pending - names of registered migrations which are not applied to db, in order of applying
+func (m *Migrator) Pending(ctx context.Context, db kv.RoDB) ([]string, error) {
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return m.pending(applied), nil
+}
+
+func (m *Migrator) pending(applied map[string]time.Time) (pending []string) {
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Name]; !ok {
+			pending = append(pending, migration.Name)
+		}
+	}
+	return pending
+}
+
+// Apply - applies pending migrations, each in own transaction together with its record in Table. Stops on first
+// failed migration: it's rolled back, previous migrations stay applied. Returns names of applied migrations.
+func (m *Migrator) Apply(ctx context.Context, db kv.RwDB) ([]string, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verify(applied); err != nil {
+		return nil, err
+	}
+	pending := m.pending(applied)
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	byName := make(map[string]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byName[migration.Name] = migration
+	}
+
+	if m.DryRun {
+		tx, err := db.BeginRw(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+		for _, name := range pending {
+			if err := m.apply(ctx, tx, byName[name]); err != nil {
+				return nil, err
+			}
+		}
+		m.logger.Info("[migrations] dry run succeeded, changes are rolled back", "migrations", pending)
+		return pending, nil
+	}
+
+	done := make([]string, 0, len(pending))
+	for _, name := range pending {
+		if err := db.Update(ctx, func(tx kv.RwTx) error { return m.apply(ctx, tx, byName[name]) }); err != nil {
+			return done, err
+		}
+		done = append(done, name)
+	}
+	return done, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, tx kv.RwTx, migration Migration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.logger.Info("[migrations] applying", "migration", migration.Name)
+	started := time.Now()
+	if err := migration.Up(tx); err != nil {
+		return fmt.Errorf("migration %s: %w", migration.Name, err)
+	}
+	if err := tx.Put(Table, []byte(migration.Name), binary.BigEndian.AppendUint64(nil, uint64(time.Now().Unix()))); err != nil {
+		return fmt.Errorf("migration %s: %w", migration.Name, err)
+	}
+	m.logger.Info("[migrations] applied", "migration", migration.Name, "took", time.Since(started))
+	return nil
+}
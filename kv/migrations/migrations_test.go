@@ -0,0 +1,173 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+func testDB(t *testing.T) kv.RwDB {
+	t.Helper()
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.MergeTableCfg(TableCfg, kv.TableCfg{"T": {}})).MustOpen()
+	t.Cleanup(db.Close)
+	return db
+}
+
+func put(k string) func(tx kv.RwTx) error {
+	return func(tx kv.RwTx) error { return tx.Put("T", []byte(k), []byte(k)) }
+}
+
+func has(t *testing.T, db kv.RoDB, k string) bool {
+	t.Helper()
+	var res bool
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) (err error) {
+		res, err = tx.Has("T", []byte(k))
+		return err
+	}))
+	return res
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	var order []string
+	m := NewMigrator(log.NewNoop(), Migration{Name: "a", Up: func(tx kv.RwTx) error {
+		order = append(order, "a")
+		return put("a")(tx)
+	}}).Register(Migration{Name: "b", Up: func(tx kv.RwTx) error {
+		order = append(order, "b")
+		return put("b")(tx)
+	}})
+
+	pending, err := m.Pending(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, pending)
+
+	done, err := m.Apply(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, done)
+	require.Equal(t, []string{"a", "b"}, order)
+	require.True(t, has(t, db, "a"))
+	require.True(t, has(t, db, "b"))
+
+	applied, err := Applied(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	require.False(t, applied["a"].IsZero())
+
+	// second run does nothing
+	done, err = m.Apply(ctx, db)
+	require.NoError(t, err)
+	require.Empty(t, done)
+	require.Equal(t, []string{"a", "b"}, order)
+
+	// new migration is applied after old ones
+	m.Register(Migration{Name: "c", Up: put("c")})
+	done, err = m.Apply(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, done)
+}
+
+func TestApplyFailure(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	failure := errors.New("failure")
+	m := NewMigrator(log.NewNoop(),
+		Migration{Name: "a", Up: put("a")},
+		Migration{Name: "b", Up: func(tx kv.RwTx) error {
+			if err := put("b")(tx); err != nil {
+				return err
+			}
+			return failure
+		}},
+		Migration{Name: "c", Up: put("c")},
+	)
+	done, err := m.Apply(ctx, db)
+	require.ErrorIs(t, err, failure)
+	require.Equal(t, []string{"a"}, done)
+	require.True(t, has(t, db, "a"))
+	require.False(t, has(t, db, "b")) // rolled back
+	require.False(t, has(t, db, "c"))
+
+	pending, err := m.Pending(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, pending)
+}
+
+func TestApplyDryRun(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	m := NewMigrator(log.NewNoop(), Migration{Name: "a", Up: put("a")}, Migration{Name: "b", Up: func(tx kv.RwTx) error {
+		// sees changes of previous migration
+		ok, err := tx.Has("T", []byte("a"))
+		require.NoError(t, err)
+		require.True(t, ok)
+		return put("b")(tx)
+	}})
+	m.DryRun = true
+	done, err := m.Apply(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, done)
+	require.False(t, has(t, db, "a"))
+
+	pending, err := m.Pending(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, pending)
+}
+
+func TestUnknownMigration(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	_, err := NewMigrator(log.NewNoop(), Migration{Name: "a", Up: put("a")}, Migration{Name: "new", Up: put("new")}).Apply(ctx, db)
+	require.NoError(t, err)
+
+	// older version of app doesn't know migration "new"
+	old := NewMigrator(log.NewNoop(), Migration{Name: "a", Up: put("a")})
+	require.ErrorIs(t, old.Verify(ctx, db), ErrUnknownMigration)
+	_, err = old.Apply(ctx, db)
+	require.ErrorIs(t, err, ErrUnknownMigration)
+
+	old.AllowUnknown = true
+	require.NoError(t, old.Verify(ctx, db))
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	_, err := NewMigrator(log.NewNoop(), Migration{Name: "a", Up: put("a")}, Migration{Name: "a", Up: put("a")}).Apply(ctx, db)
+	require.ErrorContains(t, err, "duplicated name")
+	_, err = NewMigrator(log.NewNoop(), Migration{Name: "a"}).Apply(ctx, db)
+	require.ErrorContains(t, err, "Up is nil")
+
+	notConfigured := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{"T": {}}).MustOpen()
+	defer notConfigured.Close()
+	_, err = NewMigrator(log.NewNoop(), Migration{Name: "a", Up: put("a")}).Apply(ctx, notConfigured)
+	require.ErrorContains(t, err, "not configured")
+}
@@ -16,6 +16,11 @@
 
 package kv
 
+import (
+	"bytes"
+	"encoding/binary"
+)
+
 type CmpFunc func(k1, k2, v1, v2 []byte) int
 
 type TableCfg map[string]TableCfgItem
@@ -26,13 +31,16 @@ type TableFlags uint
 
 const (
 	Default    TableFlags = 0x00
-	ReverseKey TableFlags = 0x02
+	ReverseKey TableFlags = 0x02 // keys are compared from the last byte to the first one
 	DupSort    TableFlags = 0x04
-	IntegerKey TableFlags = 0x08
-	IntegerDup TableFlags = 0x20
-	ReverseDup TableFlags = 0x40
+	IntegerKey TableFlags = 0x08 // keys are native-endian uint32 or uint64, all of the same size
+	IntegerDup TableFlags = 0x20 // values of DupSort table are native-endian uint32 or uint64, all of the same size
+	ReverseDup TableFlags = 0x40 // values of DupSort table are compared from the last byte to the first one
 )
 
+// AllTableFlags - all flags which can be used in TableCfgItem.Flags
+const AllTableFlags = ReverseKey | DupSort | IntegerKey | IntegerDup | ReverseDup
+
 const (
 	Sequence = "Sequence" // tbl_name -> seq_u64
 )
@@ -66,4 +74,75 @@ type TableCfgItem struct {
 	// Works only if AutoDupSortKeysConversion enabled
 	DupFromLen int
 	DupToLen   int
+	// KeyCmp - custom order of keys, called as KeyCmp(k1, k2, nil, nil). Has priority over IntegerKey and ReverseKey.
+	// Every process which opens the table must use the same comparator - db has no way to validate it.
+	KeyCmp CmpFunc
+	// DupCmp - custom order of values of DupSort table, called as DupCmp(nil, nil, v1, v2) - keys are not available
+	// for values comparator. Has priority over IntegerDup and ReverseDup.
+	DupCmp CmpFunc
+}
+
+// TableStat - size of table's b-tree
+type TableStat struct {
+	Name          string
+	Entries       uint64
+	Depth         uint64 // height of b-tree
+	BranchPages   uint64
+	LeafPages     uint64
+	OverflowPages uint64 // pages of values which don't fit into leaf page
+	Size          uint64 // bytes, all pages of table
+}
+
+// CompareKeys - compares 2 keys in the order in which the table stores them (see KeyCmp, IntegerKey and ReverseKey)
+func (cfg TableCfgItem) CompareKeys(a, b []byte) int {
+	if cfg.KeyCmp != nil {
+		return cfg.KeyCmp(a, b, nil, nil)
+	}
+	return compareByFlags(cfg.Flags&IntegerKey != 0, cfg.Flags&ReverseKey != 0, a, b)
+}
+
+// CompareDups - compares 2 values of the same key of DupSort table (see DupCmp, IntegerDup and ReverseDup)
+func (cfg TableCfgItem) CompareDups(a, b []byte) int {
+	if cfg.DupCmp != nil {
+		return cfg.DupCmp(nil, nil, a, b)
+	}
+	return compareByFlags(cfg.Flags&IntegerDup != 0, cfg.Flags&ReverseDup != 0, a, b)
+}
+
+func compareByFlags(integer, reverse bool, a, b []byte) int {
+	switch {
+	case integer && len(a) == len(b) && len(a) == 8:
+		return compareUint64(binary.NativeEndian.Uint64(a), binary.NativeEndian.Uint64(b))
+	case integer && len(a) == len(b) && len(a) == 4:
+		return compareUint64(uint64(binary.NativeEndian.Uint32(a)), uint64(binary.NativeEndian.Uint32(b)))
+	case reverse:
+		return compareReverse(a, b)
+	default:
+		return bytes.Compare(a, b)
+	}
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// compareReverse - lexicographic comparison which starts from the last byte. Shorter key is less if it's a suffix of longer one.
+func compareReverse(a, b []byte) int {
+	i, j := len(a)-1, len(b)-1
+	for ; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if a[i] != b[j] {
+			if a[i] < b[j] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return compareUint64(uint64(len(a)), uint64(len(b)))
 }
@@ -0,0 +1,208 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package typed
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/keys"
+)
+
+// ErrShortBuffer - encoded value is longer than bytes left to decode
+var ErrShortBuffer = errors.New("typed: short buffer")
+
+// Codec - order-preserving encoding of T: bytes.Compare of encoded values gives same order as values have.
+// Decode reads value from beginning of b and returns number of consumed bytes - it allows to decode concatenation of
+// encoded values, see Tuple2.
+type Codec[T any] interface {
+	Encode(buf []byte, v T) []byte // Encode - appends encoded v to buf
+	Decode(b []byte) (v T, n int, err error)
+}
+
+// Encode - encoded v in new slice. Encoded first elements of tuple are prefix of encoded tuple, see Table.Prefix
+func Encode[T any](c Codec[T], v T) []byte { return c.Encode(nil, v) }
+
+// Decode - decodes b which must contain exactly 1 encoded value
+func Decode[T any](c Codec[T], b []byte) (T, error) {
+	v, n, err := c.Decode(b)
+	if err != nil {
+		return v, err
+	}
+	if n != len(b) {
+		return v, fmt.Errorf("typed: %d bytes left after decoding", len(b)-n)
+	}
+	return v, nil
+}
+
+var (
+	Uint64    Codec[uint64]     = uint64Codec{} // Uint64 - big-endian, 8 bytes
+	Int64     Codec[int64]      = int64Codec{}  // Int64 - big-endian with flipped sign bit, 8 bytes
+	String    Codec[string]     = stringCodec{} // String - keys.AppendEscaped: 0x00 escaped, terminated by 0x00. Can be part of Tuple2
+	RawString Codec[string]     = rawString{}   // RawString - bytes of string as is. Consumes all bytes: only last in tuple
+	KeysTuple Codec[keys.Tuple] = keysTuple{}   // KeysTuple - keys.Tuple.Pack. Consumes all bytes: only last in tuple
+)
+
+type uint64Codec struct{}
+
+func (uint64Codec) Encode(buf []byte, v uint64) []byte { return binary.BigEndian.AppendUint64(buf, v) }
+func (uint64Codec) Decode(b []byte) (uint64, int, error) {
+	if len(b) < 8 {
+		return 0, 0, fmt.Errorf("uint64: %w", ErrShortBuffer)
+	}
+	return binary.BigEndian.Uint64(b), 8, nil
+}
+
+type int64Codec struct{}
+
+func (int64Codec) Encode(buf []byte, v int64) []byte {
+	return binary.BigEndian.AppendUint64(buf, uint64(v)^(1<<63))
+}
+func (int64Codec) Decode(b []byte) (int64, int, error) {
+	if len(b) < 8 {
+		return 0, 0, fmt.Errorf("int64: %w", ErrShortBuffer)
+	}
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63)), 8, nil
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(buf []byte, v string) []byte { return keys.AppendEscaped(buf, []byte(v)) }
+func (stringCodec) Decode(b []byte) (string, int, error) {
+	res, n, err := keys.Unescape(b)
+	if err != nil {
+		return "", 0, fmt.Errorf("string: no terminator, %w", ErrShortBuffer)
+	}
+	return string(res), n, nil
+}
+
+type rawString struct{}
+
+func (rawString) Encode(buf []byte, v string) []byte   { return append(buf, v...) }
+func (rawString) Decode(b []byte) (string, int, error) { return string(b), len(b), nil }
+
+type keysTuple struct{}
+
+// Encode - panics on element of unsupported type, as keys.Tuple.Pack
+func (keysTuple) Encode(buf []byte, v keys.Tuple) []byte {
+	buf, err := v.AppendPacked(buf)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+func (keysTuple) Decode(b []byte) (keys.Tuple, int, error) {
+	t, err := keys.Unpack(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	return t, len(b), nil
+}
+
+// FixedBytes - byte arrays of common sizes: hashes, addresses, etc.
+type FixedBytes interface {
+	~[4]byte | ~[8]byte | ~[16]byte | ~[20]byte | ~[32]byte | ~[48]byte | ~[64]byte
+}
+
+// Fixed - bytes of array as is
+func Fixed[T FixedBytes]() Codec[T] { return fixedCodec[T]{} }
+
+type fixedCodec[T FixedBytes] struct{}
+
+func (fixedCodec[T]) Encode(buf []byte, v T) []byte {
+	for i := 0; i < len(v); i++ {
+		buf = append(buf, v[i])
+	}
+	return buf
+}
+func (fixedCodec[T]) Decode(b []byte) (v T, n int, err error) {
+	if len(b) < len(v) {
+		return v, 0, fmt.Errorf("[%d]byte: %w", len(v), ErrShortBuffer)
+	}
+	for i := 0; i < len(v); i++ {
+		v[i] = b[i]
+	}
+	return v, len(v), nil
+}
+
+type Tuple2[A, B any] struct {
+	A A
+	B B
+}
+
+type Tuple3[A, B, C any] struct {
+	A A
+	B B
+	C C
+}
+
+// Tuple2Codec - concatenation of encoded elements, ordered by A, then by B. Elements of types known at compile time are
+// encoded without type codes of keys.Tuple, see KeysTuple for other tuples.
+func Tuple2Codec[A, B any](a Codec[A], b Codec[B]) Codec[Tuple2[A, B]] {
+	return tuple2Codec[A, B]{a: a, b: b}
+}
+
+// Tuple3Codec - concatenation of encoded elements, ordered by A, then by B, then by C
+func Tuple3Codec[A, B, C any](a Codec[A], b Codec[B], c Codec[C]) Codec[Tuple3[A, B, C]] {
+	return tuple3Codec[A, B, C]{a: a, b: b, c: c}
+}
+
+type tuple2Codec[A, B any] struct {
+	a Codec[A]
+	b Codec[B]
+}
+
+func (c tuple2Codec[A, B]) Encode(buf []byte, v Tuple2[A, B]) []byte {
+	return c.b.Encode(c.a.Encode(buf, v.A), v.B)
+}
+func (c tuple2Codec[A, B]) Decode(b []byte) (v Tuple2[A, B], n int, err error) {
+	var read int
+	if v.A, read, err = c.a.Decode(b); err != nil {
+		return v, 0, err
+	}
+	n += read
+	if v.B, read, err = c.b.Decode(b[n:]); err != nil {
+		return v, 0, err
+	}
+	return v, n + read, nil
+}
+
+type tuple3Codec[A, B, C any] struct {
+	a Codec[A]
+	b Codec[B]
+	c Codec[C]
+}
+
+func (c tuple3Codec[A, B, C]) Encode(buf []byte, v Tuple3[A, B, C]) []byte {
+	return c.c.Encode(c.b.Encode(c.a.Encode(buf, v.A), v.B), v.C)
+}
+func (c tuple3Codec[A, B, C]) Decode(b []byte) (v Tuple3[A, B, C], n int, err error) {
+	var read int
+	if v.A, read, err = c.a.Decode(b); err != nil {
+		return v, 0, err
+	}
+	n += read
+	if v.B, read, err = c.b.Decode(b[n:]); err != nil {
+		return v, 0, err
+	}
+	n += read
+	if v.C, read, err = c.c.Decode(b[n:]); err != nil {
+		return v, 0, err
+	}
+	return v, n + read, nil
+}
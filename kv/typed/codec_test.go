@@ -0,0 +1,71 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package typed
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/keys"
+)
+
+// checkOrder - encoding of sorted values is sorted, and decoding gives same values
+func checkOrder[T any](t *testing.T, c Codec[T], sorted []T) {
+	t.Helper()
+	encoded := make([][]byte, len(sorted))
+	for i, v := range sorted {
+		encoded[i] = Encode(c, v)
+		decoded, err := Decode(c, encoded[i])
+		require.NoError(t, err)
+		require.Equal(t, v, decoded)
+	}
+	require.True(t, sort.SliceIsSorted(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 }))
+	for i := 1; i < len(encoded); i++ {
+		require.NotEqual(t, encoded[i-1], encoded[i])
+	}
+}
+
+func TestCodecOrder(t *testing.T) {
+	checkOrder(t, Uint64, []uint64{0, 1, 255, 256, math.MaxUint32, math.MaxUint64})
+	checkOrder(t, Int64, []int64{math.MinInt64, -256, -1, 0, 1, 256, math.MaxInt64})
+	checkOrder(t, String, []string{"", "\x00", "\x00\x00", "\x00\xff", "\x01", "a", "a\x00", "a\x00b", "ab", "b"})
+	checkOrder(t, RawString, []string{"", "\x00", "a", "ab", "b"})
+
+	type addr [20]byte
+	checkOrder(t, Fixed[addr](), []addr{{}, {0, 1}, {1}, {0xff, 0xff}})
+
+	checkOrder(t, Tuple2Codec(String, Uint64), []Tuple2[string, uint64]{{"", 5}, {"a", 0}, {"a", 1}, {"a\x00", 0}, {"ab", 0}})
+	checkOrder(t, Tuple2Codec(Uint64, KeysTuple), []Tuple2[uint64, keys.Tuple]{{1, keys.Tuple{}}, {1, keys.Tuple{[]byte("a")}}, {1, keys.Tuple{"a", int64(-1)}}, {1, keys.Tuple{"a", int64(2)}}, {2, keys.Tuple{nil}}})
+	checkOrder(t, Tuple3Codec(Uint64, Int64, RawString), []Tuple3[uint64, int64, string]{{1, -1, "b"}, {1, 0, ""}, {1, 0, "a"}, {2, math.MinInt64, ""}})
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(Uint64, []byte{1, 2, 3})
+	require.ErrorIs(t, err, ErrShortBuffer)
+	_, err = Decode(String, []byte("abc"))
+	require.ErrorIs(t, err, ErrShortBuffer)
+	_, err = Decode(Uint64, make([]byte, 9))
+	require.ErrorContains(t, err, "1 bytes left")
+	_, err = Decode(Tuple2Codec(Uint64, Fixed[[4]byte]()), make([]byte, 10))
+	require.ErrorIs(t, err, ErrShortBuffer)
+	_, err = Decode(KeysTuple, []byte{0x30})
+	require.ErrorIs(t, err, keys.ErrMalformed)
+}
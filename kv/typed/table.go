@@ -0,0 +1,184 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package typed
+
+import (
+	"fmt"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
+)
+
+// Table - typed view of table: keys and values are encoded by codecs. Table doesn't own data, it's a cheap value
+// which can be declared next to kv.TableCfg.
+type Table[K, V any] struct {
+	Name  string
+	Key   Codec[K]
+	Value Codec[V]
+}
+
+func NewTable[K, V any](name string, key Codec[K], value Codec[V]) Table[K, V] {
+	return Table[K, V]{Name: name, Key: key, Value: value}
+}
+
+// Get - ok is false if key is not found. For DupSort table returns first value of key.
+func (t Table[K, V]) Get(tx kv.Getter, k K) (v V, ok bool, err error) {
+	b, err := tx.GetOne(t.Name, t.Key.Encode(nil, k))
+	if err != nil || b == nil {
+		return v, false, err
+	}
+	if v, err = Decode(t.Value, b); err != nil {
+		return v, false, fmt.Errorf("table: %s, value: %w", t.Name, err)
+	}
+	return v, true, nil
+}
+
+func (t Table[K, V]) Has(tx kv.Getter, k K) (bool, error) {
+	return tx.Has(t.Name, t.Key.Encode(nil, k))
+}
+
+// Put - for DupSort table adds v to values of k
+func (t Table[K, V]) Put(tx kv.Putter, k K, v V) error {
+	return tx.Put(t.Name, t.Key.Encode(nil, k), t.Value.Encode(nil, v))
+}
+
+// Delete - for DupSort table deletes all values of k
+func (t Table[K, V]) Delete(tx kv.Deleter, k K) error {
+	return tx.Delete(t.Name, t.Key.Encode(nil, k))
+}
+
+// Range - [from, to) in ascending order. from=nil means StartOfTable, to=nil means EndOfTable
+func (t Table[K, V]) Range(tx kv.Tx, from, to *K) (iter.Dual[K, V], error) {
+	it, err := tx.Range(t.Name, t.encodeKey(from), t.encodeKey(to))
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(it), nil
+}
+
+// RangeDescend - [from, to) in descending order, expects from > to. limit=-1 means Unlimited
+func (t Table[K, V]) RangeDescend(tx kv.Tx, from, to *K, limit int) (iter.Dual[K, V], error) {
+	it, err := tx.RangeDescend(t.Name, t.encodeKey(from), t.encodeKey(to), limit)
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(it), nil
+}
+
+// Prefix - keys which start with prefix, for example encoded first element of tuple: Encode(Uint64, blockNum)
+func (t Table[K, V]) Prefix(tx kv.Tx, prefix []byte) (iter.Dual[K, V], error) {
+	it, err := tx.Prefix(t.Name, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(it), nil
+}
+
+func (t Table[K, V]) encodeKey(k *K) []byte {
+	if k == nil {
+		return nil
+	}
+	return t.Key.Encode(nil, *k)
+}
+
+func (t Table[K, V]) decode(it iter.KV) *decodeIter[K, V] {
+	return &decodeIter[K, V]{it: it, table: t.Name, k: t.Key, v: t.Value}
+}
+
+// DupTable - typed view of DupSort table: key has sorted set of values
+type DupTable[K, V any] struct {
+	Table[K, V]
+}
+
+func NewDupTable[K, V any](name string, key Codec[K], value Codec[V]) DupTable[K, V] {
+	return DupTable[K, V]{Table: NewTable(name, key, value)}
+}
+
+// Values - values of k in order of table
+func (t DupTable[K, V]) Values(tx kv.Tx, k K) (iter.Dual[K, V], error) {
+	return t.ValuesRange(tx, k, nil, nil, order.Asc, -1)
+}
+
+// ValuesRange - values of k in [from, to). from=nil means first value, to=nil means last value, limit=-1 means
+// Unlimited. For order.Desc expects from > to.
+func (t DupTable[K, V]) ValuesRange(tx kv.Tx, k K, from, to *V, asc order.By, limit int) (iter.Dual[K, V], error) {
+	it, err := tx.RangeDupSort(t.Name, t.Key.Encode(nil, k), t.encodeValue(from), t.encodeValue(to), asc, limit)
+	if err != nil {
+		return nil, err
+	}
+	return t.decode(it), nil
+}
+
+// HasValue - k has value v
+func (t DupTable[K, V]) HasValue(tx kv.Tx, k K, v V) (bool, error) {
+	c, err := tx.CursorDupSort(t.Name)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	found, _, err := c.SeekBothExact(t.Key.Encode(nil, k), t.Value.Encode(nil, v))
+	if err != nil {
+		return false, err
+	}
+	return found != nil, nil
+}
+
+// DeleteValue - deletes v from values of k. Does nothing if k has no such value.
+func (t DupTable[K, V]) DeleteValue(tx kv.RwTx, k K, v V) error {
+	c, err := tx.RwCursorDupSort(t.Name)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.DeleteExact(t.Key.Encode(nil, k), t.Value.Encode(nil, v))
+}
+
+func (t DupTable[K, V]) encodeValue(v *V) []byte {
+	if v == nil {
+		return nil
+	}
+	return t.Value.Encode(nil, *v)
+}
+
+// decodeIter - decodes entries of iter.KV. Decoded keys and values don't reference memory of db.
+type decodeIter[K, V any] struct {
+	it    iter.KV
+	table string
+	k     Codec[K]
+	v     Codec[V]
+}
+
+func (it *decodeIter[K, V]) HasNext() bool { return it.it.HasNext() }
+func (it *decodeIter[K, V]) Next() (k K, v V, err error) {
+	kb, vb, err := it.it.Next()
+	if err != nil {
+		return k, v, err
+	}
+	if k, err = Decode(it.k, kb); err != nil {
+		return k, v, fmt.Errorf("table: %s, key %x: %w", it.table, kb, err)
+	}
+	if v, err = Decode(it.v, vb); err != nil {
+		return k, v, fmt.Errorf("table: %s, key %x, value: %w", it.table, kb, err)
+	}
+	return k, v, nil
+}
+func (it *decodeIter[K, V]) Close() {
+	if c, ok := it.it.(kv.Closer); ok {
+		c.Close()
+	}
+}
@@ -0,0 +1,131 @@
+/*
+   Copyright 2024 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package typed_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uncommoncorrelation/go-mdbx-db/kv"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/iter"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/mdbx"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/order"
+	"github.com/uncommoncorrelation/go-mdbx-db/kv/typed"
+	"github.com/uncommoncorrelation/go-mdbx-db/log"
+)
+
+var (
+	balances = typed.NewTable("Balance", typed.Tuple2Codec(typed.String, typed.Uint64), typed.Int64)
+	tags     = typed.NewDupTable("Tag", typed.Uint64, typed.String)
+)
+
+type balanceKey = typed.Tuple2[string, uint64]
+
+func TestTable(t *testing.T) {
+	ctx := context.Background()
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{balances.Name: {}, tags.Name: {Flags: kv.DupSort}}).MustOpen()
+	defer db.Close()
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i, k := range []balanceKey{{"bob", 2}, {"alice", 10}, {"bob", 1}, {"alice", 2}, {"carol", 1}} {
+			if err := balances.Put(tx, k, int64(i)-2); err != nil {
+				return err
+			}
+		}
+		return balances.Delete(tx, balanceKey{"carol", 1})
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		v, ok, err := balances.Get(tx, balanceKey{"alice", 10})
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, int64(-1), v)
+		_, ok, err = balances.Get(tx, balanceKey{"carol", 1})
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		it, err := balances.Range(tx, nil, nil)
+		require.NoError(t, err)
+		keys, values, err := iter.ToDualArray(it)
+		require.NoError(t, err)
+		require.Equal(t, []balanceKey{{"alice", 2}, {"alice", 10}, {"bob", 1}, {"bob", 2}}, keys)
+		require.Equal(t, []int64{1, -1, 0, -2}, values)
+
+		from, to := balanceKey{"bob", 2}, balanceKey{"alice", 2}
+		it, err = balances.RangeDescend(tx, &from, &to, -1)
+		require.NoError(t, err)
+		keys, _, err = iter.ToDualArray(it)
+		require.NoError(t, err)
+		require.Equal(t, []balanceKey{{"bob", 2}, {"bob", 1}, {"alice", 10}}, keys)
+
+		it, err = balances.Prefix(tx, typed.Encode(typed.String, "alice"))
+		require.NoError(t, err)
+		keys, _, err = iter.ToDualArray(it)
+		require.NoError(t, err)
+		require.Equal(t, []balanceKey{{"alice", 2}, {"alice", 10}}, keys)
+		return nil
+	}))
+}
+
+func TestDupTable(t *testing.T) {
+	ctx := context.Background()
+	db := mdbx.NewMDBX(log.NewNoop()).InMem(t.TempDir()).WithTableCfg(kv.TableCfg{tags.Name: {Flags: kv.DupSort}}).MustOpen()
+	defer db.Close()
+
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for _, v := range []string{"c", "a", "d", "b"} {
+			if err := tags.Put(tx, 1, v); err != nil {
+				return err
+			}
+		}
+		if err := tags.Put(tx, 2, "x"); err != nil {
+			return err
+		}
+		return tags.DeleteValue(tx, 1, "d")
+	}))
+
+	require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+		it, err := tags.Values(tx, 1)
+		require.NoError(t, err)
+		_, values, err := iter.ToDualArray(it)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c"}, values)
+
+		from, to := "c", "a"
+		it, err = tags.ValuesRange(tx, 1, &from, &to, order.Desc, -1)
+		require.NoError(t, err)
+		_, values, err = iter.ToDualArray(it)
+		require.NoError(t, err)
+		require.Equal(t, []string{"c", "b"}, values)
+
+		ok, err := tags.HasValue(tx, 1, "b")
+		require.NoError(t, err)
+		require.True(t, ok)
+		ok, err = tags.HasValue(tx, 1, "d")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		it, err = tags.Range(tx, nil, nil)
+		require.NoError(t, err)
+		n, err := iter.CountDual(it)
+		require.NoError(t, err)
+		require.Equal(t, 4, n)
+		return nil
+	}))
+}
@@ -171,3 +171,25 @@ func GetOrCreateHistogram(name string) Histogram {
 
 	return &histogram{h}
 }
+
+// GetOrCreateGaugeInSet is the same as GetOrCreateGauge, but the gauge is registered in s
+// instead of the global set.
+func GetOrCreateGaugeInSet(s *Set, name string) Gauge {
+	g, err := s.GetOrCreateGauge(name)
+	if err != nil {
+		panic(fmt.Errorf("could not get or create new gauge: %w", err))
+	}
+
+	return &gauge{g}
+}
+
+// GetOrCreateSummaryInSet is the same as GetOrCreateSummary, but the summary is registered in s
+// instead of the global set.
+func GetOrCreateSummaryInSet(s *Set, name string) Summary {
+	sm, err := s.GetOrCreateSummary(name)
+	if err != nil {
+		panic(fmt.Errorf("could not get or create new summary: %w", err))
+	}
+
+	return &summary{sm}
+}
@@ -29,6 +29,47 @@ type Set struct {
 
 var defaultSet = NewSet()
 
+// registeredSets - sets passed to RegisterSet, exported together with default set
+var registeredSets = &setsCollector{sets: map[*Set]struct{}{}}
+
+type setsCollector struct {
+	mu   sync.Mutex
+	sets map[*Set]struct{}
+}
+
+// Describe sends nothing - collector is unchecked, because sets are registered and unregistered at runtime.
+func (c *setsCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *setsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	sets := make([]*Set, 0, len(c.sets))
+	for s := range c.sets {
+		sets = append(sets, s)
+	}
+	c.mu.Unlock()
+	for _, s := range sets {
+		s.Collect(ch)
+	}
+}
+
+// RegisterSet registers the given set s for metrics export.
+//
+// Metrics of s are exported together with global metrics. Use UnregisterSet to stop export.
+func RegisterSet(s *Set) {
+	registeredSets.mu.Lock()
+	defer registeredSets.mu.Unlock()
+	registeredSets.sets[s] = struct{}{}
+}
+
+// UnregisterSet stops exporting metrics from the given s.
+//
+// Metrics stay registered in s - call s.UnregisterAllMetrics if s is not going to be used anymore.
+func UnregisterSet(s *Set) {
+	registeredSets.mu.Lock()
+	defer registeredSets.mu.Unlock()
+	delete(registeredSets.sets, s)
+}
+
 // NewSet creates new set of metrics.
 //
 // Pass the set to RegisterSet() function in order to export its metrics via global WritePrometheus() call.
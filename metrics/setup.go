@@ -15,7 +15,7 @@ var EnabledExpensive = false
 // Setup starts a dedicated metrics server at the given address.
 // This function enables metrics reporting separate from pprof.
 func Setup(address string, logger log.Logger) *http.ServeMux {
-	prometheus.DefaultRegisterer.MustRegister(defaultSet)
+	prometheus.DefaultRegisterer.MustRegister(defaultSet, registeredSets)
 
 	prometheusMux := http.NewServeMux()
 	prometheusMux.Handle("/debug/metrics/prometheus", promhttp.Handler())